@@ -0,0 +1,100 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Purposes of action tokens sent by email
+const (
+	PurposeVerifyEmail   = "verify_email"
+	PurposeResetPassword = "reset_password"
+	PurposeMFAChallenge  = "mfa_challenge"
+)
+
+// ActionClaims are the claims of a single-purpose token sent by email.
+// Fingerprint binds the token to account state, so a verification token
+// dies when the email changes and a reset token dies once it is used.
+type ActionClaims struct {
+	UserID      int    `json:"user_id"`
+	Purpose     string `json:"purpose"`
+	Fingerprint string `json:"fp"`
+	jwt.RegisteredClaims
+}
+
+// Fingerprint hashes account state for ActionClaims
+func Fingerprint(state string) string {
+	sum := sha256.Sum256([]byte(state))
+	return hex.EncodeToString(sum[:8])
+}
+
+// GenerateActionToken signs a token for purpose valid for ttl
+func GenerateActionToken(userID int, purpose, fingerprint string, ttl time.Duration) (string, error) {
+	claims := &ActionClaims{
+		UserID:      userID,
+		Purpose:     purpose,
+		Fingerprint: fingerprint,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString(jwtSecret)
+}
+
+// ValidateActionToken validates a token issued for purpose
+func ValidateActionToken(tokenString, purpose string) (*ActionClaims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &ActionClaims{}, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, ErrInvalidToken
+		}
+		return jwtSecret, nil
+	})
+
+	if err != nil {
+		if errors.Is(err, jwt.ErrTokenExpired) {
+			return nil, ErrExpiredToken
+		}
+		return nil, ErrInvalidToken
+	}
+
+	claims, ok := token.Claims.(*ActionClaims)
+	if !ok || !token.Valid || claims.Purpose != purpose || claims.UserID == 0 {
+		return nil, ErrInvalidToken
+	}
+
+	return claims, nil
+}
+
+// Lifetimes of action tokens
+const (
+	VerifyEmailTTL   = 24 * time.Hour
+	ResetPasswordTTL = 1 * time.Hour
+)
+
+// GenerateVerifyEmailToken signs an email verification token bound to email
+func GenerateVerifyEmailToken(userID int, email string) (string, error) {
+	return GenerateActionToken(userID, PurposeVerifyEmail, Fingerprint(email), VerifyEmailTTL)
+}
+
+// GeneratePasswordResetToken signs a reset token bound to the current
+// password hash, so it stops working once the password changes
+func GeneratePasswordResetToken(userID int, passwordHash string) (string, error) {
+	return GenerateActionToken(userID, PurposeResetPassword, Fingerprint(passwordHash), ResetPasswordTTL)
+}
+
+// MFAChallengeTTL is how long a user has to enter a second factor after
+// the first one succeeded
+const MFAChallengeTTL = 5 * time.Minute
+
+// GenerateMFAChallengeToken signs a token proving the first login factor
+// passed, bound to the password hash like a reset token
+func GenerateMFAChallengeToken(userID int, passwordHash string) (string, error) {
+	return GenerateActionToken(userID, PurposeMFAChallenge, Fingerprint(passwordHash), MFAChallengeTTL)
+}
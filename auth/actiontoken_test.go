@@ -0,0 +1,44 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+func TestValidateActionToken(t *testing.T) {
+	fp := Fingerprint("user@example.com")
+	valid, _ := GenerateActionToken(1, PurposeVerifyEmail, fp, time.Hour)
+	expired, _ := GenerateActionToken(1, PurposeVerifyEmail, fp, -time.Minute)
+	access, _ := GenerateToken(1, "user@example.com", "user", "sid", false)
+
+	tests := []struct {
+		name    string
+		token   string
+		purpose string
+		wantErr error
+	}{
+		{"valid", valid, PurposeVerifyEmail, nil},
+		{"wrong purpose", valid, PurposeResetPassword, ErrInvalidToken},
+		{"expired", expired, PurposeVerifyEmail, ErrExpiredToken},
+		{"access token", access, PurposeVerifyEmail, ErrInvalidToken},
+		{"garbage", "not-a-token", PurposeVerifyEmail, ErrInvalidToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := ValidateActionToken(tt.token, tt.purpose)
+			if err != tt.wantErr {
+				t.Fatalf("ValidateActionToken() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && (claims.UserID != 1 || claims.Fingerprint != fp) {
+				t.Errorf("ValidateActionToken() claims = %+v", claims)
+			}
+		})
+	}
+}
+
+func TestValidateToken_rejectsActionToken(t *testing.T) {
+	token, _ := GenerateActionToken(1, PurposeResetPassword, Fingerprint("hash"), time.Hour)
+	if _, err := ValidateToken(token); err != ErrInvalidToken {
+		t.Errorf("ValidateToken() error = %v, want %v", err, ErrInvalidToken)
+	}
+}
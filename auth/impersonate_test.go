@@ -0,0 +1,74 @@
+package auth
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/Ptt-Alertor/ptt-alertor/models/apitoken"
+)
+
+func TestGenerateImpersonationToken(t *testing.T) {
+	admin := &Claims{UserID: 1, Email: "admin@example.com", Role: "admin", SessionID: "sid"}
+	token, err := GenerateImpersonationToken(admin, 2, "user@example.com", "user", DefaultImpersonationScopes)
+	if err != nil {
+		t.Fatalf("GenerateImpersonationToken() error = %v", err)
+	}
+
+	claims, err := ValidateToken(token)
+	if err != nil {
+		t.Fatalf("ValidateToken() error = %v", err)
+	}
+	if !claims.Impersonated() || claims.ImpersonatorID != 1 || claims.ImpersonatorEmail != "admin@example.com" {
+		t.Errorf("impersonator = %v %q, want 1 admin@example.com", claims.ImpersonatorID, claims.ImpersonatorEmail)
+	}
+	if claims.UserID != 2 || claims.Role != "user" || claims.SessionID != "sid" {
+		t.Errorf("claims = %+v, want user 2 in session sid", claims)
+	}
+	if !reflect.DeepEqual(claims.Scopes, DefaultImpersonationScopes) {
+		t.Errorf("scopes = %v, want %v", claims.Scopes, DefaultImpersonationScopes)
+	}
+
+	access, _ := GenerateToken(1, "admin@example.com", "admin", "sid", true)
+	claims, _ = ValidateToken(access)
+	if claims.Impersonated() || len(claims.Scopes) != 0 {
+		t.Errorf("session token claims = %+v, want no impersonation", claims)
+	}
+}
+
+func TestValidateImpersonationScopes(t *testing.T) {
+	tests := []struct {
+		name    string
+		scopes  []string
+		wantErr error
+	}{
+		{"read", DefaultImpersonationScopes, nil},
+		{"write", []string{apitoken.ScopeSubscriptionsWrite}, nil},
+		{"admin", []string{apitoken.ScopeSubscriptionsRead, apitoken.ScopeAdmin}, apitoken.ErrInvalidScope},
+		{"unknown", []string{"tokens:write"}, apitoken.ErrInvalidScope},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateImpersonationScopes(tt.scopes); err != tt.wantErr {
+				t.Errorf("ValidateImpersonationScopes() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCanAdminister_TokenWithoutAdminScope(t *testing.T) {
+	tests := []struct {
+		name   string
+		claims *Claims
+	}{
+		{"personal access token", &Claims{UserID: 1, Role: "admin", TokenID: 3, Scopes: []string{apitoken.ScopeSubscriptionsWrite}}},
+		{"impersonation", &Claims{UserID: 2, Role: "admin", ImpersonatorID: 1, Scopes: DefaultImpersonationScopes}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			granted, err := CanAdminister(tt.claims, "admin_users")
+			if err != nil || granted {
+				t.Errorf("CanAdminister() = %v, %v, want false", granted, err)
+			}
+		})
+	}
+}
@@ -12,11 +12,12 @@ import (
 
 var (
 	jwtSecret     = []byte(os.Getenv("JWT_SECRET"))
-	jwtExpiration = 24 * time.Hour
+	jwtExpiration = 15 * time.Minute
 
 	ErrInvalidToken = errors.New("invalid token")
 	ErrExpiredToken = errors.New("token expired")
 	ErrMissingToken = errors.New("missing token")
+	ErrRevokedToken = errors.New("token revoked")
 )
 
 // Claims represents JWT claims
@@ -24,15 +25,33 @@ type Claims struct {
 	UserID int    `json:"user_id"`
 	Email  string `json:"email"`
 	Role   string `json:"role"`
+	// SessionID ties the token to a login session so it can be revoked
+	SessionID string `json:"sid"`
+	// MFA is set when the session passed two-factor authentication
+	MFA bool `json:"mfa,omitempty"`
+	// TokenID and Scopes are set instead of SessionID when the request
+	// carries a personal access token. Impersonation tokens carry Scopes too.
+	TokenID int      `json:"-"`
+	Scopes  []string `json:"scp,omitempty"`
+	// ImpersonatorID and ImpersonatorEmail are the admin acting as the user
+	ImpersonatorID    int    `json:"imp,omitempty"`
+	ImpersonatorEmail string `json:"imp_email,omitempty"`
 	jwt.RegisteredClaims
 }
 
-// GenerateToken generates a JWT token for a user
-func GenerateToken(userID int, email, role string) (string, error) {
+// AccessTokenTTL is how long an access token is valid
+func AccessTokenTTL() time.Duration {
+	return jwtExpiration
+}
+
+// GenerateToken generates a short-lived JWT token for a user's session
+func GenerateToken(userID int, email, role, sessionID string, mfa bool) (string, error) {
 	claims := &Claims{
-		UserID: userID,
-		Email:  email,
-		Role:   role,
+		UserID:    userID,
+		Email:     email,
+		Role:      role,
+		SessionID: sessionID,
+		MFA:       mfa,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(jwtExpiration)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
@@ -60,7 +79,7 @@ func ValidateToken(tokenString string) (*Claims, error) {
 	}
 
 	claims, ok := token.Claims.(*Claims)
-	if !ok || !token.Valid {
+	if !ok || !token.Valid || claims.SessionID == "" {
 		return nil, ErrInvalidToken
 	}
 
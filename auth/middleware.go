@@ -3,11 +3,28 @@ package auth
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 
+	log "github.com/Ptt-Alertor/logrus"
+	"github.com/Ptt-Alertor/ptt-alertor/models/account"
+	"github.com/Ptt-Alertor/ptt-alertor/models/apitoken"
+	"github.com/Ptt-Alertor/ptt-alertor/models/audit"
+	"github.com/Ptt-Alertor/ptt-alertor/models/session"
+
 	"github.com/julienschmidt/httprouter"
 )
 
+var (
+	ErrInsufficientScope = errors.New("insufficient scope")
+	ErrMFARequired       = errors.New("two-factor authentication required")
+
+	apiTokenRepo  = &apitoken.Postgres{}
+	accountRepo   = &account.Postgres{}
+	roleLimitRepo = &account.RoleLimitPostgres{}
+	auditRepo     = &audit.Postgres{}
+)
+
 type contextKey string
 
 const (
@@ -26,7 +43,8 @@ func writeJSON(w http.ResponseWriter, status int, data interface{}) {
 	json.NewEncoder(w).Encode(data)
 }
 
-// JWTAuth middleware validates JWT token
+// JWTAuth middleware validates JWT token and applies the API quota of the
+// user's role. Impersonation tokens can only read through it.
 func JWTAuth(next httprouter.Handle) httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 		tokenString, err := ExtractTokenFromHeader(r)
@@ -35,39 +53,212 @@ func JWTAuth(next httprouter.Handle) httprouter.Handle {
 			return
 		}
 
-		claims, err := ValidateToken(tokenString)
+		claims, err := authenticateJWT(tokenString)
 		if err != nil {
 			writeJSON(w, http.StatusUnauthorized, ErrorResponse{Error: err.Error()})
 			return
 		}
 
+		if claims.Impersonated() {
+			if !isReadOnly(r) {
+				writeJSON(w, http.StatusForbidden, ErrorResponse{Error: ErrImpersonationReadOnly.Error()})
+				return
+			}
+			traceImpersonation(r, claims)
+		}
+
+		if !allowQuota(w, claims) {
+			return
+		}
+
 		// Add claims to context
 		ctx := context.WithValue(r.Context(), UserContextKey, claims)
 		next(w, r.WithContext(ctx), ps)
 	}
 }
 
-// RequireRole middleware checks if user has required role
-func RequireRole(role string, next httprouter.Handle) httprouter.Handle {
-	return JWTAuth(func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+// TokenAuth middleware accepts a session JWT, which may do anything the
+// user can, or a personal access token or impersonation token granted scope
+func TokenAuth(scope string, next httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		tokenString, err := ExtractTokenFromHeader(r)
+		if err != nil {
+			writeJSON(w, http.StatusUnauthorized, ErrorResponse{Error: err.Error()})
+			return
+		}
+
+		var claims *Claims
+		if apitoken.IsToken(tokenString) {
+			claims, err = authenticateAPIToken(tokenString, scope)
+		} else {
+			claims, err = authenticateJWT(tokenString)
+			if err == nil && claims.Impersonated() && !apitoken.Allows(claims.Scopes, scope) {
+				err = ErrInsufficientScope
+			}
+		}
+		if err != nil {
+			status := http.StatusUnauthorized
+			if err == ErrInsufficientScope {
+				status = http.StatusForbidden
+			}
+			writeJSON(w, status, ErrorResponse{Error: err.Error()})
+			return
+		}
+
+		if !allowQuota(w, claims) {
+			return
+		}
+
+		if claims.Impersonated() {
+			traceImpersonation(r, claims)
+		}
+
+		ctx := context.WithValue(r.Context(), UserContextKey, claims)
+		next(w, r.WithContext(ctx), ps)
+	}
+}
+
+func authenticateJWT(tokenString string) (*Claims, error) {
+	claims, err := ValidateToken(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	if session.IsRevoked(claims.SessionID) {
+		return nil, ErrRevokedToken
+	}
+	// the impersonated user may have been disabled since
+	if claims.Impersonated() {
+		acc, err := accountRepo.FindByID(claims.UserID)
+		if err != nil || !acc.Enabled {
+			return nil, ErrInvalidToken
+		}
+	}
+	return claims, nil
+}
+
+// authenticateAPIToken resolves a personal access token to its owner. The
+// owner is read on every request so disabling the account or changing its
+// role applies immediately.
+func authenticateAPIToken(tokenString, scope string) (*Claims, error) {
+	token, err := apiTokenRepo.FindByHash(apitoken.Hash(tokenString))
+	if err != nil {
+		if err != apitoken.ErrTokenNotFound {
+			log.WithError(err).Error("Find API Token Failed")
+		}
+		return nil, ErrInvalidToken
+	}
+
+	acc, err := accountRepo.FindByID(token.UserID)
+	if err != nil || !acc.Enabled {
+		return nil, ErrInvalidToken
+	}
+
+	if !apitoken.Allows(token.Scopes, scope) {
+		return nil, ErrInsufficientScope
+	}
+
+	go func() {
+		if err := apiTokenRepo.Touch(token.ID); err != nil {
+			log.WithError(err).Error("Touch API Token Failed")
+		}
+	}()
+
+	return &Claims{
+		UserID:  acc.ID,
+		Email:   acc.Email,
+		Role:    acc.Role,
+		TokenID: token.ID,
+		Scopes:  token.Scopes,
+	}, nil
+}
+
+// RequirePermission middleware checks that the user's role is granted perm
+// and that the user passed two-factor authentication when the role requires
+// it. Personal access tokens must be granted the admin scope.
+func RequirePermission(perm string, next httprouter.Handle) httprouter.Handle {
+	return TokenAuth(apitoken.ScopeAdmin, checkPermission(perm, checkMFA(next)))
+}
+
+// checkMFA rejects sessions that skipped two-factor authentication when
+// the user's role requires it. Admin-scoped personal access tokens can only
+// be created from such sessions, so they pass.
+func checkMFA(next httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		claims := GetUserFromContext(r.Context())
+		if claims == nil {
+			writeJSON(w, http.StatusUnauthorized, ErrorResponse{Error: "未授權"})
+			return
+		}
+
+		passed, err := passedMFA(claims)
+		if err != nil {
+			log.WithError(err).Error("Check Role 2FA Policy Failed")
+			writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "查詢角色失敗"})
+			return
+		}
+		if !passed {
+			writeJSON(w, http.StatusForbidden, ErrorResponse{Error: ErrMFARequired.Error()})
+			return
+		}
+
+		next(w, r, ps)
+	}
+}
+
+// passedMFA reports whether the user passed two-factor authentication or
+// the role does not require it
+func passedMFA(claims *Claims) (bool, error) {
+	if claims.MFA || claims.TokenID != 0 {
+		return true, nil
+	}
+	required, err := roleLimitRepo.RequiresTwoFactor(claims.Role)
+	if err != nil {
+		return false, err
+	}
+	return !required, nil
+}
+
+func checkPermission(perm string, next httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 		claims := GetUserFromContext(r.Context())
 		if claims == nil {
 			writeJSON(w, http.StatusUnauthorized, ErrorResponse{Error: "未授權"})
 			return
 		}
 
-		if claims.Role != role && claims.Role != "admin" {
+		granted, err := Can(claims, perm)
+		if err != nil {
+			log.WithError(err).Error("Check Role Permission Failed")
+			writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "查詢角色失敗"})
+			return
+		}
+		if !granted {
 			writeJSON(w, http.StatusForbidden, ErrorResponse{Error: "禁止存取"})
 			return
 		}
 
 		next(w, r, ps)
-	})
+	}
+}
+
+// Can reports whether the user's role is granted perm
+func Can(claims *Claims, perm string) (bool, error) {
+	return roleLimitRepo.Can(claims.Role, perm)
 }
 
-// RequireAdmin middleware checks if user is admin
-func RequireAdmin(next httprouter.Handle) httprouter.Handle {
-	return RequireRole("admin", next)
+// CanAdminister reports whether a request behind TokenAuth may use perm on
+// other users' data, holding it to what RequirePermission checks: tokens
+// must be granted the admin scope and sessions must have passed two-factor
+// authentication when the role requires it
+func CanAdminister(claims *Claims, perm string) (bool, error) {
+	if (claims.TokenID != 0 || claims.Impersonated()) && !apitoken.Allows(claims.Scopes, apitoken.ScopeAdmin) {
+		return false, nil
+	}
+	granted, err := Can(claims, perm)
+	if err != nil || !granted {
+		return false, err
+	}
+	return passedMFA(claims)
 }
 
 // GetUserFromContext gets user claims from context
@@ -0,0 +1,56 @@
+package auth
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	log "github.com/Ptt-Alertor/logrus"
+	"github.com/Ptt-Alertor/ptt-alertor/ratelimit"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+const rateLimitedMsg = "請求過於頻繁，請稍後再試"
+
+// quotaWindow is the window of the per-role API quota
+const quotaWindow = time.Minute
+
+// RateLimit middleware limits requests to a route per account when wrapped
+// by an auth middleware, otherwise per client IP. The limit can be
+// overridden by RATE_LIMIT_<ROUTE>.
+func RateLimit(route string, limit ratelimit.Limit, next httprouter.Handle) httprouter.Handle {
+	limit = ratelimit.Configured(route, limit)
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		id := "ip:" + ratelimit.ClientIP(r)
+		if claims := GetUserFromContext(r.Context()); claims != nil {
+			id = "user:" + strconv.Itoa(claims.UserID)
+		}
+
+		res := ratelimit.Allow(route, id, limit)
+		ratelimit.SetHeaders(w, res)
+		if !res.Allowed {
+			writeJSON(w, http.StatusTooManyRequests, ErrorResponse{Error: rateLimitedMsg})
+			return
+		}
+
+		next(w, r, ps)
+	}
+}
+
+// allowQuota counts an authenticated request against the per-minute API
+// quota of the user's role and writes the rejection when it is used up
+func allowQuota(w http.ResponseWriter, claims *Claims) bool {
+	perMinute, err := roleLimitRepo.GetAPIRateLimit(claims.Role)
+	if err != nil {
+		log.WithError(err).Error("Get Role API Rate Limit Failed")
+	}
+
+	res := ratelimit.Allow("api", strconv.Itoa(claims.UserID), ratelimit.Limit{Requests: perMinute, Window: quotaWindow})
+	ratelimit.SetHeaders(w, res)
+	if !res.Allowed {
+		writeJSON(w, http.StatusTooManyRequests, ErrorResponse{Error: rateLimitedMsg})
+		return false
+	}
+	return true
+}
@@ -0,0 +1,113 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrTelegramHash    = errors.New("telegram data hash mismatch")
+	ErrTelegramExpired = errors.New("telegram data expired")
+)
+
+// TelegramAuthMaxAge is how old a signed Telegram login may be
+const TelegramAuthMaxAge = 24 * time.Hour
+
+// TelegramUser is the identity Telegram signed for a login
+type TelegramUser struct {
+	ID        int64  `json:"id"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Username  string `json:"username"`
+	PhotoURL  string `json:"photo_url"`
+}
+
+// VerifyTelegramLogin checks fields sent by the Telegram Login Widget. The
+// secret is SHA256 of the bot token.
+func VerifyTelegramLogin(fields map[string]string, botToken string) (*TelegramUser, error) {
+	secret := sha256.Sum256([]byte(botToken))
+	if err := checkTelegramHash(fields, secret[:]); err != nil {
+		return nil, err
+	}
+
+	id, err := strconv.ParseInt(fields["id"], 10, 64)
+	if err != nil || id == 0 {
+		return nil, ErrInvalidToken
+	}
+	return &TelegramUser{
+		ID:        id,
+		FirstName: fields["first_name"],
+		LastName:  fields["last_name"],
+		Username:  fields["username"],
+		PhotoURL:  fields["photo_url"],
+	}, nil
+}
+
+// VerifyTelegramInitData checks the initData query string of a Mini App.
+// The secret is HMAC-SHA256 of the bot token keyed with "WebAppData".
+func VerifyTelegramInitData(initData, botToken string) (*TelegramUser, error) {
+	values, err := url.ParseQuery(initData)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	fields := make(map[string]string, len(values))
+	for k := range values {
+		fields[k] = values.Get(k)
+	}
+
+	mac := hmac.New(sha256.New, []byte("WebAppData"))
+	mac.Write([]byte(botToken))
+	if err := checkTelegramHash(fields, mac.Sum(nil)); err != nil {
+		return nil, err
+	}
+
+	var user TelegramUser
+	if err := json.Unmarshal([]byte(fields["user"]), &user); err != nil || user.ID == 0 {
+		return nil, ErrInvalidToken
+	}
+	return &user, nil
+}
+
+// checkTelegramHash verifies the hash over the sorted key=value lines of
+// every other field, and that auth_date is recent
+func checkTelegramHash(fields map[string]string, secret []byte) error {
+	hash := fields["hash"]
+	if hash == "" {
+		return ErrTelegramHash
+	}
+
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		if k != "hash" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	lines := make([]string, len(keys))
+	for i, k := range keys {
+		lines[i] = k + "=" + fields[k]
+	}
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(strings.Join(lines, "\n")))
+	if !hmac.Equal([]byte(hex.EncodeToString(mac.Sum(nil))), []byte(strings.ToLower(hash))) {
+		return ErrTelegramHash
+	}
+
+	authDate, err := strconv.ParseInt(fields["auth_date"], 10, 64)
+	if err != nil {
+		return ErrTelegramHash
+	}
+	if time.Since(time.Unix(authDate, 0)) > TelegramAuthMaxAge {
+		return ErrTelegramExpired
+	}
+	return nil
+}
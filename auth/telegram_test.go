@@ -0,0 +1,104 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testBotToken = "123456:ABC-DEF"
+
+func signTelegram(fields map[string]string, secret []byte) string {
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	lines := make([]string, len(keys))
+	for i, k := range keys {
+		lines[i] = k + "=" + fields[k]
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(strings.Join(lines, "\n")))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func widgetFields(authDate time.Time) map[string]string {
+	fields := map[string]string{
+		"id":         "42",
+		"first_name": "Dino",
+		"username":   "dinos",
+		"auth_date":  strconv.FormatInt(authDate.Unix(), 10),
+	}
+	secret := sha256.Sum256([]byte(testBotToken))
+	fields["hash"] = signTelegram(fields, secret[:])
+	return fields
+}
+
+func TestVerifyTelegramLogin(t *testing.T) {
+	tampered := widgetFields(time.Now())
+	tampered["id"] = "43"
+
+	tests := []struct {
+		name     string
+		fields   map[string]string
+		botToken string
+		wantErr  error
+	}{
+		{"valid", widgetFields(time.Now()), testBotToken, nil},
+		{"tampered", tampered, testBotToken, ErrTelegramHash},
+		{"other bot", widgetFields(time.Now()), "654321:XYZ", ErrTelegramHash},
+		{"expired", widgetFields(time.Now().Add(-48 * time.Hour)), testBotToken, ErrTelegramExpired},
+		{"no hash", map[string]string{"id": "42"}, testBotToken, ErrTelegramHash},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user, err := VerifyTelegramLogin(tt.fields, tt.botToken)
+			if err != tt.wantErr {
+				t.Fatalf("VerifyTelegramLogin() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && (user.ID != 42 || user.Username != "dinos") {
+				t.Errorf("VerifyTelegramLogin() = %+v", user)
+			}
+		})
+	}
+}
+
+func TestVerifyTelegramInitData(t *testing.T) {
+	fields := map[string]string{
+		"query_id":  "AAH",
+		"user":      `{"id":42,"first_name":"Dino","username":"dinos"}`,
+		"auth_date": strconv.FormatInt(time.Now().Unix(), 10),
+	}
+	mac := hmac.New(sha256.New, []byte("WebAppData"))
+	mac.Write([]byte(testBotToken))
+	fields["hash"] = signTelegram(fields, mac.Sum(nil))
+
+	values := url.Values{}
+	for k, v := range fields {
+		values.Set(k, v)
+	}
+
+	user, err := VerifyTelegramInitData(values.Encode(), testBotToken)
+	if err != nil {
+		t.Fatalf("VerifyTelegramInitData() error = %v", err)
+	}
+	if user.ID != 42 || user.FirstName != "Dino" {
+		t.Errorf("VerifyTelegramInitData() = %+v", user)
+	}
+
+	// widget signing must not be accepted for initData
+	secret := sha256.Sum256([]byte(testBotToken))
+	values.Set("hash", signTelegram(map[string]string{
+		"query_id": fields["query_id"], "user": fields["user"], "auth_date": fields["auth_date"],
+	}, secret[:]))
+	if _, err := VerifyTelegramInitData(values.Encode(), testBotToken); err != ErrTelegramHash {
+		t.Errorf("VerifyTelegramInitData() error = %v, want %v", err, ErrTelegramHash)
+	}
+}
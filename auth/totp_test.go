@@ -0,0 +1,81 @@
+package auth
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTotpCode(t *testing.T) {
+	// RFC 6238 appendix B, SHA1
+	key := []byte("12345678901234567890")
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1234567890, "89005924"},
+		{20000000000, "65353130"},
+	}
+	for _, tt := range tests {
+		if got := totpCode(key, uint64(tt.unix/totpPeriod), 8); got != tt.want {
+			t.Errorf("totpCode(%d) = %v, want %v", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+	now := time.Unix(1111111109, 0)
+
+	tests := []struct {
+		name     string
+		code     string
+		at       time.Time
+		wantStep int64
+		wantOK   bool
+	}{
+		{"current", "081804", now, 37037036, true},
+		{"previous period", "081804", now.Add(30 * time.Second), 37037036, true},
+		{"too old", "081804", now.Add(90 * time.Second), 0, false},
+		{"wrong", "123456", now, 0, false},
+		{"short", "81804", now, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := ValidateTOTP(secret, tt.code, tt.at)
+			if ok != tt.wantOK || step != tt.wantStep {
+				t.Errorf("ValidateTOTP() = %v, %v, want %v, %v", step, ok, tt.wantStep, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestGenerateRecoveryCodes(t *testing.T) {
+	codes, err := GenerateRecoveryCodes()
+	if err != nil {
+		t.Fatalf("GenerateRecoveryCodes() error = %v", err)
+	}
+	if len(codes) != RecoveryCodeCount {
+		t.Fatalf("GenerateRecoveryCodes() returned %d codes", len(codes))
+	}
+	seen := map[string]bool{}
+	for _, c := range codes {
+		if len(c) != 11 || c[5] != '-' || seen[c] {
+			t.Errorf("GenerateRecoveryCodes() bad code %q", c)
+		}
+		seen[c] = true
+	}
+	if HashRecoveryCode(strings.ToUpper(strings.ReplaceAll(codes[0], "-", ""))) != HashRecoveryCode(codes[0]) {
+		t.Errorf("HashRecoveryCode() depends on case or separator")
+	}
+}
+
+func TestTOTPURI(t *testing.T) {
+	uri := TOTPURI("ABC", "user@example.com")
+	if !strings.HasPrefix(uri, "otpauth://totp/PTT%20Alertor:user@example.com?") || !strings.Contains(uri, "secret=ABC") {
+		t.Errorf("TOTPURI() = %v", uri)
+	}
+}
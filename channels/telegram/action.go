@@ -0,0 +1,417 @@
+package telegram
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/Ptt-Alertor/logrus"
+	"github.com/gomodule/redigo/redis"
+
+	"github.com/Ptt-Alertor/ptt-alertor/connections"
+	"github.com/Ptt-Alertor/ptt-alertor/models/account"
+	"github.com/Ptt-Alertor/ptt-alertor/models/pttmail"
+	"github.com/Ptt-Alertor/ptt-alertor/ptt/mail"
+	"github.com/Ptt-Alertor/ptt-alertor/ratelimit"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// pttActionLimit bounds the pushes and replies a user queues,
+// RATE_LIMIT_PTT_ACTION overrides it
+var pttActionLimit = ratelimit.Limit{Requests: 20, Window: time.Hour}
+
+const (
+	// maxActionArticles bounds the articles with push and reply buttons
+	maxActionArticles = 4
+	// pendingActionTTL is how long the prompt waits for the user's text
+	pendingActionTTL    = 10 * time.Minute
+	pendingActionPrefix = "ptt_action:"
+)
+
+var pushTypeNames = map[mail.PushType]string{
+	mail.PushUp:    "推",
+	mail.PushDown:  "噓",
+	mail.PushArrow: "→",
+}
+
+// ActionButtonData contains data for push and reply button callbacks
+type ActionButtonData struct {
+	UserID       int    `json:"u"` // User ID in PostgreSQL
+	Board        string `json:"b"` // PTT board of the article
+	ArticleCode  string `json:"c"` // PTT article code, e.g. M.1498563199.A.35C
+	ArticleIndex int    `json:"i"` // 1-based index for display
+}
+
+// actionButtonRows creates a row of push and reply buttons per article
+func actionButtonRows(actionDataList []*ActionButtonData) [][]tgbotapi.InlineKeyboardButton {
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for i, d := range actionDataList {
+		if i == maxActionArticles {
+			break
+		}
+		// Create callback data: a_p:<userID>:<board>:<code>, a_r for reply
+		target := strconv.Itoa(d.UserID) + ":" + d.Board + ":" + d.ArticleCode
+
+		pushText, replyText := "💬 推文", "↩️ 回文"
+		if len(actionDataList) > 1 {
+			pushText += "#" + strconv.Itoa(d.ArticleIndex)
+			replyText += "#" + strconv.Itoa(d.ArticleIndex)
+		}
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(pushText, "a_p:"+target),
+			tgbotapi.NewInlineKeyboardButtonData(replyText, "a_r:"+target),
+		))
+	}
+	return rows
+}
+
+// pendingAction is a push, reply or mail reply waiting for the user's text
+// and confirmation, kept under the prompt message
+type pendingAction struct {
+	Kind      string `json:"kind"`
+	UserID    int    `json:"user_id"`
+	Board     string `json:"board,omitempty"`
+	Code      string `json:"code,omitempty"`
+	PushType  int    `json:"push_type,omitempty"`
+	Recipient string `json:"recipient,omitempty"`
+	Subject   string `json:"subject,omitempty"`
+	Content   string `json:"content,omitempty"`
+}
+
+// target describes the action for messages, e.g. 推文至 board
+func (a *pendingAction) target() string {
+	switch a.Kind {
+	case pttmail.KindPush:
+		return "推文至 " + a.Board
+	case pttmail.KindMail:
+		return "寄信給 " + a.Recipient
+	}
+	return "回文至 " + a.Board
+}
+
+// parseActionCallback parses <prefix>:<userID>:<board>:<code>[:<pushType>]
+// and returns the message to show when it is invalid
+func parseActionCallback(data string) (*pendingAction, string) {
+	parts := strings.Split(data, ":")
+	if len(parts) != 4 && len(parts) != 5 {
+		return nil, "❌ 無效的請求"
+	}
+
+	userID, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return nil, "❌ 無效的使用者 ID"
+	}
+
+	if parts[2] == "" || parts[3] == "" {
+		return nil, "❌ 無效的文章"
+	}
+
+	a := &pendingAction{Kind: pttmail.KindReply, UserID: userID, Board: parts[2], Code: parts[3]}
+	if parts[0] == "a_t" {
+		if len(parts) != 5 {
+			return nil, "❌ 無效的請求"
+		}
+		t, err := strconv.Atoi(parts[4])
+		if err != nil || !mail.ValidPushType(mail.PushType(t)) {
+			return nil, "❌ 無效的推文類型"
+		}
+		a.Kind, a.PushType = pttmail.KindPush, t
+	}
+	return a, ""
+}
+
+func pendingActionKey(chatID int64, messageID int) string {
+	return pendingActionPrefix + strconv.FormatInt(chatID, 10) + ":" + strconv.Itoa(messageID)
+}
+
+func savePendingAction(chatID int64, messageID int, a *pendingAction, ttl time.Duration) error {
+	conn := connections.Redis()
+	defer conn.Close()
+
+	b, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+	_, err = conn.Do("SET", pendingActionKey(chatID, messageID), b, "PX", ttl.Milliseconds())
+	return err
+}
+
+// findPendingAction returns nil when the prompt expired or was not one
+func findPendingAction(chatID int64, messageID int) (*pendingAction, error) {
+	conn := connections.Redis()
+	defer conn.Close()
+
+	b, err := redis.Bytes(conn.Do("GET", pendingActionKey(chatID, messageID)))
+	if err == redis.ErrNil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var a pendingAction
+	if err := json.Unmarshal(b, &a); err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// claimScript gets and deletes the pending action in one step
+var claimScript = redis.NewScript(1, `
+local v = redis.call("GET", KEYS[1])
+if v then
+	redis.call("DEL", KEYS[1])
+end
+return v`)
+
+// claimPendingAction takes the confirmed action out of Redis, of taps
+// racing on the confirm button only one gets it
+func claimPendingAction(chatID int64, messageID int) (*pendingAction, error) {
+	conn := connections.Redis()
+	defer conn.Close()
+
+	b, err := redis.Bytes(claimScript.Do(conn, pendingActionKey(chatID, messageID)))
+	if err == redis.ErrNil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var a pendingAction
+	if err := json.Unmarshal(b, &a); err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// pttActionAccount returns the PTT account a confirmed action is sent
+// with, checked again since buttons outlive role and password changes
+func pttActionAccount(userID int) (*account.PTTAccount, string) {
+	acc, err := accountRepo.FindByID(userID)
+	if err != nil {
+		log.WithError(err).Error("Failed to find account")
+		return nil, "❌ 取得帳號失敗"
+	}
+	granted, err := (&account.RoleLimitPostgres{}).Can(acc.Role, account.PermPTTMail)
+	if err != nil {
+		log.WithError(err).Error("Check Role Permission Failed")
+		return nil, "❌ 操作失敗，請稍後再試"
+	}
+	if !granted {
+		return nil, "🚫 您的角色未開放 PTT 寄信、推文與回文"
+	}
+
+	// the worker logs in with its credentials
+	pttAccount, err := (&account.PTTAccountPostgres{}).FindByUserID(userID)
+	if err != nil {
+		if err == account.ErrPTTAccountNotFound {
+			return nil, "⚠️ 尚未綁定 PTT 帳號"
+		}
+		log.WithError(err).Error("Failed to find PTT account")
+		return nil, "❌ 取得 PTT 帳號失敗"
+	}
+	if pttAccount.CredentialStatus == account.CredentialInvalid {
+		return nil, "🔑 PTT 帳號密碼錯誤，請重新設定帳號密碼"
+	}
+	return pttAccount, ""
+}
+
+// restorePendingAction puts back an action claimed but not queued
+func restorePendingAction(chatID int64, messageID int, a *pendingAction) {
+	if err := savePendingAction(chatID, messageID, a, pendingActionTTL); err != nil {
+		log.WithError(err).Error("Restore Pending PTT Action Failed")
+	}
+}
+
+// handlePushTypes asks for 推, 噓 or → of the push button
+func handlePushTypes(callbackData string, chatID int64) {
+	// Parse callback data: a_p:<userID>:<board>:<code>
+	a, errText := parseActionCallback(callbackData)
+	if errText != "" {
+		SendTextMessage(chatID, errText)
+		return
+	}
+
+	// Create push type callback data: a_t:<userID>:<board>:<code>:<type>
+	target := "a_t:" + strings.TrimPrefix(callbackData, "a_p:") + ":"
+	msg := tgbotapi.NewMessage(chatID, "💬 推文至 "+a.Board+"，請選擇：")
+	markup := tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("推", target+strconv.Itoa(int(mail.PushUp))),
+			tgbotapi.NewInlineKeyboardButtonData("噓", target+strconv.Itoa(int(mail.PushDown))),
+			tgbotapi.NewInlineKeyboardButtonData("→", target+strconv.Itoa(int(mail.PushArrow))),
+			tgbotapi.NewInlineKeyboardButtonData("❌ 取消", "a_x"),
+		),
+	)
+	if _, err := sendWithKeyboard(msg, markup); err != nil {
+		log.WithError(err).Error("Failed to send push types")
+	}
+}
+
+// handleActionPrompt asks for the comment or the reply, which the user
+// sends as a reply to the prompt. It returns empty when the prompt was sent.
+func handleActionPrompt(callbackData string, chatID int64) string {
+	// Parse callback data: a_t:<userID>:<board>:<code>:<type> or a_r:<userID>:<board>:<code>
+	a, errText := parseActionCallback(callbackData)
+	if errText != "" {
+		return errText
+	}
+	return promptAction(chatID, a)
+}
+
+// promptAction asks for the text of the action as a reply to the prompt
+func promptAction(chatID int64, a *pendingAction) string {
+	var text string
+	switch a.Kind {
+	case pttmail.KindPush:
+		text = "💬 請回覆此訊息輸入推文內容 (" + pushTypeNames[mail.PushType(a.PushType)] + " " + a.Board +
+			")，限一行 " + strconv.Itoa(mail.MaxPushWidth/2) + " 個中文字"
+	case pttmail.KindMail:
+		text = "📧 請回覆此訊息輸入回信內容 (寄給 " + a.Recipient + ")"
+	default:
+		text = "↩️ 請回覆此訊息輸入回文內容 (" + a.Board + ")"
+	}
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ReplyMarkup = tgbotapi.ForceReply{ForceReply: true, Selective: true}
+	sent, err := bot.Send(msg)
+	if err != nil {
+		log.WithError(err).Error("Failed to send PTT action prompt")
+		return "❌ 操作失敗，請稍後再試"
+	}
+
+	if err := savePendingAction(chatID, sent.MessageID, a, pendingActionTTL); err != nil {
+		log.WithError(err).Error("Save Pending PTT Action Failed")
+		return "❌ 操作失敗，請稍後再試"
+	}
+	return ""
+}
+
+// handleActionInput previews the text replied to a push, reply or mail
+// reply prompt with confirm/cancel buttons. It reports false when the
+// message replied to is no pending prompt.
+func handleActionInput(chatID int64, promptID int, text string) bool {
+	a, err := findPendingAction(chatID, promptID)
+	if err != nil {
+		log.WithError(err).Error("Find Pending PTT Action Failed")
+		return false
+	}
+	if a == nil {
+		return false
+	}
+
+	var previewText string
+	switch a.Kind {
+	case pttmail.KindPush:
+		if err := mail.ValidateComment(text); err != nil {
+			SendTextMessage(chatID, "📝 推文內容需為一行，且不超過 "+strconv.Itoa(mail.MaxPushWidth/2)+" 個中文字，請重新回覆")
+			return true
+		}
+		previewText = "💬 推文預覽\n\n看板: " + a.Board + "\n" + pushTypeNames[mail.PushType(a.PushType)] + " " + text
+	case pttmail.KindMail:
+		previewText = "📧 寄信預覽\n\n收件人: " + a.Recipient + "\n標題: " + a.Subject + "\n─────────────\n" + text
+	default:
+		previewText = "↩️ 回文預覽\n\n看板: " + a.Board + "\n─────────────\n" + text
+	}
+	if strings.TrimSpace(text) == "" {
+		SendTextMessage(chatID, "📝 內容不能為空白，請重新回覆")
+		return true
+	}
+
+	a.Content = text
+	if err := savePendingAction(chatID, promptID, a, pendingActionTTL); err != nil {
+		log.WithError(err).Error("Save Pending PTT Action Failed")
+		SendTextMessage(chatID, "❌ 操作失敗，請稍後再試")
+		return true
+	}
+
+	// Create confirm callback data: a_c:<promptMessageID>
+	msg := tgbotapi.NewMessage(chatID, previewText)
+	markup := tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("✅ 送出", "a_c:"+strconv.Itoa(promptID)),
+			tgbotapi.NewInlineKeyboardButtonData("❌ 取消", "a_x"),
+		),
+	)
+	if _, err := sendWithKeyboard(msg, markup); err != nil {
+		log.WithError(err).Error("Failed to send PTT action preview")
+	}
+	return true
+}
+
+// handleActionConfirm queues the push, reply or mail reply of the confirm
+// button, it returns empty when the queued message was sent
+func handleActionConfirm(callbackData string, chatID int64) string {
+	// Parse callback data: a_c:<promptMessageID>
+	promptID, err := strconv.Atoi(strings.TrimPrefix(callbackData, "a_c:"))
+	if err != nil {
+		return "❌ 無效的請求"
+	}
+
+	// the confirm button is tapped once, a second tap finds nothing
+	a, err := claimPendingAction(chatID, promptID)
+	if err != nil {
+		log.WithError(err).Error("Claim Pending PTT Action Failed")
+		return "❌ 操作失敗，請稍後再試"
+	}
+	if a == nil || a.Content == "" {
+		return "⌛ 操作已逾時或已送出，請重新點選按鈕"
+	}
+
+	pttAccount, errText := pttActionAccount(a.UserID)
+	if errText != "" {
+		return errText
+	}
+
+	// mail replies count as mails
+	bucket, limit := "ptt-action", pttActionLimit
+	if a.Kind == pttmail.KindMail {
+		bucket, limit = "ptt-mail", pttMailLimit
+	}
+	if res := ratelimit.Allow(bucket, strconv.Itoa(a.UserID), ratelimit.Configured(bucket, limit)); !res.Allowed {
+		// the user may confirm again once allowed
+		restorePendingAction(chatID, promptID, a)
+		return "⏳ 操作過於頻繁，請於 " + strconv.Itoa(int(res.RetryAfter.Minutes())+1) + " 分鐘後再試"
+	}
+
+	action := a.target()
+
+	// Queue the action, the worker edits this message with the result
+	messageID, err := sendTextMessageForID(chatID, "⏳ 已排入佇列，"+action)
+	if err != nil {
+		log.WithError(err).Error("Telegram Send Message Failed")
+	}
+	job := &pttmail.Job{
+		Kind:              a.Kind,
+		UserID:            a.UserID,
+		PTTUsername:       pttAccount.PTTUsername,
+		Recipient:         a.Recipient,
+		Subject:           a.Subject,
+		Content:           a.Content,
+		ArticleCode:       a.Code,
+		Board:             a.Board,
+		PushType:          a.PushType,
+		TelegramChatID:    chatID,
+		TelegramMessageID: messageID,
+	}
+	if err := mailJobRepo.Enqueue(job); err != nil {
+		log.WithError(err).WithFields(log.Fields{
+			"user_id": a.UserID,
+			"target":  action,
+			"kind":    a.Kind,
+		}).Error("Failed to queue PTT action")
+		if messageID != 0 {
+			EditTextMessage(chatID, messageID, "❌ "+action+" 失敗，請稍後再試")
+			return ""
+		}
+		return "❌ " + action + " 失敗，請稍後再試"
+	}
+
+	log.WithFields(log.Fields{
+		"user_id": a.UserID,
+		"board":   a.Board,
+		"kind":    a.Kind,
+		"job_id":  job.ID,
+	}).Info("PTT action queued via Telegram button")
+
+	return ""
+}
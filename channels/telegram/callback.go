@@ -0,0 +1,117 @@
+package telegram
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/Ptt-Alertor/logrus"
+	"github.com/gomodule/redigo/redis"
+
+	"github.com/Ptt-Alertor/ptt-alertor/connections"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Telegram sends back whatever callback data a client makes up, so buttons
+// carry t:<token>:<index> instead of their data. The data of a keyboard is
+// kept in Redis under the token with the chat it was sent to, a callback
+// from another chat or with a made-up token finds nothing.
+const (
+	callbackDataPrefix = "t:"
+	callbackKeyPrefix  = "tg_callback:"
+	// callbackTTL is how long the buttons of a message work
+	callbackTTL = 7 * 24 * time.Hour
+)
+
+// sealedKeyboard is the data of a keyboard's buttons in order
+type sealedKeyboard struct {
+	ChatID int64    `json:"chat_id"`
+	Data   []string `json:"data"`
+}
+
+// sealKeyboard stores the callback data of the keyboard for chatID and
+// returns it with the data replaced by tokens. Buttons without callback
+// data, such as links, are kept as they are.
+func sealKeyboard(chatID int64, markup tgbotapi.InlineKeyboardMarkup) (tgbotapi.InlineKeyboardMarkup, error) {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return markup, err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+
+	sk := sealedKeyboard{ChatID: chatID}
+	sealed := tgbotapi.InlineKeyboardMarkup{InlineKeyboard: make([][]tgbotapi.InlineKeyboardButton, len(markup.InlineKeyboard))}
+	for i, row := range markup.InlineKeyboard {
+		sealed.InlineKeyboard[i] = make([]tgbotapi.InlineKeyboardButton, len(row))
+		for j, button := range row {
+			if button.CallbackData != nil {
+				data := callbackDataPrefix + token + ":" + strconv.Itoa(len(sk.Data))
+				sk.Data = append(sk.Data, *button.CallbackData)
+				button.CallbackData = &data
+			}
+			sealed.InlineKeyboard[i][j] = button
+		}
+	}
+
+	v, err := json.Marshal(sk)
+	if err != nil {
+		return markup, err
+	}
+	conn := connections.Redis()
+	defer conn.Close()
+	if _, err := conn.Do("SET", callbackKeyPrefix+token, v, "PX", callbackTTL.Milliseconds()); err != nil {
+		return markup, err
+	}
+	return sealed, nil
+}
+
+// openCallback returns the data of the button pressed in chatID and the
+// message to show when the button is not one sealed for the chat
+func openCallback(chatID int64, callbackData string) (string, string) {
+	token, index, found := strings.Cut(strings.TrimPrefix(callbackData, callbackDataPrefix), ":")
+	if !strings.HasPrefix(callbackData, callbackDataPrefix) || !found {
+		return "", "⌛ 此按鈕已失效，請使用新的訊息"
+	}
+	i, err := strconv.Atoi(index)
+	if err != nil || i < 0 {
+		return "", "❌ 無效的請求"
+	}
+
+	conn := connections.Redis()
+	defer conn.Close()
+	v, err := redis.Bytes(conn.Do("GET", callbackKeyPrefix+token))
+	if err == redis.ErrNil {
+		return "", "⌛ 此按鈕已失效，請使用新的訊息"
+	}
+	if err != nil {
+		log.WithError(err).Error("Find Telegram Callback Failed")
+		return "", "❌ 操作失敗，請稍後再試"
+	}
+	var sk sealedKeyboard
+	if err := json.Unmarshal(v, &sk); err != nil {
+		log.WithError(err).Error("Decode Telegram Callback Failed")
+		return "", "❌ 操作失敗，請稍後再試"
+	}
+
+	if sk.ChatID != chatID {
+		log.WithField("chat_id", chatID).Warn("Telegram Callback From Another Chat")
+		return "", "🚫 無權限使用此按鈕"
+	}
+	if i >= len(sk.Data) {
+		return "", "❌ 無效的請求"
+	}
+	return sk.Data[i], ""
+}
+
+// sendWithKeyboard sends msg with the keyboard sealed for its chat
+func sendWithKeyboard(msg tgbotapi.MessageConfig, markup tgbotapi.InlineKeyboardMarkup) (tgbotapi.Message, error) {
+	sealed, err := sealKeyboard(msg.ChatID, markup)
+	if err != nil {
+		return tgbotapi.Message{}, err
+	}
+	msg.ReplyMarkup = sealed
+	return bot.Send(msg)
+}
@@ -0,0 +1,59 @@
+package telegram
+
+import (
+	"strings"
+	"time"
+
+	log "github.com/Ptt-Alertor/logrus"
+	"github.com/Ptt-Alertor/ptt-alertor/models/pttmail"
+	"github.com/Ptt-Alertor/ptt-alertor/ptt/mail"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// inboxReplyTTL is how long the reply button of a forwarded mail works
+const inboxReplyTTL = 7 * 24 * time.Hour
+
+// SendInboxMail forwards a PTT mail of userID's mailbox with a reply button.
+// A long mail is cut to one message, the whole of it stays on PTT.
+func SendInboxMail(chatID int64, userID int, m *mail.InboxMail) {
+	header := "📬 PTT 新信件\n寄件人: " + m.Author + "\n標題: " + m.Subject + "\n時間: " + m.Date + "\n─────────────\n"
+	content := []rune(m.Content)
+	if room := maxCharacters - len([]rune(header)); len(content) > room {
+		content = append(content[:room-1], '…')
+	}
+
+	msg := tgbotapi.NewMessage(chatID, header+string(content))
+	msg.DisableWebPagePreview = true
+	markup := tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("↩️ 回信", "a_m"),
+	))
+	sent, err := sendWithKeyboard(msg, markup)
+	if err != nil {
+		log.WithError(err).Error("Telegram Send Inbox Mail Failed")
+		return
+	}
+
+	// the reply waits under the forwarded message until the button is tapped
+	a := &pendingAction{
+		Kind:      pttmail.KindMail,
+		UserID:    userID,
+		Recipient: m.Author,
+		Subject:   "Re: " + strings.TrimPrefix(m.Subject, "Re: "),
+	}
+	if err := savePendingAction(chatID, sent.MessageID, a, inboxReplyTTL); err != nil {
+		log.WithError(err).Error("Save Inbox Mail Reply Failed")
+	}
+}
+
+// handleInboxReply asks for the reply to the forwarded mail of messageID
+func handleInboxReply(chatID int64, messageID int) string {
+	a, err := findPendingAction(chatID, messageID)
+	if err != nil {
+		log.WithError(err).Error("Find Inbox Mail Reply Failed")
+		return "❌ 操作失敗，請稍後再試"
+	}
+	if a == nil {
+		return "⌛ 回信已逾時，請至 PTT 回信"
+	}
+	return promptAction(chatID, a)
+}
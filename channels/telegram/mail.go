@@ -0,0 +1,234 @@
+package telegram
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/Ptt-Alertor/logrus"
+	"github.com/Ptt-Alertor/ptt-alertor/models/account"
+	"github.com/Ptt-Alertor/ptt-alertor/models/archive"
+	"github.com/Ptt-Alertor/ptt-alertor/models/binding"
+	"github.com/Ptt-Alertor/ptt-alertor/models/pttmail"
+	"github.com/Ptt-Alertor/ptt-alertor/ratelimit"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+var (
+	archiveRepo = &archive.Postgres{}
+	mailJobRepo = &pttmail.Postgres{}
+)
+
+// pttMailLimit bounds the mails a user queues, RATE_LIMIT_PTT_MAIL overrides it
+var pttMailLimit = ratelimit.Limit{Requests: 10, Window: time.Hour}
+
+const mailHistoryLimit = 10
+
+// mailCallback is the data of the mail preview and confirm buttons
+type mailCallback struct {
+	userID int
+	subID  int
+	author string
+	// code is empty on buttons sent before article codes were added
+	code string
+	// template indexes Subscription.MailTemplates, buttons sent before
+	// mail rules were added mean the first
+	template int
+}
+
+// parseMailCallback parses
+// <prefix>:<userID>:<subID>:<author>[:<code>[:<template>]] and returns the
+// message to show when it is invalid
+func parseMailCallback(data string) (*mailCallback, string) {
+	parts := strings.Split(data, ":")
+	if len(parts) < 4 || len(parts) > 6 {
+		return nil, "❌ 無效的請求"
+	}
+
+	userID, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return nil, "❌ 無效的使用者 ID"
+	}
+
+	subID, err := strconv.Atoi(parts[2])
+	if err != nil {
+		return nil, "❌ 無效的訂閱 ID"
+	}
+
+	if parts[3] == "" {
+		return nil, "❌ 無效的收件者"
+	}
+
+	cb := &mailCallback{userID: userID, subID: subID, author: parts[3]}
+	if len(parts) >= 5 {
+		cb.code = parts[4]
+	}
+	if len(parts) == 6 {
+		if cb.template, err = strconv.Atoi(parts[5]); err != nil || cb.template < 0 {
+			return nil, "❌ 無效的信件模板"
+		}
+	}
+	return cb, ""
+}
+
+// findMailTemplate returns the subscription and mail template of the button
+// and the message to show when they are gone
+func findMailTemplate(cb *mailCallback) (*account.Subscription, *account.MailTemplate, string) {
+	sub, err := (&account.SubscriptionPostgres{}).FindByID(cb.subID)
+	if err != nil {
+		log.WithError(err).Error("Failed to find subscription for mail")
+		return nil, nil, "📭 找不到訂閱設定"
+	}
+
+	// Check ownership
+	if sub.UserID != cb.userID {
+		return nil, nil, "🚫 無權限使用此訂閱"
+	}
+
+	templates := sub.MailTemplates()
+	if len(templates) == 0 {
+		return nil, nil, "📝 此訂閱尚未設定信件模板"
+	}
+	if cb.template >= len(templates) {
+		return nil, nil, "📝 信件模板已變更，請重新點選按鈕"
+	}
+	return sub, templates[cb.template], ""
+}
+
+// handleMailTemplates asks which of the subscription's mail templates to
+// preview
+func handleMailTemplates(callbackData string, chatID int64) {
+	// Parse callback data: m_s:<userID>:<subID>:<author>:<code>
+	cb, errText := parseMailCallback(callbackData)
+	if errText != "" {
+		SendTextMessage(chatID, errText)
+		return
+	}
+
+	sub, _, errText := findMailTemplate(cb)
+	if errText != "" {
+		SendTextMessage(chatID, errText)
+		return
+	}
+
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for i, t := range sub.MailTemplates() {
+		name := t.Name
+		if name == "" {
+			name = "預設"
+		}
+		data := "m_p:" + strings.TrimPrefix(callbackData, "m_s:") + ":" + strconv.Itoa(i)
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("📧 "+name, data)))
+	}
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("❌ 取消", "m_x")))
+
+	msg := tgbotapi.NewMessage(chatID, "📧 選擇寄給 "+cb.author+" 的信件模板")
+	if _, err := sendWithKeyboard(msg, tgbotapi.InlineKeyboardMarkup{InlineKeyboard: rows}); err != nil {
+		log.WithError(err).Error("Failed to send mail templates")
+	}
+}
+
+// mailData looks up the article of the button for the mail template,
+// falling back to what the button and subscription tell
+func mailData(cb *mailCallback, sub *account.Subscription) account.MailData {
+	d := account.NewMailData(cb.author, sub.Board, cb.code)
+	if cb.code == "" {
+		return d
+	}
+
+	a, err := archiveRepo.FindByCode(cb.code)
+	if err != nil {
+		if err != archive.ErrArticleNotFound {
+			log.WithError(err).Error("Find Archived Article For Mail Failed")
+		}
+		return d
+	}
+
+	d.Title = a.Title
+	d.Price = account.ParsePrice(a.Title)
+	d.Board = a.Board
+	if a.Link != "" {
+		d.Link = a.Link
+	}
+	return d
+}
+
+const mailPendingText = "⏳ 這封信已在寄信佇列中"
+
+// checkDuplicateMail returns the message to show when the same mail is
+// already queued or was sent within the cooldown
+func checkDuplicateMail(userID int, recipient, code string) string {
+	pending, err := mailJobRepo.Pending(userID, recipient, code)
+	if err != nil {
+		log.WithError(err).Error("Check Pending PTT Mail Failed")
+	}
+	if pending {
+		return mailPendingText
+	}
+
+	cooldown := pttmail.Cooldown()
+	if cooldown == 0 {
+		return ""
+	}
+	last, err := mailJobRepo.LastSent(userID, recipient, code, time.Now().Add(-cooldown))
+	if err != nil {
+		log.WithError(err).Error("Check PTT Mail Cooldown Failed")
+	}
+	if last != nil {
+		return "📭 已於 " + account.FormatMailDate(last.CreatedAt) + " 寄信給 " + recipient + "，請勿重複寄送"
+	}
+	return ""
+}
+
+// mailHistory lists the latest PTT mails of the account bound to the chat
+func mailHistory(chatID int64) string {
+	b, err := bindingRepo.FindByServiceID(binding.ServiceTelegram, strconv.FormatInt(chatID, 10))
+	if err != nil {
+		if err == binding.ErrBindingNotFound {
+			return "尚未綁定帳號，請先使用 /bind"
+		}
+		log.WithError(err).Error("Failed to find binding for mail history")
+		return "❌ 取得寄信紀錄失敗"
+	}
+
+	result, err := mailJobRepo.History(b.UserID, 1, mailHistoryLimit)
+	if err != nil {
+		log.WithError(err).Error("Failed to list PTT mail history")
+		return "❌ 取得寄信紀錄失敗"
+	}
+	if len(result.Entries) == 0 {
+		return "尚未寄過站內信。"
+	}
+
+	var sb strings.Builder
+	sb.WriteString("最近 " + strconv.Itoa(len(result.Entries)) + " 封站內信：\n")
+	for _, e := range result.Entries {
+		mark := "✅"
+		if e.Status != pttmail.StatusSent {
+			mark = "❌"
+		}
+		sb.WriteString(mark + " " + account.FormatMailDate(e.CreatedAt) + " " + e.Recipient + "：" + e.Subject + "\n")
+	}
+	return strings.TrimSpace(sb.String())
+}
+
+// sendTextMessageForID sends a short message and returns its ID to edit
+// it later
+func sendTextMessageForID(chatID int64, text string) (int, error) {
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.DisableWebPagePreview = true
+	sent, err := bot.Send(msg)
+	if err != nil {
+		return 0, err
+	}
+	return sent.MessageID, nil
+}
+
+// EditTextMessage replaces the text of a message sent by the bot
+func EditTextMessage(chatID int64, messageID int, text string) {
+	edit := tgbotapi.NewEditMessageText(chatID, messageID, text)
+	edit.DisableWebPagePreview = true
+	if _, err := bot.Send(edit); err != nil {
+		log.WithError(err).Error("Telegram Edit Message Failed")
+	}
+}
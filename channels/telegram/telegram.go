@@ -2,8 +2,8 @@ package telegram
 
 import (
 	"encoding/json"
+	"errors"
 	"io"
-	"math/rand"
 	"net/http"
 	"os"
 	"regexp"
@@ -11,15 +11,13 @@ import (
 	"strings"
 
 	log "github.com/Ptt-Alertor/logrus"
-	"github.com/gomodule/redigo/redis"
-	"golang.org/x/crypto/bcrypt"
 
 	"github.com/Ptt-Alertor/ptt-alertor/command"
-	"github.com/Ptt-Alertor/ptt-alertor/connections"
 	"github.com/Ptt-Alertor/ptt-alertor/models/account"
 	"github.com/Ptt-Alertor/ptt-alertor/models/binding"
+	"github.com/Ptt-Alertor/ptt-alertor/models/pttmail"
 	"github.com/Ptt-Alertor/ptt-alertor/myutil"
-	"github.com/Ptt-Alertor/ptt-alertor/ptt/mail"
+	"github.com/Ptt-Alertor/ptt-alertor/ratelimit"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"github.com/julienschmidt/httprouter"
 )
@@ -84,25 +82,57 @@ func handleCallbackQuery(update tgbotapi.Update) {
 	var responseText string
 	userID := strconv.FormatInt(update.CallbackQuery.From.ID, 10)
 	chatID := update.CallbackQuery.Message.Chat.ID
-	data := update.CallbackQuery.Data
 
 	// Answer callback query immediately to prevent Telegram from retrying
 	callback := tgbotapi.NewCallback(update.CallbackQuery.ID, "")
 	bot.Request(callback)
 
+	// Buttons carry a token of the data sealed for this chat
+	data, errText := openCallback(chatID, update.CallbackQuery.Data)
+	if errText != "" {
+		SendTextMessage(chatID, errText)
+		return
+	}
+
 	switch {
 	case data == "CANCEL":
 		responseText = "取消"
 	case data == "m_x":
 		responseText = "ℹ️ 已取消寄信"
+	case strings.HasPrefix(data, "m_s:"):
+		// Ask which mail template to send
+		handleMailTemplates(data, chatID)
+		return
 	case strings.HasPrefix(data, "m_p:"):
 		// Show mail preview with confirm/cancel buttons
 		handleMailPreview(data, chatID)
 		return
 	case strings.HasPrefix(data, "m_c:"):
-		// Send "processing" message first for mail (takes time)
-		SendTextMessage(chatID, "⏳ 正在寄送信件...")
-		responseText = handleMailConfirm(data, chatID)
+		// Mail is sent by a worker, which reports on the queued message
+		if responseText = handleMailConfirm(data, chatID); responseText == "" {
+			return
+		}
+	case data == "a_x":
+		responseText = "ℹ️ 已取消"
+	case strings.HasPrefix(data, "a_p:"):
+		// Ask for 推, 噓 or →
+		handlePushTypes(data, chatID)
+		return
+	case strings.HasPrefix(data, "a_t:"), strings.HasPrefix(data, "a_r:"):
+		// Ask for the comment or the reply as a reply to the prompt
+		if responseText = handleActionPrompt(data, chatID); responseText == "" {
+			return
+		}
+	case data == "a_m":
+		// Ask for the reply to a forwarded PTT mail
+		if responseText = handleInboxReply(chatID, update.CallbackQuery.Message.MessageID); responseText == "" {
+			return
+		}
+	case strings.HasPrefix(data, "a_c:"):
+		// Pushes and replies are sent by the mail worker as well
+		if responseText = handleActionConfirm(data, chatID); responseText == "" {
+			return
+		}
 	default:
 		responseText = command.HandleCommand(data, userID, true)
 	}
@@ -115,6 +145,7 @@ func handleCallbackQuery(update tgbotapi.Update) {
 // add - 新增看板關鍵字、作者、推文數
 // del - 刪除看板關鍵字、作者、推文數
 // bind - 綁定網頁帳號
+// mails - 寄信紀錄
 // showkeyboard - 顯示快捷小鍵盤
 // hidekeyboard - 隱藏快捷小鍵盤
 func handleCommand(update tgbotapi.Update) {
@@ -132,9 +163,9 @@ func handleCommand(update tgbotapi.Update) {
 		} else {
 			responseText = "歡迎使用 PTT Alertor！\n\n" +
 				"📌 如何開始：\n" +
-				"1. 前往網站註冊/登入\n" +
-				"2. 使用 /bind 綁定帳號\n\n" +
-				"🔗 網站：https://ptt.luan.com.tw\n\n" +
+				"1. 使用 /bind 建立帳號並綁定\n" +
+				"2. 以 Telegram 登入網站管理訂閱\n\n" +
+				"🔗 網站：" + siteURL + "\n\n" +
 				"輸入 /help 查看更多指令"
 		}
 	case "help":
@@ -152,6 +183,8 @@ func handleCommand(update tgbotapi.Update) {
 		}
 		// Has arguments - legacy bind code flow from Dashboard
 		responseText = handleBindCode(args, chatID)
+	case "mails":
+		responseText = mailHistory(chatID)
 	case "showkeyboard":
 		showReplyKeyboard(chatID)
 		return
@@ -167,8 +200,7 @@ func handleCommand(update tgbotapi.Update) {
 var bindingRepo = &binding.Postgres{}
 var accountRepo = &account.Postgres{}
 
-const waitingEmailPrefix = "telegram:waiting_email:"
-const waitingEmailExpiry = 300 // 5 minutes
+const siteURL = "https://ptt.luan.com.tw"
 
 // handleBindCode handles the /bind <code> command (legacy flow from Dashboard)
 func handleBindCode(args string, chatID int64) string {
@@ -210,161 +242,28 @@ func handleBindCode(args string, chatID int64) string {
 	return "綁定成功！您現在可以在網頁上管理訂閱，通知將發送到此 Telegram。"
 }
 
-// handleBindCommand handles /bind command - check if bound or ask for email
+// handleBindCommand handles /bind command without a code - report the
+// bound account, or create one bound to this chat to log in with Telegram
 func handleBindCommand(chatID int64) {
-	chatIDStr := strconv.FormatInt(chatID, 10)
-
-	// Check if already bound
-	existingBinding, err := bindingRepo.FindByServiceID(binding.ServiceTelegram, chatIDStr)
-	if err == nil && existingBinding != nil {
-		// Already bound - get account info
-		acc, err := accountRepo.FindByID(existingBinding.UserID)
-		if err == nil {
-			SendTextMessage(chatID, "✅ 已綁定帳號："+acc.Email)
-			return
-		}
-	}
-
-	// Not bound - ask for email
-	conn := connections.Redis()
-	defer conn.Close()
-
-	// Set waiting state in Redis
-	key := waitingEmailPrefix + chatIDStr
-	_, err = conn.Do("SETEX", key, waitingEmailExpiry, "1")
-	if err != nil {
-		log.WithError(err).Error("Failed to set waiting email state")
-		SendTextMessage(chatID, "發生錯誤，請稍後再試")
-		return
-	}
-
-	SendTextMessage(chatID, "請輸入您的 Email：")
-}
-
-// isWaitingForEmail checks if chatID is waiting for email input
-func isWaitingForEmail(chatID int64) bool {
-	conn := connections.Redis()
-	defer conn.Close()
-
-	key := waitingEmailPrefix + strconv.FormatInt(chatID, 10)
-	exists, err := redis.Bool(conn.Do("EXISTS", key))
+	acc, created, err := accountRepo.FindOrCreateByTelegram(strconv.FormatInt(chatID, 10))
 	if err != nil {
-		return false
-	}
-	return exists
-}
-
-// clearWaitingEmail clears the waiting email state
-func clearWaitingEmail(chatID int64) {
-	conn := connections.Redis()
-	defer conn.Close()
-
-	key := waitingEmailPrefix + strconv.FormatInt(chatID, 10)
-	conn.Do("DEL", key)
-}
-
-// handleEmailInput handles email input for registration and binding
-func handleEmailInput(chatID int64, email string) {
-	chatIDStr := strconv.FormatInt(chatID, 10)
-
-	// Clear waiting state
-	clearWaitingEmail(chatID)
-
-	// Validate email format
-	if !isValidEmail(email) {
-		SendTextMessage(chatID, "❌ Email 格式不正確，請重新輸入 /bind")
+		log.WithError(err).Error("Failed to find or create Telegram account")
+		SendTextMessage(chatID, "❌ 綁定失敗，請稍後再試")
 		return
 	}
 
-	const siteURL = "https://ptt.luan.com.tw"
-
-	// Check if email already registered
-	existingAcc, err := accountRepo.FindByEmail(email)
-	if err == nil && existingAcc != nil {
-		// Email exists - check if this account is already bound to another Telegram
-		existingBinding, _ := bindingRepo.FindByUserAndService(existingAcc.ID, binding.ServiceTelegram)
-		if existingBinding != nil && existingBinding.ServiceID != "" {
-			// Already bound to another Telegram
-			SendTextMessage(chatID, "❌ 此帳號已綁定其他 Telegram")
+	if !created {
+		if account.IsTelegramEmail(acc.Email) {
+			SendTextMessage(chatID, "✅ 已綁定 Telegram 帳號\n\n🔗 以 Telegram 登入網站管理訂閱："+siteURL)
 			return
 		}
-
-		// Account exists but not bound - bind it
-		SendTextMessage(chatID, "已有帳號，為您綁定中...")
-
-		// Create or update binding
-		if existingBinding != nil {
-			// Binding record exists but no service ID - update it
-			err = bindingRepo.ConfirmBinding(existingAcc.ID, binding.ServiceTelegram, chatIDStr)
-		} else {
-			// No binding record - create new
-			_, err = bindingRepo.Create(existingAcc.ID, binding.ServiceTelegram, chatIDStr)
-		}
-
-		if err != nil {
-			log.WithError(err).Error("Failed to bind existing account")
-			SendTextMessage(chatID, "❌ 綁定失敗，請稍後再試")
-			return
-		}
-
-		// Sync subscriptions to Redis
-		go (&account.RedisSync{}).SyncAllSubscriptions(existingAcc.ID)
-
-		SendTextMessage(chatID, "✅ 綁定成功！\n\n🔗 前往網站管理訂閱："+siteURL)
-		return
-	}
-
-	// New user - create account
-	password := generateRandomPassword()
-
-	// Hash password
-	passwordHash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	if err != nil {
-		log.WithError(err).Error("Failed to hash password")
-		SendTextMessage(chatID, "❌ 建立帳號失敗，請稍後再試")
-		return
-	}
-
-	// Create account
-	newAcc, err := accountRepo.Create(email, string(passwordHash), "user")
-	if err != nil {
-		log.WithError(err).Error("Failed to create account")
-		SendTextMessage(chatID, "❌ 建立帳號失敗，請稍後再試")
+		SendTextMessage(chatID, "✅ 已綁定帳號："+acc.Email)
 		return
 	}
 
-	// Create binding
-	_, err = bindingRepo.Create(newAcc.ID, binding.ServiceTelegram, chatIDStr)
-	if err != nil {
-		log.WithError(err).Error("Failed to create binding")
-		SendTextMessage(chatID, "❌ 綁定失敗，請稍後再試")
-		return
-	}
-
-	// Send success message
-	successMsg := "✅ 帳號建立成功！\n\n" +
-		"📧 Email: " + email + "\n" +
-		"🔑 臨時密碼: " + password + "\n\n" +
-		"⚠️ 請記得至網頁修改密碼\n" +
-		"🔗 " + siteURL
-	SendTextMessage(chatID, successMsg)
-}
-
-// isValidEmail validates email format
-func isValidEmail(email string) bool {
-	pattern := `^[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}$`
-	matched, _ := regexp.MatchString(pattern, email)
-	return matched
-}
-
-// generateRandomPassword generates a random 6-letter password
-func generateRandomPassword() string {
-	const letters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
-	result := make([]byte, 6)
-	for i := range result {
-		result[i] = letters[rand.Intn(len(letters))]
-	}
-	return string(result)
+	SendTextMessage(chatID, "✅ 帳號建立成功並已綁定！\n\n"+
+		"🔗 以 Telegram 登入網站管理訂閱："+siteURL+"\n\n"+
+		"若已有網站帳號，請先於網站產生綁定碼，再輸入 /bind <綁定碼>")
 }
 
 func handleText(update tgbotapi.Update) {
@@ -373,16 +272,17 @@ func handleText(update tgbotapi.Update) {
 	chatID := update.Message.Chat.ID
 	text := update.Message.Text
 
-	// Check if waiting for email input
-	if isWaitingForEmail(chatID) {
-		handleEmailInput(chatID, strings.TrimSpace(text))
-		return
-	}
-
 	if match, _ := regexp.MatchString("^(刪除|刪除作者)+\\s.*\\*+", text); match {
 		sendConfirmation(chatID, text)
 		return
 	}
+	if update.Message.ReplyToMessage != nil && handleActionInput(chatID, update.Message.ReplyToMessage.MessageID, text) {
+		return
+	}
+	if strings.TrimSpace(text) == "寄信紀錄" {
+		SendTextMessage(chatID, mailHistory(chatID))
+		return
+	}
 	responseText = command.HandleCommand(text, userID, true)
 	SendTextMessage(chatID, responseText)
 }
@@ -394,8 +294,7 @@ func sendConfirmation(chatID int64, cmd string) {
 			tgbotapi.NewInlineKeyboardButtonData("否", "CANCEL"),
 		))
 	msg := tgbotapi.NewMessage(chatID, "確定"+cmd+"？")
-	msg.ReplyMarkup = markup
-	_, err := bot.Send(msg)
+	_, err := sendWithKeyboard(msg, markup)
 	if err != nil {
 		log.WithError(err).Error("Telegram Send Confirmation Failed")
 	}
@@ -419,27 +318,29 @@ func sendTextMessage(chatID int64, text string) {
 	}
 }
 
-
 // MailButtonData contains data for mail button callback
 type MailButtonData struct {
 	UserID         int    `json:"u"` // User ID in PostgreSQL
 	SubscriptionID int    `json:"s"` // Subscription ID
 	ArticleAuthor  string `json:"a"` // PTT article author
+	ArticleCode    string `json:"c"` // PTT article code, e.g. M.1498563199.A.35C
 	ArticleIndex   int    `json:"i"` // 1-based index for display
+	Templates      int    `json:"t"` // Mail templates offered, more than one are picked from
 }
 
-// SendMessageWithMailButton sends message with mail buttons for multiple articles
-func SendMessageWithMailButton(chatID int64, text string, mailDataList []*MailButtonData) {
+// SendMessageWithPTTButtons sends message with mail, push and reply buttons
+// for multiple articles
+func SendMessageWithPTTButtons(chatID int64, text string, mailDataList []*MailButtonData, actionDataList []*ActionButtonData) {
 	for _, msg := range myutil.SplitTextByLineBreak(text, maxCharacters) {
-		if len(mailDataList) > 0 {
-			sendTextMessageWithMailButton(chatID, msg, mailDataList)
+		if len(mailDataList) > 0 || len(actionDataList) > 0 {
+			sendTextMessageWithPTTButtons(chatID, msg, mailDataList, actionDataList)
 		} else {
 			sendTextMessage(chatID, msg)
 		}
 	}
 }
 
-func sendTextMessageWithMailButton(chatID int64, text string, mailDataList []*MailButtonData) {
+func sendTextMessageWithPTTButtons(chatID int64, text string, mailDataList []*MailButtonData, actionDataList []*ActionButtonData) {
 	msg := tgbotapi.NewMessage(chatID, text)
 	msg.DisableWebPagePreview = true
 
@@ -452,26 +353,27 @@ func sendTextMessageWithMailButton(chatID int64, text string, mailDataList []*Ma
 
 	for i := 0; i < maxButtons; i++ {
 		mailData := mailDataList[i]
-		// Create callback data: m_p:<userID>:<subID>:<author>
-		callbackData := "m_p:" + strconv.Itoa(mailData.UserID) + ":" +
-			strconv.Itoa(mailData.SubscriptionID) + ":" + mailData.ArticleAuthor
-
-		// Check if callback data is within Telegram's limit (64 bytes)
-		if len(callbackData) <= 64 {
-			// Button text: multiple articles show "寄信給#N作者", single shows "寄信給作者"
-			var buttonText string
-			if len(mailDataList) > 1 {
-				buttonText = "📧 寄信給#" + strconv.Itoa(mailData.ArticleIndex) + "作者"
-			} else {
-				buttonText = "📧 寄信給作者"
-			}
-			buttons = append(buttons, tgbotapi.NewInlineKeyboardButtonData(buttonText, callbackData))
+		// Create callback data: m_p:<userID>:<subID>:<author>:<code>:<template>,
+		// or m_s:<userID>:<subID>:<author>:<code> to pick the template first
+		callbackData := "m_s:" + strconv.Itoa(mailData.UserID) + ":" +
+			strconv.Itoa(mailData.SubscriptionID) + ":" + mailData.ArticleAuthor + ":" + mailData.ArticleCode
+		if mailData.Templates <= 1 {
+			callbackData = "m_p:" + strings.TrimPrefix(callbackData, "m_s:") + ":0"
 		}
+
+		// Button text: multiple articles show "寄信給#N作者", single shows "寄信給作者"
+		var buttonText string
+		if len(mailDataList) > 1 {
+			buttonText = "📧 寄信給#" + strconv.Itoa(mailData.ArticleIndex) + "作者"
+		} else {
+			buttonText = "📧 寄信給作者"
+		}
+		buttons = append(buttons, tgbotapi.NewInlineKeyboardButtonData(buttonText, callbackData))
 	}
 
+	var rows [][]tgbotapi.InlineKeyboardButton
 	if len(buttons) > 0 {
 		// Create rows with 2 buttons each
-		var rows [][]tgbotapi.InlineKeyboardButton
 		for i := 0; i < len(buttons); i += 2 {
 			if i+1 < len(buttons) {
 				rows = append(rows, tgbotapi.NewInlineKeyboardRow(buttons[i], buttons[i+1]))
@@ -479,155 +381,137 @@ func sendTextMessageWithMailButton(chatID int64, text string, mailDataList []*Ma
 				rows = append(rows, tgbotapi.NewInlineKeyboardRow(buttons[i]))
 			}
 		}
-		msg.ReplyMarkup = tgbotapi.InlineKeyboardMarkup{InlineKeyboard: rows}
+	}
+	rows = append(rows, actionButtonRows(actionDataList)...)
+	if len(rows) > 0 {
+		// the alert goes out without buttons rather than not at all
+		if markup, err := sealKeyboard(chatID, tgbotapi.InlineKeyboardMarkup{InlineKeyboard: rows}); err != nil {
+			log.WithError(err).Error("Telegram Seal PTT Buttons Failed")
+		} else {
+			msg.ReplyMarkup = markup
+		}
 	}
 
 	_, err := bot.Send(msg)
 	if err != nil {
-		log.WithError(err).Error("Telegram Send Message With Mail Button Failed")
+		log.WithError(err).Error("Telegram Send Message With PTT Buttons Failed")
 	}
 }
 
 // handleMailPreview shows mail preview with confirm/cancel buttons
 func handleMailPreview(callbackData string, chatID int64) {
-	// Parse callback data: m_p:<userID>:<subID>:<author>
-	parts := strings.Split(callbackData, ":")
-	if len(parts) != 4 {
-		SendTextMessage(chatID, "❌ 無效的請求")
+	// Parse callback data: m_p:<userID>:<subID>:<author>:<code>:<template>
+	cb, errText := parseMailCallback(callbackData)
+	if errText != "" {
+		SendTextMessage(chatID, errText)
 		return
 	}
 
-	userID, err := strconv.Atoi(parts[1])
-	if err != nil {
-		SendTextMessage(chatID, "❌ 無效的使用者 ID")
-		return
-	}
-
-	subID, err := strconv.Atoi(parts[2])
-	if err != nil {
-		SendTextMessage(chatID, "❌ 無效的訂閱 ID")
-		return
-	}
-
-	recipient := parts[3]
-	if recipient == "" {
-		SendTextMessage(chatID, "❌ 無效的收件者")
+	sub, tmpl, errText := findMailTemplate(cb)
+	if errText != "" {
+		SendTextMessage(chatID, errText)
 		return
 	}
 
-	// Get subscription to get mail template
-	subRepo := &account.SubscriptionPostgres{}
-	sub, err := subRepo.FindByID(subID)
+	subject, content, err := tmpl.Render(mailData(cb, sub))
 	if err != nil {
-		log.WithError(err).Error("Failed to find subscription for mail preview")
-		SendTextMessage(chatID, "📭 找不到訂閱設定")
-		return
-	}
-
-	// Check ownership
-	if sub.UserID != userID {
-		SendTextMessage(chatID, "🚫 無權限使用此訂閱")
-		return
-	}
-
-	// Check mail template
-	if sub.Mail == nil || (sub.Mail.Subject == "" && sub.Mail.Content == "") {
-		SendTextMessage(chatID, "📝 此訂閱尚未設定信件模板")
+		log.WithError(err).Error("Failed to render mail template for preview")
+		SendTextMessage(chatID, "📝 信件模板格式錯誤，請重新設定")
 		return
 	}
 
 	// Build preview message
 	previewText := "📧 寄信預覽\n\n"
-	previewText += "收件人: " + recipient + "\n"
-	previewText += "標題: " + sub.Mail.Subject + "\n"
+	previewText += "收件人: " + cb.author + "\n"
+	previewText += "標題: " + subject + "\n"
 	previewText += "─────────────\n"
-	previewText += sub.Mail.Content
+	previewText += content
 
-	// Create confirm callback data: m_c:<userID>:<subID>:<author>
-	confirmData := "m_c:" + strconv.Itoa(userID) + ":" +
-		strconv.Itoa(subID) + ":" + recipient
+	// Create confirm callback data: m_c:<userID>:<subID>:<author>:<code>:<template>
+	confirmData := "m_c:" + strings.TrimPrefix(callbackData, "m_p:")
 
 	// Send preview with confirm/cancel buttons
 	msg := tgbotapi.NewMessage(chatID, previewText)
-	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+	markup := tgbotapi.NewInlineKeyboardMarkup(
 		tgbotapi.NewInlineKeyboardRow(
 			tgbotapi.NewInlineKeyboardButtonData("✅ 寄信", confirmData),
 			tgbotapi.NewInlineKeyboardButtonData("❌ 取消", "m_x"),
 		),
 	)
 
-	_, err = bot.Send(msg)
+	_, err = sendWithKeyboard(msg, markup)
 	if err != nil {
 		log.WithError(err).Error("Failed to send mail preview")
 	}
 }
 
-// handleMailConfirm handles the mail confirm button callback
+// handleMailConfirm queues the mail of the confirm button, it returns empty
+// when the queued message was sent
 func handleMailConfirm(callbackData string, chatID int64) string {
-	// Parse callback data: m_c:<userID>:<subID>:<author>
-	parts := strings.Split(callbackData, ":")
-	if len(parts) != 4 {
-		return "❌ 無效的請求"
+	// Parse callback data: m_c:<userID>:<subID>:<author>:<code>:<template>
+	cb, errText := parseMailCallback(callbackData)
+	if errText != "" {
+		return errText
 	}
+	userID, recipient := cb.userID, cb.author
 
-	userID, err := strconv.Atoi(parts[1])
-	if err != nil {
-		return "❌ 無效的使用者 ID"
+	sub, tmpl, errText := findMailTemplate(cb)
+	if errText != "" {
+		return errText
 	}
 
-	subID, err := strconv.Atoi(parts[2])
+	subject, content, err := tmpl.Render(mailData(cb, sub))
 	if err != nil {
-		return "❌ 無效的訂閱 ID"
+		log.WithError(err).Error("Failed to render mail template")
+		return "📝 信件模板格式錯誤，請重新設定"
 	}
 
-	recipient := parts[3]
-	if recipient == "" {
-		return "❌ 無效的收件者"
+	pttAccount, errText := pttActionAccount(userID)
+	if errText != "" {
+		return errText
 	}
 
-	// Get subscription to get mail template
-	subRepo := &account.SubscriptionPostgres{}
-	sub, err := subRepo.FindByID(subID)
-	if err != nil {
-		log.WithError(err).Error("Failed to find subscription for mail")
-		return "📭 找不到訂閱設定"
+	if errText := checkDuplicateMail(userID, recipient, cb.code); errText != "" {
+		return errText
 	}
 
-	// Check ownership
-	if sub.UserID != userID {
-		return "🚫 無權限使用此訂閱"
+	if res := ratelimit.Allow("ptt-mail", strconv.Itoa(userID), ratelimit.Configured("ptt-mail", pttMailLimit)); !res.Allowed {
+		return "⏳ 寄信過於頻繁，請於 " + strconv.Itoa(int(res.RetryAfter.Minutes())+1) + " 分鐘後再試"
 	}
 
-	// Check mail template
-	if sub.Mail == nil || (sub.Mail.Subject == "" && sub.Mail.Content == "") {
-		return "📝 此訂閱尚未設定信件模板"
-	}
-
-	// Get PTT credentials
-	pttRepo := &account.PTTAccountPostgres{}
-	pttUsername, pttPassword, err := pttRepo.GetCredentials(userID)
+	// Queue the mail, the worker edits this message with the result
+	messageID, err := sendTextMessageForID(chatID, "⏳ 已排入寄信佇列，寄給 "+recipient)
 	if err != nil {
-		if err == account.ErrPTTAccountNotFound {
-			return "⚠️ 尚未綁定 PTT 帳號"
-		}
-		log.WithError(err).Error("Failed to get PTT credentials")
-		return "❌ 取得 PTT 帳號失敗"
+		log.WithError(err).Error("Telegram Send Message Failed")
 	}
-
-	// Send PTT mail
-	mailClient := mail.NewPTTClient(pttUsername, pttPassword)
-	err = mailClient.SendMail(recipient, sub.Mail.Subject, sub.Mail.Content)
-	if err != nil {
+	subID := sub.ID
+	job := &pttmail.Job{
+		UserID:            userID,
+		SubscriptionID:    &subID,
+		PTTUsername:       pttAccount.PTTUsername,
+		Recipient:         recipient,
+		Subject:           subject,
+		Content:           content,
+		ArticleCode:       cb.code,
+		TelegramChatID:    chatID,
+		TelegramMessageID: messageID,
+	}
+	if err := mailJobRepo.Enqueue(job); err != nil {
+		// a tap racing this one queued it first
+		if errors.Is(err, pttmail.ErrMailPending) {
+			if messageID != 0 {
+				EditTextMessage(chatID, messageID, mailPendingText)
+				return ""
+			}
+			return mailPendingText
+		}
 		log.WithError(err).WithFields(log.Fields{
 			"user_id":   userID,
 			"recipient": recipient,
-		}).Error("Failed to send PTT mail")
-
-		if err == mail.ErrLoginFailed {
-			return "🔑 帳號密碼錯誤，請重新設定"
-		}
-		if err == mail.ErrUserNotFound {
-			return "👤 找不到此 PTT 使用者"
+		}).Error("Failed to queue PTT mail")
+		if messageID != 0 {
+			EditTextMessage(chatID, messageID, "❌ 寄信失敗，請稍後再試")
+			return ""
 		}
 		return "❌ 寄信失敗，請稍後再試"
 	}
@@ -635,10 +519,10 @@ func handleMailConfirm(callbackData string, chatID int64) string {
 	log.WithFields(log.Fields{
 		"user_id":   userID,
 		"recipient": recipient,
-		"subject":   sub.Mail.Subject,
-	}).Info("PTT mail sent successfully via Telegram button")
+		"job_id":    job.ID,
+	}).Info("PTT mail queued via Telegram button")
 
-	return "✅ 已成功寄信給 " + recipient
+	return ""
 }
 
 func showReplyKeyboard(chatID int64) {
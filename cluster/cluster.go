@@ -0,0 +1,291 @@
+package cluster
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"hash/fnv"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/Ptt-Alertor/logrus"
+	"github.com/gomodule/redigo/redis"
+
+	"github.com/Ptt-Alertor/ptt-alertor/connections"
+	"github.com/Ptt-Alertor/ptt-alertor/myutil"
+)
+
+const (
+	nodesKey  = "cluster:nodes"
+	leaderKey = "cluster:leader"
+	sentKey   = "cluster:sent:"
+
+	heartbeatInterval = 5 * time.Second
+	nodeTTL           = 15 * time.Second
+	leaseTTL          = 15 * time.Second
+	deliveryTTL       = 48 * time.Hour
+)
+
+var connectRedis = connections.Redis
+
+// renewScript extends the leader lease only when this node still holds it
+var renewScript = redis.NewScript(1, `
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0`)
+
+// releaseScript deletes the leader lease only when this node still holds it
+var releaseScript = redis.NewScript(1, `
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+
+// Node is a crawler instance coordinating with its peers through Redis.
+// When clustering is disabled it owns every board and is always the leader,
+// so a single instance behaves exactly as before.
+type Node struct {
+	ID      string
+	enabled bool
+
+	mu      sync.RWMutex
+	members []string
+	leader  bool
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+var self *Node
+var selfOnce sync.Once
+
+// Self returns the Node for this process, configured from CRAWLER_CLUSTER
+// and CRAWLER_NODE_ID
+func Self() *Node {
+	selfOnce.Do(func() {
+		self = NewNode(os.Getenv("CRAWLER_NODE_ID"), os.Getenv("CRAWLER_CLUSTER") == "true")
+	})
+	return self
+}
+
+// NewNode creates a Node, generating an ID from the hostname when id is empty
+func NewNode(id string, enabled bool) *Node {
+	if id == "" {
+		id = generateNodeID()
+	}
+	return &Node{
+		ID:      id,
+		enabled: enabled,
+		members: []string{id},
+		leader:  !enabled,
+	}
+}
+
+func generateNodeID() string {
+	host, _ := os.Hostname()
+	if host == "" {
+		host = "node"
+	}
+	b := make([]byte, 4)
+	rand.Read(b)
+	return host + "-" + hex.EncodeToString(b)
+}
+
+// Enabled reports whether the node coordinates with other instances
+func (n *Node) Enabled() bool {
+	return n.enabled
+}
+
+// Start registers the node and keeps its heartbeat and leader lease alive
+// until Stop is called
+func (n *Node) Start() {
+	if !n.enabled {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	n.cancel = cancel
+	n.done = make(chan struct{})
+	n.tick()
+	log.WithField("node", n.ID).Info("Cluster Node Started")
+
+	go func() {
+		defer close(n.done)
+		ticker := time.NewTicker(heartbeatInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				n.tick()
+			}
+		}
+	}()
+}
+
+// Stop leaves the cluster so peers can take over this node's boards right away
+func (n *Node) Stop() {
+	if !n.enabled || n.cancel == nil {
+		return
+	}
+	n.cancel()
+	<-n.done
+
+	conn := connectRedis()
+	defer conn.Close()
+	if _, err := conn.Do("ZREM", nodesKey, n.ID); err != nil {
+		log.WithField("runtime", myutil.BasicRuntimeInfo()).WithError(err).Error()
+	}
+	if _, err := releaseScript.Do(conn, leaderKey, n.ID); err != nil {
+		log.WithField("runtime", myutil.BasicRuntimeInfo()).WithError(err).Error()
+	}
+	log.WithField("node", n.ID).Info("Cluster Node Stopped")
+}
+
+// tick sends a heartbeat, refreshes the member list and renews or acquires the lease
+func (n *Node) tick() {
+	conn := connectRedis()
+	defer conn.Close()
+
+	members, err := n.heartbeat(conn)
+	if err != nil {
+		log.WithField("runtime", myutil.BasicRuntimeInfo()).WithError(err).Error("Cluster Heartbeat Failed")
+	} else {
+		n.setMembers(members)
+	}
+
+	leader, err := n.elect(conn)
+	if err != nil {
+		log.WithField("runtime", myutil.BasicRuntimeInfo()).WithError(err).Error("Cluster Election Failed")
+	}
+	n.setLeader(leader)
+}
+
+func (n *Node) heartbeat(conn redis.Conn) ([]string, error) {
+	now := time.Now()
+	if _, err := conn.Do("ZADD", nodesKey, now.UnixMilli(), n.ID); err != nil {
+		return nil, err
+	}
+	expired := now.Add(-nodeTTL).UnixMilli()
+	if _, err := conn.Do("ZREMRANGEBYSCORE", nodesKey, "-inf", "("+strconv.FormatInt(expired, 10)); err != nil {
+		return nil, err
+	}
+	return redis.Strings(conn.Do("ZRANGE", nodesKey, 0, -1))
+}
+
+func (n *Node) elect(conn redis.Conn) (bool, error) {
+	ttl := leaseTTL.Milliseconds()
+	renewed, err := redis.Int(renewScript.Do(conn, leaderKey, n.ID, ttl))
+	if err != nil {
+		return false, err
+	}
+	if renewed == 1 {
+		return true, nil
+	}
+	_, err = redis.String(conn.Do("SET", leaderKey, n.ID, "NX", "PX", ttl))
+	if err == redis.ErrNil {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (n *Node) setMembers(members []string) {
+	sort.Strings(members)
+	n.mu.Lock()
+	changed := !equalStrings(n.members, members)
+	n.members = members
+	n.mu.Unlock()
+	if changed {
+		log.WithFields(log.Fields{
+			"node":    n.ID,
+			"members": members,
+		}).Info("Cluster Membership Changed")
+	}
+}
+
+func (n *Node) setLeader(leader bool) {
+	n.mu.Lock()
+	changed := n.leader != leader
+	n.leader = leader
+	n.mu.Unlock()
+	if changed {
+		log.WithFields(log.Fields{
+			"node":   n.ID,
+			"leader": leader,
+		}).Info("Cluster Leadership Changed")
+	}
+}
+
+// Members returns the live node IDs as of the last heartbeat
+func (n *Node) Members() []string {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return append([]string(nil), n.members...)
+}
+
+// IsLeader reports whether this node holds the leader lease
+func (n *Node) IsLeader() bool {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return n.leader
+}
+
+// Owns reports whether this node is responsible for key (a board name or
+// article code). Ownership uses rendezvous hashing over live members, so when
+// a node joins or dies only its share of keys moves.
+func (n *Node) Owns(key string) bool {
+	if !n.enabled {
+		return true
+	}
+	return Owner(key, n.Members()) == n.ID
+}
+
+// Owner picks the member responsible for key
+func Owner(key string, members []string) string {
+	var owner string
+	var max uint64
+	for _, m := range members {
+		h := fnv.New64a()
+		h.Write([]byte(m))
+		h.Write([]byte{0})
+		h.Write([]byte(key))
+		if score := h.Sum64(); owner == "" || score > max {
+			owner, max = m, score
+		}
+	}
+	return owner
+}
+
+// ClaimDelivery records that account is being alerted about article and
+// reports whether the caller is the first to claim it. It prevents duplicate
+// alerts when several checkers or instances match the same article.
+func ClaimDelivery(account, article string) bool {
+	conn := connectRedis()
+	defer conn.Close()
+
+	_, err := redis.String(conn.Do("SET", sentKey+account+":"+article, 1, "NX", "EX", int(deliveryTTL.Seconds())))
+	if err == redis.ErrNil {
+		return false
+	}
+	if err != nil {
+		// fail open: a duplicate alert beats a missing one
+		log.WithField("runtime", myutil.BasicRuntimeInfo()).WithError(err).Error()
+	}
+	return true
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
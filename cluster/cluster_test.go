@@ -0,0 +1,123 @@
+package cluster
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gomodule/redigo/redis"
+)
+
+var s *miniredis.Miniredis
+
+func TestMain(m *testing.M) {
+	var err error
+	s, err = miniredis.Run()
+	if err != nil {
+		panic(err)
+	}
+
+	connectRedis = func() redis.Conn {
+		conn, err := redis.Dial("tcp", s.Addr())
+		if err != nil {
+			panic(err)
+		}
+		return conn
+	}
+
+	v := m.Run()
+
+	s.Close()
+	os.Exit(v)
+}
+
+func TestOwner(t *testing.T) {
+	members := []string{"a", "b", "c"}
+	boards := []string{"Gossiping", "Stock", "Lifeismoney", "movie", "C_Chat", "Beauty", "HardwareSale", "Tech_Job"}
+
+	owned := map[string]int{}
+	for _, board := range boards {
+		owner := Owner(board, members)
+		if owner == "" {
+			t.Fatalf("Owner(%s) is empty", board)
+		}
+		if again := Owner(board, []string{"c", "a", "b"}); again != owner {
+			t.Errorf("Owner(%s) depends on member order: %s != %s", board, again, owner)
+		}
+		owned[owner]++
+	}
+
+	// removing a node only moves the boards it owned
+	for _, board := range boards {
+		before := Owner(board, members)
+		after := Owner(board, []string{"a", "b"})
+		if before != "c" && before != after {
+			t.Errorf("Owner(%s) moved from %s to %s", board, before, after)
+		}
+	}
+}
+
+func TestNode_Owns(t *testing.T) {
+	tests := []struct {
+		name    string
+		node    *Node
+		members []string
+		key     string
+		want    bool
+	}{
+		{"disabled owns everything", NewNode("a", false), nil, "Gossiping", true},
+		{"single member", NewNode("a", true), []string{"a"}, "Gossiping", true},
+		{"other member", NewNode("a", true), []string{"a", "b"}, "Gossiping", Owner("Gossiping", []string{"a", "b"}) == "a"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.members != nil {
+				tt.node.setMembers(tt.members)
+			}
+			if got := tt.node.Owns(tt.key); got != tt.want {
+				t.Errorf("Node.Owns() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNode_tick(t *testing.T) {
+	s.FlushAll()
+	a := NewNode("a", true)
+	b := NewNode("b", true)
+
+	a.tick()
+	b.tick()
+	if !a.IsLeader() || b.IsLeader() {
+		t.Fatalf("leader a = %v, b = %v, want only a", a.IsLeader(), b.IsLeader())
+	}
+	a.tick()
+	if got := a.Members(); len(got) != 2 {
+		t.Errorf("Members() = %v, want [a b]", got)
+	}
+
+	// a stops heartbeating: its node entry and lease expire, b takes over
+	s.FastForward(leaseTTL + time.Second)
+	s.ZAdd(nodesKey, float64(time.Now().Add(-2*nodeTTL).UnixMilli()), "a")
+	b.tick()
+	if !b.IsLeader() {
+		t.Errorf("b should take over leadership")
+	}
+	if got := b.Members(); len(got) != 1 || got[0] != "b" {
+		t.Errorf("Members() = %v, want [b]", got)
+	}
+}
+
+func TestClaimDelivery(t *testing.T) {
+	s.FlushAll()
+	if !ClaimDelivery("web_1", "M.1.A.1") {
+		t.Errorf("first claim should succeed")
+	}
+	if ClaimDelivery("web_1", "M.1.A.1") {
+		t.Errorf("second claim should fail")
+	}
+	if !ClaimDelivery("web_2", "M.1.A.1") {
+		t.Errorf("claim for another user should succeed")
+	}
+}
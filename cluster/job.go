@@ -0,0 +1,28 @@
+package cluster
+
+import (
+	log "github.com/Ptt-Alertor/logrus"
+)
+
+// Job is anything runnable by the scheduler
+type Job interface {
+	Run()
+}
+
+type leaderJob struct {
+	job  Job
+	node *Node
+}
+
+// LeaderOnly wraps a scheduled job so that it only runs on the leader node
+func LeaderOnly(job Job) Job {
+	return leaderJob{job: job, node: Self()}
+}
+
+func (lj leaderJob) Run() {
+	if !lj.node.IsLeader() {
+		log.WithField("node", lj.node.ID).Debug("Skip Job on Follower Node")
+		return
+	}
+	lj.job.Run()
+}
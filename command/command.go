@@ -12,11 +12,17 @@ import (
 	"github.com/Ptt-Alertor/ptt-alertor/models/account"
 	"github.com/Ptt-Alertor/ptt-alertor/models/article"
 	"github.com/Ptt-Alertor/ptt-alertor/models/top"
+	"github.com/Ptt-Alertor/ptt-alertor/preview"
 	"github.com/Ptt-Alertor/ptt-alertor/ptt/web"
+	"github.com/Ptt-Alertor/ptt-alertor/ratelimit"
 )
 
 const subArticlesLimit int = 50
+const previewArticlesLimit int = 5
 const updateFailedMsg string = "失敗，請嘗試封鎖再解封鎖，並重新執行註冊步驟。\n若問題未解決，請至粉絲團或 LINE 首頁留言。"
+const emailNotVerifiedMsg string = "請先至網站完成電子郵件驗證，才能新增訂閱。"
+const boardLimitMsg string = "已達看板數量上限"
+const regexNotAllowedMsg string = "您的角色未開放正規表示式關鍵字"
 
 var subscriptionRepo = &account.SubscriptionPostgres{}
 var accountRepoCmd = &account.Postgres{}
@@ -84,6 +90,15 @@ var Commands = []CommandCategory{
 			{"範例", "新增推文 https://www.ptt.cc/bbs/EZsoft/M.1497363598.A.74E.html"},
 		},
 	},
+	{
+		Name: "試算",
+		Items: []CommandItem{
+			{"試算 看板 關鍵字", "用近期文章試算關鍵字會通知幾則"},
+			{"試算作者 看板 作者", "試算作者訂閱"},
+			{"試算(推/噓)文數 看板 總數", "試算推噓文數訂閱"},
+			{"範例", "試算 gossiping 金城武"},
+		},
+	},
 	{
 		Name: "進階應用",
 		Items: []CommandItem{
@@ -184,6 +199,24 @@ func HandleCommand(text string, userID string, isUser bool) string {
 			return err.Error()
 		}
 		return result
+	case "試算", "試算作者", "試算推文數", "試算噓文數":
+		re := regexp.MustCompile("^(試算|試算作者|試算推文數|試算噓文數)\\s+([\\w-_\\.]+):?\\s+(.*[^\\s])$")
+		if matched := re.MatchString(text); !matched {
+			errorTips := []string{
+				"指令格式錯誤。",
+				"1. 需以空白分隔動作、板名、參數",
+				"2. 一次只能試算一個看板",
+				"正確範例：",
+				command + " gossiping 問卦",
+			}
+			return strings.Join(errorTips, "\n")
+		}
+		args := re.FindStringSubmatch(text)
+		result, err := handlePreview(command, userID, args[2], args[3])
+		if err != nil {
+			return err.Error()
+		}
+		return result
 	case "清理推文":
 		return cleanCommentList(userID)
 	case "推文清單":
@@ -362,6 +395,15 @@ func handleKeyword(command, chatID, boardStr, keywordStr string) (string, error)
 					if errors.Is(err, account.ErrSubscriptionLimitReached) {
 						return "", errors.New("已達訂閱上限")
 					}
+					if errors.Is(err, account.ErrBoardLimitReached) {
+						return "", errors.New(boardLimitMsg)
+					}
+					if errors.Is(err, account.ErrRegexNotAllowed) {
+						return "", errors.New(regexNotAllowedMsg)
+					}
+					if errors.Is(err, account.ErrEmailNotVerified) {
+						return "", errors.New(emailNotVerifiedMsg)
+					}
 					log.WithError(err).Error("Keyword Create Failed")
 					return "", errors.New(command + updateFailedMsg)
 				}
@@ -439,6 +481,12 @@ func handleAuthor(command, chatID, boardStr, authorStr string) (string, error) {
 					if errors.Is(err, account.ErrSubscriptionLimitReached) {
 						return "", errors.New("已達訂閱上限")
 					}
+					if errors.Is(err, account.ErrBoardLimitReached) {
+						return "", errors.New(boardLimitMsg)
+					}
+					if errors.Is(err, account.ErrEmailNotVerified) {
+						return "", errors.New(emailNotVerifiedMsg)
+					}
 					log.WithError(err).Error("Author Create Failed")
 					return "", errors.New(command + updateFailedMsg)
 				}
@@ -532,6 +580,12 @@ func handlePushSum(command, chatID, boardStr, sumStr string) (string, error) {
 				if errors.Is(err, account.ErrSubscriptionLimitReached) {
 					return "", errors.New("已達訂閱上限")
 				}
+				if errors.Is(err, account.ErrBoardLimitReached) {
+					return "", errors.New(boardLimitMsg)
+				}
+				if errors.Is(err, account.ErrEmailNotVerified) {
+					return "", errors.New(emailNotVerifiedMsg)
+				}
 				log.WithError(err).Error("PushSum Create Failed")
 				return "", errors.New(command + updateFailedMsg)
 			}
@@ -551,6 +605,81 @@ func handlePushSum(command, chatID, boardStr, sumStr string) (string, error) {
 	return command + "成功", nil
 }
 
+// handlePreview crawls the board's latest pages, at most preview.Limit
+// times per account
+func handlePreview(command, userID, boardName, value string) (string, error) {
+	subType := "keyword"
+	switch command {
+	case "試算作者":
+		subType = "author"
+	case "試算推文數":
+		subType = "pushsum"
+		value = strings.TrimLeft(value, "+-")
+	case "試算噓文數":
+		subType = "pushsum"
+		value = "-" + strings.TrimLeft(value, "+-")
+	}
+
+	if subType == "keyword" && strings.HasPrefix(value, "regexp:") {
+		if err := checkRegexAllowed(userID); err != nil {
+			return "", err
+		}
+	}
+
+	if res := ratelimit.Allow("preview", userID, ratelimit.Configured("preview", preview.Limit)); !res.Allowed {
+		return "", fmt.Errorf("試算過於頻繁，請於 %d 分鐘後再試。", int(res.RetryAfter.Minutes())+1)
+	}
+
+	result, err := preview.Run(preview.Request{Board: boardName, SubType: subType, Value: value})
+	if err != nil {
+		switch err {
+		case preview.ErrInvalidValue:
+			return "", errors.New("試算內容格式錯誤，推噓文數需為 1-100 的數字，正規表示式需可編譯。")
+		case preview.ErrBoardNotFound:
+			return "", errors.New("板名錯誤，請確認拼字。")
+		}
+		log.WithError(err).Error("Preview Failed")
+		return "", errors.New("試算失敗，請稍後再試。")
+	}
+
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("試算 %s %s\n", boardName, value))
+	b.WriteString(fmt.Sprintf("近 %.1f 天共 %d 篇文章，符合 %d 篇\n", result.Days, result.Scanned, result.Matched))
+	b.WriteString(fmt.Sprintf("預估每天通知 %.1f 則", result.AlertsPerDay))
+	for i, m := range result.Articles {
+		if i == previewArticlesLimit {
+			break
+		}
+		b.WriteString("\n\n" + m.Title + "\n" + m.Link)
+	}
+	return b.String(), nil
+}
+
+// checkRegexAllowed checks the role of the chat's account may use regexp
+// keywords, as saving the subscription would
+func checkRegexAllowed(chatID string) error {
+	userID, err := account.GetUserIDByTelegramChatID(chatID)
+	if err != nil {
+		if errors.Is(err, account.ErrUserNotBound) {
+			return errors.New("請先綁定帳號，輸入 /bind")
+		}
+		return errors.New("取得用戶資料失敗")
+	}
+	acc, err := accountRepoCmd.FindByID(userID)
+	if err != nil {
+		return errors.New("取得帳號資料失敗")
+	}
+	granted, err := (&account.RoleLimitPostgres{}).Can(acc.Role, account.PermRegexKeywords)
+	if err != nil {
+		log.WithError(err).Error("Check Role Permission Failed")
+		return errors.New("試算失敗，請稍後再試。")
+	}
+	if !granted {
+		return errors.New(regexNotAllowedMsg)
+	}
+	return nil
+}
+
 func handleComment(command, chatID, boardName, articleCode string) (string, error) {
 	// Get PostgreSQL userID from chatID
 	userID, err := account.GetUserIDByTelegramChatID(chatID)
@@ -592,6 +721,9 @@ func handleComment(command, chatID, boardName, articleCode string) (string, erro
 			if errors.Is(err, account.ErrSubscriptionExists) {
 				return "", errors.New("已追蹤此文章")
 			}
+			if errors.Is(err, account.ErrEmailNotVerified) {
+				return "", errors.New(emailNotVerifiedMsg)
+			}
 			log.WithError(err).Error("Article Create Failed")
 			return "", errors.New(command + updateFailedMsg)
 		}
@@ -8,7 +8,10 @@ import (
 	"github.com/Ptt-Alertor/ptt-alertor/auth"
 	"github.com/Ptt-Alertor/ptt-alertor/jobs"
 	"github.com/Ptt-Alertor/ptt-alertor/models/account"
+	"github.com/Ptt-Alertor/ptt-alertor/models/audit"
 	"github.com/Ptt-Alertor/ptt-alertor/models/stats"
+	pttHttp "github.com/Ptt-Alertor/ptt-alertor/ptt/http"
+	"github.com/Ptt-Alertor/ptt-alertor/ratelimit"
 	"github.com/julienschmidt/httprouter"
 )
 
@@ -98,9 +101,22 @@ func AdminUpdateUser(w http.ResponseWriter, r *http.Request, ps httprouter.Param
 	}
 
 	// Validate role
-	validRoles := map[string]bool{"admin": true, "user": true}
-	if !validRoles[req.Role] {
-		writeJSON(w, http.StatusBadRequest, ErrorResponse{Success: false, Message: "無效的角色，必須是 admin 或 user"})
+	if _, err := roleLimitRepo.FindByRole(req.Role); err != nil {
+		if err == account.ErrRoleLimitNotFound {
+			writeJSON(w, http.StatusBadRequest, ErrorResponse{Success: false, Message: "無效的角色"})
+			return
+		}
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Success: false, Message: "查詢角色失敗"})
+		return
+	}
+
+	acc, err := accountRepo.FindByID(id)
+	if err != nil {
+		if err == account.ErrAccountNotFound {
+			writeJSON(w, http.StatusNotFound, ErrorResponse{Success: false, Message: "找不到用戶"})
+			return
+		}
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Success: false, Message: "取得用戶失敗"})
 		return
 	}
 
@@ -109,6 +125,17 @@ func AdminUpdateUser(w http.ResponseWriter, r *http.Request, ps httprouter.Param
 		return
 	}
 
+	recordAudit(r, auth.GetUserFromContext(r.Context()), audit.ActionUserUpdate, audit.TargetUser, id,
+		UpdateUserRequest{Role: acc.Role, Enabled: acc.Enabled}, req)
+
+	// Disabled users and role changes need a fresh login
+	if !req.Enabled || req.Role != acc.Role {
+		if err := sessionRepo.RevokeAll(id, ""); err != nil {
+			writeJSON(w, http.StatusInternalServerError, ErrorResponse{Success: false, Message: "登出用戶失敗"})
+			return
+		}
+	}
+
 	writeJSON(w, http.StatusOK, SuccessResponse{Success: true, Message: "用戶已更新"})
 }
 
@@ -123,11 +150,16 @@ func AdminDeleteUser(w http.ResponseWriter, r *http.Request, ps httprouter.Param
 	// Get account for Redis cleanup before deleting
 	acc, _ := accountRepo.FindByID(id)
 
+	// Reject the user's access tokens right away
+	sessionRepo.RevokeAll(id, "")
+
 	if err := accountRepo.Delete(id); err != nil {
 		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Success: false, Message: "刪除用戶失敗"})
 		return
 	}
 
+	recordAudit(r, auth.GetUserFromContext(r.Context()), audit.ActionUserDelete, audit.TargetUser, id, acc, nil)
+
 	// Sync to Redis (remove user data)
 	if acc != nil {
 		go redisSync.SyncUserDelete(acc)
@@ -167,6 +199,8 @@ func AdminBroadcast(w http.ResponseWriter, r *http.Request, _ httprouter.Params)
 		return
 	}
 
+	recordAudit(r, auth.GetUserFromContext(r.Context()), audit.ActionBroadcast, audit.TargetBroadcast, "", nil, req)
+
 	writeJSON(w, http.StatusOK, SuccessResponse{Success: true, Message: "廣播已發送"})
 }
 
@@ -178,11 +212,16 @@ func AdminLogin(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 		return
 	}
 
+	lockoutKey := loginLockoutKey(req.Email)
+	if !checkLockout(w, lockoutKey) {
+		return
+	}
+
 	// Find account
 	acc, err := accountRepo.FindByEmail(req.Email)
 	if err != nil {
 		if err == account.ErrAccountNotFound {
-			writeJSON(w, http.StatusUnauthorized, ErrorResponse{Success: false, Message: "電子郵件或密碼錯誤"})
+			failAttempt(w, lockoutKey, http.StatusUnauthorized, "電子郵件或密碼錯誤")
 			return
 		}
 		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Success: false, Message: "查詢帳號失敗"})
@@ -195,26 +234,25 @@ func AdminLogin(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 		return
 	}
 
-	// Check if account is admin
-	if acc.Role != "admin" {
+	// Check if the account's role has any admin panel
+	admin, err := roleLimitRepo.HasAdminAccess(acc.Role)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Success: false, Message: "查詢角色失敗"})
+		return
+	}
+	if !admin {
 		writeJSON(w, http.StatusForbidden, ErrorResponse{Success: false, Message: "權限不足"})
 		return
 	}
 
 	// Check password
 	if !auth.CheckPassword(req.Password, acc.Password) {
-		writeJSON(w, http.StatusUnauthorized, ErrorResponse{Success: false, Message: "電子郵件或密碼錯誤"})
+		failAttempt(w, lockoutKey, http.StatusUnauthorized, "電子郵件或密碼錯誤")
 		return
 	}
+	ratelimit.Reset(lockoutKey)
 
-	// Generate token
-	token, err := auth.GenerateToken(acc.ID, acc.Email, acc.Role)
-	if err != nil {
-		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Success: false, Message: "產生令牌失敗"})
-		return
-	}
-
-	writeJSON(w, http.StatusOK, TokenResponse{Token: token})
+	completeLogin(w, r, acc)
 }
 
 // AdminInit returns admin dashboard statistics
@@ -227,3 +265,11 @@ func AdminInit(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 
 	writeJSON(w, http.StatusOK, response)
 }
+
+// AdminProxyStats returns per-proxy success/error counts and the PTT backoff state
+func AdminProxyStats(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"proxies":         pttHttp.Stats(),
+		"backoff_seconds": int(pttHttp.Backoff().Seconds()),
+	})
+}
@@ -0,0 +1,124 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/Ptt-Alertor/ptt-alertor/auth"
+	"github.com/Ptt-Alertor/ptt-alertor/models/archive"
+	"github.com/Ptt-Alertor/ptt-alertor/models/audit"
+	"github.com/julienschmidt/httprouter"
+)
+
+var archiveRepo = &archive.Postgres{}
+
+// maxSearchLimit caps the page size of article search
+const maxSearchLimit = 100
+
+// SetArchivePolicyRequest represents a board retention policy update
+type SetArchivePolicyRequest struct {
+	RetentionDays int  `json:"retention_days"`
+	StoreBody     bool `json:"store_body"`
+}
+
+// SearchArticles searches archived articles (public)
+func SearchArticles(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	q := r.URL.Query()
+
+	query := archive.SearchQuery{
+		Q:      q.Get("q"),
+		Body:   q.Get("body") == "true",
+		Board:  q.Get("board"),
+		Author: q.Get("author"),
+		From:   q.Get("from"),
+		To:     q.Get("to"),
+		Page:   1,
+		Limit:  20,
+	}
+
+	if p := q.Get("page"); p != "" {
+		if parsed, err := strconv.Atoi(p); err == nil && parsed > 0 {
+			query.Page = parsed
+		}
+	}
+
+	if l := q.Get("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 {
+			query.Limit = min(parsed, maxSearchLimit)
+		}
+	}
+
+	result, err := archiveRepo.Search(query)
+	if err != nil {
+		switch err {
+		case archive.ErrInvalidDate:
+			writeJSON(w, http.StatusBadRequest, ErrorResponse{Success: false, Message: "日期格式錯誤，請使用 YYYY-MM-DD"})
+			return
+		case archive.ErrNoSearchFilter:
+			writeJSON(w, http.StatusBadRequest, ErrorResponse{Success: false, Message: "請輸入關鍵字、看板或作者"})
+			return
+		case archive.ErrTooManyTerms:
+			writeJSON(w, http.StatusBadRequest, ErrorResponse{Success: false, Message: "關鍵字最多 " + strconv.Itoa(archive.MaxSearchTerms) + " 個"})
+			return
+		case archive.ErrPageTooDeep:
+			writeJSON(w, http.StatusBadRequest, ErrorResponse{Success: false, Message: "頁碼最多 " + strconv.Itoa(archive.MaxSearchPage) + "，請縮小搜尋範圍"})
+			return
+		}
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Success: false, Message: "搜尋文章失敗"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
+
+// AdminListArchivePolicies returns all board retention policies (admin only)
+func AdminListArchivePolicies(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	policies, err := archiveRepo.ListPolicies()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Success: false, Message: "取得保存設定失敗"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, policies)
+}
+
+// AdminSetArchivePolicy creates or updates a board retention policy (admin only)
+func AdminSetArchivePolicy(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	var req SetArchivePolicyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Success: false, Message: "無效的請求內容"})
+		return
+	}
+
+	policy := &archive.Policy{
+		Board:         ps.ByName("board"),
+		RetentionDays: req.RetentionDays,
+		StoreBody:     req.StoreBody,
+	}
+	if err := archiveRepo.SetPolicy(policy); err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Success: false, Message: "更新保存設定失敗"})
+		return
+	}
+
+	recordAudit(r, auth.GetUserFromContext(r.Context()), audit.ActionArchivePolicySet, audit.TargetArchivePolicy, policy.Board, nil, policy)
+
+	writeJSON(w, http.StatusOK, policy)
+}
+
+// AdminDeleteArchivePolicy removes a board retention policy (admin only)
+func AdminDeleteArchivePolicy(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	err := archiveRepo.DeletePolicy(ps.ByName("board"))
+	if err != nil {
+		if err == archive.ErrPolicyNotFound {
+			writeJSON(w, http.StatusNotFound, ErrorResponse{Success: false, Message: "找不到保存設定"})
+			return
+		}
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Success: false, Message: "刪除保存設定失敗"})
+		return
+	}
+
+	recordAudit(r, auth.GetUserFromContext(r.Context()), audit.ActionArchivePolicyDelete, audit.TargetArchivePolicy, ps.ByName("board"), nil, nil)
+
+	writeJSON(w, http.StatusOK, SuccessResponse{Success: true, Message: "保存設定已刪除"})
+}
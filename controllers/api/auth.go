@@ -5,11 +5,15 @@ import (
 	"net/http"
 	"os"
 	"regexp"
+	"strconv"
 	"time"
 
+	log "github.com/Ptt-Alertor/logrus"
 	"github.com/Ptt-Alertor/ptt-alertor/auth"
 	"github.com/Ptt-Alertor/ptt-alertor/models/account"
+	"github.com/Ptt-Alertor/ptt-alertor/models/audit"
 	"github.com/Ptt-Alertor/ptt-alertor/models/binding"
+	"github.com/Ptt-Alertor/ptt-alertor/ratelimit"
 	"github.com/julienschmidt/httprouter"
 )
 
@@ -30,7 +34,9 @@ type LoginRequest struct {
 
 // TokenResponse represents a token response
 type TokenResponse struct {
-	Token string `json:"token"`
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"`
 }
 
 // SuccessResponse represents a success response
@@ -66,8 +72,8 @@ func Register(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 		return
 	}
 
-	// Validate email
-	if !isValidEmail(req.Email) {
+	// Validate email; placeholder addresses are reserved for Telegram accounts
+	if !isValidEmail(req.Email) || account.IsTelegramEmail(req.Email) {
 		writeJSON(w, http.StatusBadRequest, ErrorResponse{Success: false, Message: "無效的電子郵件格式"})
 		return
 	}
@@ -86,7 +92,7 @@ func Register(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	}
 
 	// Create account
-	_, err = accountRepo.Create(req.Email, hash, "user")
+	acc, err := accountRepo.Create(req.Email, hash, "user")
 	if err != nil {
 		if err == account.ErrEmailExists {
 			writeJSON(w, http.StatusConflict, ErrorResponse{Success: false, Message: "電子郵件已存在"})
@@ -96,7 +102,14 @@ func Register(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 		return
 	}
 
-	writeJSON(w, http.StatusCreated, SuccessResponse{Success: true, Message: "註冊成功"})
+	// Send verification email
+	go func() {
+		if err := sendVerificationEmail(acc); err != nil {
+			log.WithError(err).Error("Send Verification Email Failed")
+		}
+	}()
+
+	writeJSON(w, http.StatusCreated, SuccessResponse{Success: true, Message: "註冊成功，請至信箱完成驗證"})
 }
 
 // Login handles user login
@@ -107,11 +120,16 @@ func Login(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 		return
 	}
 
+	lockoutKey := loginLockoutKey(req.Email)
+	if !checkLockout(w, lockoutKey) {
+		return
+	}
+
 	// Find account
 	acc, err := accountRepo.FindByEmail(req.Email)
 	if err != nil {
 		if err == account.ErrAccountNotFound {
-			writeJSON(w, http.StatusUnauthorized, ErrorResponse{Success: false, Message: "電子郵件或密碼錯誤"})
+			failAttempt(w, lockoutKey, http.StatusUnauthorized, "電子郵件或密碼錯誤")
 			return
 		}
 		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Success: false, Message: "查詢帳號失敗"})
@@ -126,28 +144,105 @@ func Login(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 
 	// Check password
 	if !auth.CheckPassword(req.Password, acc.Password) {
-		writeJSON(w, http.StatusUnauthorized, ErrorResponse{Success: false, Message: "電子郵件或密碼錯誤"})
+		failAttempt(w, lockoutKey, http.StatusUnauthorized, "電子郵件或密碼錯誤")
+		return
+	}
+	ratelimit.Reset(lockoutKey)
+
+	completeLogin(w, r, acc)
+}
+
+// TelegramLoginRequest carries either Login Widget fields or Mini App
+// initData
+type TelegramLoginRequest struct {
+	InitData  string `json:"init_data"`
+	ID        int64  `json:"id"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Username  string `json:"username"`
+	PhotoURL  string `json:"photo_url"`
+	AuthDate  int64  `json:"auth_date"`
+	Hash      string `json:"hash"`
+}
+
+// widgetFields returns the fields Telegram signed; empty ones are omitted
+// by the widget and so are left out of the check too
+func (req TelegramLoginRequest) widgetFields() map[string]string {
+	fields := map[string]string{
+		"id":        strconv.FormatInt(req.ID, 10),
+		"auth_date": strconv.FormatInt(req.AuthDate, 10),
+		"hash":      req.Hash,
+	}
+	for k, v := range map[string]string{
+		"first_name": req.FirstName,
+		"last_name":  req.LastName,
+		"username":   req.Username,
+		"photo_url":  req.PhotoURL,
+	} {
+		if v != "" {
+			fields[k] = v
+		}
+	}
+	return fields
+}
+
+// TelegramLogin logs in the account bound to a Telegram user, creating and
+// binding one on first login
+func TelegramLogin(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	var req TelegramLoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Success: false, Message: "無效的請求內容"})
+		return
+	}
+
+	botToken := os.Getenv("TELEGRAM_TOKEN")
+	var user *auth.TelegramUser
+	var err error
+	if req.InitData != "" {
+		user, err = auth.VerifyTelegramInitData(req.InitData, botToken)
+	} else {
+		user, err = auth.VerifyTelegramLogin(req.widgetFields(), botToken)
+	}
+	if err != nil {
+		if err == auth.ErrTelegramExpired {
+			writeJSON(w, http.StatusUnauthorized, ErrorResponse{Success: false, Message: "Telegram 登入已過期，請重新登入"})
+			return
+		}
+		writeJSON(w, http.StatusUnauthorized, ErrorResponse{Success: false, Message: "Telegram 登入驗證失敗"})
 		return
 	}
 
-	// Generate token
-	token, err := auth.GenerateToken(acc.ID, acc.Email, acc.Role)
+	acc, created, err := accountRepo.FindOrCreateByTelegram(strconv.FormatInt(user.ID, 10))
 	if err != nil {
-		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Success: false, Message: "產生令牌失敗"})
+		log.WithError(err).Error("Telegram Login: Find Or Create Account Failed")
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Success: false, Message: "登入失敗"})
 		return
 	}
 
-	writeJSON(w, http.StatusOK, TokenResponse{Token: token})
+	if !acc.Enabled {
+		writeJSON(w, http.StatusForbidden, ErrorResponse{Success: false, Message: "帳號已停用"})
+		return
+	}
+
+	if created {
+		log.WithFields(log.Fields{"userID": acc.ID, "telegram": user.ID}).Info("Telegram Account Created")
+	}
+
+	completeLogin(w, r, acc)
 }
 
 // MeResponse represents the /me endpoint response
 type MeResponse struct {
-	ID        int             `json:"id"`
-	Email     string          `json:"email"`
-	Role      string          `json:"role"`
-	Bindings  map[string]bool `json:"bindings"`
-	Enabled   bool            `json:"enabled"`
-	CreatedAt string          `json:"created_at"`
+	ID            int             `json:"id"`
+	Email         string          `json:"email"`
+	EmailVerified bool            `json:"email_verified"`
+	Role          string          `json:"role"`
+	Permissions   []string        `json:"permissions"`
+	Bindings      map[string]bool `json:"bindings"`
+	Enabled       bool            `json:"enabled"`
+	CreatedAt     string          `json:"created_at"`
+	// ImpersonatedBy is the admin viewing as the user
+	ImpersonatedBy string `json:"impersonated_by,omitempty"`
 }
 
 // Me returns the current user info
@@ -180,13 +275,24 @@ func Me(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	pttExists, _ := pttAccountRepo.Exists(acc.ID)
 	bindingStatus["ptt"] = pttExists
 
+	// Permissions let the frontend show the features of the role
+	permissions := []string{}
+	if rl, err := roleLimitRepo.FindByRole(acc.Role); err == nil {
+		permissions = rl.Permissions
+	}
+
 	response := MeResponse{
-		ID:        acc.ID,
-		Email:     acc.Email,
-		Role:      acc.Role,
-		Bindings:  bindingStatus,
-		Enabled:   acc.Enabled,
-		CreatedAt: acc.CreatedAt.Format(time.RFC3339),
+		ID:            acc.ID,
+		Email:         acc.Email,
+		EmailVerified: acc.EmailVerified,
+		Role:          acc.Role,
+		Permissions:   permissions,
+		Bindings:      bindingStatus,
+		Enabled:       acc.Enabled,
+		CreatedAt:     acc.CreatedAt.Format(time.RFC3339),
+	}
+	if claims.Impersonated() {
+		response.ImpersonatedBy = claims.ImpersonatorEmail
 	}
 
 	writeJSON(w, http.StatusOK, response)
@@ -244,6 +350,14 @@ func ChangePassword(w http.ResponseWriter, r *http.Request, _ httprouter.Params)
 		return
 	}
 
+	recordAudit(r, claims, audit.ActionPasswordChange, audit.TargetUser, claims.UserID, nil, nil)
+
+	// Sign out other devices
+	if err := sessionRepo.RevokeAll(claims.UserID, claims.SessionID); err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Success: false, Message: "登出其他裝置失敗"})
+		return
+	}
+
 	writeJSON(w, http.StatusOK, SuccessResponse{Success: true, Message: "密碼變更成功"})
 }
 
@@ -385,6 +499,9 @@ func UnbindService(w http.ResponseWriter, r *http.Request, ps httprouter.Params)
 		return
 	}
 
+	recordAudit(r, claims, audit.ActionBindingUnbind, audit.TargetUser, claims.UserID,
+		map[string]string{"service": service}, nil)
+
 	writeJSON(w, http.StatusOK, SuccessResponse{Success: true, Message: "已解除綁定"})
 }
 
@@ -439,10 +556,12 @@ func SetBindingEnabled(w http.ResponseWriter, r *http.Request, ps httprouter.Par
 		return
 	}
 
+	recordAudit(r, claims, audit.ActionBindingUpdate, audit.TargetUser, claims.UserID,
+		nil, map[string]interface{}{"service": service, "enabled": req.Enabled})
+
 	status := "停用"
 	if req.Enabled {
 		status = "啟用"
 	}
 	writeJSON(w, http.StatusOK, SuccessResponse{Success: true, Message: "已" + status + "綁定"})
 }
-
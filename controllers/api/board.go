@@ -0,0 +1,62 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/Ptt-Alertor/ptt-alertor/models/catalog"
+	"github.com/julienschmidt/httprouter"
+)
+
+var catalogRepo = &catalog.Postgres{}
+
+const (
+	// catalogSuggestions is how many names are suggested when nothing matches
+	catalogSuggestions = 5
+	// maxCatalogQuery bounds q, board titles are short
+	maxCatalogQuery = 30
+)
+
+// SearchBoardCatalog searches PTT boards by name or Chinese title (public)
+func SearchBoardCatalog(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	q := r.URL.Query()
+
+	search := q.Get("q")
+	category := q.Get("category")
+	if utf8.RuneCountInString(search) > maxCatalogQuery {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Success: false, Message: "搜尋字數不可超過 " + strconv.Itoa(maxCatalogQuery) + " 字"})
+		return
+	}
+
+	// Get pagination params (default: page=1, limit=20)
+	page := 1
+	limit := 20
+
+	if p := q.Get("page"); p != "" {
+		if parsed, err := strconv.Atoi(p); err == nil && parsed > 0 {
+			page = parsed
+		}
+	}
+
+	if l := q.Get("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 {
+			limit = min(parsed, maxSearchLimit)
+		}
+	}
+
+	result, err := catalogRepo.Search(search, category, page, limit)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Success: false, Message: "取得看板列表失敗"})
+		return
+	}
+
+	// suggest close names for typos
+	if result.Total == 0 && search != "" {
+		if names, err := catalogRepo.SuggestNames(search, catalogSuggestions); err == nil {
+			result.Suggestions = names
+		}
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
@@ -0,0 +1,180 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	log "github.com/Ptt-Alertor/logrus"
+	"github.com/Ptt-Alertor/ptt-alertor/auth"
+	"github.com/Ptt-Alertor/ptt-alertor/email"
+	"github.com/Ptt-Alertor/ptt-alertor/models/account"
+	"github.com/Ptt-Alertor/ptt-alertor/models/audit"
+	"github.com/julienschmidt/httprouter"
+)
+
+// TokenRequest carries a token from an email link
+type TokenRequest struct {
+	Token string `json:"token"`
+}
+
+// ForgotPasswordRequest represents a password reset request
+type ForgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+// ResetPasswordRequest represents a password reset with an email token
+type ResetPasswordRequest struct {
+	Token       string `json:"token"`
+	NewPassword string `json:"new_password"`
+}
+
+// sendVerificationEmail mails acc a link to verify its email
+func sendVerificationEmail(acc *account.Account) error {
+	token, err := auth.GenerateVerifyEmailToken(acc.ID, acc.Email)
+	if err != nil {
+		return err
+	}
+	return email.Send(email.VerificationMessage(acc.Email, token))
+}
+
+// SendVerificationEmail sends the current user another verification email
+func SendVerificationEmail(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	claims := auth.GetUserFromContext(r.Context())
+	if claims == nil {
+		writeJSON(w, http.StatusUnauthorized, ErrorResponse{Success: false, Message: "未授權"})
+		return
+	}
+
+	acc, err := accountRepo.FindByID(claims.UserID)
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, ErrorResponse{Success: false, Message: "找不到帳號"})
+		return
+	}
+
+	if acc.EmailVerified {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Success: false, Message: "電子郵件已驗證"})
+		return
+	}
+
+	if account.IsTelegramEmail(acc.Email) {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Success: false, Message: "Telegram 帳號沒有電子郵件"})
+		return
+	}
+
+	if err := sendVerificationEmail(acc); err != nil {
+		log.WithError(err).Error("Send Verification Email Failed")
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Success: false, Message: "寄送驗證信失敗"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, SuccessResponse{Success: true, Message: "驗證信已寄出"})
+}
+
+// VerifyEmail consumes an email verification token
+func VerifyEmail(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	var req TokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Success: false, Message: "無效的請求內容"})
+		return
+	}
+
+	claims, err := auth.ValidateActionToken(req.Token, auth.PurposeVerifyEmail)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Success: false, Message: "驗證連結無效或已過期"})
+		return
+	}
+
+	acc, err := accountRepo.FindByID(claims.UserID)
+	if err != nil || claims.Fingerprint != auth.Fingerprint(acc.Email) {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Success: false, Message: "驗證連結無效或已過期"})
+		return
+	}
+
+	if err := accountRepo.MarkEmailVerified(acc.ID); err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Success: false, Message: "驗證失敗"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, SuccessResponse{Success: true, Message: "電子郵件驗證成功"})
+}
+
+// ForgotPassword mails a reset link. The response is the same whether or
+// not the email is registered.
+func ForgotPassword(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	var req ForgotPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || !isValidEmail(req.Email) {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Success: false, Message: "無效的電子郵件格式"})
+		return
+	}
+
+	acc, err := accountRepo.FindByEmail(req.Email)
+	if err == nil && acc.Enabled {
+		token, err := auth.GeneratePasswordResetToken(acc.ID, acc.Password)
+		if err == nil {
+			err = email.Send(email.PasswordResetMessage(acc.Email, token))
+		}
+		if err != nil {
+			log.WithError(err).Error("Send Password Reset Email Failed")
+		}
+	} else if err != nil && err != account.ErrAccountNotFound {
+		log.WithError(err).Error("Forgot Password: Find Account Failed")
+	}
+
+	writeJSON(w, http.StatusOK, SuccessResponse{Success: true, Message: "若此電子郵件已註冊，將收到重設密碼信"})
+}
+
+// ResetPassword sets a new password with a reset token and signs out
+// every device
+func ResetPassword(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	var req ResetPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Success: false, Message: "無效的請求內容"})
+		return
+	}
+
+	if len(req.NewPassword) < 6 {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Success: false, Message: "新密碼必須至少 6 個字元"})
+		return
+	}
+
+	claims, err := auth.ValidateActionToken(req.Token, auth.PurposeResetPassword)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Success: false, Message: "重設連結無效或已過期"})
+		return
+	}
+
+	acc, err := accountRepo.FindByID(claims.UserID)
+	if err != nil || claims.Fingerprint != auth.Fingerprint(acc.Password) {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Success: false, Message: "重設連結無效或已過期"})
+		return
+	}
+
+	if !acc.Enabled {
+		writeJSON(w, http.StatusForbidden, ErrorResponse{Success: false, Message: "帳號已停用"})
+		return
+	}
+
+	hash, err := auth.HashPassword(req.NewPassword)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Success: false, Message: "密碼加密失敗"})
+		return
+	}
+
+	if err := accountRepo.UpdatePassword(acc.ID, hash); err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Success: false, Message: "密碼重設失敗"})
+		return
+	}
+
+	recordAudit(r, &auth.Claims{UserID: acc.ID, Email: acc.Email}, audit.ActionPasswordReset, audit.TargetUser, acc.ID, nil, nil)
+
+	// the link reached the mailbox, which proves ownership of the email
+	if err := accountRepo.MarkEmailVerified(acc.ID); err != nil {
+		log.WithError(err).Error("Reset Password: Mark Email Verified Failed")
+	}
+
+	if err := sessionRepo.RevokeAll(acc.ID, ""); err != nil {
+		log.WithError(err).Error("Reset Password: Revoke Sessions Failed")
+	}
+
+	writeJSON(w, http.StatusOK, SuccessResponse{Success: true, Message: "密碼已重設，請重新登入"})
+}
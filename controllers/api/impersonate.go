@@ -0,0 +1,116 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Ptt-Alertor/ptt-alertor/auth"
+	"github.com/Ptt-Alertor/ptt-alertor/models/account"
+	"github.com/Ptt-Alertor/ptt-alertor/models/audit"
+	"github.com/julienschmidt/httprouter"
+)
+
+// ImpersonateRequest represents a request to view the site as a user.
+// Scopes default to read only.
+type ImpersonateRequest struct {
+	Scopes []string `json:"scopes"`
+}
+
+// ImpersonateResponse represents an impersonation token
+type ImpersonateResponse struct {
+	Token     string   `json:"token"`
+	ExpiresIn int      `json:"expires_in"`
+	UserID    int      `json:"user_id"`
+	Email     string   `json:"email"`
+	Scopes    []string `json:"scopes"`
+}
+
+// AdminImpersonateUser mints a short-lived token acting as the user, so an
+// admin can call the user's APIs to see what the user sees (admin only)
+func AdminImpersonateUser(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	claims := auth.GetUserFromContext(r.Context())
+	if claims == nil {
+		writeJSON(w, http.StatusUnauthorized, ErrorResponse{Success: false, Message: "未授權"})
+		return
+	}
+
+	// the token lives in the admin's session, a personal access token has none
+	if claims.SessionID == "" {
+		writeJSON(w, http.StatusForbidden, ErrorResponse{Success: false, Message: "請使用登入工作階段操作"})
+		return
+	}
+
+	id, err := strconv.Atoi(ps.ByName("id"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Success: false, Message: "無效的用戶 ID"})
+		return
+	}
+
+	var req ImpersonateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Success: false, Message: "無效的請求內容"})
+		return
+	}
+
+	scopes := req.Scopes
+	if len(scopes) == 0 {
+		scopes = auth.DefaultImpersonationScopes
+	}
+	if err := auth.ValidateImpersonationScopes(scopes); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Success: false, Message: "無效的權限範圍"})
+		return
+	}
+
+	if id == claims.UserID {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Success: false, Message: "無法模擬自己"})
+		return
+	}
+
+	acc, err := accountRepo.FindByID(id)
+	if err != nil {
+		if err == account.ErrAccountNotFound {
+			writeJSON(w, http.StatusNotFound, ErrorResponse{Success: false, Message: "找不到用戶"})
+			return
+		}
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Success: false, Message: "取得用戶失敗"})
+		return
+	}
+
+	if !acc.Enabled {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Success: false, Message: "用戶已停用"})
+		return
+	}
+
+	// acting as another admin would borrow their panels
+	isAdmin, err := roleLimitRepo.HasAdminAccess(acc.Role)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Success: false, Message: "查詢角色失敗"})
+		return
+	}
+	if isAdmin {
+		writeJSON(w, http.StatusForbidden, ErrorResponse{Success: false, Message: "無法模擬管理員"})
+		return
+	}
+
+	token, err := auth.GenerateImpersonationToken(claims, acc.ID, acc.Email, acc.Role, scopes)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Success: false, Message: "產生令牌失敗"})
+		return
+	}
+
+	recordAudit(r, claims, audit.ActionImpersonate, audit.TargetUser, acc.ID, nil, map[string]interface{}{
+		"scopes":     scopes,
+		"expires_at": time.Now().Add(auth.ImpersonationTTL),
+	})
+
+	writeJSON(w, http.StatusOK, ImpersonateResponse{
+		Token:     token,
+		ExpiresIn: int(auth.ImpersonationTTL.Seconds()),
+		UserID:    acc.ID,
+		Email:     acc.Email,
+		Scopes:    scopes,
+	})
+}
@@ -0,0 +1,45 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Ptt-Alertor/ptt-alertor/ratelimit"
+)
+
+// loginLockoutKey counts failed logins per email, whether or not the account
+// exists, so lockouts don't reveal which emails are registered
+func loginLockoutKey(email string) string {
+	return "login:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+// mfaLockoutKey counts failed second factors per account
+func mfaLockoutKey(userID int) string {
+	return "mfa:" + strconv.Itoa(userID)
+}
+
+// checkLockout rejects the attempt while key is locked out
+func checkLockout(w http.ResponseWriter, key string) bool {
+	if d := ratelimit.Locked(key); d > 0 {
+		writeLockedOut(w, d)
+		return false
+	}
+	return true
+}
+
+// failAttempt records a failed attempt of key and writes the rejection,
+// which becomes a lockout once too many attempts failed in a row
+func failAttempt(w http.ResponseWriter, key string, status int, message string) {
+	if d := ratelimit.Fail(key); d > 0 {
+		writeLockedOut(w, d)
+		return
+	}
+	writeJSON(w, status, ErrorResponse{Success: false, Message: message})
+}
+
+func writeLockedOut(w http.ResponseWriter, d time.Duration) {
+	ratelimit.SetRetryAfter(w, d)
+	writeJSON(w, http.StatusTooManyRequests, ErrorResponse{Success: false, Message: "嘗試次數過多，請稍後再試"})
+}
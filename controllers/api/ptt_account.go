@@ -2,10 +2,14 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 
+	log "github.com/Ptt-Alertor/logrus"
 	"github.com/Ptt-Alertor/ptt-alertor/auth"
 	"github.com/Ptt-Alertor/ptt-alertor/models/account"
+	"github.com/Ptt-Alertor/ptt-alertor/models/audit"
+	"github.com/Ptt-Alertor/ptt-alertor/models/pttmail"
 	"github.com/Ptt-Alertor/ptt-alertor/ptt/mail"
 	"github.com/julienschmidt/httprouter"
 )
@@ -26,9 +30,13 @@ func BindPTTAccount(w http.ResponseWriter, r *http.Request, _ httprouter.Params)
 		return
 	}
 
-	// Check if user has VIP or above role
-	if claims.Role != "vip" && claims.Role != "admin" {
-		writeJSON(w, http.StatusForbidden, ErrorResponse{Success: false, Message: "此功能僅限 VIP 以上用戶使用"})
+	granted, err := auth.Can(claims, account.PermPTTMail)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Success: false, Message: "查詢角色失敗"})
+		return
+	}
+	if !granted {
+		writeJSON(w, http.StatusForbidden, ErrorResponse{Success: false, Message: "您的角色未開放 PTT 站內信功能"})
 		return
 	}
 
@@ -44,16 +52,6 @@ func BindPTTAccount(w http.ResponseWriter, r *http.Request, _ httprouter.Params)
 		return
 	}
 
-	// Test PTT login
-	if err := mail.TestCredentials(req.Username, req.Password); err != nil {
-		if err == mail.ErrLoginFailed {
-			writeJSON(w, http.StatusBadRequest, ErrorResponse{Success: false, Message: "PTT 帳號或密碼錯誤"})
-			return
-		}
-		writeJSON(w, http.StatusBadRequest, ErrorResponse{Success: false, Message: "PTT 連線失敗，請稍後再試"})
-		return
-	}
-
 	// Check if already bound
 	existing, _ := pttAccountRepo.FindByUserID(claims.UserID)
 	if existing != nil {
@@ -63,18 +61,57 @@ func BindPTTAccount(w http.ResponseWriter, r *http.Request, _ httprouter.Params)
 			writeJSON(w, http.StatusInternalServerError, ErrorResponse{Success: false, Message: "更新 PTT 帳號失敗"})
 			return
 		}
-		writeJSON(w, http.StatusOK, SuccessResponse{Success: true, Message: "PTT 帳號已更新"})
+		recordAudit(r, claims, audit.ActionPTTAccountBind, audit.TargetUser, claims.UserID,
+			map[string]string{"ptt_username": existing.PTTUsername}, map[string]string{"ptt_username": req.Username})
+		verifyPTTAccount(claims.UserID, req.Username)
+		writeJSON(w, http.StatusAccepted, SuccessResponse{Success: true, Message: "PTT 帳號已更新，正在驗證帳號密碼"})
 		return
 	}
 
 	// Create new binding
-	_, err := pttAccountRepo.Create(claims.UserID, req.Username, req.Password)
+	_, err = pttAccountRepo.Create(claims.UserID, req.Username, req.Password)
 	if err != nil {
 		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Success: false, Message: "綁定 PTT 帳號失敗"})
 		return
 	}
 
-	writeJSON(w, http.StatusCreated, SuccessResponse{Success: true, Message: "PTT 帳號已綁定"})
+	recordAudit(r, claims, audit.ActionPTTAccountBind, audit.TargetUser, claims.UserID,
+		nil, map[string]string{"ptt_username": req.Username})
+	verifyPTTAccount(claims.UserID, req.Username)
+
+	writeJSON(w, http.StatusAccepted, SuccessResponse{Success: true, Message: "PTT 帳號已綁定，正在驗證帳號密碼"})
+}
+
+// verifyPTTAccount queues a login with the new credentials, the credential
+// verifier queues it again when this fails. A pending check logs in with
+// the credentials current when it runs, so another is not queued.
+func verifyPTTAccount(userID int, username string) {
+	job := &pttmail.Job{Kind: pttmail.KindVerify, UserID: userID, PTTUsername: username}
+	if err := pttMailJobRepo.Enqueue(job); err != nil && !errors.Is(err, pttmail.ErrVerifyPending) {
+		log.WithField("user_id", userID).WithError(err).Error("Queue PTT Credential Check Failed")
+	}
+}
+
+// GetPTTAccount returns the user's PTT account binding and whether its
+// credentials work
+func GetPTTAccount(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	claims := auth.GetUserFromContext(r.Context())
+	if claims == nil {
+		writeJSON(w, http.StatusUnauthorized, ErrorResponse{Success: false, Message: "未授權"})
+		return
+	}
+
+	acc, err := pttAccountRepo.FindByUserID(claims.UserID)
+	if err != nil {
+		if err == account.ErrPTTAccountNotFound {
+			writeJSON(w, http.StatusNotFound, ErrorResponse{Success: false, Message: "尚未綁定 PTT 帳號"})
+			return
+		}
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Success: false, Message: "取得 PTT 帳號失敗"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, acc)
 }
 
 // UnbindPTTAccount unbinds the PTT account from the user
@@ -85,6 +122,8 @@ func UnbindPTTAccount(w http.ResponseWriter, r *http.Request, _ httprouter.Param
 		return
 	}
 
+	existing, _ := pttAccountRepo.FindByUserID(claims.UserID)
+
 	err := pttAccountRepo.Delete(claims.UserID)
 	if err != nil {
 		if err == account.ErrPTTAccountNotFound {
@@ -95,9 +134,64 @@ func UnbindPTTAccount(w http.ResponseWriter, r *http.Request, _ httprouter.Param
 		return
 	}
 
+	var before interface{}
+	if existing != nil {
+		before = map[string]string{"ptt_username": existing.PTTUsername}
+	}
+	recordAudit(r, claims, audit.ActionPTTAccountUnbind, audit.TargetUser, claims.UserID, before, nil)
+
 	writeJSON(w, http.StatusOK, SuccessResponse{Success: true, Message: "已解除 PTT 帳號綁定"})
 }
 
+// PTTInboxWatchRequest represents a request to turn the inbox watch on or off
+type PTTInboxWatchRequest struct {
+	Enabled bool `json:"enabled"`
+}
+
+// SetPTTInboxWatch turns forwarding of new PTT mails to Telegram on or off
+func SetPTTInboxWatch(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	claims := auth.GetUserFromContext(r.Context())
+	if claims == nil {
+		writeJSON(w, http.StatusUnauthorized, ErrorResponse{Success: false, Message: "未授權"})
+		return
+	}
+
+	var req PTTInboxWatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Success: false, Message: "無效的請求內容"})
+		return
+	}
+
+	// turning it off is always allowed, the watcher skips roles without
+	// ptt_mail anyway
+	if req.Enabled {
+		granted, err := auth.Can(claims, account.PermPTTMail)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, ErrorResponse{Success: false, Message: "查詢角色失敗"})
+			return
+		}
+		if !granted {
+			writeJSON(w, http.StatusForbidden, ErrorResponse{Success: false, Message: "您的角色未開放 PTT 站內信功能"})
+			return
+		}
+	}
+
+	if err := pttAccountRepo.SetWatchInbox(claims.UserID, req.Enabled); err != nil {
+		if err == account.ErrPTTAccountNotFound {
+			writeJSON(w, http.StatusNotFound, ErrorResponse{Success: false, Message: "尚未綁定 PTT 帳號"})
+			return
+		}
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Success: false, Message: "更新收信通知失敗"})
+		return
+	}
+
+	message := "已關閉 PTT 收信通知"
+	if req.Enabled {
+		message = "已開啟 PTT 收信通知"
+	}
+	writeJSON(w, http.StatusOK, SuccessResponse{Success: true, Message: message})
+}
+
 // SendPTTMail sends a PTT mail (called from Telegram callback)
 func SendPTTMail(userID int, recipient, subject, content string) error {
 	// Get PTT credentials
@@ -0,0 +1,85 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/Ptt-Alertor/ptt-alertor/auth"
+	"github.com/Ptt-Alertor/ptt-alertor/models/pttmail"
+	"github.com/julienschmidt/httprouter"
+)
+
+var pttMailJobRepo = &pttmail.Postgres{}
+
+// ListPTTMailJobs lists the user's queued and handled PTT mails, newest first
+func ListPTTMailJobs(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	claims := auth.GetUserFromContext(r.Context())
+	if claims == nil {
+		writeJSON(w, http.StatusUnauthorized, ErrorResponse{Success: false, Message: "未授權"})
+		return
+	}
+
+	q := r.URL.Query()
+	query := pttmail.ListQuery{
+		UserID: claims.UserID,
+		Status: q.Get("status"),
+		Page:   1,
+		Limit:  20,
+	}
+	if query.Status != "" && !pttmail.ValidStatus(query.Status) {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Success: false, Message: "無效的狀態，可用 queued、running、sent、failed"})
+		return
+	}
+
+	if p := q.Get("page"); p != "" {
+		if parsed, err := strconv.Atoi(p); err == nil && parsed > 0 {
+			query.Page = parsed
+		}
+	}
+
+	if l := q.Get("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 {
+			query.Limit = min(parsed, maxSearchLimit)
+		}
+	}
+
+	result, err := pttMailJobRepo.List(query)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Success: false, Message: "取得寄信紀錄失敗"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
+
+// ListPTTMailHistory lists the PTT mails the user sent or failed to send,
+// newest first
+func ListPTTMailHistory(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	claims := auth.GetUserFromContext(r.Context())
+	if claims == nil {
+		writeJSON(w, http.StatusUnauthorized, ErrorResponse{Success: false, Message: "未授權"})
+		return
+	}
+
+	q := r.URL.Query()
+	page, limit := 1, 20
+	if p := q.Get("page"); p != "" {
+		if parsed, err := strconv.Atoi(p); err == nil && parsed > 0 {
+			page = parsed
+		}
+	}
+
+	if l := q.Get("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 {
+			limit = min(parsed, maxSearchLimit)
+		}
+	}
+
+	result, err := pttMailJobRepo.History(claims.UserID, page, limit)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Success: false, Message: "取得寄信紀錄失敗"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
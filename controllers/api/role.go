@@ -4,7 +4,9 @@ import (
 	"encoding/json"
 	"net/http"
 
+	"github.com/Ptt-Alertor/ptt-alertor/auth"
 	"github.com/Ptt-Alertor/ptt-alertor/models/account"
+	"github.com/Ptt-Alertor/ptt-alertor/models/audit"
 	"github.com/julienschmidt/httprouter"
 )
 
@@ -12,15 +14,28 @@ var roleLimitRepo = &account.RoleLimitPostgres{}
 
 // CreateRoleRequest represents a request to create a role
 type CreateRoleRequest struct {
-	Role             string `json:"role"`
-	MaxSubscriptions int    `json:"max_subscriptions"`
-	Description      string `json:"description"`
+	Role             string   `json:"role"`
+	MaxSubscriptions int      `json:"max_subscriptions"`
+	Description      string   `json:"description"`
+	Require2FA       bool     `json:"require_2fa"`
+	Permissions      []string `json:"permissions"`
+	MinPollInterval  int      `json:"min_poll_interval"`
+	// APIRateLimit is requests per minute, -1 for unlimited
+	APIRateLimit *int `json:"api_rate_limit"`
+	// MaxBoards defaults to -1, unlimited
+	MaxBoards *int `json:"max_boards"`
 }
 
 // UpdateRoleRequest represents a request to update a role
 type UpdateRoleRequest struct {
 	MaxSubscriptions int    `json:"max_subscriptions"`
 	Description      string `json:"description"`
+	// Fields below keep their current value when omitted
+	Require2FA      *bool    `json:"require_2fa"`
+	APIRateLimit    *int     `json:"api_rate_limit"`
+	Permissions     []string `json:"permissions"`
+	MaxBoards       *int     `json:"max_boards"`
+	MinPollInterval *int     `json:"min_poll_interval"`
 }
 
 // RoleResponse represents a role with user count
@@ -29,6 +44,37 @@ type RoleResponse struct {
 	UserCount int `json:"user_count"`
 }
 
+// validateRole checks a role's limits and permissions, writing the error
+func validateRole(w http.ResponseWriter, rl *account.RoleLimit) bool {
+	if rl.APIRateLimit == 0 || rl.APIRateLimit < -1 {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Success: false, Message: "API 請求上限須為正數或 -1（無限制）"})
+		return false
+	}
+	if rl.MaxBoards == 0 || rl.MaxBoards < -1 {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Success: false, Message: "看板上限須為正數或 -1（無限制）"})
+		return false
+	}
+	if rl.MinPollInterval < 0 {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Success: false, Message: "最短輪詢間隔不可為負數"})
+		return false
+	}
+	if err := account.ValidatePermissions(rl.Permissions); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Success: false, Message: "無效的權限"})
+		return false
+	}
+	// the built-in admin role must be able to grant permissions back
+	if rl.Role == "admin" && !rl.Has(account.PermAdminRoles) {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Success: false, Message: "admin 角色必須保留角色管理權限"})
+		return false
+	}
+	return true
+}
+
+// AdminListPermissions returns every permission a role can be granted (admin only)
+func AdminListPermissions(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	writeJSON(w, http.StatusOK, account.AllPermissions)
+}
+
 // AdminListRoles returns all role limits (admin only)
 func AdminListRoles(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	roles, err := roleLimitRepo.List()
@@ -97,12 +143,37 @@ func AdminCreateRole(w http.ResponseWriter, r *http.Request, _ httprouter.Params
 		return
 	}
 
-	role, err := roleLimitRepo.Create(req.Role, req.MaxSubscriptions, req.Description)
+	rl := &account.RoleLimit{
+		Role:             req.Role,
+		MaxSubscriptions: req.MaxSubscriptions,
+		Description:      req.Description,
+		Require2FA:       req.Require2FA,
+		APIRateLimit:     account.DefaultAPIRateLimit,
+		Permissions:      req.Permissions,
+		MaxBoards:        -1,
+		MinPollInterval:  req.MinPollInterval,
+	}
+	if req.APIRateLimit != nil {
+		rl.APIRateLimit = *req.APIRateLimit
+	}
+	if req.MaxBoards != nil {
+		rl.MaxBoards = *req.MaxBoards
+	}
+	if rl.Permissions == nil {
+		rl.Permissions = []string{}
+	}
+	if !validateRole(w, rl) {
+		return
+	}
+
+	role, err := roleLimitRepo.Create(rl)
 	if err != nil {
 		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Success: false, Message: "建立角色失敗"})
 		return
 	}
 
+	recordAudit(r, auth.GetUserFromContext(r.Context()), audit.ActionRoleCreate, audit.TargetRole, role.Role, nil, role)
+
 	writeJSON(w, http.StatusCreated, role)
 }
 
@@ -116,7 +187,7 @@ func AdminUpdateRole(w http.ResponseWriter, r *http.Request, ps httprouter.Param
 		return
 	}
 
-	role, err := roleLimitRepo.Update(roleName, req.MaxSubscriptions, req.Description)
+	rl, err := roleLimitRepo.FindByRole(roleName)
 	if err != nil {
 		if err == account.ErrRoleLimitNotFound {
 			writeJSON(w, http.StatusNotFound, ErrorResponse{Success: false, Message: "找不到角色"})
@@ -126,6 +197,40 @@ func AdminUpdateRole(w http.ResponseWriter, r *http.Request, ps httprouter.Param
 		return
 	}
 
+	before := *rl
+	rl.MaxSubscriptions = req.MaxSubscriptions
+	rl.Description = req.Description
+	if req.Require2FA != nil {
+		rl.Require2FA = *req.Require2FA
+	}
+	if req.APIRateLimit != nil {
+		rl.APIRateLimit = *req.APIRateLimit
+	}
+	if req.Permissions != nil {
+		rl.Permissions = req.Permissions
+	}
+	if req.MaxBoards != nil {
+		rl.MaxBoards = *req.MaxBoards
+	}
+	if req.MinPollInterval != nil {
+		rl.MinPollInterval = *req.MinPollInterval
+	}
+	if !validateRole(w, rl) {
+		return
+	}
+
+	role, err := roleLimitRepo.Update(rl)
+	if err != nil {
+		if err == account.ErrRoleLimitNotFound {
+			writeJSON(w, http.StatusNotFound, ErrorResponse{Success: false, Message: "找不到角色"})
+			return
+		}
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Success: false, Message: "更新角色失敗"})
+		return
+	}
+
+	recordAudit(r, auth.GetUserFromContext(r.Context()), audit.ActionRoleUpdate, audit.TargetRole, roleName, before, role)
+
 	writeJSON(w, http.StatusOK, role)
 }
 
@@ -140,6 +245,8 @@ func AdminDeleteRole(w http.ResponseWriter, r *http.Request, ps httprouter.Param
 		return
 	}
 
+	before, _ := roleLimitRepo.FindByRole(roleName)
+
 	err := roleLimitRepo.Delete(roleName)
 	if err != nil {
 		if err == account.ErrRoleLimitNotFound {
@@ -154,5 +261,7 @@ func AdminDeleteRole(w http.ResponseWriter, r *http.Request, ps httprouter.Param
 		return
 	}
 
+	recordAudit(r, auth.GetUserFromContext(r.Context()), audit.ActionRoleDelete, audit.TargetRole, roleName, before, nil)
+
 	writeJSON(w, http.StatusOK, SuccessResponse{Success: true, Message: "刪除成功"})
 }
@@ -0,0 +1,150 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/Ptt-Alertor/ptt-alertor/auth"
+	"github.com/Ptt-Alertor/ptt-alertor/models/account"
+	"github.com/Ptt-Alertor/ptt-alertor/models/session"
+	"github.com/Ptt-Alertor/ptt-alertor/ratelimit"
+	"github.com/julienschmidt/httprouter"
+)
+
+var sessionRepo = &session.Postgres{}
+
+// RefreshRequest represents a token refresh request
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// issueTokens starts a session for acc and writes the token pair. mfa
+// records whether the login passed two-factor authentication.
+func issueTokens(w http.ResponseWriter, r *http.Request, acc *account.Account, mfa bool) {
+	refreshToken, hash, err := session.NewRefreshToken()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Success: false, Message: "產生令牌失敗"})
+		return
+	}
+
+	s, err := sessionRepo.Create(acc.ID, hash, r.UserAgent(), ratelimit.ClientIP(r), mfa)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Success: false, Message: "建立登入階段失敗"})
+		return
+	}
+
+	token, err := auth.GenerateToken(acc.ID, acc.Email, acc.Role, s.ID, s.MFA)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Success: false, Message: "產生令牌失敗"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, TokenResponse{
+		Token:        token,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(auth.AccessTokenTTL().Seconds()),
+	})
+}
+
+// Refresh exchanges a refresh token for a new token pair
+func Refresh(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	var req RefreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RefreshToken == "" {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Success: false, Message: "無效的請求內容"})
+		return
+	}
+
+	refreshToken, hash, err := session.NewRefreshToken()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Success: false, Message: "產生令牌失敗"})
+		return
+	}
+
+	s, err := sessionRepo.Rotate(session.HashToken(req.RefreshToken), hash)
+	if err != nil {
+		switch err {
+		case session.ErrSessionNotFound, session.ErrTokenReused:
+			writeJSON(w, http.StatusUnauthorized, ErrorResponse{Success: false, Message: "登入已失效，請重新登入"})
+		default:
+			writeJSON(w, http.StatusInternalServerError, ErrorResponse{Success: false, Message: "更新令牌失敗"})
+		}
+		return
+	}
+
+	// role and enabled state are read again so changes apply on refresh
+	acc, err := accountRepo.FindByID(s.UserID)
+	if err != nil || !acc.Enabled {
+		sessionRepo.Revoke(s.UserID, s.ID)
+		writeJSON(w, http.StatusUnauthorized, ErrorResponse{Success: false, Message: "登入已失效，請重新登入"})
+		return
+	}
+
+	token, err := auth.GenerateToken(acc.ID, acc.Email, acc.Role, s.ID, s.MFA)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Success: false, Message: "產生令牌失敗"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, TokenResponse{
+		Token:        token,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(auth.AccessTokenTTL().Seconds()),
+	})
+}
+
+// Logout revokes the current session
+func Logout(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	claims := auth.GetUserFromContext(r.Context())
+	if claims == nil {
+		writeJSON(w, http.StatusUnauthorized, ErrorResponse{Success: false, Message: "未授權"})
+		return
+	}
+
+	if err := sessionRepo.Revoke(claims.UserID, claims.SessionID); err != nil && err != session.ErrSessionNotFound {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Success: false, Message: "登出失敗"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, SuccessResponse{Success: true, Message: "已登出"})
+}
+
+// ListSessions returns the current user's active sessions
+func ListSessions(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	claims := auth.GetUserFromContext(r.Context())
+	if claims == nil {
+		writeJSON(w, http.StatusUnauthorized, ErrorResponse{Success: false, Message: "未授權"})
+		return
+	}
+
+	sessions, err := sessionRepo.ListActive(claims.UserID)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Success: false, Message: "取得登入階段失敗"})
+		return
+	}
+
+	for _, s := range sessions {
+		s.Current = s.ID == claims.SessionID
+	}
+
+	writeJSON(w, http.StatusOK, sessions)
+}
+
+// RevokeSession ends one of the current user's sessions
+func RevokeSession(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	claims := auth.GetUserFromContext(r.Context())
+	if claims == nil {
+		writeJSON(w, http.StatusUnauthorized, ErrorResponse{Success: false, Message: "未授權"})
+		return
+	}
+
+	if err := sessionRepo.Revoke(claims.UserID, ps.ByName("id")); err != nil {
+		if err == session.ErrSessionNotFound {
+			writeJSON(w, http.StatusNotFound, ErrorResponse{Success: false, Message: "找不到登入階段"})
+			return
+		}
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Success: false, Message: "登出裝置失敗"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, SuccessResponse{Success: true, Message: "已登出該裝置"})
+}
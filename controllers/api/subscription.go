@@ -2,22 +2,35 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/Ptt-Alertor/ptt-alertor/auth"
 	"github.com/Ptt-Alertor/ptt-alertor/models/account"
+	"github.com/Ptt-Alertor/ptt-alertor/preview"
 	"github.com/julienschmidt/httprouter"
 )
 
 var subscriptionRepo = &account.SubscriptionPostgres{}
 
+var mailTemplateErrorMessage = "信件模板格式錯誤，僅可使用 {{.Author}}、{{.Title}}、{{.Link}}、{{.Board}}、{{.Code}}、{{.Date}}、{{.Price}} 變數，標題不超過 " +
+	strconv.Itoa(account.MaxMailSubject) + " 字、內容不超過 " + strconv.Itoa(account.MaxMailContent) + " 字"
+
 // MailTemplateRequest represents mail template in request
 type MailTemplateRequest struct {
+	Name    string `json:"name,omitempty"`
 	Subject string `json:"subject"`
 	Content string `json:"content"`
 }
 
+// MailRuleRequest represents mail rule in request
+type MailRuleRequest struct {
+	TitlePattern string                `json:"title_pattern"`
+	Templates    []MailTemplateRequest `json:"templates"`
+}
+
 // CreateSubscriptionRequest represents a subscription creation request
 type CreateSubscriptionRequest struct {
 	Board   string               `json:"board"`
@@ -28,11 +41,12 @@ type CreateSubscriptionRequest struct {
 
 // UpdateSubscriptionRequest represents a subscription update request
 type UpdateSubscriptionRequest struct {
-	Board   string               `json:"board"`
-	SubType string               `json:"sub_type"`
-	Value   string               `json:"value"`
-	Enabled bool                 `json:"enabled"`
-	Mail    *MailTemplateRequest `json:"mail,omitempty"`
+	Board    string               `json:"board"`
+	SubType  string               `json:"sub_type"`
+	Value    string               `json:"value"`
+	Enabled  bool                 `json:"enabled"`
+	Mail     *MailTemplateRequest `json:"mail,omitempty"`
+	MailRule *MailRuleRequest     `json:"mail_rule,omitempty"`
 }
 
 // ListSubscriptions returns all subscriptions for the current user
@@ -95,6 +109,12 @@ func CreateSubscription(w http.ResponseWriter, r *http.Request, _ httprouter.Par
 			writeJSON(w, http.StatusConflict, ErrorResponse{Success: false, Message: "訂閱已存在"})
 		case account.ErrSubscriptionLimitReached:
 			writeJSON(w, http.StatusForbidden, ErrorResponse{Success: false, Message: "已達訂閱上限"})
+		case account.ErrBoardLimitReached:
+			writeJSON(w, http.StatusForbidden, ErrorResponse{Success: false, Message: "已達看板數量上限"})
+		case account.ErrRegexNotAllowed:
+			writeJSON(w, http.StatusForbidden, ErrorResponse{Success: false, Message: "您的角色未開放正規表示式關鍵字"})
+		case account.ErrEmailNotVerified:
+			writeJSON(w, http.StatusForbidden, ErrorResponse{Success: false, Message: "請先完成電子郵件驗證"})
 		case account.ErrBoardNotFound:
 			writeJSON(w, http.StatusBadRequest, ErrorResponse{Success: false, Message: "看板不存在"})
 		default:
@@ -106,6 +126,55 @@ func CreateSubscription(w http.ResponseWriter, r *http.Request, _ httprouter.Par
 	writeJSON(w, http.StatusCreated, SuccessResponse{Success: true, Message: "訂閱已建立"})
 }
 
+// PreviewSubscription back-tests a subscription against past articles
+// without saving it
+func PreviewSubscription(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	claims := auth.GetUserFromContext(r.Context())
+	if claims == nil {
+		writeJSON(w, http.StatusUnauthorized, ErrorResponse{Success: false, Message: "未授權"})
+		return
+	}
+
+	var req preview.Request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Success: false, Message: "無效的請求內容"})
+		return
+	}
+
+	if req.SubType == "keyword" && strings.HasPrefix(req.Value, "regexp:") {
+		granted, err := auth.Can(claims, account.PermRegexKeywords)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, ErrorResponse{Success: false, Message: "試算失敗"})
+			return
+		}
+		if !granted {
+			writeJSON(w, http.StatusForbidden, ErrorResponse{Success: false, Message: "您的角色未開放正規表示式關鍵字"})
+			return
+		}
+	}
+
+	result, err := preview.Run(req)
+	if err != nil {
+		switch err {
+		case preview.ErrBoardRequired:
+			writeJSON(w, http.StatusBadRequest, ErrorResponse{Success: false, Message: "看板為必填"})
+		case preview.ErrInvalidSubType:
+			writeJSON(w, http.StatusBadRequest, ErrorResponse{Success: false, Message: "無效的訂閱類型，必須是 keyword、author 或 pushsum"})
+		case preview.ErrInvalidValue:
+			writeJSON(w, http.StatusBadRequest, ErrorResponse{Success: false, Message: "無效的訂閱值"})
+		case preview.ErrInvalidSource:
+			writeJSON(w, http.StatusBadRequest, ErrorResponse{Success: false, Message: "無效的資料來源，必須是 archive 或 live"})
+		case preview.ErrBoardNotFound:
+			writeJSON(w, http.StatusBadRequest, ErrorResponse{Success: false, Message: "看板不存在"})
+		default:
+			writeJSON(w, http.StatusInternalServerError, ErrorResponse{Success: false, Message: "試算失敗"})
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
+
 // GetSubscription returns a single subscription
 func GetSubscription(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	claims := auth.GetUserFromContext(r.Context())
@@ -131,9 +200,11 @@ func GetSubscription(w http.ResponseWriter, r *http.Request, ps httprouter.Param
 	}
 
 	// Check ownership
-	if sub.UserID != claims.UserID && claims.Role != "admin" {
-		writeJSON(w, http.StatusForbidden, ErrorResponse{Success: false, Message: "禁止存取"})
-		return
+	if sub.UserID != claims.UserID {
+		if granted, _ := auth.CanAdminister(claims, account.PermAdminUsers); !granted {
+			writeJSON(w, http.StatusForbidden, ErrorResponse{Success: false, Message: "禁止存取"})
+			return
+		}
 	}
 
 	writeJSON(w, http.StatusOK, sub)
@@ -179,6 +250,11 @@ func UpdateSubscription(w http.ResponseWriter, r *http.Request, ps httprouter.Pa
 	// Prepare mail template pointers
 	var mailSubject, mailContent *string
 	if req.Mail != nil {
+		tmpl := &account.MailTemplate{Subject: req.Mail.Subject, Content: req.Mail.Content}
+		if err := tmpl.Validate(); err != nil {
+			writeJSON(w, http.StatusBadRequest, ErrorResponse{Success: false, Message: mailTemplateErrorMessage})
+			return
+		}
 		if req.Mail.Subject != "" {
 			mailSubject = &req.Mail.Subject
 		}
@@ -187,11 +263,29 @@ func UpdateSubscription(w http.ResponseWriter, r *http.Request, ps httprouter.Pa
 		}
 	}
 
+	// Prepare mail rule, an empty one is cleared
+	var mailRule *account.MailRule
+	if req.MailRule != nil && (req.MailRule.TitlePattern != "" || len(req.MailRule.Templates) > 0) {
+		mailRule = &account.MailRule{TitlePattern: req.MailRule.TitlePattern}
+		for _, t := range req.MailRule.Templates {
+			mailRule.Templates = append(mailRule.Templates, &account.MailTemplate{Name: t.Name, Subject: t.Subject, Content: t.Content})
+		}
+		if err := mailRule.Validate(); err != nil {
+			if errors.Is(err, account.ErrInvalidMailTemplate) {
+				writeJSON(w, http.StatusBadRequest, ErrorResponse{Success: false, Message: mailTemplateErrorMessage})
+				return
+			}
+			writeJSON(w, http.StatusBadRequest, ErrorResponse{Success: false, Message: "信件規則格式錯誤，標題條件須為正規表示式，模板最多 " +
+				strconv.Itoa(account.MaxMailTemplates) + " 個，名稱必填、不可重複且不超過 " + strconv.Itoa(account.MaxMailTemplateName) + " 字"})
+			return
+		}
+	}
+
 	// Update subscription (includes ownership check, board validation, Redis sync, stats)
-	// Admin can update any subscription
+	// Admins managing users can update any subscription, tokens only with
+	// the admin scope
 	userID := claims.UserID
-	if claims.Role == "admin" {
-		// For admin, get the actual owner's userID from the subscription
+	if granted, _ := auth.CanAdminister(claims, account.PermAdminUsers); granted {
 		sub, err := subscriptionRepo.FindByID(id)
 		if err != nil {
 			if err == account.ErrSubscriptionNotFound {
@@ -204,11 +298,15 @@ func UpdateSubscription(w http.ResponseWriter, r *http.Request, ps httprouter.Pa
 		userID = sub.UserID
 	}
 
-	err = subscriptionRepo.Update(id, userID, req.Board, req.SubType, req.Value, req.Enabled, mailSubject, mailContent)
+	err = subscriptionRepo.Update(id, userID, req.Board, req.SubType, req.Value, req.Enabled, mailSubject, mailContent, mailRule)
 	if err != nil {
 		switch err {
 		case account.ErrSubscriptionNotFound:
 			writeJSON(w, http.StatusNotFound, ErrorResponse{Success: false, Message: "找不到訂閱"})
+		case account.ErrBoardLimitReached:
+			writeJSON(w, http.StatusForbidden, ErrorResponse{Success: false, Message: "已達看板數量上限"})
+		case account.ErrRegexNotAllowed:
+			writeJSON(w, http.StatusForbidden, ErrorResponse{Success: false, Message: "您的角色未開放正規表示式關鍵字"})
 		case account.ErrBoardNotFound:
 			writeJSON(w, http.StatusBadRequest, ErrorResponse{Success: false, Message: "看板不存在"})
 		default:
@@ -234,9 +332,9 @@ func DeleteSubscription(w http.ResponseWriter, r *http.Request, ps httprouter.Pa
 		return
 	}
 
-	// For admin, get the actual owner's userID from the subscription
+	// For admins managing users, get the actual owner's userID from the subscription
 	userID := claims.UserID
-	if claims.Role == "admin" {
+	if granted, _ := auth.CanAdminister(claims, account.PermAdminUsers); granted {
 		sub, err := subscriptionRepo.FindByID(id)
 		if err != nil {
 			if err == account.ErrSubscriptionNotFound {
@@ -0,0 +1,259 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Ptt-Alertor/ptt-alertor/auth"
+	"github.com/Ptt-Alertor/ptt-alertor/models/apitoken"
+	"github.com/julienschmidt/httprouter"
+)
+
+var apiTokenRepo = &apitoken.Postgres{}
+
+// maxTokenExpiryDays bounds the optional expiry of a personal access token
+const maxTokenExpiryDays = 365
+
+// CreateTokenRequest represents a personal access token creation request
+type CreateTokenRequest struct {
+	Name          string   `json:"name"`
+	Scopes        []string `json:"scopes"`
+	ExpiresInDays int      `json:"expires_in_days"`
+}
+
+// UpdateTokenRequest represents a personal access token update request
+type UpdateTokenRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+}
+
+// CreateTokenResponse carries the plain token, shown only once
+type CreateTokenResponse struct {
+	*apitoken.Token
+	Plain string `json:"token"`
+}
+
+// writeTokenError maps token validation errors to responses
+func writeTokenError(w http.ResponseWriter, err error) {
+	switch err {
+	case apitoken.ErrNameRequired:
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Success: false, Message: "名稱為必填"})
+	case apitoken.ErrNameTooLong:
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Success: false, Message: "名稱最多 50 個字元"})
+	case apitoken.ErrScopeRequired:
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Success: false, Message: "至少需要一個權限範圍"})
+	case apitoken.ErrInvalidScope:
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Success: false, Message: "無效的權限範圍，可用：" + strings.Join(apitoken.Scopes, "、")})
+	case apitoken.ErrAdminScopeOnly:
+		writeJSON(w, http.StatusForbidden, ErrorResponse{Success: false, Message: "僅管理員可使用 admin:* 權限"})
+	case apitoken.ErrTokenLimit:
+		writeJSON(w, http.StatusForbidden, ErrorResponse{Success: false, Message: "存取權杖已達上限"})
+	case apitoken.ErrTokenNotFound:
+		writeJSON(w, http.StatusNotFound, ErrorResponse{Success: false, Message: "找不到存取權杖"})
+	default:
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Success: false, Message: "存取權杖操作失敗"})
+	}
+}
+
+// checkAdminScopeMFA requires sessions granting admin:* to have passed
+// two-factor authentication when the role requires it, since admin tokens
+// skip that check later
+func checkAdminScopeMFA(w http.ResponseWriter, claims *auth.Claims, role string, scopes []string) bool {
+	if claims.MFA || !apitoken.Allows(scopes, apitoken.ScopeAdmin) {
+		return true
+	}
+	required, err := roleLimitRepo.RequiresTwoFactor(role)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Success: false, Message: "查詢角色失敗"})
+		return false
+	}
+	if required {
+		writeJSON(w, http.StatusForbidden, ErrorResponse{Success: false, Message: "請先以兩步驟驗證登入"})
+		return false
+	}
+	return true
+}
+
+// validateTokenInput checks a token's name and scopes for the owner's role
+func validateTokenInput(name string, scopes []string, role string) (string, []string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", nil, apitoken.ErrNameRequired
+	}
+	if len([]rune(name)) > apitoken.MaxNameLength {
+		return "", nil, apitoken.ErrNameTooLong
+	}
+	admin, err := roleLimitRepo.HasAdminAccess(role)
+	if err != nil {
+		return "", nil, err
+	}
+	scopes, err = apitoken.ValidateScopes(scopes, admin)
+	return name, scopes, err
+}
+
+// ListTokens returns the current user's personal access tokens
+func ListTokens(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	claims := auth.GetUserFromContext(r.Context())
+	if claims == nil {
+		writeJSON(w, http.StatusUnauthorized, ErrorResponse{Success: false, Message: "未授權"})
+		return
+	}
+
+	tokens, err := apiTokenRepo.ListByUser(claims.UserID)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Success: false, Message: "取得存取權杖失敗"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, tokens)
+}
+
+// CreateToken issues a personal access token
+func CreateToken(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	claims := auth.GetUserFromContext(r.Context())
+	if claims == nil {
+		writeJSON(w, http.StatusUnauthorized, ErrorResponse{Success: false, Message: "未授權"})
+		return
+	}
+
+	var req CreateTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Success: false, Message: "無效的請求內容"})
+		return
+	}
+
+	if req.ExpiresInDays < 0 || req.ExpiresInDays > maxTokenExpiryDays {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Success: false, Message: "有效天數必須介於 1 到 365，或 0 表示不過期"})
+		return
+	}
+
+	// role is read from the database so a stale JWT can't grant admin:*
+	acc, err := accountRepo.FindByID(claims.UserID)
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, ErrorResponse{Success: false, Message: "找不到帳號"})
+		return
+	}
+
+	name, scopes, err := validateTokenInput(req.Name, req.Scopes, acc.Role)
+	if err != nil {
+		writeTokenError(w, err)
+		return
+	}
+
+	if !checkAdminScopeMFA(w, claims, acc.Role, scopes) {
+		return
+	}
+
+	var expiresAt *time.Time
+	if req.ExpiresInDays > 0 {
+		t := time.Now().AddDate(0, 0, req.ExpiresInDays)
+		expiresAt = &t
+	}
+
+	plain, hash, prefix, err := apitoken.New()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Success: false, Message: "產生存取權杖失敗"})
+		return
+	}
+
+	token, err := apiTokenRepo.Create(claims.UserID, name, hash, prefix, scopes, expiresAt)
+	if err != nil {
+		writeTokenError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, CreateTokenResponse{Token: token, Plain: plain})
+}
+
+// GetToken returns one of the current user's personal access tokens
+func GetToken(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	claims := auth.GetUserFromContext(r.Context())
+	if claims == nil {
+		writeJSON(w, http.StatusUnauthorized, ErrorResponse{Success: false, Message: "未授權"})
+		return
+	}
+
+	id, err := strconv.Atoi(ps.ByName("id"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Success: false, Message: "無效的 ID"})
+		return
+	}
+
+	token, err := apiTokenRepo.FindByID(claims.UserID, id)
+	if err != nil {
+		writeTokenError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, token)
+}
+
+// UpdateToken renames a personal access token or changes its scopes
+func UpdateToken(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	claims := auth.GetUserFromContext(r.Context())
+	if claims == nil {
+		writeJSON(w, http.StatusUnauthorized, ErrorResponse{Success: false, Message: "未授權"})
+		return
+	}
+
+	id, err := strconv.Atoi(ps.ByName("id"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Success: false, Message: "無效的 ID"})
+		return
+	}
+
+	var req UpdateTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Success: false, Message: "無效的請求內容"})
+		return
+	}
+
+	acc, err := accountRepo.FindByID(claims.UserID)
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, ErrorResponse{Success: false, Message: "找不到帳號"})
+		return
+	}
+
+	name, scopes, err := validateTokenInput(req.Name, req.Scopes, acc.Role)
+	if err != nil {
+		writeTokenError(w, err)
+		return
+	}
+
+	if !checkAdminScopeMFA(w, claims, acc.Role, scopes) {
+		return
+	}
+
+	token, err := apiTokenRepo.Update(claims.UserID, id, name, scopes)
+	if err != nil {
+		writeTokenError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, token)
+}
+
+// DeleteToken revokes a personal access token
+func DeleteToken(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	claims := auth.GetUserFromContext(r.Context())
+	if claims == nil {
+		writeJSON(w, http.StatusUnauthorized, ErrorResponse{Success: false, Message: "未授權"})
+		return
+	}
+
+	id, err := strconv.Atoi(ps.ByName("id"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Success: false, Message: "無效的 ID"})
+		return
+	}
+
+	if err := apiTokenRepo.Delete(claims.UserID, id); err != nil {
+		writeTokenError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, SuccessResponse{Success: true, Message: "存取權杖已撤銷"})
+}
@@ -0,0 +1,369 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"time"
+
+	log "github.com/Ptt-Alertor/logrus"
+	"github.com/Ptt-Alertor/ptt-alertor/auth"
+	"github.com/Ptt-Alertor/ptt-alertor/models/account"
+	"github.com/Ptt-Alertor/ptt-alertor/models/audit"
+	"github.com/Ptt-Alertor/ptt-alertor/ratelimit"
+	"github.com/julienschmidt/httprouter"
+)
+
+var twoFactorRepo = &account.TwoFactorPostgres{}
+
+var totpCodePattern = regexp.MustCompile(`^\d{6}$`)
+
+// MFAChallengeResponse asks for a second factor to finish logging in
+type MFAChallengeResponse struct {
+	MFARequired    bool   `json:"mfa_required"`
+	ChallengeToken string `json:"challenge_token"`
+	ExpiresIn      int    `json:"expires_in"`
+}
+
+// TwoFactorCodeRequest carries a TOTP or recovery code
+type TwoFactorCodeRequest struct {
+	Code string `json:"code"`
+}
+
+// VerifyTwoFactorRequest finishes a login with a second factor
+type VerifyTwoFactorRequest struct {
+	ChallengeToken string `json:"challenge_token"`
+	Code           string `json:"code"`
+}
+
+// TwoFactorStatusResponse describes the current user's 2FA state
+type TwoFactorStatusResponse struct {
+	Enabled                bool `json:"enabled"`
+	Required               bool `json:"required"`
+	RecoveryCodesRemaining int  `json:"recovery_codes_remaining"`
+}
+
+// TwoFactorSetupResponse carries a new secret for the authenticator app
+type TwoFactorSetupResponse struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+// RecoveryCodesResponse carries recovery codes, shown only once
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// completeLogin issues tokens after the first factor, or a challenge when
+// the account has two-factor authentication enabled
+func completeLogin(w http.ResponseWriter, r *http.Request, acc *account.Account) {
+	enabled, err := twoFactorRepo.IsEnabled(acc.ID)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Success: false, Message: "查詢兩步驟驗證失敗"})
+		return
+	}
+	if !enabled {
+		issueTokens(w, r, acc, false)
+		return
+	}
+
+	token, err := auth.GenerateMFAChallengeToken(acc.ID, acc.Password)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Success: false, Message: "產生令牌失敗"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, MFAChallengeResponse{
+		MFARequired:    true,
+		ChallengeToken: token,
+		ExpiresIn:      int(auth.MFAChallengeTTL.Seconds()),
+	})
+}
+
+// checkSecondFactor accepts a current TOTP code or an unused recovery code
+// of an enabled enrollment
+func checkSecondFactor(userID int, code string) (bool, error) {
+	if totpCodePattern.MatchString(code) {
+		tf, err := twoFactorRepo.Find(userID)
+		if err == account.ErrTwoFactorNotSetup || (err == nil && !tf.Enabled) {
+			return false, account.ErrTwoFactorNotEnabled
+		}
+		if err != nil {
+			return false, err
+		}
+		step, ok := auth.ValidateTOTP(tf.Secret, code, time.Now())
+		if !ok {
+			return false, nil
+		}
+		return twoFactorRepo.UseStep(userID, step)
+	}
+	return twoFactorRepo.UseRecoveryCode(userID, auth.HashRecoveryCode(code))
+}
+
+// newRecoveryCodes generates recovery codes and their hashes
+func newRecoveryCodes() ([]string, []string, error) {
+	codes, err := auth.GenerateRecoveryCodes()
+	if err != nil {
+		return nil, nil, err
+	}
+	hashes := make([]string, len(codes))
+	for i, c := range codes {
+		hashes[i] = auth.HashRecoveryCode(c)
+	}
+	return codes, hashes, nil
+}
+
+// VerifyTwoFactor finishes a login with a TOTP or recovery code
+func VerifyTwoFactor(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	var req VerifyTwoFactorRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ChallengeToken == "" || req.Code == "" {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Success: false, Message: "無效的請求內容"})
+		return
+	}
+
+	claims, err := auth.ValidateActionToken(req.ChallengeToken, auth.PurposeMFAChallenge)
+	if err != nil {
+		writeJSON(w, http.StatusUnauthorized, ErrorResponse{Success: false, Message: "登入已逾時，請重新登入"})
+		return
+	}
+
+	acc, err := accountRepo.FindByID(claims.UserID)
+	if err != nil || claims.Fingerprint != auth.Fingerprint(acc.Password) {
+		writeJSON(w, http.StatusUnauthorized, ErrorResponse{Success: false, Message: "登入已逾時，請重新登入"})
+		return
+	}
+
+	if !acc.Enabled {
+		writeJSON(w, http.StatusForbidden, ErrorResponse{Success: false, Message: "帳號已停用"})
+		return
+	}
+
+	lockoutKey := mfaLockoutKey(acc.ID)
+	if !checkLockout(w, lockoutKey) {
+		return
+	}
+
+	ok, err := checkSecondFactor(acc.ID, req.Code)
+	if err != nil {
+		if err == account.ErrTwoFactorNotEnabled {
+			writeJSON(w, http.StatusUnauthorized, ErrorResponse{Success: false, Message: "登入已逾時，請重新登入"})
+			return
+		}
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Success: false, Message: "驗證失敗"})
+		return
+	}
+	if !ok {
+		failAttempt(w, lockoutKey, http.StatusUnauthorized, "驗證碼錯誤")
+		return
+	}
+	ratelimit.Reset(lockoutKey)
+
+	issueTokens(w, r, acc, true)
+}
+
+// TwoFactorStatus returns the current user's 2FA state
+func TwoFactorStatus(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	claims := auth.GetUserFromContext(r.Context())
+	if claims == nil {
+		writeJSON(w, http.StatusUnauthorized, ErrorResponse{Success: false, Message: "未授權"})
+		return
+	}
+
+	enabled, err := twoFactorRepo.IsEnabled(claims.UserID)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Success: false, Message: "查詢兩步驟驗證失敗"})
+		return
+	}
+	required, _ := roleLimitRepo.RequiresTwoFactor(claims.Role)
+	remaining := 0
+	if enabled {
+		remaining, _ = twoFactorRepo.CountRecoveryCodes(claims.UserID)
+	}
+
+	writeJSON(w, http.StatusOK, TwoFactorStatusResponse{
+		Enabled:                enabled,
+		Required:               required,
+		RecoveryCodesRemaining: remaining,
+	})
+}
+
+// SetupTwoFactor starts enrollment with a new secret, confirmed by
+// EnableTwoFactor
+func SetupTwoFactor(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	claims := auth.GetUserFromContext(r.Context())
+	if claims == nil {
+		writeJSON(w, http.StatusUnauthorized, ErrorResponse{Success: false, Message: "未授權"})
+		return
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Success: false, Message: "產生金鑰失敗"})
+		return
+	}
+
+	if err := twoFactorRepo.SetPending(claims.UserID, secret); err != nil {
+		if err == account.ErrTwoFactorEnabled {
+			writeJSON(w, http.StatusConflict, ErrorResponse{Success: false, Message: "已啟用兩步驟驗證"})
+			return
+		}
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Success: false, Message: "設定兩步驟驗證失敗"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, TwoFactorSetupResponse{
+		Secret: secret,
+		URI:    auth.TOTPURI(secret, claims.Email),
+	})
+}
+
+// EnableTwoFactor confirms enrollment with a code from the app and returns
+// recovery codes
+func EnableTwoFactor(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	claims := auth.GetUserFromContext(r.Context())
+	if claims == nil {
+		writeJSON(w, http.StatusUnauthorized, ErrorResponse{Success: false, Message: "未授權"})
+		return
+	}
+
+	var req TwoFactorCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Success: false, Message: "無效的請求內容"})
+		return
+	}
+
+	tf, err := twoFactorRepo.Find(claims.UserID)
+	if err != nil {
+		if err == account.ErrTwoFactorNotSetup {
+			writeJSON(w, http.StatusBadRequest, ErrorResponse{Success: false, Message: "請先設定兩步驟驗證"})
+			return
+		}
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Success: false, Message: "查詢兩步驟驗證失敗"})
+		return
+	}
+	if tf.Enabled {
+		writeJSON(w, http.StatusConflict, ErrorResponse{Success: false, Message: "已啟用兩步驟驗證"})
+		return
+	}
+
+	step, ok := auth.ValidateTOTP(tf.Secret, req.Code, time.Now())
+	if !ok {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Success: false, Message: "驗證碼錯誤"})
+		return
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Success: false, Message: "產生復原碼失敗"})
+		return
+	}
+
+	if err := twoFactorRepo.Enable(claims.UserID, step, hashes); err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Success: false, Message: "啟用兩步驟驗證失敗"})
+		return
+	}
+
+	recordAudit(r, claims, audit.ActionTwoFactorEnable, audit.TargetUser, claims.UserID, nil, nil)
+
+	// the current session just proved the second factor
+	if err := sessionRepo.MarkMFA(claims.SessionID); err != nil {
+		log.WithError(err).Error("Mark Session MFA Failed")
+	}
+
+	writeJSON(w, http.StatusOK, RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// DisableTwoFactor turns off 2FA unless the user's role requires it
+func DisableTwoFactor(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	claims := auth.GetUserFromContext(r.Context())
+	if claims == nil {
+		writeJSON(w, http.StatusUnauthorized, ErrorResponse{Success: false, Message: "未授權"})
+		return
+	}
+
+	var req TwoFactorCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Code == "" {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Success: false, Message: "無效的請求內容"})
+		return
+	}
+
+	required, err := roleLimitRepo.RequiresTwoFactor(claims.Role)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Success: false, Message: "查詢角色失敗"})
+		return
+	}
+	if required {
+		writeJSON(w, http.StatusForbidden, ErrorResponse{Success: false, Message: "此角色必須啟用兩步驟驗證"})
+		return
+	}
+
+	ok, err := checkSecondFactor(claims.UserID, req.Code)
+	if err != nil {
+		if err == account.ErrTwoFactorNotEnabled {
+			writeJSON(w, http.StatusBadRequest, ErrorResponse{Success: false, Message: "尚未啟用兩步驟驗證"})
+			return
+		}
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Success: false, Message: "驗證失敗"})
+		return
+	}
+	if !ok {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Success: false, Message: "驗證碼錯誤"})
+		return
+	}
+
+	if err := twoFactorRepo.Disable(claims.UserID); err != nil {
+		if err == account.ErrTwoFactorNotEnabled {
+			writeJSON(w, http.StatusBadRequest, ErrorResponse{Success: false, Message: "尚未啟用兩步驟驗證"})
+			return
+		}
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Success: false, Message: "停用兩步驟驗證失敗"})
+		return
+	}
+
+	recordAudit(r, claims, audit.ActionTwoFactorDisable, audit.TargetUser, claims.UserID, nil, nil)
+
+	writeJSON(w, http.StatusOK, SuccessResponse{Success: true, Message: "已停用兩步驟驗證"})
+}
+
+// RegenerateRecoveryCodes replaces every recovery code after checking a
+// current TOTP code
+func RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	claims := auth.GetUserFromContext(r.Context())
+	if claims == nil {
+		writeJSON(w, http.StatusUnauthorized, ErrorResponse{Success: false, Message: "未授權"})
+		return
+	}
+
+	var req TwoFactorCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || !totpCodePattern.MatchString(req.Code) {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Success: false, Message: "請輸入驗證器的 6 位數驗證碼"})
+		return
+	}
+
+	ok, err := checkSecondFactor(claims.UserID, req.Code)
+	if err != nil {
+		if err == account.ErrTwoFactorNotEnabled {
+			writeJSON(w, http.StatusBadRequest, ErrorResponse{Success: false, Message: "尚未啟用兩步驟驗證"})
+			return
+		}
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Success: false, Message: "驗證失敗"})
+		return
+	}
+	if !ok {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Success: false, Message: "驗證碼錯誤"})
+		return
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Success: false, Message: "產生復原碼失敗"})
+		return
+	}
+
+	if err := twoFactorRepo.ReplaceRecoveryCodes(claims.UserID, hashes); err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Success: false, Message: "更新復原碼失敗"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, RecoveryCodesResponse{RecoveryCodes: codes})
+}
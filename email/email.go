@@ -0,0 +1,86 @@
+// Package email sends account emails such as verification and password reset
+// links. The sender is chosen by MAIL_DRIVER: smtp, file or log (default).
+package email
+
+import (
+	"errors"
+	"os"
+	"sync"
+	"time"
+)
+
+var ErrNoRecipient = errors.New("mail has no recipient")
+
+// Message is a plain text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Sender delivers messages
+type Sender interface {
+	Send(msg Message) error
+}
+
+var (
+	sender     Sender
+	senderOnce sync.Once
+)
+
+// Default returns the sender configured by the environment
+func Default() Sender {
+	senderOnce.Do(func() {
+		if sender == nil {
+			sender = fromEnv()
+		}
+	})
+	return sender
+}
+
+// SetSender replaces the default sender, mainly for tests
+func SetSender(s Sender) {
+	senderOnce.Do(func() {})
+	sender = s
+}
+
+// Send delivers msg through the default sender
+func Send(msg Message) error {
+	if msg.To == "" {
+		return ErrNoRecipient
+	}
+	return Default().Send(msg)
+}
+
+func fromEnv() Sender {
+	switch os.Getenv("MAIL_DRIVER") {
+	case "smtp":
+		return &SMTPSender{
+			Host:     os.Getenv("SMTP_HOST"),
+			Port:     os.Getenv("SMTP_PORT"),
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     os.Getenv("MAIL_FROM"),
+		}
+	case "file":
+		dir := os.Getenv("MAIL_FILE_DIR")
+		if dir == "" {
+			dir = os.TempDir()
+		}
+		return &FileSender{Dir: dir, From: os.Getenv("MAIL_FROM")}
+	default:
+		return &LogSender{}
+	}
+}
+
+// format renders msg as an RFC 5322 message
+func format(from string, msg Message) []byte {
+	header := "From: " + from + "\r\n" +
+		"To: " + msg.To + "\r\n" +
+		"Subject: " + mimeHeader(msg.Subject) + "\r\n" +
+		"Date: " + time.Now().Format(time.RFC1123Z) + "\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: text/plain; charset=UTF-8\r\n" +
+		"Content-Transfer-Encoding: 8bit\r\n\r\n"
+	return []byte(header + msg.Body)
+}
@@ -0,0 +1,54 @@
+package email
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileSender_Send(t *testing.T) {
+	dir := t.TempDir()
+	s := &FileSender{Dir: dir, From: "noreply@example.com"}
+	if err := s.Send(VerificationMessage("user@example.com", "a+b")); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*user_at_example.com.eml"))
+	if len(files) != 1 {
+		t.Fatalf("Send() wrote %d files, want 1", len(files))
+	}
+	b, _ := os.ReadFile(files[0])
+	content := string(b)
+	for _, want := range []string{
+		"To: user@example.com\r\n",
+		"Subject: =?UTF-8?q?",
+		"/verify-email?token=a%2Bb",
+	} {
+		if !strings.Contains(content, want) {
+			t.Errorf("Send() content missing %q", want)
+		}
+	}
+}
+
+type recorder struct{ sent []Message }
+
+func (r *recorder) Send(msg Message) error {
+	r.sent = append(r.sent, msg)
+	return nil
+}
+
+func TestSend(t *testing.T) {
+	r := &recorder{}
+	SetSender(r)
+
+	if err := Send(Message{Subject: "no one"}); err != ErrNoRecipient {
+		t.Errorf("Send() error = %v, want %v", err, ErrNoRecipient)
+	}
+	if err := Send(Message{To: "user@example.com"}); err != nil {
+		t.Errorf("Send() error = %v", err)
+	}
+	if len(r.sent) != 1 {
+		t.Errorf("Send() delivered %d messages, want 1", len(r.sent))
+	}
+}
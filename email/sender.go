@@ -0,0 +1,68 @@
+package email
+
+import (
+	"fmt"
+	"mime"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	log "github.com/Ptt-Alertor/logrus"
+)
+
+func mimeHeader(s string) string {
+	return mime.QEncoding.Encode("UTF-8", s)
+}
+
+// SMTPSender sends mail through an SMTP server with PLAIN auth
+type SMTPSender struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+// Send implements Sender
+func (s *SMTPSender) Send(msg Message) error {
+	port := s.Port
+	if port == "" {
+		port = "587"
+	}
+	var auth smtp.Auth
+	if s.Username != "" {
+		auth = smtp.PlainAuth("", s.Username, s.Password, s.Host)
+	}
+	return smtp.SendMail(s.Host+":"+port, auth, s.From, []string{msg.To}, format(s.From, msg))
+}
+
+// FileSender writes each message as an .eml file, for local development
+type FileSender struct {
+	Dir  string
+	From string
+}
+
+// Send implements Sender
+func (s *FileSender) Send(msg Message) error {
+	if err := os.MkdirAll(s.Dir, 0o755); err != nil {
+		return err
+	}
+	recipient := strings.NewReplacer("@", "_at_", "/", "_").Replace(msg.To)
+	name := fmt.Sprintf("%d-%s.eml", time.Now().UnixNano(), recipient)
+	return os.WriteFile(filepath.Join(s.Dir, name), format(s.From, msg), 0o644)
+}
+
+// LogSender only logs messages, the default when no driver is configured
+type LogSender struct{}
+
+// Send implements Sender
+func (s *LogSender) Send(msg Message) error {
+	log.WithFields(log.Fields{
+		"to":      msg.To,
+		"subject": msg.Subject,
+		"body":    msg.Body,
+	}).Info("Mail")
+	return nil
+}
@@ -0,0 +1,43 @@
+package email
+
+import (
+	"net/url"
+	"os"
+	"strings"
+)
+
+const defaultSiteURL = "https://ptt.luan.com.tw"
+
+// SiteURL is the web frontend that email links point to, set by SITE_URL
+func SiteURL() string {
+	if u := os.Getenv("SITE_URL"); u != "" {
+		return strings.TrimRight(u, "/")
+	}
+	return defaultSiteURL
+}
+
+func link(path, token string) string {
+	return SiteURL() + path + "?token=" + url.QueryEscape(token)
+}
+
+// VerificationMessage asks the user to confirm their email address
+func VerificationMessage(to, token string) Message {
+	return Message{
+		To:      to,
+		Subject: "PTT Alertor 電子郵件驗證",
+		Body: "您好，\n\n請點擊以下連結完成電子郵件驗證（24 小時內有效）：\n" +
+			link("/verify-email", token) + "\n\n" +
+			"若您沒有註冊 PTT Alertor，請忽略此信。\n",
+	}
+}
+
+// PasswordResetMessage carries a link to choose a new password
+func PasswordResetMessage(to, token string) Message {
+	return Message{
+		To:      to,
+		Subject: "PTT Alertor 重設密碼",
+		Body: "您好，\n\n請點擊以下連結重設密碼（1 小時內有效，使用一次後失效）：\n" +
+			link("/reset-password", token) + "\n\n" +
+			"若您沒有申請重設密碼，請忽略此信，您的密碼不會變更。\n",
+	}
+}
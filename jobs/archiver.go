@@ -0,0 +1,93 @@
+package jobs
+
+import (
+	"os"
+	"strconv"
+	"time"
+
+	log "github.com/Ptt-Alertor/logrus"
+	"github.com/Ptt-Alertor/ptt-alertor/models/archive"
+	"github.com/Ptt-Alertor/ptt-alertor/models/article"
+	"github.com/Ptt-Alertor/ptt-alertor/myutil"
+	pttHttp "github.com/Ptt-Alertor/ptt-alertor/ptt/http"
+	"github.com/Ptt-Alertor/ptt-alertor/ptt/web"
+)
+
+const defaultArchiveRetentionDays = 180
+
+// archiveBodyDuration is the delay between body fetches to avoid rate limiting
+const archiveBodyDuration = 500 * time.Millisecond
+
+var archiveRepo = &archive.Postgres{}
+
+// archiveArticles stores crawled articles for search, and their bodies when
+// the board's policy asks for it
+func archiveArticles(board string, articles article.Articles, withPush bool) {
+	archived := make([]archive.Article, 0, len(articles))
+	for _, a := range articles {
+		a.Board = board
+		if aa, ok := archive.FromArticle(a); ok {
+			archived = append(archived, aa)
+		}
+	}
+	if len(archived) == 0 {
+		return
+	}
+
+	created, err := archiveRepo.Save(archived, withPush)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"runtime": myutil.BasicRuntimeInfo(),
+			"board":   board,
+		}).WithError(err).Error("Archive Articles Failed")
+		return
+	}
+	if len(created) == 0 {
+		return
+	}
+
+	policy, err := archiveRepo.GetPolicy(board)
+	if err != nil || !policy.StoreBody {
+		return
+	}
+	for _, code := range created {
+		time.Sleep(archiveBodyDuration)
+		pttHttp.WaitBackoff()
+		body, err := web.FetchArticleBody(board, code)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"board": board,
+				"code":  code,
+			}).WithError(err).Warn("Fetch Article Body Failed")
+			continue
+		}
+		if err := archiveRepo.UpdateBody(code, body); err != nil {
+			log.WithField("runtime", myutil.BasicRuntimeInfo()).WithError(err).Error("Archive Article Body Failed")
+		}
+	}
+}
+
+// ArchiveCleaner deletes archived articles past their board's retention
+type ArchiveCleaner struct {
+	defaultDays int
+}
+
+// NewArchiveCleaner creates an ArchiveCleaner, boards without a policy keep
+// articles for ARCHIVE_RETENTION_DAYS (default 180)
+func NewArchiveCleaner() *ArchiveCleaner {
+	days := defaultArchiveRetentionDays
+	if v, err := strconv.Atoi(os.Getenv("ARCHIVE_RETENTION_DAYS")); err == nil {
+		days = v
+	}
+	return &ArchiveCleaner{defaultDays: days}
+}
+
+// Run executes the archive cleanup job
+func (ac ArchiveCleaner) Run() {
+	deleted, err := archiveRepo.Purge(ac.defaultDays)
+	if err != nil {
+		log.WithField("runtime", myutil.BasicRuntimeInfo()).WithError(err).Error("Archive Cleaner Failed")
+		return
+	}
+	log.WithField("deleted", deleted).Info("Archive Cleaner Completed")
+}
@@ -0,0 +1,119 @@
+package jobs
+
+import (
+	"time"
+
+	log "github.com/Ptt-Alertor/logrus"
+	"github.com/Ptt-Alertor/ptt-alertor/models/catalog"
+	"github.com/Ptt-Alertor/ptt-alertor/myutil"
+	pttHttp "github.com/Ptt-Alertor/ptt-alertor/ptt/http"
+	"github.com/Ptt-Alertor/ptt-alertor/ptt/web"
+)
+
+// over18ChecksPerRun bounds how many unchecked boards are probed for the
+// age confirmation page in one run
+const over18ChecksPerRun = 200
+
+var catalogRepo = &catalog.Postgres{}
+
+// BoardCatalogSync crawls PTT's board hierarchy into the board catalog
+type BoardCatalogSync struct {
+	duration time.Duration
+	hotOnly  bool
+}
+
+// NewBoardCatalogSync creates a job walking every class page from the root
+func NewBoardCatalogSync() *BoardCatalogSync {
+	return &BoardCatalogSync{duration: 300 * time.Millisecond}
+}
+
+// NewHotBoardSync creates a job refreshing only the hot boards' popularity
+func NewHotBoardSync() *BoardCatalogSync {
+	return &BoardCatalogSync{duration: 300 * time.Millisecond, hotOnly: true}
+}
+
+// Run executes the catalog sync
+func (bcs BoardCatalogSync) Run() {
+	hot, err := web.FetchHotBoards()
+	if err != nil {
+		log.WithError(err).Error("Board Catalog: Fetch Hot Boards Failed")
+	} else {
+		bcs.save(hot)
+	}
+	if bcs.hotOnly {
+		return
+	}
+
+	total := 0
+	visited := map[string]bool{web.RootClass: true}
+	queue := []string{web.RootClass}
+	for len(queue) > 0 {
+		classID := queue[0]
+		queue = queue[1:]
+
+		time.Sleep(bcs.duration)
+		pttHttp.WaitBackoff()
+		entries, err := web.FetchClass(classID)
+		if err != nil {
+			log.WithField("class", classID).WithError(err).Warn("Board Catalog: Fetch Class Failed")
+			continue
+		}
+		boards := make([]web.BoardEntry, 0, len(entries))
+		for _, e := range entries {
+			if !e.IsClass() {
+				boards = append(boards, e)
+				continue
+			}
+			if !visited[e.ClassID] {
+				visited[e.ClassID] = true
+				queue = append(queue, e.ClassID)
+			}
+		}
+		bcs.save(boards)
+		total += len(boards)
+	}
+
+	bcs.checkOver18()
+
+	log.WithFields(log.Fields{
+		"classes": len(visited),
+		"boards":  total,
+	}).Info("Board Catalog Synced")
+}
+
+func (bcs BoardCatalogSync) save(entries []web.BoardEntry) {
+	if len(entries) == 0 {
+		return
+	}
+	boards := make([]*catalog.Board, 0, len(entries))
+	for _, e := range entries {
+		boards = append(boards, &catalog.Board{
+			Name:        e.Name,
+			Title:       e.Title,
+			Category:    e.Class,
+			OnlineUsers: e.Users,
+		})
+	}
+	if err := catalogRepo.Upsert(boards); err != nil {
+		log.WithField("runtime", myutil.BasicRuntimeInfo()).WithError(err).Error("Board Catalog: Save Failed")
+	}
+}
+
+func (bcs BoardCatalogSync) checkOver18() {
+	names, err := catalogRepo.UnknownOver18(over18ChecksPerRun)
+	if err != nil {
+		log.WithField("runtime", myutil.BasicRuntimeInfo()).WithError(err).Error("Board Catalog: Query Over18 Failed")
+		return
+	}
+	for _, name := range names {
+		time.Sleep(bcs.duration)
+		pttHttp.WaitBackoff()
+		over18, err := web.IsOver18(name)
+		if err != nil {
+			continue
+		}
+		if err := catalogRepo.SetOver18(name, over18); err != nil {
+			log.WithField("runtime", myutil.BasicRuntimeInfo()).WithError(err).Error("Board Catalog: Save Over18 Failed")
+		}
+	}
+}
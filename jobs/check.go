@@ -8,6 +8,7 @@ import (
 
 	"github.com/Ptt-Alertor/ptt-alertor/channels/telegram"
 	accountModel "github.com/Ptt-Alertor/ptt-alertor/models/account"
+	"github.com/Ptt-Alertor/ptt-alertor/models/archive"
 	"github.com/Ptt-Alertor/ptt-alertor/models/counter"
 )
 
@@ -65,51 +66,67 @@ func sendTelegram(c check) {
 	chatID := cr.Profile.TelegramChat
 	text := c.String()
 
-	// Check if we should show mail buttons
-	mailDataList := getMailButtonData(cr)
+	// Check if we should show PTT buttons
+	var mailDataList []*telegram.MailButtonData
+	var actionDataList []*telegram.ActionButtonData
+	if userID, ok := pttButtonUser(cr); ok {
+		mailDataList = getMailButtonData(cr, userID)
+		actionDataList = getActionButtonData(cr, userID)
+	}
 
-	if len(mailDataList) > 0 {
-		telegram.SendMessageWithMailButton(chatID, text, mailDataList)
+	if len(mailDataList) > 0 || len(actionDataList) > 0 {
+		telegram.SendMessageWithPTTButtons(chatID, text, mailDataList, actionDataList)
 	} else {
 		telegram.SendTextMessage(chatID, text)
 	}
 }
 
-// getMailButtonData checks if mail button should be shown and returns data for it
-// Returns nil if conditions are not met
-func getMailButtonData(cr Checker) []*telegram.MailButtonData {
+// pttButtonUser returns the user ID when PTT buttons may be shown: a web
+// account whose role is granted PTT mail and has a PTT account bound
+func pttButtonUser(cr Checker) (int, bool) {
 	// Must have at least one article
 	if len(cr.articles) == 0 {
-		return nil
+		return 0, false
 	}
 
 	// Check if this is a web account (format: web_<userID>)
 	account := cr.Profile.Account
 	if !strings.HasPrefix(account, accountModel.WebAccountPrefix) {
-		return nil
+		return 0, false
 	}
 
 	// Parse user ID from account
 	userIDStr := strings.TrimPrefix(account, accountModel.WebAccountPrefix)
 	userID, err := strconv.Atoi(userIDStr)
 	if err != nil {
-		return nil
+		return 0, false
 	}
 
-	// Check user role (VIP or admin only)
+	// Check the user's role is granted PTT mail
 	accRepo := &accountModel.Postgres{}
 	acc, err := accRepo.FindByID(userID)
-	if err != nil || (acc.Role != "vip" && acc.Role != "admin") {
-		return nil
+	if err != nil {
+		return 0, false
+	}
+	roleRepo := &accountModel.RoleLimitPostgres{}
+	if granted, err := roleRepo.Can(acc.Role, accountModel.PermPTTMail); err != nil || !granted {
+		return 0, false
 	}
 
-	// Check if PTT account is bound
+	// Check if PTT account is bound and its credentials are not known wrong
 	pttRepo := &accountModel.PTTAccountPostgres{}
-	hasPTT, err := pttRepo.Exists(userID)
-	if err != nil || !hasPTT {
-		return nil
+	pttAccount, err := pttRepo.FindByUserID(userID)
+	if err != nil || pttAccount.CredentialStatus == accountModel.CredentialInvalid {
+		return 0, false
 	}
 
+	return userID, true
+}
+
+// getMailButtonData returns the mail buttons of the articles the mail rule
+// of the matching subscription lets through
+// Returns nil if the matching subscription has no mail template
+func getMailButtonData(cr Checker, userID int) []*telegram.MailButtonData {
 	// Find subscription with mail template
 	subRepo := &accountModel.SubscriptionPostgres{}
 	subs, err := subRepo.ListByUserID(userID)
@@ -119,9 +136,10 @@ func getMailButtonData(cr Checker) []*telegram.MailButtonData {
 
 	// Find matching subscription with mail template
 	var matchingSub *accountModel.Subscription
+	var templates int
 	for _, sub := range subs {
 		if sub.Board == cr.board && sub.SubType == cr.subType && sub.Value == cr.word && sub.Enabled {
-			if sub.Mail != nil && (sub.Mail.Subject != "" || sub.Mail.Content != "") {
+			if templates = len(sub.MailTemplates()); templates > 0 {
 				matchingSub = sub
 				break
 			}
@@ -135,16 +153,46 @@ func getMailButtonData(cr Checker) []*telegram.MailButtonData {
 	// Create mail button data for each article with author
 	var mailDataList []*telegram.MailButtonData
 	for i, article := range cr.articles {
-		if article.Author == "" {
+		if article.Author == "" || !matchingSub.MailRule.Match(article.Title) {
 			continue
 		}
+		// the code lets the mail template reference the article
+		var code string
+		if aa, ok := archive.FromArticle(article); ok {
+			code = aa.Code
+		}
 		mailDataList = append(mailDataList, &telegram.MailButtonData{
 			UserID:         userID,
 			SubscriptionID: matchingSub.ID,
 			ArticleAuthor:  article.Author,
+			ArticleCode:    code,
 			ArticleIndex:   i + 1, // 1-based index
+			Templates:      templates,
 		})
 	}
 
 	return mailDataList
 }
+
+// getActionButtonData returns the push and reply buttons of the articles,
+// which need the board and code to find the article on PTT
+func getActionButtonData(cr Checker, userID int) []*telegram.ActionButtonData {
+	var actionDataList []*telegram.ActionButtonData
+	for i, article := range cr.articles {
+		aa, ok := archive.FromArticle(article)
+		if !ok {
+			continue
+		}
+		board := aa.Board
+		if board == "" {
+			board = cr.board
+		}
+		actionDataList = append(actionDataList, &telegram.ActionButtonData{
+			UserID:       userID,
+			Board:        board,
+			ArticleCode:  aa.Code,
+			ArticleIndex: i + 1, // 1-based index
+		})
+	}
+	return actionDataList
+}
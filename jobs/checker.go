@@ -10,12 +10,14 @@ import (
 
 	log "github.com/Ptt-Alertor/logrus"
 
+	"github.com/Ptt-Alertor/ptt-alertor/cluster"
 	"github.com/Ptt-Alertor/ptt-alertor/models"
 	"github.com/Ptt-Alertor/ptt-alertor/models/article"
 	"github.com/Ptt-Alertor/ptt-alertor/models/author"
 	"github.com/Ptt-Alertor/ptt-alertor/models/board"
 	"github.com/Ptt-Alertor/ptt-alertor/models/keyword"
 	"github.com/Ptt-Alertor/ptt-alertor/models/user"
+	pttHttp "github.com/Ptt-Alertor/ptt-alertor/ptt/http"
 )
 
 const checkHighBoardDuration = 1 * time.Second
@@ -173,8 +175,14 @@ func (c Checker) Stop() {
 }
 
 func checkBoards(bds []*board.Board, duration time.Duration) {
+	node := cluster.Self()
 	for _, bd := range bds {
+		// each board is crawled by exactly one node in the cluster
+		if !node.Owns(bd.Name) {
+			continue
+		}
 		time.Sleep(duration)
+		pttHttp.WaitBackoff()
 		go checkNewArticle(bd, boardCh)
 	}
 }
@@ -185,6 +193,7 @@ func checkNewArticle(bd *board.Board, boardCh chan *board.Board) {
 		bd.Articles = bd.OnlineArticles
 		log.WithField("board", bd.Name).Info("Created Articles")
 		bd.Save()
+		go archiveArticles(bd.Name, bd.OnlineArticles, false)
 	}
 	if len(bd.NewArticles) != 0 {
 		bd.Articles = bd.OnlineArticles
@@ -192,6 +201,7 @@ func checkNewArticle(bd *board.Board, boardCh chan *board.Board) {
 			"board": bd.Name,
 			"count": len(bd.NewArticles),
 		}).Infof("Updated Articles%s", bd.NewArticles.String())
+		go archiveArticles(bd.Name, bd.NewArticles, false)
 		if err := bd.Save(); err == nil {
 			boardCh <- bd
 		}
@@ -224,7 +234,7 @@ func checkKeywordSubscription(user user.User, bd *board.Board, cker Checker) {
 func checkKeyword(keyword string, bd *board.Board, cker Checker) {
 	keywordArticles := make(article.Articles, 0)
 	for _, newAtcl := range bd.NewArticles {
-		if newAtcl.MatchKeyword(keyword) {
+		if newAtcl.MatchKeyword(keyword) && claimDelivery(cker.Profile.Account, newAtcl) {
 			keywordArticles = append(keywordArticles, newAtcl)
 		}
 	}
@@ -263,7 +273,7 @@ func checkAuthorSubscription(user user.User, bd *board.Board, cker Checker) {
 func checkAuthor(author string, bd *board.Board, cker Checker) {
 	authorArticles := make(article.Articles, 0)
 	for _, newAtcl := range bd.NewArticles {
-		if strings.EqualFold(newAtcl.Author, author) {
+		if strings.EqualFold(newAtcl.Author, author) && claimDelivery(cker.Profile.Account, newAtcl) {
 			authorArticles = append(authorArticles, newAtcl)
 		}
 	}
@@ -275,3 +285,23 @@ func checkAuthor(author string, bd *board.Board, cker Checker) {
 		cker.ch <- cker
 	}
 }
+
+// claimDelivery makes sure a user is alerted about an article only once,
+// no matter how many subscriptions or instances match it
+func claimDelivery(account string, a article.Article) bool {
+	key := a.Code
+	if key == "" {
+		key = a.Link
+	}
+	if key == "" {
+		return true
+	}
+	return cluster.ClaimDelivery(account, key)
+}
+
+// claimAlert is claimDelivery for alerts an article can raise more than
+// once, keyed by the parts naming the alert, e.g. the board, article code
+// and subscription
+func claimAlert(account string, parts ...string) bool {
+	return cluster.ClaimDelivery(account, strings.Join(parts, ":"))
+}
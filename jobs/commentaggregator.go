@@ -8,6 +8,7 @@ import (
 	"github.com/Ptt-Alertor/ptt-alertor/connections"
 	"github.com/Ptt-Alertor/ptt-alertor/models/article"
 	"github.com/Ptt-Alertor/ptt-alertor/myutil"
+	pttHttp "github.com/Ptt-Alertor/ptt-alertor/ptt/http"
 	"github.com/Ptt-Alertor/ptt-alertor/ptt/web"
 )
 
@@ -38,6 +39,7 @@ func (ca CommentAggregator) Run() {
 	updated := 0
 	for _, a := range articles {
 		time.Sleep(ca.duration)
+		pttHttp.WaitBackoff()
 
 		fetched, err := web.FetchArticle(a.Board, a.Code)
 		if err != nil {
@@ -70,6 +72,14 @@ func (ca CommentAggregator) Run() {
 			continue
 		}
 
+		positive, negative, neutral := fetched.Comments.CountByTag()
+		if err := archiveRepo.UpdatePushCounts(a.Code, a.PushSum, positive, negative, neutral); err != nil {
+			log.WithFields(log.Fields{
+				"board": a.Board,
+				"code":  a.Code,
+			}).WithError(err).Warn("Comment Aggregator: Failed to update archive")
+		}
+
 		updated++
 	}
 
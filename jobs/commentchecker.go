@@ -2,6 +2,7 @@ package jobs
 
 import (
 	"context"
+	"strconv"
 	"sync"
 	"time"
 
@@ -9,8 +10,10 @@ import (
 
 	"fmt"
 
+	"github.com/Ptt-Alertor/ptt-alertor/cluster"
 	"github.com/Ptt-Alertor/ptt-alertor/models"
 	"github.com/Ptt-Alertor/ptt-alertor/models/article"
+	pttHttp "github.com/Ptt-Alertor/ptt-alertor/ptt/http"
 	"github.com/Ptt-Alertor/ptt-alertor/ptt/web"
 )
 
@@ -57,8 +60,13 @@ func (cc commentChecker) Run() {
 				return
 			default:
 				codes := new(article.Articles).List()
+				node := cluster.Self()
 				for _, code := range codes {
+					if !node.Owns(code) {
+						continue
+					}
 					time.Sleep(cc.duration)
+					pttHttp.WaitBackoff()
 					go cc.checkComments(code, ach)
 				}
 			}
@@ -134,6 +142,12 @@ func (cc commentChecker) checkSubscribers() {
 }
 
 func (cc commentChecker) send(account string) {
+	// the comments up to the last push are sent once, also when the
+	// article moved to another checker while they were fetched
+	lastPush := strconv.FormatInt(cc.Article.LastPushDateTime.Unix(), 10)
+	if !claimAlert(account, "comment", cc.Article.Board, cc.Article.Code, lastPush) {
+		return
+	}
 	cc.board = cc.Article.Board
 	cc.subType = "push"
 	cc.word = cc.Article.Code
@@ -0,0 +1,119 @@
+package jobs
+
+import (
+	"errors"
+	"time"
+
+	log "github.com/Ptt-Alertor/logrus"
+
+	"github.com/Ptt-Alertor/ptt-alertor/models/account"
+	"github.com/Ptt-Alertor/ptt-alertor/models/pttmail"
+	"github.com/Ptt-Alertor/ptt-alertor/myutil"
+	"github.com/Ptt-Alertor/ptt-alertor/ptt/mail"
+)
+
+const (
+	// credentialVerifyInterval is how long a login vouches for the
+	// credentials, mails and inbox checks count as logins too
+	credentialVerifyInterval = 24 * time.Hour
+	// credentialRetry spaces out checks of credentials PTT could not be
+	// reached to verify
+	credentialRetry = 30 * time.Minute
+)
+
+// CredentialVerifier queues login checks of newly bound PTT accounts and of
+// ones not logged in for a day, the PTT mail workers run them
+type CredentialVerifier struct{}
+
+// NewCredentialVerifier creates a CredentialVerifier
+func NewCredentialVerifier() *CredentialVerifier {
+	return &CredentialVerifier{}
+}
+
+// Run queues the due credential checks
+func (cv CredentialVerifier) Run() {
+	n, err := pttMailRepo.EnqueueCredentialChecks(credentialVerifyInterval, credentialRetry)
+	if err != nil {
+		log.WithField("runtime", myutil.BasicRuntimeInfo()).WithError(err).Error("Enqueue PTT Credential Checks Failed")
+		return
+	}
+	if n > 0 {
+		log.WithField("checks", n).Info("PTT Credential Checks Queued")
+	}
+}
+
+// verifyCredentials runs a credential check job. A failed check is not
+// retried, the verifier queues the next one.
+func (pm PTTMailer) verifyCredentials(j *pttmail.Job, entry *log.Entry) {
+	err := checkPTTLogin(j)
+
+	// hold back the account's next job before this one leaves running
+	if perr := pttMailRepo.Pace(j.PTTUsername, pttMailPacing); perr != nil {
+		entry.WithError(perr).Error("Pace PTT Mail Jobs Failed")
+	}
+
+	if err == nil {
+		if err := pttMailRepo.Complete(j.ID); err != nil {
+			entry.WithError(err).Error("Complete PTT Mail Job Failed")
+		}
+		entry.Info("PTT Credentials Verified")
+		return
+	}
+
+	if ferr := pttMailRepo.Fail(j.ID, err.Error()); ferr != nil {
+		entry.WithError(ferr).Error("Fail PTT Mail Job Failed")
+	}
+	entry.WithError(err).Warn("PTT Credential Check Failed")
+}
+
+func checkPTTLogin(j *pttmail.Job) error {
+	username, password, err := pttCredentials(j.UserID)
+	if err != nil {
+		return err
+	}
+	err = mail.NewPTTClient(username, password).TestLogin()
+	recordLogin(j.UserID, username, err)
+	return err
+}
+
+// pttCredentials returns the user's PTT credentials unless they are known
+// wrong, logging in with a wrong password again and again gets the account
+// locked on PTT
+func pttCredentials(userID int) (username, password string, err error) {
+	pttRepo := &account.PTTAccountPostgres{}
+	acc, err := pttRepo.FindByUserID(userID)
+	if err != nil {
+		return "", "", err
+	}
+	if acc.CredentialStatus == account.CredentialInvalid {
+		return "", "", account.ErrPTTCredentialsInvalid
+	}
+	return pttRepo.GetCredentials(userID)
+}
+
+// recordLogin records whether logging in as username worked and tells the
+// user when it changed. Errors other than a refused login say nothing about
+// the credentials.
+func recordLogin(userID int, username string, err error) {
+	status, lastError := account.CredentialValid, ""
+	if err != nil {
+		if !errors.Is(err, mail.ErrLoginFailed) {
+			return
+		}
+		status, lastError = account.CredentialInvalid, err.Error()
+	}
+
+	changed, serr := (&account.PTTAccountPostgres{}).SetCredentialStatus(userID, username, status, lastError)
+	if serr != nil {
+		log.WithField("user_id", userID).WithError(serr).Error("Record PTT Credential Status Failed")
+		return
+	}
+	if !changed {
+		return
+	}
+	if status == account.CredentialValid {
+		notifyUser(userID, "✅ PTT 帳號 "+username+" 驗證成功")
+		return
+	}
+	notifyUser(userID, "🔑 PTT 帳號 "+username+" 密碼錯誤，已暫停寄信、推文、回文與收信通知，請重新設定帳號密碼")
+}
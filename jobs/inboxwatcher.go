@@ -0,0 +1,158 @@
+package jobs
+
+import (
+	"os"
+	"strconv"
+	"time"
+
+	log "github.com/Ptt-Alertor/logrus"
+
+	"github.com/Ptt-Alertor/ptt-alertor/channels/telegram"
+	"github.com/Ptt-Alertor/ptt-alertor/models/account"
+	"github.com/Ptt-Alertor/ptt-alertor/models/binding"
+	"github.com/Ptt-Alertor/ptt-alertor/models/pttmail"
+	"github.com/Ptt-Alertor/ptt-alertor/myutil"
+	"github.com/Ptt-Alertor/ptt-alertor/ptt/mail"
+)
+
+const (
+	defaultInboxInterval = 15 * time.Minute
+	// minInboxInterval keeps the watcher's logins far apart, each check is
+	// a PTT login
+	minInboxInterval = 5 * time.Minute
+	// inboxMailLimit bounds the mails forwarded per check, the rest come
+	// with the next one
+	inboxMailLimit = 5
+	// inboxCheckRetention is how long finished checks stay in the queue
+	inboxCheckRetention = 24 * time.Hour
+)
+
+// InboxWatcher queues inbox checks of the PTT accounts that opted in, the
+// PTT mail workers log in and forward new mails
+type InboxWatcher struct {
+	interval time.Duration
+}
+
+// NewInboxWatcher creates an InboxWatcher checking each account every
+// PTT_INBOX_INTERVAL (default 15m, at least 5m)
+func NewInboxWatcher() *InboxWatcher {
+	return &InboxWatcher{interval: parseInboxInterval(os.Getenv("PTT_INBOX_INTERVAL"))}
+}
+
+func parseInboxInterval(v string) time.Duration {
+	if v == "" {
+		return defaultInboxInterval
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		log.WithField("env", "PTT_INBOX_INTERVAL").Warn("Invalid PTT Inbox Interval, Using Default")
+		return defaultInboxInterval
+	}
+	return max(d, minInboxInterval)
+}
+
+// Run queues the due inbox checks and deletes old finished inbox and
+// credential checks
+func (iw InboxWatcher) Run() {
+	n, err := pttMailRepo.EnqueueInboxChecks(iw.interval)
+	if err != nil {
+		log.WithField("runtime", myutil.BasicRuntimeInfo()).WithError(err).Error("Enqueue PTT Inbox Checks Failed")
+		return
+	}
+	if n > 0 {
+		log.WithField("checks", n).Info("PTT Inbox Checks Queued")
+	}
+
+	if _, err := pttMailRepo.DeleteChecks(time.Now().Add(-inboxCheckRetention)); err != nil {
+		log.WithField("runtime", myutil.BasicRuntimeInfo()).WithError(err).Error("Delete Finished PTT Checks Failed")
+	}
+}
+
+// checkInbox runs an inbox check job. A failed check is not retried, the
+// watcher queues the next one after the interval.
+func (pm PTTMailer) checkInbox(j *pttmail.Job, entry *log.Entry) {
+	forwarded, err := checkPTTInbox(j)
+
+	// hold back the account's next job before this one leaves running
+	if perr := pttMailRepo.Pace(j.PTTUsername, pttMailPacing); perr != nil {
+		entry.WithError(perr).Error("Pace PTT Mail Jobs Failed")
+	}
+
+	if err == nil {
+		if err := pttMailRepo.Complete(j.ID); err != nil {
+			entry.WithError(err).Error("Complete PTT Mail Job Failed")
+		}
+		entry.WithField("mails", forwarded).Info("PTT Inbox Checked")
+		return
+	}
+
+	if ferr := pttMailRepo.Fail(j.ID, err.Error()); ferr != nil {
+		entry.WithError(ferr).Error("Fail PTT Mail Job Failed")
+	}
+	entry.WithError(err).Warn("PTT Inbox Check Failed")
+}
+
+// checkPTTInbox reads the new mails of the job owner's mailbox and forwards
+// them, returning how many were forwarded
+func checkPTTInbox(j *pttmail.Job) (int, error) {
+	pttRepo := &account.PTTAccountPostgres{}
+	lastIndex, checked, err := pttRepo.InboxState(j.UserID)
+	if err != nil {
+		return 0, err
+	}
+	// the first check only notes where the mailbox is
+	if !checked {
+		lastIndex = -1
+	}
+
+	username, password, err := pttCredentials(j.UserID)
+	if err != nil {
+		return 0, err
+	}
+	inbox, err := mail.NewPTTClient(username, password).Inbox(lastIndex, inboxMailLimit)
+	recordLogin(j.UserID, username, err)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, m := range inbox.Mails {
+		forwardInboxMail(j.UserID, m)
+	}
+	return len(inbox.Mails), pttRepo.SaveInboxState(j.UserID, inbox.LastIndex)
+}
+
+// forwardInboxMail sends the mail to the user's notification channels
+func forwardInboxMail(userID int, m *mail.InboxMail) {
+	for _, chatID := range telegramChats(userID) {
+		telegram.SendInboxMail(chatID, userID, m)
+	}
+}
+
+// notifyUser sends text to the user's notification channels
+func notifyUser(userID int, text string) {
+	for _, chatID := range telegramChats(userID) {
+		telegram.SendTextMessage(chatID, text)
+	}
+}
+
+// telegramChats returns the enabled Telegram bindings of the user, the only
+// channel able to take PTT mails
+func telegramChats(userID int) []int64 {
+	bindings, err := (&binding.Postgres{}).FindAllByUser(userID)
+	if err != nil {
+		log.WithField("user_id", userID).WithError(err).Error("Find Notification Bindings Failed")
+		return nil
+	}
+	var chats []int64
+	for _, b := range bindings {
+		if b.Service != binding.ServiceTelegram || !b.Enabled || b.ServiceID == "" {
+			continue
+		}
+		chatID, err := strconv.ParseInt(b.ServiceID, 10, 64)
+		if err != nil {
+			continue
+		}
+		chats = append(chats, chatID)
+	}
+	return chats
+}
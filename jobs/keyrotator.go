@@ -0,0 +1,33 @@
+package jobs
+
+import (
+	log "github.com/Ptt-Alertor/logrus"
+	"github.com/Ptt-Alertor/ptt-alertor/models/account"
+	"github.com/Ptt-Alertor/ptt-alertor/myutil"
+)
+
+// KeyRotator re-encrypts stored PTT passwords with the active key
+type KeyRotator struct{}
+
+// NewKeyRotator creates a KeyRotator
+func NewKeyRotator() *KeyRotator {
+	return &KeyRotator{}
+}
+
+// Run executes the re-encryption job
+func (kr KeyRotator) Run() {
+	migrated, failed, err := (&account.PTTAccountPostgres{}).ReEncrypt()
+	if err != nil {
+		log.WithField("runtime", myutil.BasicRuntimeInfo()).WithError(err).Error("Key Rotator Failed")
+		return
+	}
+	entry := log.WithFields(log.Fields{
+		"migrated": migrated,
+		"failed":   failed,
+	})
+	if failed > 0 {
+		entry.Warn("Key Rotator Completed With Undecryptable Passwords")
+		return
+	}
+	entry.Info("Key Rotator Completed")
+}
@@ -0,0 +1,228 @@
+package jobs
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"time"
+
+	log "github.com/Ptt-Alertor/logrus"
+
+	"github.com/Ptt-Alertor/ptt-alertor/channels/telegram"
+	"github.com/Ptt-Alertor/ptt-alertor/models/account"
+	"github.com/Ptt-Alertor/ptt-alertor/models/pttmail"
+	"github.com/Ptt-Alertor/ptt-alertor/myutil"
+	"github.com/Ptt-Alertor/ptt-alertor/ptt/mail"
+)
+
+const (
+	defaultPTTMailWorkers = 4
+	pttMailPollInterval   = 2 * time.Second
+	// pttMailPacing spaces out the logins of one PTT account, PTT kicks
+	// accounts that log in too often
+	pttMailPacing = 20 * time.Second
+	// pttMailStaleAfter is well past the SSH client's own timeout
+	pttMailStaleAfter = 5 * time.Minute
+)
+
+var pttMailRepo = &pttmail.Postgres{}
+
+// PTTMailer sends queued PTT mails, pushes and replies, and checks inboxes.
+// Jobs are claimed in the database so every instance can run one, a PTT
+// account is only logged in once at a time.
+type PTTMailer struct {
+	workers int
+}
+
+// NewPTTMailer creates a PTTMailer running PTT_MAIL_WORKERS (default 4)
+// workers
+func NewPTTMailer() *PTTMailer {
+	workers := defaultPTTMailWorkers
+	if v, err := strconv.Atoi(os.Getenv("PTT_MAIL_WORKERS")); err == nil && v > 0 {
+		workers = v
+	}
+	return &PTTMailer{workers: workers}
+}
+
+// Run starts the workers and requeues jobs of workers that died mid-send
+func (pm PTTMailer) Run() {
+	for i := 0; i < pm.workers; i++ {
+		go pm.work()
+	}
+	for range time.Tick(pttMailStaleAfter) {
+		n, err := pttMailRepo.RequeueStale(pttMailStaleAfter)
+		if err != nil {
+			log.WithField("runtime", myutil.BasicRuntimeInfo()).WithError(err).Error("Requeue Stale PTT Mail Jobs Failed")
+			continue
+		}
+		if n > 0 {
+			log.WithField("jobs", n).Warn("Requeued Stale PTT Mail Jobs")
+		}
+	}
+}
+
+func (pm PTTMailer) work() {
+	for {
+		j, err := pttMailRepo.Claim()
+		if err != nil {
+			log.WithField("runtime", myutil.BasicRuntimeInfo()).WithError(err).Error("Claim PTT Mail Job Failed")
+		}
+		if j == nil {
+			time.Sleep(pttMailPollInterval)
+			continue
+		}
+		pm.process(j)
+	}
+}
+
+func (pm PTTMailer) process(j *pttmail.Job) {
+	entry := log.WithFields(log.Fields{
+		"job_id":    j.ID,
+		"kind":      j.Kind,
+		"user_id":   j.UserID,
+		"recipient": j.Recipient,
+		"board":     j.Board,
+		"attempt":   j.Attempts,
+	})
+	switch j.Kind {
+	case pttmail.KindInbox:
+		pm.checkInbox(j, entry)
+		return
+	case pttmail.KindVerify:
+		pm.verifyCredentials(j, entry)
+		return
+	}
+	isMail := j.Kind == pttmail.KindMail
+
+	// a double tap or a second alert may have queued the same mail twice,
+	// jobs of one account run in turn so the first is logged by now. Mails
+	// without a subscription reply to the inbox and are not duplicates.
+	if cooldown := pttmail.Cooldown(); isMail && j.SubscriptionID != nil && cooldown > 0 {
+		last, err := pttMailRepo.LastSent(j.UserID, j.Recipient, j.ArticleCode, time.Now().Add(-cooldown))
+		if err != nil {
+			entry.WithError(err).Error("Check PTT Mail Cooldown Failed")
+		}
+		if last != nil {
+			if err := pttMailRepo.Fail(j.ID, "duplicate of mail sent at "+last.CreatedAt.Format(time.RFC3339)); err != nil {
+				entry.WithError(err).Error("Fail PTT Mail Job Failed")
+			}
+			entry.Info("Duplicate PTT Mail Skipped")
+			notifyPTTMail(j, "📭 已於 "+account.FormatMailDate(last.CreatedAt)+" 寄信給 "+j.Recipient+"，略過重複寄送")
+			return
+		}
+	}
+
+	err := runPTTJob(j)
+
+	// hold back the account's next job before this one leaves running
+	if perr := pttMailRepo.Pace(j.PTTUsername, pttMailPacing); perr != nil {
+		entry.WithError(perr).Error("Pace PTT Mail Jobs Failed")
+	}
+
+	if err == nil {
+		if err := pttMailRepo.Complete(j.ID); err != nil {
+			entry.WithError(err).Error("Complete PTT Mail Job Failed")
+		}
+		if isMail {
+			if err := pttMailRepo.Log(j, pttmail.StatusSent, ""); err != nil {
+				entry.WithError(err).Error("Log PTT Mail Failed")
+			}
+		}
+		entry.Info("PTT Mail Job Done")
+		notifyPTTMail(j, "✅ 已成功"+jobAction(j))
+		return
+	}
+
+	if permanentMailError(err) || j.Attempts >= pttmail.MaxAttempts {
+		if ferr := pttMailRepo.Fail(j.ID, err.Error()); ferr != nil {
+			entry.WithError(ferr).Error("Fail PTT Mail Job Failed")
+		}
+		if isMail {
+			if lerr := pttMailRepo.Log(j, pttmail.StatusFailed, err.Error()); lerr != nil {
+				entry.WithError(lerr).Error("Log PTT Mail Failed")
+			}
+		}
+		entry.WithError(err).Error("PTT Mail Job Failed")
+		notifyPTTMail(j, failedJobText(j, err))
+		return
+	}
+
+	delay := pttmail.RetryDelay(j.Attempts)
+	if rerr := pttMailRepo.Retry(j.ID, err.Error(), time.Now().Add(delay)); rerr != nil {
+		entry.WithError(rerr).Error("Retry PTT Mail Job Failed")
+	}
+	entry.WithError(err).Warn("PTT Mail Job Failed, Retrying")
+	notifyPTTMail(j, "⏳ "+jobAction(j)+" 失敗，將於 "+strconv.Itoa(int(delay.Minutes()))+
+		" 分鐘後重試 ("+strconv.Itoa(j.Attempts)+"/"+strconv.Itoa(pttmail.MaxAttempts)+")")
+}
+
+// runPTTJob logs in with the job owner's current credentials, so a
+// password changed after queueing is used
+func runPTTJob(j *pttmail.Job) error {
+	username, password, err := pttCredentials(j.UserID)
+	if err != nil {
+		return err
+	}
+	client := mail.NewPTTClient(username, password)
+	switch j.Kind {
+	case pttmail.KindPush:
+		err = client.Push(j.Board, j.ArticleCode, mail.PushType(j.PushType), j.Content)
+	case pttmail.KindReply:
+		err = client.Reply(j.Board, j.ArticleCode, j.Content)
+	default:
+		err = client.SendMail(j.Recipient, j.Subject, j.Content)
+	}
+	recordLogin(j.UserID, username, err)
+	return err
+}
+
+// jobAction describes the job for its Telegram message, e.g. 寄信給 author
+func jobAction(j *pttmail.Job) string {
+	switch j.Kind {
+	case pttmail.KindPush:
+		return "推文至 " + j.Board
+	case pttmail.KindReply:
+		return "回文至 " + j.Board
+	}
+	return "寄信給 " + j.Recipient
+}
+
+// permanentMailError reports whether retrying cannot help
+func permanentMailError(err error) bool {
+	return errors.Is(err, mail.ErrLoginFailed) ||
+		errors.Is(err, mail.ErrUserNotFound) ||
+		errors.Is(err, mail.ErrBoardNotFound) ||
+		errors.Is(err, mail.ErrArticleNotFound) ||
+		errors.Is(err, mail.ErrActionDenied) ||
+		errors.Is(err, mail.ErrInvalidComment) ||
+		errors.Is(err, account.ErrPTTAccountNotFound) ||
+		errors.Is(err, account.ErrPTTCredentialsInvalid)
+}
+
+func failedJobText(j *pttmail.Job, err error) string {
+	switch {
+	case errors.Is(err, mail.ErrLoginFailed), errors.Is(err, account.ErrPTTCredentialsInvalid):
+		return "🔑 帳號密碼錯誤，請重新設定"
+	case errors.Is(err, mail.ErrUserNotFound):
+		return "👤 找不到此 PTT 使用者"
+	case errors.Is(err, mail.ErrBoardNotFound):
+		return "📋 找不到看板 " + j.Board
+	case errors.Is(err, mail.ErrArticleNotFound):
+		return "📄 找不到文章，可能已被刪除"
+	case errors.Is(err, mail.ErrActionDenied):
+		return "🚫 PTT 拒絕了" + jobAction(j) + "，看板可能禁止推文或回文"
+	case errors.Is(err, mail.ErrInvalidComment):
+		return "📝 推文內容需為一行，且不超過 " + strconv.Itoa(mail.MaxPushWidth/2) + " 個中文字"
+	case errors.Is(err, account.ErrPTTAccountNotFound):
+		return "⚠️ 尚未綁定 PTT 帳號"
+	}
+	return "❌ " + jobAction(j) + " 失敗，請稍後再試"
+}
+
+// notifyPTTMail edits the queued message of jobs from a Telegram button
+func notifyPTTMail(j *pttmail.Job, text string) {
+	if j.TelegramChatID == 0 || j.TelegramMessageID == 0 {
+		return
+	}
+	telegram.EditTextMessage(j.TelegramChatID, j.TelegramMessageID, text)
+}
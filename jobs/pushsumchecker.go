@@ -12,11 +12,13 @@ import (
 
 	log "github.com/Ptt-Alertor/logrus"
 
+	"github.com/Ptt-Alertor/ptt-alertor/cluster"
 	"github.com/Ptt-Alertor/ptt-alertor/models"
 	"github.com/Ptt-Alertor/ptt-alertor/models/article"
 	"github.com/Ptt-Alertor/ptt-alertor/models/pushsum"
 	"github.com/Ptt-Alertor/ptt-alertor/models/subscription"
 	"github.com/Ptt-Alertor/ptt-alertor/models/user"
+	pttHttp "github.com/Ptt-Alertor/ptt-alertor/ptt/http"
 	"github.com/Ptt-Alertor/ptt-alertor/ptt/web"
 )
 
@@ -75,9 +77,14 @@ func (psc pushSumChecker) Run() {
 				return
 			default:
 				boards := pushsum.List()
+				node := cluster.Self()
 				for _, board := range boards {
+					if !node.Owns(board) {
+						continue
+					}
 					ba := BoardArticles{board: board}
 					time.Sleep(psc.duration)
+					pttHttp.WaitBackoff()
 					go psc.crawlArticles(ba, baCh)
 				}
 			}
@@ -152,6 +159,7 @@ Page:
 		"total": len(ba.articles),
 	}).Info("PushSum Crawl Finish")
 
+	go archiveArticles(ba.board, ba.articles, true)
 	baCh <- ba
 }
 
@@ -224,9 +232,17 @@ func (psc pushSumChecker) toSendArticles(ids []int, articles article.Articles) a
 	}
 	sendArticles := make(article.Articles, 0)
 	for _, a := range articles {
-		if diffIds[a.ID] {
+		// checkers racing on the board during handover send it once
+		if diffIds[a.ID] && claimAlert(psc.Profile.Account, "pushsum", psc.board, pushSumArticleKey(a), psc.subType) {
 			sendArticles = append(sendArticles, a)
 		}
 	}
 	return sendArticles
 }
+
+func pushSumArticleKey(a article.Article) string {
+	if a.Code != "" {
+		return a.Code
+	}
+	return strconv.Itoa(a.ID)
+}
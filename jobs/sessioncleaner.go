@@ -0,0 +1,25 @@
+package jobs
+
+import (
+	log "github.com/Ptt-Alertor/logrus"
+	"github.com/Ptt-Alertor/ptt-alertor/models/session"
+	"github.com/Ptt-Alertor/ptt-alertor/myutil"
+)
+
+// SessionCleaner deletes expired and revoked login sessions
+type SessionCleaner struct{}
+
+// NewSessionCleaner creates a SessionCleaner
+func NewSessionCleaner() *SessionCleaner {
+	return &SessionCleaner{}
+}
+
+// Run executes the session cleanup job
+func (sc SessionCleaner) Run() {
+	deleted, err := (&session.Postgres{}).DeleteExpired()
+	if err != nil {
+		log.WithField("runtime", myutil.BasicRuntimeInfo()).WithError(err).Error("Session Cleaner Failed")
+		return
+	}
+	log.WithField("deleted", deleted).Info("Session Cleaner Completed")
+}
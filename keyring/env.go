@@ -0,0 +1,46 @@
+package keyring
+
+import (
+	"os"
+	"sync"
+
+	log "github.com/Ptt-Alertor/logrus"
+)
+
+var (
+	mu      sync.RWMutex
+	current *Keyring
+)
+
+// Load builds the shared keyring from PTT_ENCRYPT_KEYS and
+// PTT_LEGACY_ENCRYPT_KEY. It fails on missing or weak keys, so the server
+// refuses to start instead of writing secrets it cannot read back.
+func Load() error {
+	k, err := New(os.Getenv("PTT_ENCRYPT_KEYS"), os.Getenv("PTT_LEGACY_ENCRYPT_KEY"))
+	if err != nil {
+		return err
+	}
+	if k.legacy != nil {
+		log.Warn("PTT_LEGACY_ENCRYPT_KEY is set, remove it once every PTT account is re-encrypted")
+	}
+
+	Set(k)
+	return nil
+}
+
+// Set replaces the shared keyring, e.g. one with a KeyWrapper
+func Set(k *Keyring) {
+	mu.Lock()
+	defer mu.Unlock()
+	current = k
+}
+
+// Current returns the shared keyring
+func Current() (*Keyring, error) {
+	mu.RLock()
+	defer mu.RUnlock()
+	if current == nil {
+		return nil, ErrNotConfigured
+	}
+	return current, nil
+}
@@ -0,0 +1,258 @@
+// Package keyring encrypts stored secrets with versioned AES-256-GCM keys.
+// Every ciphertext starts with the ID of its key, so a new key can be added
+// and old rows re-encrypted without losing anything.
+package keyring
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// KeySize is the size of a key in bytes, for AES-256
+const KeySize = 32
+
+// minDistinctBytes rejects keys that are obviously not random, such as
+// padded passwords or repeated characters
+const minDistinctBytes = 16
+
+// envelopeID prefixes ciphertexts sealed with a wrapped data key
+const envelopeID = "env"
+
+var keyIDPattern = regexp.MustCompile(`^[a-z0-9]{1,16}$`)
+
+var (
+	ErrNoKeys        = errors.New("no encryption keys")
+	ErrInvalidKey    = errors.New("invalid encryption key")
+	ErrWeakKey       = errors.New("weak encryption key")
+	ErrDuplicateKey  = errors.New("duplicate encryption key id")
+	ErrUnknownKey    = errors.New("unknown encryption key")
+	ErrMalformed     = errors.New("malformed ciphertext")
+	ErrNoKeyWrapper  = errors.New("envelope ciphertext without key wrapper")
+	ErrNotConfigured = errors.New("keyring not configured")
+)
+
+// KeyWrapper wraps the random data key of each envelope ciphertext with a
+// master key kept outside the database, e.g. in a cloud KMS
+type KeyWrapper interface {
+	WrapKey(dataKey []byte) ([]byte, error)
+	UnwrapKey(wrapped []byte) ([]byte, error)
+}
+
+// Keyring holds the key that encrypts and every key that still decrypts
+type Keyring struct {
+	active  string
+	keys    map[string]cipher.AEAD
+	legacy  cipher.AEAD
+	wrapper KeyWrapper
+}
+
+// New parses keys of the form "v2:<base64>,v1:<base64>". The first key
+// encrypts, all of them decrypt. legacy, when set, decrypts ciphertexts
+// written before keys had IDs.
+func New(keys, legacy string) (*Keyring, error) {
+	k := &Keyring{keys: make(map[string]cipher.AEAD)}
+
+	for _, entry := range strings.Split(keys, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		id, encoded, ok := strings.Cut(entry, ":")
+		if !ok || !keyIDPattern.MatchString(id) || id == envelopeID {
+			return nil, fmt.Errorf("%w: bad key id in %q", ErrInvalidKey, id)
+		}
+		if _, exists := k.keys[id]; exists {
+			return nil, fmt.Errorf("%w: %s", ErrDuplicateKey, id)
+		}
+
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(key) != KeySize {
+			return nil, fmt.Errorf("%w: %s must be %d bytes in base64", ErrInvalidKey, id, KeySize)
+		}
+		if !random(key) {
+			return nil, fmt.Errorf("%w: %s", ErrWeakKey, id)
+		}
+
+		aead, err := newAEAD(key)
+		if err != nil {
+			return nil, err
+		}
+		k.keys[id] = aead
+		if k.active == "" {
+			k.active = id
+		}
+	}
+	if k.active == "" {
+		return nil, ErrNoKeys
+	}
+
+	if legacy != "" {
+		aead, err := newAEAD(legacyKey(legacy))
+		if err != nil {
+			return nil, err
+		}
+		k.legacy = aead
+	}
+
+	return k, nil
+}
+
+// random reports whether key has enough distinct bytes to be random
+func random(key []byte) bool {
+	seen := make(map[byte]bool)
+	for _, b := range key {
+		seen[b] = true
+	}
+	return len(seen) >= minDistinctBytes
+}
+
+// legacyKey derives a key the way it was before keys had IDs: the secret
+// zero-padded or cut to 32 bytes
+func legacyKey(secret string) []byte {
+	key := make([]byte, KeySize)
+	copy(key, secret)
+	return key
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// SetKeyWrapper turns on envelope encryption: every new ciphertext gets its
+// own data key, wrapped by w. Ciphertexts of the local keys still decrypt.
+func (k *Keyring) SetKeyWrapper(w KeyWrapper) {
+	k.wrapper = w
+}
+
+// ActiveKeyID returns the ID new ciphertexts are written with
+func (k *Keyring) ActiveKeyID() string {
+	if k.wrapper != nil {
+		return envelopeID
+	}
+	return k.active
+}
+
+// Encrypt seals plaintext with the active key
+func (k *Keyring) Encrypt(plaintext string) (string, error) {
+	if k.wrapper != nil {
+		return k.encryptEnvelope(plaintext)
+	}
+
+	sealed, err := seal(k.keys[k.active], []byte(plaintext))
+	if err != nil {
+		return "", err
+	}
+	return k.active + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func (k *Keyring) encryptEnvelope(plaintext string) (string, error) {
+	dataKey := make([]byte, KeySize)
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		return "", err
+	}
+	wrapped, err := k.wrapper.WrapKey(dataKey)
+	if err != nil {
+		return "", err
+	}
+
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := seal(aead, []byte(plaintext))
+	if err != nil {
+		return "", err
+	}
+
+	return envelopeID + ":" + base64.StdEncoding.EncodeToString(wrapped) + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt opens a ciphertext of any known key
+func (k *Keyring) Decrypt(ciphertext string) (string, error) {
+	id, rest, ok := strings.Cut(ciphertext, ":")
+	if !ok {
+		// written before keys had IDs
+		if k.legacy == nil {
+			return "", ErrUnknownKey
+		}
+		return open(k.legacy, ciphertext)
+	}
+
+	if id == envelopeID {
+		return k.decryptEnvelope(rest)
+	}
+
+	aead, exists := k.keys[id]
+	if !exists {
+		return "", fmt.Errorf("%w: %s", ErrUnknownKey, id)
+	}
+	return open(aead, rest)
+}
+
+func (k *Keyring) decryptEnvelope(rest string) (string, error) {
+	if k.wrapper == nil {
+		return "", ErrNoKeyWrapper
+	}
+	encodedKey, sealed, ok := strings.Cut(rest, ":")
+	if !ok {
+		return "", ErrMalformed
+	}
+	wrapped, err := base64.StdEncoding.DecodeString(encodedKey)
+	if err != nil {
+		return "", ErrMalformed
+	}
+
+	dataKey, err := k.wrapper.UnwrapKey(wrapped)
+	if err != nil {
+		return "", err
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return "", err
+	}
+	return open(aead, sealed)
+}
+
+// NeedsRotation reports whether ciphertext was not written with the active
+// key and should be re-encrypted
+func (k *Keyring) NeedsRotation(ciphertext string) bool {
+	id, _, ok := strings.Cut(ciphertext, ":")
+	return !ok || id != k.ActiveKeyID()
+}
+
+func seal(aead cipher.AEAD, plaintext []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func open(aead cipher.AEAD, encoded string) (string, error) {
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", ErrMalformed
+	}
+
+	nonceSize := aead.NonceSize()
+	if len(data) < nonceSize {
+		return "", ErrMalformed
+	}
+
+	plaintext, err := aead.Open(nil, data[:nonceSize], data[nonceSize:], nil)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
@@ -0,0 +1,137 @@
+package keyring
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+)
+
+const (
+	key1 = "AAECAwQFBgcICQoLDA0ODxAREhMUFRYXGBkaGxwdHh8="
+	key2 = "ICEiIyQlJicoKSorLC0uLzAxMjM0NTY3ODk6Ozw9Pj8="
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name       string
+		keys       string
+		wantActive string
+		wantErr    error
+	}{
+		{"single", "v1:" + key1, "v1", nil},
+		{"first is active", " v2:" + key2 + ", v1:" + key1, "v2", nil},
+		{"missing", "", "", ErrNoKeys},
+		{"no id", key1, "", ErrInvalidKey},
+		{"reserved id", "env:" + key1, "", ErrInvalidKey},
+		{"short", "v1:" + base64.StdEncoding.EncodeToString([]byte("secret")), "", ErrInvalidKey},
+		{"weak", "v1:" + base64.StdEncoding.EncodeToString(make([]byte, KeySize)), "", ErrWeakKey},
+		{"duplicate", "v1:" + key1 + ",v1:" + key2, "", ErrDuplicateKey},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k, err := New(tt.keys, "")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("New() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && k.ActiveKeyID() != tt.wantActive {
+				t.Errorf("ActiveKeyID() = %v, want %v", k.ActiveKeyID(), tt.wantActive)
+			}
+		})
+	}
+}
+
+func TestKeyring_rotation(t *testing.T) {
+	old, _ := New("v1:"+key1, "")
+	ciphertext, err := old.Encrypt("hunter2")
+	if err != nil {
+		t.Fatalf("Encrypt() error = %v", err)
+	}
+	if !strings.HasPrefix(ciphertext, "v1:") {
+		t.Fatalf("Encrypt() = %v, want v1 prefix", ciphertext)
+	}
+
+	rotated, _ := New("v2:"+key2+",v1:"+key1, "")
+	if !rotated.NeedsRotation(ciphertext) {
+		t.Error("NeedsRotation() = false, want true for v1 ciphertext")
+	}
+	if got, err := rotated.Decrypt(ciphertext); err != nil || got != "hunter2" {
+		t.Errorf("Decrypt() = %v, %v, want hunter2", got, err)
+	}
+
+	reencrypted, _ := rotated.Encrypt("hunter2")
+	if rotated.NeedsRotation(reencrypted) {
+		t.Errorf("NeedsRotation(%v) = true, want false", reencrypted)
+	}
+
+	dropped, _ := New("v2:"+key2, "")
+	if _, err := dropped.Decrypt(ciphertext); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("Decrypt() error = %v, want %v", err, ErrUnknownKey)
+	}
+}
+
+func TestKeyring_legacy(t *testing.T) {
+	// how ciphertexts were written before key IDs
+	block, _ := aes.NewCipher(legacyKey("old-secret"))
+	gcm, _ := cipher.NewGCM(block)
+	nonce := make([]byte, gcm.NonceSize())
+	legacy := base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, []byte("hunter2"), nil))
+
+	k, _ := New("v1:"+key1, "old-secret")
+	if !k.NeedsRotation(legacy) {
+		t.Error("NeedsRotation() = false, want true for legacy ciphertext")
+	}
+	if got, err := k.Decrypt(legacy); err != nil || got != "hunter2" {
+		t.Errorf("Decrypt() = %v, %v, want hunter2", got, err)
+	}
+
+	withoutLegacy, _ := New("v1:"+key1, "")
+	if _, err := withoutLegacy.Decrypt(legacy); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("Decrypt() error = %v, want %v", err, ErrUnknownKey)
+	}
+}
+
+// xorWrapper stands in for a KMS
+type xorWrapper struct{}
+
+func (xorWrapper) WrapKey(dataKey []byte) ([]byte, error) {
+	wrapped := make([]byte, len(dataKey))
+	for i, b := range dataKey {
+		wrapped[i] = b ^ 0x5a
+	}
+	return wrapped, nil
+}
+
+func (w xorWrapper) UnwrapKey(wrapped []byte) ([]byte, error) {
+	return w.WrapKey(wrapped)
+}
+
+func TestKeyring_envelope(t *testing.T) {
+	k, _ := New("v1:"+key1, "")
+	local, _ := k.Encrypt("hunter2")
+
+	k.SetKeyWrapper(xorWrapper{})
+	ciphertext, err := k.Encrypt("hunter2")
+	if err != nil {
+		t.Fatalf("Encrypt() error = %v", err)
+	}
+	if !strings.HasPrefix(ciphertext, "env:") {
+		t.Fatalf("Encrypt() = %v, want env prefix", ciphertext)
+	}
+	if got, err := k.Decrypt(ciphertext); err != nil || got != "hunter2" {
+		t.Errorf("Decrypt() = %v, %v, want hunter2", got, err)
+	}
+	if !k.NeedsRotation(local) || k.NeedsRotation(ciphertext) {
+		t.Error("NeedsRotation() should move local ciphertexts to envelopes")
+	}
+	if got, err := k.Decrypt(local); err != nil || got != "hunter2" {
+		t.Errorf("Decrypt() local = %v, %v, want hunter2", got, err)
+	}
+
+	plain, _ := New("v1:"+key1, "")
+	if _, err := plain.Decrypt(ciphertext); !errors.Is(err, ErrNoKeyWrapper) {
+		t.Errorf("Decrypt() error = %v, want %v", err, ErrNoKeyWrapper)
+	}
+}
@@ -14,10 +14,16 @@ import (
 
 	"github.com/Ptt-Alertor/ptt-alertor/auth"
 	"github.com/Ptt-Alertor/ptt-alertor/channels/telegram"
+	"github.com/Ptt-Alertor/ptt-alertor/cluster"
 	ctrlr "github.com/Ptt-Alertor/ptt-alertor/controllers"
 	"github.com/Ptt-Alertor/ptt-alertor/controllers/api"
 	"github.com/Ptt-Alertor/ptt-alertor/jobs"
+	"github.com/Ptt-Alertor/ptt-alertor/keyring"
 	"github.com/Ptt-Alertor/ptt-alertor/middleware"
+	"github.com/Ptt-Alertor/ptt-alertor/models/account"
+	"github.com/Ptt-Alertor/ptt-alertor/models/apitoken"
+	"github.com/Ptt-Alertor/ptt-alertor/preview"
+	"github.com/Ptt-Alertor/ptt-alertor/ratelimit"
 )
 
 var (
@@ -58,6 +64,10 @@ func newRouter() *myRouter {
 }
 
 func main() {
+	if err := keyring.Load(); err != nil {
+		log.WithError(err).Fatal("Load PTT_ENCRYPT_KEYS Failed")
+	}
+
 	log.Info("Start Jobs")
 	startJobs()
 
@@ -90,47 +100,92 @@ func main() {
 	router.POST("/telegram/"+telegramToken, telegram.HandleRequest)
 
 	// API v1 - Auth
-	router.POST("/api/auth/register", api.Register)
-	router.POST("/api/auth/login", api.Login)
+	router.POST("/api/auth/register", auth.RateLimit("register", ratelimit.Limit{Requests: 5, Window: time.Hour}, api.Register))
+	router.POST("/api/auth/login", auth.RateLimit("login", ratelimit.Limit{Requests: 10, Window: time.Minute}, api.Login))
+	router.POST("/api/auth/telegram", auth.RateLimit("telegram-login", ratelimit.Limit{Requests: 10, Window: time.Minute}, api.TelegramLogin))
 	router.GET("/api/auth/me", auth.JWTAuth(api.Me))
 	router.PUT("/api/auth/password", auth.JWTAuth(api.ChangePassword))
+	router.POST("/api/auth/refresh", auth.RateLimit("refresh", ratelimit.Limit{Requests: 30, Window: time.Minute}, api.Refresh))
+	router.POST("/api/auth/logout", auth.JWTAuth(api.Logout))
+	router.GET("/api/auth/sessions", auth.JWTAuth(api.ListSessions))
+	router.DELETE("/api/auth/sessions/:id", auth.JWTAuth(api.RevokeSession))
+	router.POST("/api/auth/verify-email", auth.RateLimit("verify-email", ratelimit.Limit{Requests: 10, Window: time.Minute}, api.VerifyEmail))
+	router.POST("/api/auth/verify-email/send", auth.JWTAuth(auth.RateLimit("verify-email-send", ratelimit.Limit{Requests: 3, Window: time.Hour}, api.SendVerificationEmail)))
+	router.POST("/api/auth/password/forgot", auth.RateLimit("password-forgot", ratelimit.Limit{Requests: 5, Window: time.Hour}, api.ForgotPassword))
+	router.POST("/api/auth/password/reset", auth.RateLimit("password-reset", ratelimit.Limit{Requests: 10, Window: time.Hour}, api.ResetPassword))
+	router.POST("/api/auth/2fa/verify", auth.RateLimit("2fa-verify", ratelimit.Limit{Requests: 10, Window: time.Minute}, api.VerifyTwoFactor))
+	router.GET("/api/auth/2fa", auth.JWTAuth(api.TwoFactorStatus))
+	router.POST("/api/auth/2fa/setup", auth.JWTAuth(api.SetupTwoFactor))
+	router.POST("/api/auth/2fa/enable", auth.JWTAuth(api.EnableTwoFactor))
+	router.POST("/api/auth/2fa/disable", auth.JWTAuth(api.DisableTwoFactor))
+	router.POST("/api/auth/2fa/recovery-codes", auth.JWTAuth(api.RegenerateRecoveryCodes))
 
 	// API v1 - Notification bindings
-	router.GET("/api/bindings", auth.JWTAuth(api.GetAllBindings))
-	router.POST("/api/bindings/bind-code", auth.JWTAuth(api.GenerateBindCode))
-	router.GET("/api/bindings/:service", auth.JWTAuth(api.BindingStatus))
+	router.GET("/api/bindings", auth.TokenAuth(apitoken.ScopeNotificationsRead, api.GetAllBindings))
+	router.POST("/api/bindings/bind-code", auth.JWTAuth(auth.RateLimit("bind-code", ratelimit.Limit{Requests: 5, Window: 10 * time.Minute}, api.GenerateBindCode)))
+	router.GET("/api/bindings/:service", auth.TokenAuth(apitoken.ScopeNotificationsRead, api.BindingStatus))
 	router.PATCH("/api/bindings/:service", auth.JWTAuth(api.SetBindingEnabled))
 	router.DELETE("/api/bindings/:service", auth.JWTAuth(api.UnbindService))
 
 	// API v1 - Subscriptions
-	router.GET("/api/subscriptions", auth.JWTAuth(api.ListSubscriptions))
-	router.POST("/api/subscriptions", auth.JWTAuth(api.CreateSubscription))
-	router.GET("/api/subscriptions/:id", auth.JWTAuth(api.GetSubscription))
-	router.PUT("/api/subscriptions/:id", auth.JWTAuth(api.UpdateSubscription))
-	router.DELETE("/api/subscriptions/:id", auth.JWTAuth(api.DeleteSubscription))
+	router.GET("/api/subscriptions", auth.TokenAuth(apitoken.ScopeSubscriptionsRead, api.ListSubscriptions))
+	router.POST("/api/subscriptions", auth.TokenAuth(apitoken.ScopeSubscriptionsWrite, api.CreateSubscription))
+	router.POST("/api/subscriptions/preview", auth.TokenAuth(apitoken.ScopeSubscriptionsRead, auth.RateLimit("preview", preview.Limit, api.PreviewSubscription)))
+	router.GET("/api/subscriptions/:id", auth.TokenAuth(apitoken.ScopeSubscriptionsRead, api.GetSubscription))
+	router.PUT("/api/subscriptions/:id", auth.TokenAuth(apitoken.ScopeSubscriptionsWrite, api.UpdateSubscription))
+	router.DELETE("/api/subscriptions/:id", auth.TokenAuth(apitoken.ScopeSubscriptionsWrite, api.DeleteSubscription))
+
+	// API v1 - Personal access tokens (session login only)
+	router.GET("/api/tokens", auth.JWTAuth(api.ListTokens))
+	router.POST("/api/tokens", auth.JWTAuth(api.CreateToken))
+	router.GET("/api/tokens/:id", auth.JWTAuth(api.GetToken))
+	router.PUT("/api/tokens/:id", auth.JWTAuth(api.UpdateToken))
+	router.DELETE("/api/tokens/:id", auth.JWTAuth(api.DeleteToken))
 
 	// API v1 - Stats (public)
 	router.GET("/api/stats/subscriptions", api.ListSubscriptionStats)
 
+	// API v1 - Board catalog (public)
+	router.GET("/api/boards/catalog", auth.RateLimit("board-catalog", ratelimit.Limit{Requests: 30, Window: time.Minute}, api.SearchBoardCatalog))
+
+	// API v1 - Article archive search (public)
+	router.GET("/api/articles/search", auth.RateLimit("article-search", ratelimit.Limit{Requests: 30, Window: time.Minute}, api.SearchArticles))
+
 	// API v1 - Admin
-	router.POST("/api/admin/login", api.AdminLogin)
-	router.GET("/api/admin/init", auth.RequireAdmin(api.AdminInit))
-	router.GET("/api/admin/users", auth.RequireAdmin(api.AdminListUsers))
-	router.GET("/api/admin/users/:id", auth.RequireAdmin(api.AdminGetUser))
-	router.PUT("/api/admin/users/:id", auth.RequireAdmin(api.AdminUpdateUser))
-	router.DELETE("/api/admin/users/:id", auth.RequireAdmin(api.AdminDeleteUser))
-	router.POST("/api/admin/broadcast", auth.RequireAdmin(api.AdminBroadcast))
+	router.POST("/api/admin/login", auth.RateLimit("admin-login", ratelimit.Limit{Requests: 5, Window: time.Minute}, api.AdminLogin))
+	router.GET("/api/admin/init", auth.RequirePermission(account.PermAdminStats, api.AdminInit))
+	router.GET("/api/admin/users", auth.RequirePermission(account.PermAdminUsers, api.AdminListUsers))
+	router.GET("/api/admin/users/:id", auth.RequirePermission(account.PermAdminUsers, api.AdminGetUser))
+	router.PUT("/api/admin/users/:id", auth.RequirePermission(account.PermAdminUsers, api.AdminUpdateUser))
+	router.DELETE("/api/admin/users/:id", auth.RequirePermission(account.PermAdminUsers, api.AdminDeleteUser))
+	router.POST("/api/admin/users/:id/impersonate", auth.RequirePermission(account.PermAdminImpersonate, api.AdminImpersonateUser))
+	router.POST("/api/admin/broadcast", auth.RequirePermission(account.PermAdminBroadcast, api.AdminBroadcast))
+	router.GET("/api/admin/crawler/proxies", auth.RequirePermission(account.PermAdminCrawler, api.AdminProxyStats))
+
+	// API v1 - Admin Article Archive
+	router.GET("/api/admin/archive/policies", auth.RequirePermission(account.PermAdminArchive, api.AdminListArchivePolicies))
+	router.PUT("/api/admin/archive/policies/:board", auth.RequirePermission(account.PermAdminArchive, api.AdminSetArchivePolicy))
+	router.DELETE("/api/admin/archive/policies/:board", auth.RequirePermission(account.PermAdminArchive, api.AdminDeleteArchivePolicy))
 
 	// API v1 - Admin Roles
-	router.GET("/api/admin/roles", auth.RequireAdmin(api.AdminListRoles))
-	router.POST("/api/admin/roles", auth.RequireAdmin(api.AdminCreateRole))
-	router.GET("/api/admin/roles/:role", auth.RequireAdmin(api.AdminGetRole))
-	router.PUT("/api/admin/roles/:role", auth.RequireAdmin(api.AdminUpdateRole))
-	router.DELETE("/api/admin/roles/:role", auth.RequireAdmin(api.AdminDeleteRole))
-
-	// API v1 - PTT Account (VIP+ only)
-	router.POST("/api/ptt-account", auth.JWTAuth(api.BindPTTAccount))
+	router.GET("/api/admin/roles", auth.RequirePermission(account.PermAdminRoles, api.AdminListRoles))
+	router.GET("/api/admin/permissions", auth.RequirePermission(account.PermAdminRoles, api.AdminListPermissions))
+	router.POST("/api/admin/roles", auth.RequirePermission(account.PermAdminRoles, api.AdminCreateRole))
+	router.GET("/api/admin/roles/:role", auth.RequirePermission(account.PermAdminRoles, api.AdminGetRole))
+	router.PUT("/api/admin/roles/:role", auth.RequirePermission(account.PermAdminRoles, api.AdminUpdateRole))
+	router.DELETE("/api/admin/roles/:role", auth.RequirePermission(account.PermAdminRoles, api.AdminDeleteRole))
+
+	// API v1 - Admin Audit Log
+	router.GET("/api/admin/audit", auth.RequirePermission(account.PermAdminAudit, api.AdminListAudit))
+	router.GET("/api/admin/audit/export", auth.RequirePermission(account.PermAdminAudit, api.AdminExportAudit))
+
+	// API v1 - PTT Account (ptt_mail permission)
+	router.GET("/api/ptt-account", auth.JWTAuth(api.GetPTTAccount))
+	router.POST("/api/ptt-account", auth.JWTAuth(auth.RateLimit("ptt-account-bind", ratelimit.Limit{Requests: 5, Window: time.Hour}, api.BindPTTAccount)))
 	router.DELETE("/api/ptt-account", auth.JWTAuth(api.UnbindPTTAccount))
+	router.PATCH("/api/ptt-account/inbox", auth.JWTAuth(api.SetPTTInboxWatch))
+	router.GET("/api/ptt-mail/jobs", auth.JWTAuth(api.ListPTTMailJobs))
+	router.GET("/api/ptt-mail/history", auth.JWTAuth(api.ListPTTMailHistory))
 
 	// gops agent
 	if err := agent.Listen(agent.Options{Addr: ":6060", ShutdownCleanup: true}); err != nil {
@@ -160,16 +215,26 @@ func main() {
 		log.WithError(err).Fatal("Web Server Showdown Failed")
 	}
 	log.Info("Web Server Was Been Shutdown")
+	cluster.Self().Stop()
 }
 
 func startJobs() {
+	cluster.Self().Start()
 	go jobs.NewChecker().Run()
 	go jobs.NewPushSumChecker().Run()
 	go jobs.NewCommentChecker().Run()
 	go jobs.NewPttMonitor().Run()
+	go jobs.NewPTTMailer().Run()
 	c := cron.New()
-	c.AddJob("@hourly", jobs.NewCommentAggregator())
-	c.AddJob("@every 48h", jobs.NewPushSumKeyReplacer())
+	c.AddJob("@hourly", cluster.LeaderOnly(jobs.NewCommentAggregator()))
+	c.AddJob("@every 48h", cluster.LeaderOnly(jobs.NewPushSumKeyReplacer()))
+	c.AddJob("@daily", cluster.LeaderOnly(jobs.NewArchiveCleaner()))
+	c.AddJob("@daily", cluster.LeaderOnly(jobs.NewBoardCatalogSync()))
+	c.AddJob("@hourly", cluster.LeaderOnly(jobs.NewHotBoardSync()))
+	c.AddJob("@daily", cluster.LeaderOnly(jobs.NewSessionCleaner()))
+	c.AddJob("@hourly", cluster.LeaderOnly(jobs.NewKeyRotator()))
+	c.AddJob("@every 1m", cluster.LeaderOnly(jobs.NewInboxWatcher()))
+	c.AddJob("@every 1m", cluster.LeaderOnly(jobs.NewCredentialVerifier()))
 	c.Start()
 }
 
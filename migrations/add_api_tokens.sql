@@ -0,0 +1,19 @@
+-- Add personal access tokens
+
+-- ============================================
+-- API tokens table (personal access tokens)
+-- ============================================
+CREATE TABLE IF NOT EXISTS api_tokens (
+    id            SERIAL PRIMARY KEY,
+    user_id       INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name          VARCHAR(50) NOT NULL,
+    token_hash    VARCHAR(64) NOT NULL UNIQUE,
+    token_prefix  VARCHAR(16) NOT NULL,
+    scopes        TEXT[] NOT NULL,
+    expires_at    TIMESTAMP,
+    last_used_at  TIMESTAMP,
+    created_at    TIMESTAMP DEFAULT NOW()
+);
+
+-- API tokens indexes
+CREATE INDEX IF NOT EXISTS idx_api_tokens_user_id ON api_tokens(user_id);
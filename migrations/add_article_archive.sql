@@ -0,0 +1,46 @@
+-- Add article archive for full-text search
+
+-- ============================================
+-- Article Archive table (every crawled article, for search)
+-- ============================================
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+CREATE TABLE IF NOT EXISTS article_archive (
+    code            VARCHAR(50) PRIMARY KEY,
+    board           VARCHAR(50) NOT NULL,
+    title           TEXT NOT NULL,
+    author          VARCHAR(50),
+    link            TEXT,
+    published_at    TIMESTAMPTZ NOT NULL,
+    push_sum        INTEGER DEFAULT 0,
+    positive_count  INTEGER DEFAULT 0,
+    negative_count  INTEGER DEFAULT 0,
+    neutral_count   INTEGER DEFAULT 0,
+    body            TEXT,
+    first_seen_at   TIMESTAMP DEFAULT NOW(),
+    last_seen_at    TIMESTAMP DEFAULT NOW()
+);
+
+-- ============================================
+-- Article Archive Policies table (per-board retention)
+-- ============================================
+CREATE TABLE IF NOT EXISTS article_archive_policies (
+    board           VARCHAR(50) PRIMARY KEY,
+    retention_days  INTEGER NOT NULL DEFAULT 180,
+    store_body      BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at      TIMESTAMP DEFAULT NOW(),
+    updated_at      TIMESTAMP DEFAULT NOW()
+);
+
+-- Article archive indexes (trigram for CJK substring search)
+CREATE INDEX IF NOT EXISTS idx_article_archive_title_trgm ON article_archive USING GIN (title gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_article_archive_body_trgm ON article_archive USING GIN (body gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_article_archive_board_published ON article_archive(LOWER(board), published_at DESC);
+CREATE INDEX IF NOT EXISTS idx_article_archive_author ON article_archive(LOWER(author));
+CREATE INDEX IF NOT EXISTS idx_article_archive_published ON article_archive(published_at DESC);
+
+-- Apply trigger to article_archive_policies
+DROP TRIGGER IF EXISTS article_archive_policies_updated_at ON article_archive_policies;
+CREATE TRIGGER article_archive_policies_updated_at
+    BEFORE UPDATE ON article_archive_policies
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at();
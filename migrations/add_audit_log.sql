@@ -0,0 +1,26 @@
+-- Add audit log of admin and sensitive user actions
+
+-- ============================================
+-- Audit log table
+-- ============================================
+CREATE TABLE IF NOT EXISTS audit_log (
+    id          BIGSERIAL PRIMARY KEY,
+    actor_id    INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    actor_email VARCHAR(255) NOT NULL DEFAULT '',
+    action      VARCHAR(50) NOT NULL,
+    target_type VARCHAR(30) NOT NULL DEFAULT '',
+    target_id   VARCHAR(100) NOT NULL DEFAULT '',
+    before      JSONB,
+    after       JSONB,
+    ip          VARCHAR(45) NOT NULL DEFAULT '',
+    created_at  TIMESTAMP DEFAULT NOW()
+);
+
+-- Audit log indexes
+CREATE INDEX IF NOT EXISTS idx_audit_log_created_at ON audit_log(created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_audit_log_actor_id ON audit_log(actor_id);
+CREATE INDEX IF NOT EXISTS idx_audit_log_target ON audit_log(target_type, target_id);
+
+-- Let the admin role read the audit log
+UPDATE role_limits SET permissions = array_append(permissions, 'admin_audit')
+WHERE role = 'admin' AND NOT 'admin_audit' = ANY(permissions);
@@ -0,0 +1,31 @@
+-- Add board catalog for board search and suggestions
+
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+-- ============================================
+-- Board Catalog table (PTT board hierarchy)
+-- ============================================
+CREATE TABLE IF NOT EXISTS board_catalog (
+    name            VARCHAR(50) PRIMARY KEY,
+    title           TEXT NOT NULL DEFAULT '',
+    category        VARCHAR(50) NOT NULL DEFAULT '',
+    online_users    INTEGER NOT NULL DEFAULT 0,
+    over18          BOOLEAN,
+    synced_at       TIMESTAMP DEFAULT NOW(),
+    created_at      TIMESTAMP DEFAULT NOW(),
+    updated_at      TIMESTAMP DEFAULT NOW()
+);
+
+-- Web list pages don't show moderators, drop the column from earlier runs
+ALTER TABLE board_catalog DROP COLUMN IF EXISTS moderators;
+
+-- Board catalog indexes
+CREATE INDEX IF NOT EXISTS idx_board_catalog_name_lower ON board_catalog(LOWER(name));
+CREATE INDEX IF NOT EXISTS idx_board_catalog_title_trgm ON board_catalog USING GIN (title gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_board_catalog_online_users ON board_catalog(online_users DESC);
+
+-- Apply trigger to board_catalog
+DROP TRIGGER IF EXISTS board_catalog_updated_at ON board_catalog;
+CREATE TRIGGER board_catalog_updated_at
+    BEFORE UPDATE ON board_catalog
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at();
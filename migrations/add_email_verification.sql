@@ -0,0 +1,5 @@
+-- Add email verification to users
+-- Existing accounts start unverified; they can request a verification email
+-- or verify by resetting their password
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email_verified_at TIMESTAMP;
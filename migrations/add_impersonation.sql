@@ -0,0 +1,4 @@
+-- Let the admin role view the site as a user
+
+UPDATE role_limits SET permissions = array_append(permissions, 'admin_impersonate')
+WHERE role = 'admin' AND NOT 'admin_impersonate' = ANY(permissions);
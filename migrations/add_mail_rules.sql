@@ -0,0 +1,3 @@
+-- Add per-subscription mail rules: a title pattern for mail buttons and named mail templates
+
+ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS mail_rule JSONB;
@@ -0,0 +1,15 @@
+-- Add named permissions and board/polling limits to roles
+
+ALTER TABLE role_limits ADD COLUMN IF NOT EXISTS permissions TEXT[] NOT NULL DEFAULT '{}';
+ALTER TABLE role_limits ADD COLUMN IF NOT EXISTS max_boards INTEGER NOT NULL DEFAULT -1;
+ALTER TABLE role_limits ADD COLUMN IF NOT EXISTS min_poll_interval INTEGER NOT NULL DEFAULT 0;
+
+-- Keep what each role could do before: admins everything, VIPs PTT mail,
+-- and everyone regex keywords
+UPDATE role_limits SET permissions = ARRAY['ptt_mail', 'regex_keywords', 'webhook_channel',
+    'admin_stats', 'admin_users', 'admin_roles', 'admin_broadcast', 'admin_archive', 'admin_crawler']
+WHERE role = 'admin';
+UPDATE role_limits SET permissions = ARRAY['ptt_mail', 'regex_keywords', 'webhook_channel']
+WHERE role = 'vip';
+UPDATE role_limits SET permissions = ARRAY['regex_keywords']
+WHERE role NOT IN ('admin', 'vip') AND permissions = '{}';
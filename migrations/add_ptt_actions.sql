@@ -0,0 +1,5 @@
+-- Add pushes and replies to the PTT mail queue
+
+ALTER TABLE ptt_mail_jobs ADD COLUMN IF NOT EXISTS kind VARCHAR(10) NOT NULL DEFAULT 'mail' CHECK (kind IN ('mail', 'push', 'reply'));
+ALTER TABLE ptt_mail_jobs ADD COLUMN IF NOT EXISTS board VARCHAR(50) NOT NULL DEFAULT '';
+ALTER TABLE ptt_mail_jobs ADD COLUMN IF NOT EXISTS push_type SMALLINT NOT NULL DEFAULT 0;
@@ -0,0 +1,12 @@
+-- Track whether the bound PTT credentials still log in, checked through the PTT mail queue
+
+ALTER TABLE ptt_accounts ADD COLUMN IF NOT EXISTS credential_status VARCHAR(10) NOT NULL DEFAULT 'pending';
+ALTER TABLE ptt_accounts ADD COLUMN IF NOT EXISTS last_verified_at TIMESTAMP;
+ALTER TABLE ptt_accounts ADD COLUMN IF NOT EXISTS last_error TEXT;
+ALTER TABLE ptt_accounts DROP CONSTRAINT IF EXISTS ptt_accounts_credential_status_check;
+ALTER TABLE ptt_accounts ADD CONSTRAINT ptt_accounts_credential_status_check CHECK (credential_status IN ('pending', 'valid', 'invalid'));
+
+ALTER TABLE ptt_mail_jobs DROP CONSTRAINT IF EXISTS ptt_mail_jobs_kind_check;
+ALTER TABLE ptt_mail_jobs ADD CONSTRAINT ptt_mail_jobs_kind_check CHECK (kind IN ('mail', 'push', 'reply', 'inbox', 'verify'));
+
+CREATE INDEX IF NOT EXISTS idx_ptt_mail_jobs_verify ON ptt_mail_jobs(user_id, created_at DESC) WHERE kind = 'verify';
@@ -0,0 +1,10 @@
+-- Add the opt-in PTT inbox watcher, which checks mailboxes through the PTT mail queue
+
+ALTER TABLE ptt_accounts ADD COLUMN IF NOT EXISTS watch_inbox BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE ptt_accounts ADD COLUMN IF NOT EXISTS inbox_last_index INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE ptt_accounts ADD COLUMN IF NOT EXISTS inbox_checked_at TIMESTAMP;
+
+ALTER TABLE ptt_mail_jobs DROP CONSTRAINT IF EXISTS ptt_mail_jobs_kind_check;
+ALTER TABLE ptt_mail_jobs ADD CONSTRAINT ptt_mail_jobs_kind_check CHECK (kind IN ('mail', 'push', 'reply', 'inbox'));
+
+CREATE INDEX IF NOT EXISTS idx_ptt_mail_jobs_inbox ON ptt_mail_jobs(user_id, created_at DESC) WHERE kind = 'inbox';
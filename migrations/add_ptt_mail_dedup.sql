@@ -0,0 +1,15 @@
+-- Hold the same mail about an article to one queued or running job, two
+-- taps on the confirm button racing past the pending check cannot both queue
+
+-- fail duplicates queued before the index, keeping the first of each
+UPDATE ptt_mail_jobs j
+SET status = 'failed', last_error = 'duplicate mail', finished_at = NOW()
+WHERE j.kind = 'mail' AND j.article_code <> '' AND j.status = 'queued'
+  AND EXISTS (
+    SELECT 1 FROM ptt_mail_jobs d
+    WHERE d.kind = 'mail' AND d.user_id = j.user_id AND LOWER(d.recipient) = LOWER(j.recipient)
+      AND d.article_code = j.article_code AND d.status IN ('queued', 'running') AND d.id < j.id
+  );
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_ptt_mail_jobs_pending_mail ON ptt_mail_jobs(user_id, LOWER(recipient), article_code)
+    WHERE kind = 'mail' AND article_code <> '' AND status IN ('queued', 'running');
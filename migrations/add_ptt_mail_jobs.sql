@@ -0,0 +1,36 @@
+-- Add queue of PTT mail sends
+
+-- ============================================
+-- PTT mail jobs table
+-- ============================================
+CREATE TABLE IF NOT EXISTS ptt_mail_jobs (
+    id                  BIGSERIAL PRIMARY KEY,
+    user_id             INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    subscription_id     INTEGER REFERENCES subscriptions(id) ON DELETE SET NULL,
+    ptt_username        VARCHAR(50) NOT NULL,
+    recipient           VARCHAR(50) NOT NULL,
+    subject             TEXT NOT NULL DEFAULT '',
+    content             TEXT NOT NULL DEFAULT '',
+    article_code        VARCHAR(30) NOT NULL DEFAULT '',
+    status              VARCHAR(20) NOT NULL DEFAULT 'queued' CHECK (status IN ('queued', 'running', 'sent', 'failed')),
+    attempts            INTEGER NOT NULL DEFAULT 0,
+    last_error          TEXT NOT NULL DEFAULT '',
+    telegram_chat_id    BIGINT,
+    telegram_message_id INTEGER,
+    run_at              TIMESTAMP NOT NULL DEFAULT NOW(),
+    started_at          TIMESTAMP,
+    finished_at         TIMESTAMP,
+    created_at          TIMESTAMP DEFAULT NOW(),
+    updated_at          TIMESTAMP DEFAULT NOW()
+);
+
+-- PTT mail job indexes (one running job per PTT account)
+CREATE INDEX IF NOT EXISTS idx_ptt_mail_jobs_user_id ON ptt_mail_jobs(user_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_ptt_mail_jobs_queued ON ptt_mail_jobs(run_at) WHERE status = 'queued';
+CREATE UNIQUE INDEX IF NOT EXISTS idx_ptt_mail_jobs_running ON ptt_mail_jobs(LOWER(ptt_username)) WHERE status = 'running';
+
+-- Apply trigger to ptt_mail_jobs
+DROP TRIGGER IF EXISTS ptt_mail_jobs_updated_at ON ptt_mail_jobs;
+CREATE TRIGGER ptt_mail_jobs_updated_at
+    BEFORE UPDATE ON ptt_mail_jobs
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at();
@@ -0,0 +1,19 @@
+-- Add log of sent PTT mails for history and duplicate-send protection
+
+-- ============================================
+-- PTT mail log table
+-- ============================================
+CREATE TABLE IF NOT EXISTS ptt_mail_log (
+    id           BIGSERIAL PRIMARY KEY,
+    user_id      INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    recipient    VARCHAR(50) NOT NULL,
+    subject      TEXT NOT NULL DEFAULT '',
+    article_code VARCHAR(30) NOT NULL DEFAULT '',
+    status       VARCHAR(20) NOT NULL CHECK (status IN ('sent', 'failed')),
+    error        TEXT NOT NULL DEFAULT '',
+    created_at   TIMESTAMP DEFAULT NOW()
+);
+
+-- PTT mail log indexes (cooldown looks up sent mails per recipient and article)
+CREATE INDEX IF NOT EXISTS idx_ptt_mail_log_user_id ON ptt_mail_log(user_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_ptt_mail_log_sent ON ptt_mail_log(user_id, LOWER(recipient), article_code, created_at DESC) WHERE status = 'sent';
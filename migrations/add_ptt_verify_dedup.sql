@@ -0,0 +1,15 @@
+-- Hold each user to one queued or running credential check, binding the
+-- PTT account again while one is pending cannot queue another login
+
+-- fail duplicates queued before the index, keeping the first of each
+UPDATE ptt_mail_jobs j
+SET status = 'failed', last_error = 'duplicate credential check', finished_at = NOW()
+WHERE j.kind = 'verify' AND j.status = 'queued'
+  AND EXISTS (
+    SELECT 1 FROM ptt_mail_jobs d
+    WHERE d.kind = 'verify' AND d.user_id = j.user_id
+      AND d.status IN ('queued', 'running') AND d.id < j.id
+  );
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_ptt_mail_jobs_pending_verify ON ptt_mail_jobs(user_id)
+    WHERE kind = 'verify' AND status IN ('queued', 'running');
@@ -0,0 +1,5 @@
+-- Add per-role API rate limits (requests per minute, -1 for unlimited)
+
+ALTER TABLE role_limits ADD COLUMN IF NOT EXISTS api_rate_limit INTEGER NOT NULL DEFAULT 60;
+UPDATE role_limits SET api_rate_limit = -1 WHERE role = 'admin';
+UPDATE role_limits SET api_rate_limit = 300 WHERE role = 'vip';
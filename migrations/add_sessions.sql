@@ -0,0 +1,21 @@
+-- Add sessions for refresh tokens and revocation
+
+-- ============================================
+-- Sessions table (refresh tokens)
+-- ============================================
+CREATE TABLE IF NOT EXISTS sessions (
+    id                   VARCHAR(32) PRIMARY KEY,
+    user_id              INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    refresh_token_hash   VARCHAR(64) NOT NULL UNIQUE,
+    previous_token_hash  VARCHAR(64),
+    user_agent           TEXT NOT NULL DEFAULT '',
+    ip                   VARCHAR(45) NOT NULL DEFAULT '',
+    created_at           TIMESTAMP DEFAULT NOW(),
+    last_used_at         TIMESTAMP DEFAULT NOW(),
+    expires_at           TIMESTAMP NOT NULL,
+    revoked_at           TIMESTAMP
+);
+
+-- Sessions indexes
+CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions(user_id);
+CREATE INDEX IF NOT EXISTS idx_sessions_previous_token_hash ON sessions(previous_token_hash);
@@ -0,0 +1,28 @@
+-- Add TOTP two-factor authentication
+
+ALTER TABLE role_limits ADD COLUMN IF NOT EXISTS require_2fa BOOLEAN NOT NULL DEFAULT FALSE;
+UPDATE role_limits SET require_2fa = TRUE WHERE role = 'admin';
+
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS mfa BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- ============================================
+-- Two-factor authentication tables (TOTP)
+-- ============================================
+CREATE TABLE IF NOT EXISTS user_totp (
+    user_id     INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    secret      TEXT NOT NULL,
+    enabled_at  TIMESTAMP,
+    last_step   BIGINT NOT NULL DEFAULT 0,
+    created_at  TIMESTAMP DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS recovery_codes (
+    id          SERIAL PRIMARY KEY,
+    user_id     INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    code_hash   VARCHAR(64) NOT NULL,
+    used_at     TIMESTAMP,
+    created_at  TIMESTAMP DEFAULT NOW()
+);
+
+-- Recovery codes indexes
+CREATE INDEX IF NOT EXISTS idx_recovery_codes_user_id ON recovery_codes(user_id);
@@ -51,15 +51,22 @@ CREATE TABLE IF NOT EXISTS role_limits (
     role                VARCHAR(20) UNIQUE NOT NULL,
     max_subscriptions   INTEGER NOT NULL DEFAULT 3,
     description         VARCHAR(100),
+    require_2fa         BOOLEAN NOT NULL DEFAULT FALSE,
+    api_rate_limit      INTEGER NOT NULL DEFAULT 60,
+    permissions         TEXT[] NOT NULL DEFAULT '{}',
+    max_boards          INTEGER NOT NULL DEFAULT -1,
+    min_poll_interval   INTEGER NOT NULL DEFAULT 0,
     created_at          TIMESTAMP DEFAULT NOW(),
     updated_at          TIMESTAMP DEFAULT NOW()
 );
 
 -- Insert default roles
-INSERT INTO role_limits (id, role, max_subscriptions, description) VALUES
-(1, 'admin', -1, '管理員，無限制'),
-(2, 'vip', 20, 'VIP 用戶'),
-(3, 'user', 3, '一般用戶')
+INSERT INTO role_limits (id, role, max_subscriptions, description, require_2fa, api_rate_limit, permissions) VALUES
+(1, 'admin', -1, '管理員，無限制', TRUE, -1, ARRAY['ptt_mail', 'regex_keywords', 'webhook_channel',
+    'admin_stats', 'admin_users', 'admin_roles', 'admin_broadcast', 'admin_archive', 'admin_crawler',
+    'admin_audit', 'admin_impersonate']),
+(2, 'vip', 20, 'VIP 用戶', FALSE, 300, ARRAY['ptt_mail', 'regex_keywords', 'webhook_channel']),
+(3, 'user', 3, '一般用戶', FALSE, 60, ARRAY['regex_keywords'])
 ON CONFLICT (role) DO NOTHING;
 
 -- ============================================
@@ -71,6 +78,7 @@ CREATE TABLE IF NOT EXISTS users (
     password    VARCHAR(255) NOT NULL,
     role        VARCHAR(20) DEFAULT 'user' REFERENCES role_limits(role),
     enabled     BOOLEAN DEFAULT TRUE,
+    email_verified_at TIMESTAMP,
     created_at  TIMESTAMP DEFAULT NOW(),
     updated_at  TIMESTAMP DEFAULT NOW()
 );
@@ -87,6 +95,7 @@ CREATE TABLE IF NOT EXISTS subscriptions (
     enabled       BOOLEAN DEFAULT TRUE,
     mail_subject  VARCHAR(100),
     mail_content  TEXT,
+    mail_rule     JSONB,
     created_at    TIMESTAMP DEFAULT NOW(),
     updated_at    TIMESTAMP DEFAULT NOW(),
     UNIQUE(user_id, board, sub_type, value)
@@ -117,6 +126,12 @@ CREATE TABLE IF NOT EXISTS ptt_accounts (
     user_id                 INTEGER UNIQUE NOT NULL REFERENCES users(id) ON DELETE CASCADE,
     ptt_username            VARCHAR(50) NOT NULL,
     ptt_password_encrypted  TEXT NOT NULL,
+    watch_inbox             BOOLEAN NOT NULL DEFAULT FALSE,
+    inbox_last_index        INTEGER NOT NULL DEFAULT 0,
+    inbox_checked_at        TIMESTAMP,
+    credential_status       VARCHAR(10) NOT NULL DEFAULT 'pending' CHECK (credential_status IN ('pending', 'valid', 'invalid')),
+    last_verified_at        TIMESTAMP,
+    last_error              TEXT,
     created_at              TIMESTAMP DEFAULT NOW(),
     updated_at              TIMESTAMP DEFAULT NOW()
 );
@@ -135,7 +150,161 @@ CREATE TABLE IF NOT EXISTS subscription_stats (
 );
 
 -- ============================================
--- 10. Indexes
+-- 10. Article Archive table (every crawled article, for search)
+-- ============================================
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+CREATE TABLE IF NOT EXISTS article_archive (
+    code            VARCHAR(50) PRIMARY KEY,
+    board           VARCHAR(50) NOT NULL,
+    title           TEXT NOT NULL,
+    author          VARCHAR(50),
+    link            TEXT,
+    published_at    TIMESTAMPTZ NOT NULL,
+    push_sum        INTEGER DEFAULT 0,
+    positive_count  INTEGER DEFAULT 0,
+    negative_count  INTEGER DEFAULT 0,
+    neutral_count   INTEGER DEFAULT 0,
+    body            TEXT,
+    first_seen_at   TIMESTAMP DEFAULT NOW(),
+    last_seen_at    TIMESTAMP DEFAULT NOW()
+);
+
+-- ============================================
+-- 11. Article Archive Policies table (per-board retention)
+-- ============================================
+CREATE TABLE IF NOT EXISTS article_archive_policies (
+    board           VARCHAR(50) PRIMARY KEY,
+    retention_days  INTEGER NOT NULL DEFAULT 180,
+    store_body      BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at      TIMESTAMP DEFAULT NOW(),
+    updated_at      TIMESTAMP DEFAULT NOW()
+);
+
+-- ============================================
+-- 12. Board Catalog table (PTT board hierarchy)
+-- ============================================
+CREATE TABLE IF NOT EXISTS board_catalog (
+    name            VARCHAR(50) PRIMARY KEY,
+    title           TEXT NOT NULL DEFAULT '',
+    category        VARCHAR(50) NOT NULL DEFAULT '',
+    online_users    INTEGER NOT NULL DEFAULT 0,
+    over18          BOOLEAN,
+    synced_at       TIMESTAMP DEFAULT NOW(),
+    created_at      TIMESTAMP DEFAULT NOW(),
+    updated_at      TIMESTAMP DEFAULT NOW()
+);
+
+-- ============================================
+-- 13. Sessions table (refresh tokens)
+-- ============================================
+CREATE TABLE IF NOT EXISTS sessions (
+    id                   VARCHAR(32) PRIMARY KEY,
+    user_id              INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    refresh_token_hash   VARCHAR(64) NOT NULL UNIQUE,
+    previous_token_hash  VARCHAR(64),
+    user_agent           TEXT NOT NULL DEFAULT '',
+    ip                   VARCHAR(45) NOT NULL DEFAULT '',
+    mfa                  BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at           TIMESTAMP DEFAULT NOW(),
+    last_used_at         TIMESTAMP DEFAULT NOW(),
+    expires_at           TIMESTAMP NOT NULL,
+    revoked_at           TIMESTAMP
+);
+
+-- ============================================
+-- 14. API tokens table (personal access tokens)
+-- ============================================
+CREATE TABLE IF NOT EXISTS api_tokens (
+    id            SERIAL PRIMARY KEY,
+    user_id       INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name          VARCHAR(50) NOT NULL,
+    token_hash    VARCHAR(64) NOT NULL UNIQUE,
+    token_prefix  VARCHAR(16) NOT NULL,
+    scopes        TEXT[] NOT NULL,
+    expires_at    TIMESTAMP,
+    last_used_at  TIMESTAMP,
+    created_at    TIMESTAMP DEFAULT NOW()
+);
+
+-- ============================================
+-- 15. Two-factor authentication tables (TOTP)
+-- ============================================
+CREATE TABLE IF NOT EXISTS user_totp (
+    user_id     INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    secret      TEXT NOT NULL,
+    enabled_at  TIMESTAMP,
+    last_step   BIGINT NOT NULL DEFAULT 0,
+    created_at  TIMESTAMP DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS recovery_codes (
+    id          SERIAL PRIMARY KEY,
+    user_id     INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    code_hash   VARCHAR(64) NOT NULL,
+    used_at     TIMESTAMP,
+    created_at  TIMESTAMP DEFAULT NOW()
+);
+
+-- ============================================
+-- 16. Audit log (admin and sensitive user actions)
+-- ============================================
+CREATE TABLE IF NOT EXISTS audit_log (
+    id          BIGSERIAL PRIMARY KEY,
+    actor_id    INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    actor_email VARCHAR(255) NOT NULL DEFAULT '',
+    action      VARCHAR(50) NOT NULL,
+    target_type VARCHAR(30) NOT NULL DEFAULT '',
+    target_id   VARCHAR(100) NOT NULL DEFAULT '',
+    before      JSONB,
+    after       JSONB,
+    ip          VARCHAR(45) NOT NULL DEFAULT '',
+    created_at  TIMESTAMP DEFAULT NOW()
+);
+
+-- ============================================
+-- 17. PTT mail jobs (queued PTT mails, pushes, replies, inbox and credential checks)
+-- ============================================
+CREATE TABLE IF NOT EXISTS ptt_mail_jobs (
+    id                  BIGSERIAL PRIMARY KEY,
+    kind                VARCHAR(10) NOT NULL DEFAULT 'mail' CHECK (kind IN ('mail', 'push', 'reply', 'inbox', 'verify')),
+    user_id             INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    subscription_id     INTEGER REFERENCES subscriptions(id) ON DELETE SET NULL,
+    ptt_username        VARCHAR(50) NOT NULL,
+    recipient           VARCHAR(50) NOT NULL,
+    subject             TEXT NOT NULL DEFAULT '',
+    content             TEXT NOT NULL DEFAULT '',
+    article_code        VARCHAR(30) NOT NULL DEFAULT '',
+    board               VARCHAR(50) NOT NULL DEFAULT '',
+    push_type           SMALLINT NOT NULL DEFAULT 0,
+    status              VARCHAR(20) NOT NULL DEFAULT 'queued' CHECK (status IN ('queued', 'running', 'sent', 'failed')),
+    attempts            INTEGER NOT NULL DEFAULT 0,
+    last_error          TEXT NOT NULL DEFAULT '',
+    telegram_chat_id    BIGINT,
+    telegram_message_id INTEGER,
+    run_at              TIMESTAMP NOT NULL DEFAULT NOW(),
+    started_at          TIMESTAMP,
+    finished_at         TIMESTAMP,
+    created_at          TIMESTAMP DEFAULT NOW(),
+    updated_at          TIMESTAMP DEFAULT NOW()
+);
+
+-- ============================================
+-- 18. PTT mail log (sent and failed PTT mails)
+-- ============================================
+CREATE TABLE IF NOT EXISTS ptt_mail_log (
+    id           BIGSERIAL PRIMARY KEY,
+    user_id      INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    recipient    VARCHAR(50) NOT NULL,
+    subject      TEXT NOT NULL DEFAULT '',
+    article_code VARCHAR(30) NOT NULL DEFAULT '',
+    status       VARCHAR(20) NOT NULL CHECK (status IN ('sent', 'failed')),
+    error        TEXT NOT NULL DEFAULT '',
+    created_at   TIMESTAMP DEFAULT NOW()
+);
+
+-- ============================================
+-- 19. Indexes
 -- ============================================
 -- Articles indexes
 CREATE INDEX IF NOT EXISTS idx_articles_board ON articles(board_name);
@@ -165,8 +334,50 @@ CREATE INDEX IF NOT EXISTS idx_subscription_stats_board ON subscription_stats(bo
 -- PTT accounts indexes
 CREATE INDEX IF NOT EXISTS idx_ptt_accounts_user_id ON ptt_accounts(user_id);
 
+-- Article archive indexes (trigram for CJK substring search)
+CREATE INDEX IF NOT EXISTS idx_article_archive_title_trgm ON article_archive USING GIN (title gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_article_archive_body_trgm ON article_archive USING GIN (body gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_article_archive_board_published ON article_archive(LOWER(board), published_at DESC);
+CREATE INDEX IF NOT EXISTS idx_article_archive_author ON article_archive(LOWER(author));
+CREATE INDEX IF NOT EXISTS idx_article_archive_published ON article_archive(published_at DESC);
+
+-- Board catalog indexes
+CREATE INDEX IF NOT EXISTS idx_board_catalog_name_lower ON board_catalog(LOWER(name));
+CREATE INDEX IF NOT EXISTS idx_board_catalog_title_trgm ON board_catalog USING GIN (title gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_board_catalog_online_users ON board_catalog(online_users DESC);
+
+-- Sessions indexes
+CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions(user_id);
+CREATE INDEX IF NOT EXISTS idx_sessions_previous_token_hash ON sessions(previous_token_hash);
+
+-- API tokens indexes
+CREATE INDEX IF NOT EXISTS idx_api_tokens_user_id ON api_tokens(user_id);
+
+-- Recovery codes indexes
+CREATE INDEX IF NOT EXISTS idx_recovery_codes_user_id ON recovery_codes(user_id);
+
+-- Audit log indexes
+CREATE INDEX IF NOT EXISTS idx_audit_log_created_at ON audit_log(created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_audit_log_actor_id ON audit_log(actor_id);
+CREATE INDEX IF NOT EXISTS idx_audit_log_target ON audit_log(target_type, target_id);
+
+-- PTT mail job indexes (one running job per PTT account)
+CREATE INDEX IF NOT EXISTS idx_ptt_mail_jobs_user_id ON ptt_mail_jobs(user_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_ptt_mail_jobs_queued ON ptt_mail_jobs(run_at) WHERE status = 'queued';
+CREATE UNIQUE INDEX IF NOT EXISTS idx_ptt_mail_jobs_running ON ptt_mail_jobs(LOWER(ptt_username)) WHERE status = 'running';
+CREATE UNIQUE INDEX IF NOT EXISTS idx_ptt_mail_jobs_pending_mail ON ptt_mail_jobs(user_id, LOWER(recipient), article_code)
+    WHERE kind = 'mail' AND article_code <> '' AND status IN ('queued', 'running');
+CREATE INDEX IF NOT EXISTS idx_ptt_mail_jobs_inbox ON ptt_mail_jobs(user_id, created_at DESC) WHERE kind = 'inbox';
+CREATE INDEX IF NOT EXISTS idx_ptt_mail_jobs_verify ON ptt_mail_jobs(user_id, created_at DESC) WHERE kind = 'verify';
+CREATE UNIQUE INDEX IF NOT EXISTS idx_ptt_mail_jobs_pending_verify ON ptt_mail_jobs(user_id)
+    WHERE kind = 'verify' AND status IN ('queued', 'running');
+
+-- PTT mail log indexes (cooldown looks up sent mails per recipient and article)
+CREATE INDEX IF NOT EXISTS idx_ptt_mail_log_user_id ON ptt_mail_log(user_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_ptt_mail_log_sent ON ptt_mail_log(user_id, LOWER(recipient), article_code, created_at DESC) WHERE status = 'sent';
+
 -- ============================================
--- 11. Triggers
+-- 20. Triggers
 -- ============================================
 -- Updated_at trigger function
 CREATE OR REPLACE FUNCTION update_updated_at()
@@ -224,3 +435,21 @@ DROP TRIGGER IF EXISTS ptt_accounts_updated_at ON ptt_accounts;
 CREATE TRIGGER ptt_accounts_updated_at
     BEFORE UPDATE ON ptt_accounts
     FOR EACH ROW EXECUTE FUNCTION update_updated_at();
+
+-- Apply trigger to article_archive_policies
+DROP TRIGGER IF EXISTS article_archive_policies_updated_at ON article_archive_policies;
+CREATE TRIGGER article_archive_policies_updated_at
+    BEFORE UPDATE ON article_archive_policies
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at();
+
+-- Apply trigger to board_catalog
+DROP TRIGGER IF EXISTS board_catalog_updated_at ON board_catalog;
+CREATE TRIGGER board_catalog_updated_at
+    BEFORE UPDATE ON board_catalog
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at();
+
+-- Apply trigger to ptt_mail_jobs
+DROP TRIGGER IF EXISTS ptt_mail_jobs_updated_at ON ptt_mail_jobs;
+CREATE TRIGGER ptt_mail_jobs_updated_at
+    BEFORE UPDATE ON ptt_mail_jobs
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at();
@@ -2,23 +2,32 @@ package account
 
 import (
 	"errors"
+	"os"
 	"time"
 )
 
 var (
-	ErrEmailExists     = errors.New("email already exists")
-	ErrInvalidPassword = errors.New("invalid password")
-	ErrAccountNotFound = errors.New("account not found")
-	ErrAccountDisabled = errors.New("account is disabled")
+	ErrEmailExists      = errors.New("email already exists")
+	ErrInvalidPassword  = errors.New("invalid password")
+	ErrAccountNotFound  = errors.New("account not found")
+	ErrAccountDisabled  = errors.New("account is disabled")
+	ErrEmailNotVerified = errors.New("email not verified")
 )
 
 // Account represents a user account
 type Account struct {
-	ID        int       `json:"id"`
-	Email     string    `json:"email"`
-	Password  string    `json:"-"`
-	Role      string    `json:"role"`
-	Enabled   bool      `json:"enabled"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID            int       `json:"id"`
+	Email         string    `json:"email"`
+	Password      string    `json:"-"`
+	Role          string    `json:"role"`
+	Enabled       bool      `json:"enabled"`
+	EmailVerified bool      `json:"email_verified"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// RequireEmailVerification reports whether subscriptions need a verified
+// email, set by REQUIRE_EMAIL_VERIFICATION=true
+func RequireEmailVerification() bool {
+	return os.Getenv("REQUIRE_EMAIL_VERIFICATION") == "true"
 }
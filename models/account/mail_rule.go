@@ -0,0 +1,84 @@
+package account
+
+import (
+	"errors"
+	"regexp"
+	"unicode/utf8"
+)
+
+var ErrInvalidMailRule = errors.New("invalid mail rule")
+
+const (
+	// MaxMailTemplates bounds the named templates of a rule, each is a
+	// button when picking one
+	MaxMailTemplates = 5
+	// MaxMailTemplateName keeps template names short enough for a button
+	MaxMailTemplateName = 10
+	// maxTitlePattern bounds the title pattern of a rule
+	maxTitlePattern = 200
+)
+
+// MailRule decides which articles of a subscription get a mail button and
+// which named templates the button offers besides the subscription's own
+type MailRule struct {
+	// TitlePattern is a regular expression the article title must match,
+	// e.g. ^\[售\] for selling posts only, empty matches every title
+	TitlePattern string          `json:"title_pattern,omitempty"`
+	Templates    []*MailTemplate `json:"templates,omitempty"`
+}
+
+// Validate checks the title pattern compiles and the templates are named,
+// distinct and render
+func (r *MailRule) Validate() error {
+	if len(r.TitlePattern) > maxTitlePattern {
+		return ErrInvalidMailRule
+	}
+	if _, err := regexp.Compile(r.TitlePattern); err != nil {
+		return ErrInvalidMailRule
+	}
+	if len(r.Templates) > MaxMailTemplates {
+		return ErrInvalidMailRule
+	}
+	names := make(map[string]bool)
+	for _, t := range r.Templates {
+		if t == nil || t.Name == "" || utf8.RuneCountInString(t.Name) > MaxMailTemplateName || names[t.Name] {
+			return ErrInvalidMailRule
+		}
+		if t.Subject == "" && t.Content == "" {
+			return ErrInvalidMailRule
+		}
+		if err := t.Validate(); err != nil {
+			return err
+		}
+		names[t.Name] = true
+	}
+	return nil
+}
+
+// Match reports whether an article titled title gets a mail button, a
+// pattern no longer compiling matches nothing
+func (r *MailRule) Match(title string) bool {
+	if r == nil || r.TitlePattern == "" {
+		return true
+	}
+	matched, err := regexp.MatchString(r.TitlePattern, title)
+	return err == nil && matched
+}
+
+// MailTemplates returns the templates a mail button offers: the
+// subscription's own first, then the named ones of its rule. The index
+// in this list is what buttons refer to.
+func (s *Subscription) MailTemplates() []*MailTemplate {
+	var templates []*MailTemplate
+	if s.Mail != nil && (s.Mail.Subject != "" || s.Mail.Content != "") {
+		templates = append(templates, s.Mail)
+	}
+	if s.MailRule != nil {
+		for _, t := range s.MailRule.Templates {
+			if t != nil && (t.Subject != "" || t.Content != "") {
+				templates = append(templates, t)
+			}
+		}
+	}
+	return templates
+}
@@ -0,0 +1,89 @@
+package account
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestMailRule_Validate(t *testing.T) {
+	ask := &MailTemplate{Name: "問價", Subject: "詢問 {{.Title}}", Content: "請問還在嗎？"}
+	reserve := &MailTemplate{Name: "預訂", Content: "想預訂"}
+	tests := []struct {
+		name    string
+		rule    MailRule
+		wantErr error
+	}{
+		{"pattern only", MailRule{TitlePattern: `^\[售\]`}, nil},
+		{"templates", MailRule{Templates: []*MailTemplate{ask, reserve}}, nil},
+		{"invalid pattern", MailRule{TitlePattern: `[售`}, ErrInvalidMailRule},
+		{"unnamed template", MailRule{Templates: []*MailTemplate{{Content: "您好"}}}, ErrInvalidMailRule},
+		{"long name", MailRule{Templates: []*MailTemplate{{Name: "這是一個太長的信件模板名稱", Content: "您好"}}}, ErrInvalidMailRule},
+		{"duplicate name", MailRule{Templates: []*MailTemplate{ask, ask}}, ErrInvalidMailRule},
+		{"empty template", MailRule{Templates: []*MailTemplate{{Name: "空白"}}}, ErrInvalidMailRule},
+		{"too many", MailRule{Templates: []*MailTemplate{
+			{Name: "1", Content: "a"}, {Name: "2", Content: "a"}, {Name: "3", Content: "a"},
+			{Name: "4", Content: "a"}, {Name: "5", Content: "a"}, {Name: "6", Content: "a"},
+		}}, ErrInvalidMailRule},
+		{"unknown field", MailRule{Templates: []*MailTemplate{{Name: "問價", Subject: "{{.Seller}}"}}}, ErrInvalidMailTemplate},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.rule.Validate()
+			if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+				t.Errorf("Validate() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMailRule_Match(t *testing.T) {
+	tests := []struct {
+		name  string
+		rule  *MailRule
+		title string
+		want  bool
+	}{
+		{"no rule", nil, "[徵] iPad", true},
+		{"no pattern", &MailRule{}, "[徵] iPad", true},
+		{"selling", &MailRule{TitlePattern: `^\[售\]`}, "[售] iPad Air 5 $12,000", true},
+		{"buying", &MailRule{TitlePattern: `^\[售\]`}, "[徵] iPad Air 5", false},
+		{"reply", &MailRule{TitlePattern: `^\[售\]`}, "Re: [售] iPad Air 5 $12,000", false},
+		{"invalid pattern", &MailRule{TitlePattern: `[售`}, "[售] iPad", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.rule.Match(tt.title); got != tt.want {
+				t.Errorf("Match(%q) = %v, want %v", tt.title, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSubscription_MailTemplates(t *testing.T) {
+	own := &MailTemplate{Subject: "詢問", Content: "您好"}
+	ask := &MailTemplate{Name: "問價", Content: "多少錢？"}
+	tests := []struct {
+		name string
+		sub  Subscription
+		want []*MailTemplate
+	}{
+		{"none", Subscription{}, nil},
+		{"own", Subscription{Mail: own}, []*MailTemplate{own}},
+		{"empty own", Subscription{Mail: &MailTemplate{}, MailRule: &MailRule{Templates: []*MailTemplate{ask}}}, []*MailTemplate{ask}},
+		{"own first", Subscription{Mail: own, MailRule: &MailRule{Templates: []*MailTemplate{ask}}}, []*MailTemplate{own, ask}},
+		{"pattern only", Subscription{MailRule: &MailRule{TitlePattern: `^\[售\]`}}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.sub.MailTemplates()
+			if len(got) != len(tt.want) {
+				t.Fatalf("MailTemplates() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("MailTemplates()[%d] = %v, want %v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,165 @@
+package account
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"text/template/parse"
+	"time"
+	"unicode/utf8"
+)
+
+var ErrInvalidMailTemplate = errors.New("invalid mail template")
+
+const (
+	// MaxMailSubject and MaxMailContent bound the template texts in runes,
+	// plain field actions keep what they render close to these
+	MaxMailSubject = 100
+	MaxMailContent = 2000
+)
+
+// MailData is what a mail template can reference, e.g. {{.Title}}
+type MailData struct {
+	Author string
+	Title  string
+	Link   string
+	Board  string
+	Code   string
+	// Date is the publish time in Taiwan time, YYYY/MM/DD HH:MM
+	Date string
+	// Price is parsed from the title, empty when it has none
+	Price string
+}
+
+// sampleMailData checks that a template only references known fields
+var sampleMailData = MailData{
+	Author: "author",
+	Title:  "[販售] 標題 $1,000",
+	Link:   "https://www.ptt.cc/bbs/Board/M.1498563199.A.35C.html",
+	Board:  "Board",
+	Code:   "M.1498563199.A.35C",
+	Date:   "2017/06/27 19:33",
+	Price:  "1000",
+}
+
+var (
+	mailCST = time.FixedZone("CST", 8*60*60)
+
+	pricePattern = regexp.MustCompile(`(?:\$|＄|NT\$?)\s*([0-9][0-9,]*)|([0-9][0-9,]*)\s*(?:元|塊)`)
+	codePattern  = regexp.MustCompile(`^[GM]\.(\d+)\.A\.[0-9A-F]+$`)
+)
+
+// NewMailData fills what the article code and board tell when the rest of
+// the article is unknown: the link and, from the code, the publish time
+func NewMailData(author, board, code string) MailData {
+	d := MailData{
+		Author: author,
+		Board:  board,
+		Code:   code,
+	}
+	if code != "" && board != "" {
+		d.Link = "https://www.ptt.cc/bbs/" + board + "/" + code + ".html"
+	}
+	if m := codePattern.FindStringSubmatch(code); len(m) == 2 {
+		if unix, err := strconv.ParseInt(m[1], 10, 64); err == nil {
+			d.Date = FormatMailDate(time.Unix(unix, 0))
+		}
+	}
+	return d
+}
+
+// FormatMailDate formats a publish time for MailData.Date
+func FormatMailDate(t time.Time) string {
+	return t.In(mailCST).Format("2006/01/02 15:04")
+}
+
+// ParsePrice returns the first price in a title such as "$25,000" or
+// "300元" as plain digits, empty when there is none
+func ParsePrice(title string) string {
+	m := pricePattern.FindStringSubmatch(title)
+	if m == nil {
+		return ""
+	}
+	price := m[1]
+	if price == "" {
+		price = m[2]
+	}
+	return strings.ReplaceAll(price, ",", "")
+}
+
+// Validate parses the subject and content and renders them once, so
+// unknown fields fail when the template is saved instead of when mailing
+func (t *MailTemplate) Validate() error {
+	_, _, err := t.Render(sampleMailData)
+	return err
+}
+
+// Render fills the template with the article. Whitespace in the subject is
+// collapsed to single spaces since PTT takes the subject on one line.
+func (t *MailTemplate) Render(d MailData) (subject, content string, err error) {
+	subject, err = renderMailText("subject", t.Subject, d)
+	if err != nil {
+		return "", "", err
+	}
+	content, err = renderMailText("content", t.Content, d)
+	if err != nil {
+		return "", "", err
+	}
+	subject = strings.Join(strings.Fields(subject), " ")
+	return subject, content, nil
+}
+
+func renderMailText(name, text string, d MailData) (string, error) {
+	limit := MaxMailContent
+	if name == "subject" {
+		limit = MaxMailSubject
+	}
+	if utf8.RuneCountInString(text) > limit {
+		return "", fmt.Errorf("%w: %s longer than %d characters", ErrInvalidMailTemplate, name, limit)
+	}
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidMailTemplate, err)
+	}
+	if err := checkMailNodes(tmpl.Tree.Root); err != nil {
+		return "", err
+	}
+	var sb strings.Builder
+	if err := tmpl.Execute(&sb, d); err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidMailTemplate, err)
+	}
+	return sb.String(), nil
+}
+
+// checkMailNodes allows text and plain {{.Field}} actions only. Loops,
+// conditions, variables and function calls would let a template render
+// without bound.
+func checkMailNodes(root *parse.ListNode) error {
+	for _, n := range root.Nodes {
+		switch n := n.(type) {
+		case *parse.TextNode, *parse.CommentNode:
+		case *parse.ActionNode:
+			if !isPlainField(n.Pipe) {
+				return fmt.Errorf("%w: only {{.Field}} is allowed, got %s", ErrInvalidMailTemplate, n)
+			}
+		default:
+			return fmt.Errorf("%w: only {{.Field}} is allowed, got %s", ErrInvalidMailTemplate, n)
+		}
+	}
+	return nil
+}
+
+func isPlainField(pipe *parse.PipeNode) bool {
+	if pipe == nil || len(pipe.Decl) > 0 || len(pipe.Cmds) != 1 {
+		return false
+	}
+	args := pipe.Cmds[0].Args
+	if len(args) != 1 {
+		return false
+	}
+	field, ok := args[0].(*parse.FieldNode)
+	return ok && len(field.Ident) == 1
+}
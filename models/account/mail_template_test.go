@@ -0,0 +1,80 @@
+package account
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParsePrice(t *testing.T) {
+	tests := []struct {
+		title string
+		want  string
+	}{
+		{"[販售] iPhone 15 128G $25,000", "25000"},
+		{"[販售] Switch 主機 NT$ 6500", "6500"},
+		{"[賣/台北] 二手書 300元", "300"},
+		{"[徵求] iPhone 15 128G", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			if got := ParsePrice(tt.title); got != tt.want {
+				t.Errorf("ParsePrice() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewMailData(t *testing.T) {
+	d := NewMailData("seller", "MacShop", "M.1498563199.A.35C")
+	if d.Link != "https://www.ptt.cc/bbs/MacShop/M.1498563199.A.35C.html" {
+		t.Errorf("Link = %v", d.Link)
+	}
+	if d.Date != "2017/06/27 19:33" {
+		t.Errorf("Date = %v, want 2017/06/27 19:33", d.Date)
+	}
+
+	d = NewMailData("seller", "MacShop", "")
+	if d.Link != "" || d.Date != "" {
+		t.Errorf("NewMailData() without code = %+v, want no link and date", d)
+	}
+}
+
+func TestMailTemplate_Render(t *testing.T) {
+	data := MailData{Author: "seller", Title: "[販售] iPad $9,000", Board: "MacShop", Price: "9000"}
+	tests := []struct {
+		name        string
+		tmpl        MailTemplate
+		wantSubject string
+		wantContent string
+		wantErr     error
+	}{
+		{"static", MailTemplate{Subject: "詢問", Content: "您好"}, "詢問", "您好", nil},
+		{"fields", MailTemplate{Subject: "Re: {{.Title}}", Content: "{{.Author}} 您好，{{.Price}} 元可以嗎？"},
+			"Re: [販售] iPad $9,000", "seller 您好，9000 元可以嗎？", nil},
+		{"subject on one line", MailTemplate{Subject: "{{.Board}}\n詢問", Content: "第一行\n第二行"},
+			"MacShop 詢問", "第一行\n第二行", nil},
+		{"unknown field", MailTemplate{Subject: "{{.Seller}}"}, "", "", ErrInvalidMailTemplate},
+		{"syntax", MailTemplate{Content: "{{.Title"}, "", "", ErrInvalidMailTemplate},
+		{"range", MailTemplate{Content: "{{range 1000000000}}{{.Title}}{{end}}"}, "", "", ErrInvalidMailTemplate},
+		{"condition", MailTemplate{Content: "{{if .Price}}{{.Price}}{{end}}"}, "", "", ErrInvalidMailTemplate},
+		{"function", MailTemplate{Content: "{{printf \"%s\" .Title}}"}, "", "", ErrInvalidMailTemplate},
+		{"pipeline", MailTemplate{Content: "{{.Title | len}}"}, "", "", ErrInvalidMailTemplate},
+		{"variable", MailTemplate{Content: "{{$t := .Title}}"}, "", "", ErrInvalidMailTemplate},
+		{"long subject", MailTemplate{Subject: strings.Repeat("長", MaxMailSubject+1)}, "", "", ErrInvalidMailTemplate},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			subject, content, err := tt.tmpl.Render(data)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Render() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if subject != tt.wantSubject || content != tt.wantContent {
+				t.Errorf("Render() = %q, %q, want %q, %q", subject, content, tt.wantSubject, tt.wantContent)
+			}
+			if err := tt.tmpl.Validate(); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package account
+
+import (
+	"errors"
+	"strings"
+)
+
+// Permissions a role can be granted
+const (
+	PermPTTMail        = "ptt_mail"
+	PermRegexKeywords  = "regex_keywords"
+	PermWebhookChannel = "webhook_channel"
+
+	PermAdminStats       = "admin_stats"
+	PermAdminUsers       = "admin_users"
+	PermAdminRoles       = "admin_roles"
+	PermAdminBroadcast   = "admin_broadcast"
+	PermAdminArchive     = "admin_archive"
+	PermAdminCrawler     = "admin_crawler"
+	PermAdminAudit       = "admin_audit"
+	PermAdminImpersonate = "admin_impersonate"
+)
+
+const adminPermPrefix = "admin_"
+
+var (
+	ErrUnknownPermission = errors.New("unknown permission")
+	ErrRegexNotAllowed   = errors.New("regex keywords not allowed")
+	ErrBoardLimitReached = errors.New("board limit reached")
+)
+
+// AllPermissions lists every permission, in the order shown to admins
+var AllPermissions = []string{
+	PermPTTMail,
+	PermRegexKeywords,
+	PermWebhookChannel,
+	PermAdminStats,
+	PermAdminUsers,
+	PermAdminRoles,
+	PermAdminBroadcast,
+	PermAdminArchive,
+	PermAdminCrawler,
+	PermAdminAudit,
+	PermAdminImpersonate,
+}
+
+// ValidatePermissions rejects unknown permission names
+func ValidatePermissions(perms []string) error {
+	for _, p := range perms {
+		if !containsPermission(AllPermissions, p) {
+			return ErrUnknownPermission
+		}
+	}
+	return nil
+}
+
+// IsAdminPermission reports whether perm grants an admin panel
+func IsAdminPermission(perm string) bool {
+	return strings.HasPrefix(perm, adminPermPrefix)
+}
+
+// Has reports whether the role is granted perm
+func (rl *RoleLimit) Has(perm string) bool {
+	return containsPermission(rl.Permissions, perm)
+}
+
+// HasAdminAccess reports whether the role is granted any admin panel
+func (rl *RoleLimit) HasAdminAccess() bool {
+	for _, p := range rl.Permissions {
+		if IsAdminPermission(p) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsPermission(perms []string, perm string) bool {
+	for _, p := range perms {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,49 @@
+package account
+
+import "testing"
+
+func TestValidatePermissions(t *testing.T) {
+	tests := []struct {
+		name    string
+		perms   []string
+		wantErr error
+	}{
+		{"empty", nil, nil},
+		{"known", []string{PermPTTMail, PermAdminRoles}, nil},
+		{"unknown", []string{PermPTTMail, "admin"}, ErrUnknownPermission},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidatePermissions(tt.perms); err != tt.wantErr {
+				t.Errorf("ValidatePermissions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRoleLimit_Has(t *testing.T) {
+	tests := []struct {
+		name      string
+		perms     []string
+		perm      string
+		want      bool
+		wantAdmin bool
+	}{
+		{"granted", []string{PermPTTMail, PermRegexKeywords}, PermRegexKeywords, true, false},
+		{"not granted", []string{PermRegexKeywords}, PermPTTMail, false, false},
+		{"admin panel", []string{PermAdminArchive}, PermAdminArchive, true, true},
+		{"other admin panel", []string{PermAdminArchive}, PermAdminRoles, false, true},
+		{"none", nil, PermPTTMail, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rl := &RoleLimit{Permissions: tt.perms}
+			if got := rl.Has(tt.perm); got != tt.want {
+				t.Errorf("Has() = %v, want %v", got, tt.want)
+			}
+			if got := rl.HasAdminAccess(); got != tt.wantAdmin {
+				t.Errorf("HasAdminAccess() = %v, want %v", got, tt.wantAdmin)
+			}
+		})
+	}
+}
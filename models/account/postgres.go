@@ -20,12 +20,13 @@ func (p *Postgres) Create(email, passwordHash, role string) (*Account, error) {
 	err := pool.QueryRow(ctx, `
 		INSERT INTO users (email, password, role)
 		VALUES ($1, $2, $3)
-		RETURNING id, email, role, enabled, created_at, updated_at
+		RETURNING id, email, role, enabled, email_verified_at IS NOT NULL, created_at, updated_at
 	`, email, passwordHash, role).Scan(
 		&account.ID,
 		&account.Email,
 		&account.Role,
 		&account.Enabled,
+		&account.EmailVerified,
 		&account.CreatedAt,
 		&account.UpdatedAt,
 	)
@@ -47,7 +48,7 @@ func (p *Postgres) FindByEmail(email string) (*Account, error) {
 
 	var account Account
 	err := pool.QueryRow(ctx, `
-		SELECT id, email, password, role, enabled, created_at, updated_at
+		SELECT id, email, password, role, enabled, email_verified_at IS NOT NULL, created_at, updated_at
 		FROM users
 		WHERE email = $1
 	`, email).Scan(
@@ -56,6 +57,7 @@ func (p *Postgres) FindByEmail(email string) (*Account, error) {
 		&account.Password,
 		&account.Role,
 		&account.Enabled,
+		&account.EmailVerified,
 		&account.CreatedAt,
 		&account.UpdatedAt,
 	)
@@ -77,7 +79,7 @@ func (p *Postgres) FindByID(id int) (*Account, error) {
 
 	var account Account
 	err := pool.QueryRow(ctx, `
-		SELECT id, email, password, role, enabled, created_at, updated_at
+		SELECT id, email, password, role, enabled, email_verified_at IS NOT NULL, created_at, updated_at
 		FROM users
 		WHERE id = $1
 	`, id).Scan(
@@ -86,6 +88,7 @@ func (p *Postgres) FindByID(id int) (*Account, error) {
 		&account.Password,
 		&account.Role,
 		&account.Enabled,
+		&account.EmailVerified,
 		&account.CreatedAt,
 		&account.UpdatedAt,
 	)
@@ -141,7 +144,7 @@ func (p *Postgres) List(query string, page, limit int) (*ListResult, error) {
 
 		// Get paginated results
 		rows, err = pool.Query(ctx, `
-			SELECT id, email, role, enabled, created_at, updated_at
+			SELECT id, email, role, enabled, email_verified_at IS NOT NULL, created_at, updated_at
 			FROM users
 			WHERE email ILIKE $1
 			ORDER BY created_at DESC
@@ -156,7 +159,7 @@ func (p *Postgres) List(query string, page, limit int) (*ListResult, error) {
 
 		// Get paginated results
 		rows, err = pool.Query(ctx, `
-			SELECT id, email, role, enabled, created_at, updated_at
+			SELECT id, email, role, enabled, email_verified_at IS NOT NULL, created_at, updated_at
 			FROM users
 			ORDER BY created_at DESC
 			LIMIT $1 OFFSET $2
@@ -176,6 +179,7 @@ func (p *Postgres) List(query string, page, limit int) (*ListResult, error) {
 			&account.Email,
 			&account.Role,
 			&account.Enabled,
+			&account.EmailVerified,
 			&account.CreatedAt,
 			&account.UpdatedAt,
 		)
@@ -218,13 +222,27 @@ func (p *Postgres) UpdatePassword(id int, passwordHash string) error {
 
 	_, err := pool.Exec(ctx, `
 		UPDATE users
-		SET password_hash = $1
+		SET password = $1
 		WHERE id = $2
 	`, passwordHash, id)
 
 	return err
 }
 
+// MarkEmailVerified records that the user proved ownership of the email
+func (p *Postgres) MarkEmailVerified(id int) error {
+	ctx := context.Background()
+	pool := connections.Postgres()
+
+	_, err := pool.Exec(ctx, `
+		UPDATE users
+		SET email_verified_at = COALESCE(email_verified_at, NOW())
+		WHERE id = $1
+	`, id)
+
+	return err
+}
+
 // Delete deletes an account
 func (p *Postgres) Delete(id int) error {
 	ctx := context.Background()
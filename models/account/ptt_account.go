@@ -2,104 +2,82 @@ package account
 
 import (
 	"context"
-	"crypto/aes"
-	"crypto/cipher"
-	"crypto/rand"
-	"encoding/base64"
 	"errors"
-	"io"
-	"os"
 	"time"
 
+	log "github.com/Ptt-Alertor/logrus"
 	"github.com/Ptt-Alertor/ptt-alertor/connections"
+	"github.com/Ptt-Alertor/ptt-alertor/keyring"
 	"github.com/jackc/pgx/v5"
 )
 
 var (
-	ErrPTTAccountNotFound = errors.New("ptt account not found")
-	ErrPTTAccountExists   = errors.New("ptt account already exists")
+	ErrPTTAccountNotFound    = errors.New("ptt account not found")
+	ErrPTTAccountExists      = errors.New("ptt account already exists")
+	ErrPTTCredentialsInvalid = errors.New("ptt credentials invalid")
+)
+
+// Credential statuses of a PTT account, pending until a login tells
+const (
+	CredentialPending = "pending"
+	CredentialValid   = "valid"
+	CredentialInvalid = "invalid"
 )
 
 // PTTAccount represents a user's PTT account binding
 type PTTAccount struct {
-	ID          int       `json:"id"`
-	UserID      int       `json:"user_id"`
-	PTTUsername string    `json:"ptt_username"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	ID               int        `json:"id"`
+	UserID           int        `json:"user_id"`
+	PTTUsername      string     `json:"ptt_username"`
+	WatchInbox       bool       `json:"watch_inbox"`
+	CredentialStatus string     `json:"credential_status"`
+	LastVerifiedAt   *time.Time `json:"last_verified_at"`
+	LastError        string     `json:"last_error,omitempty"`
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
 }
 
-// PTTAccountPostgres is the PostgreSQL repository for PTT accounts
-type PTTAccountPostgres struct{}
+const pttAccountColumns = `id, user_id, ptt_username, watch_inbox, credential_status,
+	last_verified_at, COALESCE(last_error, ''), created_at, updated_at`
 
-// getEncryptionKey returns the AES encryption key from environment
-func getEncryptionKey() []byte {
-	key := os.Getenv("PTT_ENCRYPT_KEY")
-	if key == "" {
-		key = os.Getenv("JWT_SECRET") // fallback to JWT secret
-	}
-	// Ensure key is 32 bytes for AES-256
-	keyBytes := []byte(key)
-	if len(keyBytes) < 32 {
-		padded := make([]byte, 32)
-		copy(padded, keyBytes)
-		return padded
+func scanPTTAccount(row pgx.Row) (*PTTAccount, error) {
+	var acc PTTAccount
+	err := row.Scan(
+		&acc.ID,
+		&acc.UserID,
+		&acc.PTTUsername,
+		&acc.WatchInbox,
+		&acc.CredentialStatus,
+		&acc.LastVerifiedAt,
+		&acc.LastError,
+		&acc.CreatedAt,
+		&acc.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
 	}
-	return keyBytes[:32]
+	return &acc, nil
 }
 
-// encrypt encrypts plaintext using AES-GCM
-func encrypt(plaintext string) (string, error) {
-	key := getEncryptionKey()
-	block, err := aes.NewCipher(key)
-	if err != nil {
-		return "", err
-	}
+// PTTAccountPostgres is the PostgreSQL repository for PTT accounts
+type PTTAccountPostgres struct{}
 
-	gcm, err := cipher.NewGCM(block)
+// encrypt encrypts plaintext with the active key of the keyring
+func encrypt(plaintext string) (string, error) {
+	k, err := keyring.Current()
 	if err != nil {
 		return "", err
 	}
-
-	nonce := make([]byte, gcm.NonceSize())
-	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
-		return "", err
-	}
-
-	ciphertext := gcm.Seal(nonce, nonce, []byte(plaintext), nil)
-	return base64.StdEncoding.EncodeToString(ciphertext), nil
+	return k.Encrypt(plaintext)
 }
 
-// decrypt decrypts ciphertext using AES-GCM
+// decrypt decrypts ciphertext with the key it was written with
 func decrypt(ciphertext string) (string, error) {
-	key := getEncryptionKey()
-	data, err := base64.StdEncoding.DecodeString(ciphertext)
-	if err != nil {
-		return "", err
-	}
-
-	block, err := aes.NewCipher(key)
-	if err != nil {
-		return "", err
-	}
-
-	gcm, err := cipher.NewGCM(block)
+	k, err := keyring.Current()
 	if err != nil {
 		return "", err
 	}
-
-	nonceSize := gcm.NonceSize()
-	if len(data) < nonceSize {
-		return "", errors.New("ciphertext too short")
-	}
-
-	nonce, cipherData := data[:nonceSize], data[nonceSize:]
-	plaintext, err := gcm.Open(nil, nonce, cipherData, nil)
-	if err != nil {
-		return "", err
-	}
-
-	return string(plaintext), nil
+	return k.Decrypt(ciphertext)
 }
 
 // Create creates a new PTT account binding
@@ -113,18 +91,11 @@ func (p *PTTAccountPostgres) Create(userID int, pttUsername, pttPassword string)
 		return nil, err
 	}
 
-	var acc PTTAccount
-	err = pool.QueryRow(ctx, `
+	acc, err := scanPTTAccount(pool.QueryRow(ctx, `
 		INSERT INTO ptt_accounts (user_id, ptt_username, ptt_password_encrypted)
 		VALUES ($1, $2, $3)
-		RETURNING id, user_id, ptt_username, created_at, updated_at
-	`, userID, pttUsername, encryptedPassword).Scan(
-		&acc.ID,
-		&acc.UserID,
-		&acc.PTTUsername,
-		&acc.CreatedAt,
-		&acc.UpdatedAt,
-	)
+		RETURNING `+pttAccountColumns,
+		userID, pttUsername, encryptedPassword))
 
 	if err != nil {
 		if err.Error() == "ERROR: duplicate key value violates unique constraint \"ptt_accounts_user_id_key\" (SQLSTATE 23505)" {
@@ -133,7 +104,7 @@ func (p *PTTAccountPostgres) Create(userID int, pttUsername, pttPassword string)
 		return nil, err
 	}
 
-	return &acc, nil
+	return acc, nil
 }
 
 // FindByUserID finds a PTT account by user ID
@@ -141,18 +112,11 @@ func (p *PTTAccountPostgres) FindByUserID(userID int) (*PTTAccount, error) {
 	ctx := context.Background()
 	pool := connections.Postgres()
 
-	var acc PTTAccount
-	err := pool.QueryRow(ctx, `
-		SELECT id, user_id, ptt_username, created_at, updated_at
+	acc, err := scanPTTAccount(pool.QueryRow(ctx, `
+		SELECT `+pttAccountColumns+`
 		FROM ptt_accounts
 		WHERE user_id = $1
-	`, userID).Scan(
-		&acc.ID,
-		&acc.UserID,
-		&acc.PTTUsername,
-		&acc.CreatedAt,
-		&acc.UpdatedAt,
-	)
+	`, userID))
 
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
@@ -161,7 +125,7 @@ func (p *PTTAccountPostgres) FindByUserID(userID int) (*PTTAccount, error) {
 		return nil, err
 	}
 
-	return &acc, nil
+	return acc, nil
 }
 
 // GetCredentials retrieves the PTT username and decrypted password
@@ -191,7 +155,9 @@ func (p *PTTAccountPostgres) GetCredentials(userID int) (username, password stri
 	return username, password, nil
 }
 
-// Update updates a PTT account binding
+// Update updates a PTT account binding. The credentials are pending again
+// until a login checks them, and another PTT account starts its inbox watch
+// over.
 func (p *PTTAccountPostgres) Update(userID int, pttUsername, pttPassword string) (*PTTAccount, error) {
 	ctx := context.Background()
 	pool := connections.Postgres()
@@ -202,19 +168,15 @@ func (p *PTTAccountPostgres) Update(userID int, pttUsername, pttPassword string)
 		return nil, err
 	}
 
-	var acc PTTAccount
-	err = pool.QueryRow(ctx, `
+	acc, err := scanPTTAccount(pool.QueryRow(ctx, `
 		UPDATE ptt_accounts
-		SET ptt_username = $2, ptt_password_encrypted = $3
+		SET ptt_username = $2, ptt_password_encrypted = $3,
+		    credential_status = 'pending', last_verified_at = NULL, last_error = NULL,
+		    inbox_last_index = CASE WHEN LOWER(ptt_username) = LOWER($2) THEN inbox_last_index ELSE 0 END,
+		    inbox_checked_at = CASE WHEN LOWER(ptt_username) = LOWER($2) THEN inbox_checked_at END
 		WHERE user_id = $1
-		RETURNING id, user_id, ptt_username, created_at, updated_at
-	`, userID, pttUsername, encryptedPassword).Scan(
-		&acc.ID,
-		&acc.UserID,
-		&acc.PTTUsername,
-		&acc.CreatedAt,
-		&acc.UpdatedAt,
-	)
+		RETURNING `+pttAccountColumns,
+		userID, pttUsername, encryptedPassword))
 
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
@@ -223,7 +185,7 @@ func (p *PTTAccountPostgres) Update(userID int, pttUsername, pttPassword string)
 		return nil, err
 	}
 
-	return &acc, nil
+	return acc, nil
 }
 
 // Delete deletes a PTT account binding
@@ -257,3 +219,139 @@ func (p *PTTAccountPostgres) Exists(userID int) (bool, error) {
 
 	return exists, err
 }
+
+// SetWatchInbox turns the inbox watcher on or off for the user's account
+func (p *PTTAccountPostgres) SetWatchInbox(userID int, on bool) error {
+	ctx := context.Background()
+	pool := connections.Postgres()
+
+	result, err := pool.Exec(ctx, `
+		UPDATE ptt_accounts SET watch_inbox = $2 WHERE user_id = $1
+	`, userID, on)
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrPTTAccountNotFound
+	}
+
+	return nil
+}
+
+// InboxState returns the last mailbox index forwarded, checked is false
+// before the first check
+func (p *PTTAccountPostgres) InboxState(userID int) (lastIndex int, checked bool, err error) {
+	ctx := context.Background()
+	pool := connections.Postgres()
+
+	var checkedAt *time.Time
+	err = pool.QueryRow(ctx, `
+		SELECT inbox_last_index, inbox_checked_at FROM ptt_accounts WHERE user_id = $1
+	`, userID).Scan(&lastIndex, &checkedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, false, ErrPTTAccountNotFound
+		}
+		return 0, false, err
+	}
+
+	return lastIndex, checkedAt != nil, nil
+}
+
+// SaveInboxState records a mailbox check
+func (p *PTTAccountPostgres) SaveInboxState(userID, lastIndex int) error {
+	ctx := context.Background()
+	pool := connections.Postgres()
+
+	_, err := pool.Exec(ctx, `
+		UPDATE ptt_accounts SET inbox_last_index = $2, inbox_checked_at = NOW()
+		WHERE user_id = $1
+	`, userID, lastIndex)
+	return err
+}
+
+// SetCredentialStatus records the outcome of a login as username, which is
+// dropped when the account was bound to another PTT account meanwhile.
+// changed reports whether the status differs from the last one.
+func (p *PTTAccountPostgres) SetCredentialStatus(userID int, username, status, lastError string) (changed bool, err error) {
+	ctx := context.Background()
+	pool := connections.Postgres()
+
+	err = pool.QueryRow(ctx, `
+		UPDATE ptt_accounts a
+		SET credential_status = $3, last_verified_at = NOW(), last_error = NULLIF($4, '')
+		FROM (SELECT id, credential_status FROM ptt_accounts WHERE user_id = $1 FOR UPDATE) old
+		WHERE a.id = old.id AND LOWER(a.ptt_username) = LOWER($2)
+		RETURNING old.credential_status <> $3
+	`, userID, username, status, lastError).Scan(&changed)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return changed, nil
+}
+
+// ReEncrypt rewrites every stored password not written with the active key.
+// A row changed meanwhile is left for the next run, one that no key can
+// decrypt is counted as failed.
+func (p *PTTAccountPostgres) ReEncrypt() (migrated, failed int, err error) {
+	ctx := context.Background()
+	pool := connections.Postgres()
+
+	k, err := keyring.Current()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	rows, err := pool.Query(ctx, `SELECT id, ptt_password_encrypted FROM ptt_accounts ORDER BY id`)
+	if err != nil {
+		return 0, 0, err
+	}
+	type stale struct {
+		id         int
+		ciphertext string
+	}
+	var pending []stale
+	for rows.Next() {
+		var s stale
+		if err := rows.Scan(&s.id, &s.ciphertext); err != nil {
+			rows.Close()
+			return 0, 0, err
+		}
+		if k.NeedsRotation(s.ciphertext) {
+			pending = append(pending, s)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, 0, err
+	}
+
+	for _, s := range pending {
+		plaintext, err := k.Decrypt(s.ciphertext)
+		if err != nil {
+			log.WithField("id", s.id).WithError(err).Error("Decrypt PTT Password Failed")
+			failed++
+			continue
+		}
+		ciphertext, err := k.Encrypt(plaintext)
+		if err != nil {
+			return migrated, failed, err
+		}
+
+		_, err = pool.Exec(ctx, `
+			UPDATE ptt_accounts SET ptt_password_encrypted = $2
+			WHERE id = $1 AND ptt_password_encrypted = $3
+		`, s.id, ciphertext, s.ciphertext)
+		if err != nil {
+			return migrated, failed, err
+		}
+		migrated++
+	}
+
+	return migrated, failed, nil
+}
@@ -14,19 +14,57 @@ var (
 	ErrRoleInUse         = errors.New("role is in use by users")
 )
 
-// RoleLimit represents a role's subscription limit configuration
+// DefaultAPIRateLimit is the API requests per minute of a role unless set
+const DefaultAPIRateLimit = 60
+
+// RoleLimit represents a role's limits and the permissions it grants
 type RoleLimit struct {
-	ID               int       `json:"id"`
-	Role             string    `json:"role"`
-	MaxSubscriptions int       `json:"max_subscriptions"`
-	Description      string    `json:"description"`
-	CreatedAt        time.Time `json:"created_at"`
-	UpdatedAt        time.Time `json:"updated_at"`
+	ID               int    `json:"id"`
+	Role             string `json:"role"`
+	MaxSubscriptions int    `json:"max_subscriptions"`
+	Description      string `json:"description"`
+	Require2FA       bool   `json:"require_2fa"`
+	APIRateLimit     int    `json:"api_rate_limit"`
+	// Permissions are the named capabilities, see AllPermissions
+	Permissions []string `json:"permissions"`
+	// MaxBoards limits the distinct boards subscribed to, -1 for unlimited
+	MaxBoards int `json:"max_boards"`
+	// MinPollInterval is the shortest polling interval in seconds
+	MinPollInterval int       `json:"min_poll_interval"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
 }
 
 // RoleLimitPostgres is the PostgreSQL repository for role limits
 type RoleLimitPostgres struct{}
 
+const roleLimitColumns = `id, role, max_subscriptions, description, require_2fa, api_rate_limit,
+		permissions, max_boards, min_poll_interval, created_at, updated_at`
+
+func scanRoleLimit(row pgx.Row) (*RoleLimit, error) {
+	var rl RoleLimit
+	err := row.Scan(
+		&rl.ID,
+		&rl.Role,
+		&rl.MaxSubscriptions,
+		&rl.Description,
+		&rl.Require2FA,
+		&rl.APIRateLimit,
+		&rl.Permissions,
+		&rl.MaxBoards,
+		&rl.MinPollInterval,
+		&rl.CreatedAt,
+		&rl.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if rl.Permissions == nil {
+		rl.Permissions = []string{}
+	}
+	return &rl, nil
+}
+
 // GetMaxSubscriptions returns the max subscriptions for a role
 // Returns -1 for unlimited, or the limit value
 func (p *RoleLimitPostgres) GetMaxSubscriptions(role string) (int, error) {
@@ -49,24 +87,91 @@ func (p *RoleLimitPostgres) GetMaxSubscriptions(role string) (int, error) {
 	return maxSubs, nil
 }
 
+// RequiresTwoFactor reports whether users of a role must log in with TOTP
+func (p *RoleLimitPostgres) RequiresTwoFactor(role string) (bool, error) {
+	ctx := context.Background()
+	pool := connections.Postgres()
+
+	var required bool
+	err := pool.QueryRow(ctx, `
+		SELECT require_2fa FROM role_limits WHERE role = $1
+	`, role).Scan(&required)
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return required, nil
+}
+
+// GetAPIRateLimit returns the API requests per minute allowed to each user
+// of a role. Returns -1 for unlimited, or DefaultAPIRateLimit if the role
+// is not found.
+func (p *RoleLimitPostgres) GetAPIRateLimit(role string) (int, error) {
+	ctx := context.Background()
+	pool := connections.Postgres()
+
+	var limit int
+	err := pool.QueryRow(ctx, `
+		SELECT api_rate_limit FROM role_limits WHERE role = $1
+	`, role).Scan(&limit)
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return DefaultAPIRateLimit, nil
+		}
+		return DefaultAPIRateLimit, err
+	}
+
+	return limit, nil
+}
+
+// Can reports whether a role is granted perm. Unknown roles have no
+// permissions.
+func (p *RoleLimitPostgres) Can(role, perm string) (bool, error) {
+	ctx := context.Background()
+	pool := connections.Postgres()
+
+	var granted bool
+	err := pool.QueryRow(ctx, `
+		SELECT $2 = ANY(permissions) FROM role_limits WHERE role = $1
+	`, role, perm).Scan(&granted)
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return granted, nil
+}
+
+// HasAdminAccess reports whether a role is granted any admin panel
+func (p *RoleLimitPostgres) HasAdminAccess(role string) (bool, error) {
+	rl, err := p.FindByRole(role)
+	if err != nil {
+		if err == ErrRoleLimitNotFound {
+			return false, nil
+		}
+		return false, err
+	}
+	return rl.HasAdminAccess(), nil
+}
+
 // FindByRole finds a role limit by role name
 func (p *RoleLimitPostgres) FindByRole(role string) (*RoleLimit, error) {
 	ctx := context.Background()
 	pool := connections.Postgres()
 
-	var rl RoleLimit
-	err := pool.QueryRow(ctx, `
-		SELECT id, role, max_subscriptions, description, created_at, updated_at
+	rl, err := scanRoleLimit(pool.QueryRow(ctx, `
+		SELECT `+roleLimitColumns+`
 		FROM role_limits
 		WHERE role = $1
-	`, role).Scan(
-		&rl.ID,
-		&rl.Role,
-		&rl.MaxSubscriptions,
-		&rl.Description,
-		&rl.CreatedAt,
-		&rl.UpdatedAt,
-	)
+	`, role))
 
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
@@ -75,7 +180,7 @@ func (p *RoleLimitPostgres) FindByRole(role string) (*RoleLimit, error) {
 		return nil, err
 	}
 
-	return &rl, nil
+	return rl, nil
 }
 
 // List returns all role limits
@@ -84,7 +189,7 @@ func (p *RoleLimitPostgres) List() ([]*RoleLimit, error) {
 	pool := connections.Postgres()
 
 	rows, err := pool.Query(ctx, `
-		SELECT id, role, max_subscriptions, description, created_at, updated_at
+		SELECT `+roleLimitColumns+`
 		FROM role_limits
 		ORDER BY id
 	`)
@@ -95,69 +200,45 @@ func (p *RoleLimitPostgres) List() ([]*RoleLimit, error) {
 
 	var limits []*RoleLimit
 	for rows.Next() {
-		var rl RoleLimit
-		err := rows.Scan(
-			&rl.ID,
-			&rl.Role,
-			&rl.MaxSubscriptions,
-			&rl.Description,
-			&rl.CreatedAt,
-			&rl.UpdatedAt,
-		)
+		rl, err := scanRoleLimit(rows)
 		if err != nil {
 			return nil, err
 		}
-		limits = append(limits, &rl)
+		limits = append(limits, rl)
 	}
 
-	return limits, nil
+	return limits, rows.Err()
 }
 
 // Create creates a new role limit
-func (p *RoleLimitPostgres) Create(role string, maxSubs int, description string) (*RoleLimit, error) {
+func (p *RoleLimitPostgres) Create(rl *RoleLimit) (*RoleLimit, error) {
 	ctx := context.Background()
 	pool := connections.Postgres()
 
-	var rl RoleLimit
-	err := pool.QueryRow(ctx, `
-		INSERT INTO role_limits (role, max_subscriptions, description)
-		VALUES ($1, $2, $3)
-		RETURNING id, role, max_subscriptions, description, created_at, updated_at
-	`, role, maxSubs, description).Scan(
-		&rl.ID,
-		&rl.Role,
-		&rl.MaxSubscriptions,
-		&rl.Description,
-		&rl.CreatedAt,
-		&rl.UpdatedAt,
-	)
-
-	if err != nil {
-		return nil, err
-	}
-
-	return &rl, nil
+	return scanRoleLimit(pool.QueryRow(ctx, `
+		INSERT INTO role_limits (role, max_subscriptions, description, require_2fa, api_rate_limit,
+			permissions, max_boards, min_poll_interval)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING `+roleLimitColumns,
+		rl.Role, rl.MaxSubscriptions, rl.Description, rl.Require2FA, rl.APIRateLimit,
+		rl.Permissions, rl.MaxBoards, rl.MinPollInterval,
+	))
 }
 
 // Update updates a role limit
-func (p *RoleLimitPostgres) Update(role string, maxSubs int, description string) (*RoleLimit, error) {
+func (p *RoleLimitPostgres) Update(rl *RoleLimit) (*RoleLimit, error) {
 	ctx := context.Background()
 	pool := connections.Postgres()
 
-	var rl RoleLimit
-	err := pool.QueryRow(ctx, `
+	updated, err := scanRoleLimit(pool.QueryRow(ctx, `
 		UPDATE role_limits
-		SET max_subscriptions = $2, description = $3
+		SET max_subscriptions = $2, description = $3, require_2fa = $4, api_rate_limit = $5,
+			permissions = $6, max_boards = $7, min_poll_interval = $8
 		WHERE role = $1
-		RETURNING id, role, max_subscriptions, description, created_at, updated_at
-	`, role, maxSubs, description).Scan(
-		&rl.ID,
-		&rl.Role,
-		&rl.MaxSubscriptions,
-		&rl.Description,
-		&rl.CreatedAt,
-		&rl.UpdatedAt,
-	)
+		RETURNING `+roleLimitColumns,
+		rl.Role, rl.MaxSubscriptions, rl.Description, rl.Require2FA, rl.APIRateLimit,
+		rl.Permissions, rl.MaxBoards, rl.MinPollInterval,
+	))
 
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
@@ -166,7 +247,7 @@ func (p *RoleLimitPostgres) Update(role string, maxSubs int, description string)
 		return nil, err
 	}
 
-	return &rl, nil
+	return updated, nil
 }
 
 // Delete deletes a role limit (only if no users are using it)
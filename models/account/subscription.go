@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/Ptt-Alertor/ptt-alertor/connections"
+	"github.com/Ptt-Alertor/ptt-alertor/models/catalog"
 	"github.com/Ptt-Alertor/ptt-alertor/models/top"
 	"github.com/Ptt-Alertor/ptt-alertor/ptt/rss"
 	"github.com/jackc/pgx/v5"
@@ -28,10 +29,13 @@ var (
 	accountRepoInternal   = &Postgres{}
 	redisSyncInternal     = &RedisSync{}
 	statsRepoInternal     = &top.Postgres{}
+	catalogRepoInternal   = &catalog.Postgres{}
 )
 
-// MailTemplate represents the mail template for a subscription
+// MailTemplate represents the mail template for a subscription, Name tells
+// the templates of a mail rule apart
 type MailTemplate struct {
+	Name    string `json:"name,omitempty"`
 	Subject string `json:"subject,omitempty"`
 	Content string `json:"content,omitempty"`
 }
@@ -45,6 +49,7 @@ type Subscription struct {
 	Value     string        `json:"value"`
 	Enabled   bool          `json:"enabled"`
 	Mail      *MailTemplate `json:"mail,omitempty"`
+	MailRule  *MailRule     `json:"mail_rule,omitempty"`
 	CreatedAt time.Time     `json:"created_at"`
 	UpdatedAt time.Time     `json:"updated_at"`
 }
@@ -60,26 +65,37 @@ func (p *SubscriptionPostgres) Create(userID int, board, subType, value string)
 		return nil, err
 	}
 
-	// 2. Check subscription limit
+	// 2. Check email verification when required; Telegram accounts are
+	// verified by Telegram instead
+	if RequireEmailVerification() && !acc.EmailVerified && !IsTelegramEmail(acc.Email) {
+		return nil, ErrEmailNotVerified
+	}
+
+	// 3. Check subscription limit
 	if err := p.CheckLimit(userID, acc.Role); err != nil {
 		return nil, err
 	}
 
-	// 3. Validate board exists
-	if !rss.CheckBoardExist(board) {
+	// 4. Check role permissions and board limit
+	if err := p.checkRolePolicy(userID, acc.Role, board, subType, value, 0); err != nil {
+		return nil, err
+	}
+
+	// 5. Validate board exists
+	if !boardExists(board) {
 		return nil, ErrBoardNotFound
 	}
 
-	// 4. Create in DB
+	// 6. Create in DB
 	sub, err := p.createInDB(userID, board, subType, value)
 	if err != nil {
 		return nil, err
 	}
 
-	// 5. Sync to Redis (async)
+	// 7. Sync to Redis (async)
 	go redisSyncInternal.SyncSubscriptionCreate(sub, acc)
 
-	// 6. Update stats (async)
+	// 8. Update stats (async)
 	go syncStats(board, subType, value, true)
 
 	return sub, nil
@@ -95,7 +111,7 @@ func (p *SubscriptionPostgres) createInDB(userID int, board, subType, value stri
 	err := pool.QueryRow(ctx, `
 		INSERT INTO subscriptions (user_id, board, sub_type, value)
 		VALUES ($1, $2, $3, $4)
-		RETURNING id, user_id, board, sub_type, value, enabled, mail_subject, mail_content, created_at, updated_at
+		RETURNING id, user_id, board, sub_type, value, enabled, mail_subject, mail_content, mail_rule, created_at, updated_at
 	`, userID, board, subType, value).Scan(
 		&sub.ID,
 		&sub.UserID,
@@ -105,6 +121,7 @@ func (p *SubscriptionPostgres) createInDB(userID int, board, subType, value stri
 		&sub.Enabled,
 		&mailSubject,
 		&mailContent,
+		&sub.MailRule,
 		&sub.CreatedAt,
 		&sub.UpdatedAt,
 	)
@@ -150,6 +167,50 @@ func (p *SubscriptionPostgres) CheckLimit(userID int, role string) error {
 	return nil
 }
 
+// checkRolePolicy checks a subscription against the permissions and board
+// limit of the owner's role. excludeID skips the subscription being updated.
+func (p *SubscriptionPostgres) checkRolePolicy(userID int, role, board, subType, value string, excludeID int) error {
+	rl, err := roleLimitRepoInternal.FindByRole(role)
+	if err != nil {
+		if err != ErrRoleLimitNotFound {
+			return err
+		}
+		rl = &RoleLimit{Role: role, MaxBoards: -1}
+	}
+
+	if subType == "keyword" && strings.HasPrefix(value, "regexp:") && !rl.Has(PermRegexKeywords) {
+		return ErrRegexNotAllowed
+	}
+
+	// Article tracking is short-lived and doesn't count towards boards
+	if subType == "article" || rl.MaxBoards < 0 {
+		return nil
+	}
+	count, err := p.countOtherBoards(userID, board, excludeID)
+	if err != nil {
+		return err
+	}
+	if count >= rl.MaxBoards {
+		return ErrBoardLimitReached
+	}
+	return nil
+}
+
+// countOtherBoards counts the distinct boards a user subscribes to besides
+// board, ignoring article tracking and the subscription excludeID
+func (p *SubscriptionPostgres) countOtherBoards(userID int, board string, excludeID int) (int, error) {
+	ctx := context.Background()
+	pool := connections.Postgres()
+
+	var count int
+	err := pool.QueryRow(ctx, `
+		SELECT COUNT(DISTINCT LOWER(board)) FROM subscriptions
+		WHERE user_id = $1 AND sub_type <> 'article' AND id <> $3 AND LOWER(board) <> LOWER($2)
+	`, userID, board, excludeID).Scan(&count)
+
+	return count, err
+}
+
 // syncStats syncs subscription stats (increment or decrement)
 func syncStats(board, subType, value string, increment bool) {
 	// Article subscriptions don't need stats (articles are ephemeral and personal)
@@ -218,7 +279,7 @@ func (p *SubscriptionPostgres) FindByID(id int) (*Subscription, error) {
 	var sub Subscription
 	var mailSubject, mailContent *string
 	err := pool.QueryRow(ctx, `
-		SELECT id, user_id, board, sub_type, value, enabled, mail_subject, mail_content, created_at, updated_at
+		SELECT id, user_id, board, sub_type, value, enabled, mail_subject, mail_content, mail_rule, created_at, updated_at
 		FROM subscriptions
 		WHERE id = $1
 	`, id).Scan(
@@ -230,6 +291,7 @@ func (p *SubscriptionPostgres) FindByID(id int) (*Subscription, error) {
 		&sub.Enabled,
 		&mailSubject,
 		&mailContent,
+		&sub.MailRule,
 		&sub.CreatedAt,
 		&sub.UpdatedAt,
 	)
@@ -261,7 +323,7 @@ func (p *SubscriptionPostgres) ListByUserID(userID int) ([]*Subscription, error)
 	pool := connections.Postgres()
 
 	rows, err := pool.Query(ctx, `
-		SELECT id, user_id, board, sub_type, value, enabled, mail_subject, mail_content, created_at, updated_at
+		SELECT id, user_id, board, sub_type, value, enabled, mail_subject, mail_content, mail_rule, created_at, updated_at
 		FROM subscriptions
 		WHERE user_id = $1
 		ORDER BY updated_at DESC
@@ -284,6 +346,7 @@ func (p *SubscriptionPostgres) ListByUserID(userID int) ([]*Subscription, error)
 			&sub.Enabled,
 			&mailSubject,
 			&mailContent,
+			&sub.MailRule,
 			&sub.CreatedAt,
 			&sub.UpdatedAt,
 		)
@@ -307,7 +370,7 @@ func (p *SubscriptionPostgres) ListByUserID(userID int) ([]*Subscription, error)
 }
 
 // Update updates a subscription with full logic (validate, DB, Redis sync, stats)
-func (p *SubscriptionPostgres) Update(id, userID int, board, subType, value string, enabled bool, mailSubject, mailContent *string) error {
+func (p *SubscriptionPostgres) Update(id, userID int, board, subType, value string, enabled bool, mailSubject, mailContent *string, mailRule *MailRule) error {
 	// 1. Get existing subscription
 	sub, err := p.FindByID(id)
 	if err != nil {
@@ -319,32 +382,38 @@ func (p *SubscriptionPostgres) Update(id, userID int, board, subType, value stri
 		return ErrSubscriptionNotFound
 	}
 
-	// 3. Validate board exists
-	if !rss.CheckBoardExist(board) {
+	// 3. Check role permissions and board limit of the owner
+	acc, err := accountRepoInternal.FindByID(userID)
+	if err != nil {
+		return err
+	}
+	if err := p.checkRolePolicy(userID, acc.Role, board, subType, value, id); err != nil {
+		return err
+	}
+
+	// 4. Validate board exists
+	if !boardExists(board) {
 		return ErrBoardNotFound
 	}
 
 	// Store old values for stats
 	oldBoard, oldSubType, oldValue := sub.Board, sub.SubType, sub.Value
 
-	// 4. Update in DB
-	if err := p.updateInDB(id, board, subType, value, enabled, mailSubject, mailContent); err != nil {
+	// 5. Update in DB
+	if err := p.updateInDB(id, board, subType, value, enabled, mailSubject, mailContent, mailRule); err != nil {
 		return err
 	}
 
-	// 5. Update sub for Redis sync
+	// 6. Update sub for Redis sync
 	sub.Board = board
 	sub.SubType = subType
 	sub.Value = value
 	sub.Enabled = enabled
 
-	// 6. Sync to Redis (async)
-	acc, _ := accountRepoInternal.FindByID(userID)
-	if acc != nil {
-		go redisSyncInternal.SyncSubscriptionCreate(sub, acc)
-	}
+	// 7. Sync to Redis (async)
+	go redisSyncInternal.SyncSubscriptionCreate(sub, acc)
 
-	// 7. Update stats (async) - decrement old, increment new
+	// 8. Update stats (async) - decrement old, increment new
 	go func() {
 		syncStats(oldBoard, oldSubType, oldValue, false)
 		syncStats(board, subType, value, true)
@@ -354,15 +423,15 @@ func (p *SubscriptionPostgres) Update(id, userID int, board, subType, value stri
 }
 
 // updateInDB updates a subscription in database only
-func (p *SubscriptionPostgres) updateInDB(id int, board, subType, value string, enabled bool, mailSubject, mailContent *string) error {
+func (p *SubscriptionPostgres) updateInDB(id int, board, subType, value string, enabled bool, mailSubject, mailContent *string, mailRule *MailRule) error {
 	ctx := context.Background()
 	pool := connections.Postgres()
 
 	_, err := pool.Exec(ctx, `
 		UPDATE subscriptions
-		SET board = $1, sub_type = $2, value = $3, enabled = $4, mail_subject = $5, mail_content = $6, updated_at = NOW()
-		WHERE id = $7
-	`, board, subType, value, enabled, mailSubject, mailContent, id)
+		SET board = $1, sub_type = $2, value = $3, enabled = $4, mail_subject = $5, mail_content = $6, mail_rule = $7, updated_at = NOW()
+		WHERE id = $8
+	`, board, subType, value, enabled, mailSubject, mailContent, mailRule, id)
 
 	return err
 }
@@ -452,7 +521,7 @@ func (p *SubscriptionPostgres) ListByUserIDAndType(userID int, subType string) (
 	pool := connections.Postgres()
 
 	rows, err := pool.Query(ctx, `
-		SELECT id, user_id, board, sub_type, value, enabled, mail_subject, mail_content, created_at, updated_at
+		SELECT id, user_id, board, sub_type, value, enabled, mail_subject, mail_content, mail_rule, created_at, updated_at
 		FROM subscriptions
 		WHERE user_id = $1 AND sub_type = $2
 		ORDER BY updated_at DESC
@@ -475,6 +544,7 @@ func (p *SubscriptionPostgres) ListByUserIDAndType(userID int, subType string) (
 			&sub.Enabled,
 			&mailSubject,
 			&mailContent,
+			&sub.MailRule,
 			&sub.CreatedAt,
 			&sub.UpdatedAt,
 		)
@@ -524,7 +594,7 @@ func (p *SubscriptionPostgres) FindByBoardAndValue(userID int, board, subType, v
 	var sub Subscription
 	var mailSubject, mailContent *string
 	err := pool.QueryRow(ctx, `
-		SELECT id, user_id, board, sub_type, value, enabled, mail_subject, mail_content, created_at, updated_at
+		SELECT id, user_id, board, sub_type, value, enabled, mail_subject, mail_content, mail_rule, created_at, updated_at
 		FROM subscriptions
 		WHERE user_id = $1 AND LOWER(board) = LOWER($2) AND sub_type = $3 AND value = $4
 	`, userID, board, subType, value).Scan(
@@ -536,6 +606,7 @@ func (p *SubscriptionPostgres) FindByBoardAndValue(userID int, board, subType, v
 		&sub.Enabled,
 		&mailSubject,
 		&mailContent,
+		&sub.MailRule,
 		&sub.CreatedAt,
 		&sub.UpdatedAt,
 	)
@@ -644,3 +715,12 @@ func (p *SubscriptionPostgres) ListFormatted(userID int) (string, error) {
 
 	return strings.TrimSpace(result.String()), nil
 }
+
+// boardExists checks the board catalog first and only asks PTT for boards
+// the catalog doesn't know yet
+func boardExists(board string) bool {
+	if _, err := catalogRepoInternal.Find(board); err == nil {
+		return true
+	}
+	return rss.CheckBoardExist(board)
+}
@@ -0,0 +1,98 @@
+package account
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/Ptt-Alertor/ptt-alertor/connections"
+	"github.com/jackc/pgx/v5"
+)
+
+// telegramEmailDomain is a reserved domain (RFC 2606) used for the email of
+// accounts created through Telegram, which have no email address
+const telegramEmailDomain = "@telegram.invalid"
+
+// noPassword is stored for accounts without a password; no bcrypt hash
+// matches it, so password login always fails
+const noPassword = "!"
+
+// TelegramEmail returns the placeholder email of a Telegram account
+func TelegramEmail(telegramID string) string {
+	return "telegram-" + telegramID + telegramEmailDomain
+}
+
+// IsTelegramEmail reports whether email is a Telegram account placeholder
+func IsTelegramEmail(email string) bool {
+	return strings.HasSuffix(strings.ToLower(email), telegramEmailDomain)
+}
+
+// FindOrCreateByTelegram returns the account bound to a Telegram user, or
+// creates one bound to it. For private chats the chat ID is the user ID.
+func (p *Postgres) FindOrCreateByTelegram(telegramID string) (acc *Account, created bool, err error) {
+	ctx := context.Background()
+	pool := connections.Postgres()
+
+	acc, err = p.findByTelegram(telegramID)
+	if err != ErrAccountNotFound {
+		return acc, false, err
+	}
+
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	defer tx.Rollback(ctx)
+
+	// an account left over from an earlier unbind is reused
+	var id int
+	var inserted bool
+	err = tx.QueryRow(ctx, `
+		INSERT INTO users (email, password, role)
+		VALUES ($1, $2, 'user')
+		ON CONFLICT (email) DO UPDATE SET email = EXCLUDED.email
+		RETURNING id, xmax = 0
+	`, TelegramEmail(telegramID), noPassword).Scan(&id, &inserted)
+	if err != nil {
+		return nil, false, err
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO notification_bindings (user_id, service, service_id, enabled)
+		VALUES ($1, 'telegram', $2, true)
+	`, id, telegramID)
+	if err != nil {
+		// bound concurrently by another request
+		if strings.Contains(err.Error(), "SQLSTATE 23505") {
+			tx.Rollback(ctx)
+			acc, err = p.findByTelegram(telegramID)
+			return acc, false, err
+		}
+		return nil, false, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, false, err
+	}
+
+	acc, err = p.FindByID(id)
+	return acc, inserted && err == nil, err
+}
+
+func (p *Postgres) findByTelegram(telegramID string) (*Account, error) {
+	ctx := context.Background()
+	pool := connections.Postgres()
+
+	var userID int
+	err := pool.QueryRow(ctx, `
+		SELECT user_id FROM notification_bindings
+		WHERE service = 'telegram' AND service_id = $1
+	`, telegramID).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrAccountNotFound
+		}
+		return nil, err
+	}
+	return p.FindByID(userID)
+}
@@ -0,0 +1,217 @@
+package account
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Ptt-Alertor/ptt-alertor/connections"
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	ErrTwoFactorNotSetup   = errors.New("two-factor authentication not set up")
+	ErrTwoFactorEnabled    = errors.New("two-factor authentication already enabled")
+	ErrTwoFactorNotEnabled = errors.New("two-factor authentication not enabled")
+)
+
+// TwoFactor is a user's TOTP enrollment. Secret is decrypted.
+type TwoFactor struct {
+	UserID   int
+	Secret   string
+	Enabled  bool
+	LastStep int64
+}
+
+// TwoFactorPostgres is the PostgreSQL repository for TOTP enrollments and
+// recovery codes. Secrets are encrypted like PTT passwords.
+type TwoFactorPostgres struct{}
+
+// Find returns a user's enrollment, pending or enabled
+func (p *TwoFactorPostgres) Find(userID int) (*TwoFactor, error) {
+	ctx := context.Background()
+	pool := connections.Postgres()
+
+	var encrypted string
+	tf := TwoFactor{UserID: userID}
+	err := pool.QueryRow(ctx, `
+		SELECT secret, enabled_at IS NOT NULL, last_step
+		FROM user_totp
+		WHERE user_id = $1
+	`, userID).Scan(&encrypted, &tf.Enabled, &tf.LastStep)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrTwoFactorNotSetup
+		}
+		return nil, err
+	}
+
+	if tf.Secret, err = decrypt(encrypted); err != nil {
+		return nil, err
+	}
+	return &tf, nil
+}
+
+// IsEnabled reports whether a user must pass TOTP to log in
+func (p *TwoFactorPostgres) IsEnabled(userID int) (bool, error) {
+	ctx := context.Background()
+	pool := connections.Postgres()
+
+	var enabled bool
+	err := pool.QueryRow(ctx, `
+		SELECT EXISTS (SELECT 1 FROM user_totp WHERE user_id = $1 AND enabled_at IS NOT NULL)
+	`, userID).Scan(&enabled)
+	return enabled, err
+}
+
+// SetPending stores a new secret awaiting confirmation, replacing an
+// earlier unconfirmed one
+func (p *TwoFactorPostgres) SetPending(userID int, secret string) error {
+	ctx := context.Background()
+	pool := connections.Postgres()
+
+	encrypted, err := encrypt(secret)
+	if err != nil {
+		return err
+	}
+
+	tag, err := pool.Exec(ctx, `
+		INSERT INTO user_totp (user_id, secret)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE
+		SET secret = EXCLUDED.secret, last_step = 0, created_at = NOW()
+		WHERE user_totp.enabled_at IS NULL
+	`, userID, encrypted)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrTwoFactorEnabled
+	}
+	return nil
+}
+
+// Enable confirms the pending secret and stores the recovery code hashes
+func (p *TwoFactorPostgres) Enable(userID int, step int64, recoveryHashes []string) error {
+	ctx := context.Background()
+	pool := connections.Postgres()
+
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, `
+		UPDATE user_totp SET enabled_at = NOW(), last_step = $2
+		WHERE user_id = $1 AND enabled_at IS NULL
+	`, userID, step)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrTwoFactorEnabled
+	}
+
+	if err := replaceRecoveryCodes(ctx, tx, userID, recoveryHashes); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// Disable removes the enrollment and its recovery codes
+func (p *TwoFactorPostgres) Disable(userID int) error {
+	ctx := context.Background()
+	pool := connections.Postgres()
+
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, `DELETE FROM user_totp WHERE user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrTwoFactorNotEnabled
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// UseStep records a verified time step. It fails when the step is not
+// newer than the last one, so a code can't be replayed.
+func (p *TwoFactorPostgres) UseStep(userID int, step int64) (bool, error) {
+	ctx := context.Background()
+	pool := connections.Postgres()
+
+	tag, err := pool.Exec(ctx, `
+		UPDATE user_totp SET last_step = $2
+		WHERE user_id = $1 AND last_step < $2
+	`, userID, step)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// UseRecoveryCode consumes an unused recovery code
+func (p *TwoFactorPostgres) UseRecoveryCode(userID int, hash string) (bool, error) {
+	ctx := context.Background()
+	pool := connections.Postgres()
+
+	tag, err := pool.Exec(ctx, `
+		UPDATE recovery_codes SET used_at = NOW()
+		WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL
+	`, userID, hash)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// ReplaceRecoveryCodes discards all recovery codes for new ones
+func (p *TwoFactorPostgres) ReplaceRecoveryCodes(userID int, hashes []string) error {
+	ctx := context.Background()
+	pool := connections.Postgres()
+
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := replaceRecoveryCodes(ctx, tx, userID, hashes); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// CountRecoveryCodes returns how many unused recovery codes remain
+func (p *TwoFactorPostgres) CountRecoveryCodes(userID int) (int, error) {
+	ctx := context.Background()
+	pool := connections.Postgres()
+
+	var count int
+	err := pool.QueryRow(ctx, `
+		SELECT COUNT(*) FROM recovery_codes WHERE user_id = $1 AND used_at IS NULL
+	`, userID).Scan(&count)
+	return count, err
+}
+
+func replaceRecoveryCodes(ctx context.Context, tx pgx.Tx, userID int, hashes []string) error {
+	if _, err := tx.Exec(ctx, `DELETE FROM recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	for _, h := range hashes {
+		if _, err := tx.Exec(ctx, `
+			INSERT INTO recovery_codes (user_id, code_hash) VALUES ($1, $2)
+		`, userID, h); err != nil {
+			return err
+		}
+	}
+	return nil
+}
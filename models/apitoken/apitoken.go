@@ -0,0 +1,135 @@
+package apitoken
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+)
+
+var (
+	ErrTokenNotFound  = errors.New("api token not found")
+	ErrInvalidScope   = errors.New("invalid scope")
+	ErrTokenLimit     = errors.New("api token limit reached")
+	ErrNameRequired   = errors.New("api token name required")
+	ErrNameTooLong    = errors.New("api token name too long")
+	ErrScopeRequired  = errors.New("api token scope required")
+	ErrAdminScopeOnly = errors.New("admin scope requires admin role")
+)
+
+// Scopes a personal access token can be granted
+const (
+	ScopeSubscriptionsRead  = "subscriptions:read"
+	ScopeSubscriptionsWrite = "subscriptions:write"
+	ScopeNotificationsRead  = "notifications:read"
+	ScopeAdmin              = "admin:*"
+)
+
+// Scopes lists every grantable scope
+var Scopes = []string{
+	ScopeSubscriptionsRead,
+	ScopeSubscriptionsWrite,
+	ScopeNotificationsRead,
+	ScopeAdmin,
+}
+
+const (
+	// Prefix marks a bearer token as a personal access token
+	Prefix = "pat_"
+	// MaxPerUser bounds how many tokens one user can hold
+	MaxPerUser = 20
+	// MaxNameLength bounds a token's display name
+	MaxNameLength = 50
+)
+
+// Token is a personal access token. Only its hash is stored; the plain
+// token is shown once when it is created.
+type Token struct {
+	ID         int        `json:"id"`
+	UserID     int        `json:"-"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// Expired reports whether the token can no longer be used
+func (t *Token) Expired() bool {
+	return t.ExpiresAt != nil && !t.ExpiresAt.After(time.Now())
+}
+
+// New returns a random token, its hash for storage and the prefix shown to
+// tell tokens apart
+func New() (token, hash, prefix string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", "", err
+	}
+	token = Prefix + base64.RawURLEncoding.EncodeToString(b)
+	return token, Hash(token), token[:len(Prefix)+8], nil
+}
+
+// Hash hashes a token for storage and lookup
+func Hash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// IsToken reports whether a bearer credential looks like a personal
+// access token rather than a JWT
+func IsToken(credential string) bool {
+	return strings.HasPrefix(credential, Prefix)
+}
+
+// ValidateScopes checks requested scopes against the known ones and
+// whether the owner's role has admin access, returning them deduplicated
+func ValidateScopes(scopes []string, admin bool) ([]string, error) {
+	if len(scopes) == 0 {
+		return nil, ErrScopeRequired
+	}
+	seen := make(map[string]bool, len(scopes))
+	valid := make([]string, 0, len(scopes))
+	for _, s := range scopes {
+		if !isKnown(s) {
+			return nil, ErrInvalidScope
+		}
+		if s == ScopeAdmin && !admin {
+			return nil, ErrAdminScopeOnly
+		}
+		if !seen[s] {
+			seen[s] = true
+			valid = append(valid, s)
+		}
+	}
+	return valid, nil
+}
+
+func isKnown(scope string) bool {
+	for _, s := range Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Allows reports whether granted scopes cover required. A "<resource>:*"
+// scope covers every action on the resource and write implies read.
+func Allows(granted []string, required string) bool {
+	resource, action, _ := strings.Cut(required, ":")
+	for _, g := range granted {
+		gResource, gAction, _ := strings.Cut(g, ":")
+		if gResource != resource {
+			continue
+		}
+		if gAction == "*" || gAction == action || (gAction == "write" && action == "read") {
+			return true
+		}
+	}
+	return false
+}
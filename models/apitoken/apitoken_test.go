@@ -0,0 +1,70 @@
+package apitoken
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAllows(t *testing.T) {
+	tests := []struct {
+		name     string
+		granted  []string
+		required string
+		want     bool
+	}{
+		{"exact", []string{ScopeSubscriptionsRead}, ScopeSubscriptionsRead, true},
+		{"write implies read", []string{ScopeSubscriptionsWrite}, ScopeSubscriptionsRead, true},
+		{"read is not write", []string{ScopeSubscriptionsRead}, ScopeSubscriptionsWrite, false},
+		{"wildcard", []string{ScopeAdmin}, "admin:users", true},
+		{"other resource", []string{ScopeNotificationsRead}, ScopeSubscriptionsRead, false},
+		{"admin is not user scope", []string{ScopeAdmin}, ScopeSubscriptionsRead, false},
+		{"none", nil, ScopeSubscriptionsRead, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Allows(tt.granted, tt.required); got != tt.want {
+				t.Errorf("Allows() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateScopes(t *testing.T) {
+	tests := []struct {
+		name    string
+		scopes  []string
+		admin   bool
+		want    []string
+		wantErr error
+	}{
+		{"dedupe", []string{ScopeSubscriptionsRead, ScopeSubscriptionsRead}, false, []string{ScopeSubscriptionsRead}, nil},
+		{"empty", nil, false, nil, ErrScopeRequired},
+		{"unknown", []string{"subscriptions:delete"}, false, nil, ErrInvalidScope},
+		{"admin by user", []string{ScopeAdmin}, false, nil, ErrAdminScopeOnly},
+		{"admin by admin", []string{ScopeAdmin}, true, []string{ScopeAdmin}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ValidateScopes(tt.scopes, tt.admin)
+			if err != tt.wantErr {
+				t.Fatalf("ValidateScopes() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ValidateScopes() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNew(t *testing.T) {
+	token, hash, prefix, err := New()
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if !IsToken(token) || IsToken("eyJhbGciOi") {
+		t.Errorf("IsToken() does not tell tokens from JWTs")
+	}
+	if hash != Hash(token) || len(prefix) != len(Prefix)+8 || token[:len(prefix)] != prefix {
+		t.Errorf("New() = %v, %v, %v", token, hash, prefix)
+	}
+}
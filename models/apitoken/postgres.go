@@ -0,0 +1,138 @@
+package apitoken
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Ptt-Alertor/ptt-alertor/connections"
+	"github.com/jackc/pgx/v5"
+)
+
+// Postgres is the PostgreSQL repository for personal access tokens
+type Postgres struct{}
+
+const tokenColumns = `id, user_id, name, token_prefix, scopes, expires_at, last_used_at, created_at`
+
+func scanToken(row pgx.Row) (*Token, error) {
+	var t Token
+	err := row.Scan(&t.ID, &t.UserID, &t.Name, &t.Prefix, &t.Scopes, &t.ExpiresAt, &t.LastUsedAt, &t.CreatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrTokenNotFound
+		}
+		return nil, err
+	}
+	return &t, nil
+}
+
+// Create stores a token for a user
+func (p *Postgres) Create(userID int, name, hash, prefix string, scopes []string, expiresAt *time.Time) (*Token, error) {
+	ctx := context.Background()
+	pool := connections.Postgres()
+
+	var count int
+	if err := pool.QueryRow(ctx, `SELECT COUNT(*) FROM api_tokens WHERE user_id = $1`, userID).Scan(&count); err != nil {
+		return nil, err
+	}
+	if count >= MaxPerUser {
+		return nil, ErrTokenLimit
+	}
+
+	return scanToken(pool.QueryRow(ctx, `
+		INSERT INTO api_tokens (user_id, name, token_hash, token_prefix, scopes, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING `+tokenColumns,
+		userID, name, hash, prefix, scopes, expiresAt))
+}
+
+// FindByHash finds an unexpired token by the hash of its plain value
+func (p *Postgres) FindByHash(hash string) (*Token, error) {
+	ctx := context.Background()
+	pool := connections.Postgres()
+
+	return scanToken(pool.QueryRow(ctx, `
+		SELECT `+tokenColumns+`
+		FROM api_tokens
+		WHERE token_hash = $1 AND (expires_at IS NULL OR expires_at > NOW())
+	`, hash))
+}
+
+// FindByID finds one of a user's tokens
+func (p *Postgres) FindByID(userID, id int) (*Token, error) {
+	ctx := context.Background()
+	pool := connections.Postgres()
+
+	return scanToken(pool.QueryRow(ctx, `
+		SELECT `+tokenColumns+`
+		FROM api_tokens
+		WHERE id = $1 AND user_id = $2
+	`, id, userID))
+}
+
+// ListByUser returns a user's tokens, newest first
+func (p *Postgres) ListByUser(userID int) ([]*Token, error) {
+	ctx := context.Background()
+	pool := connections.Postgres()
+
+	rows, err := pool.Query(ctx, `
+		SELECT `+tokenColumns+`
+		FROM api_tokens
+		WHERE user_id = $1
+		ORDER BY created_at DESC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := make([]*Token, 0)
+	for rows.Next() {
+		t, err := scanToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens, rows.Err()
+}
+
+// Update renames a token and replaces its scopes
+func (p *Postgres) Update(userID, id int, name string, scopes []string) (*Token, error) {
+	ctx := context.Background()
+	pool := connections.Postgres()
+
+	return scanToken(pool.QueryRow(ctx, `
+		UPDATE api_tokens SET name = $3, scopes = $4
+		WHERE id = $1 AND user_id = $2
+		RETURNING `+tokenColumns,
+		id, userID, name, scopes))
+}
+
+// Delete revokes one of a user's tokens
+func (p *Postgres) Delete(userID, id int) error {
+	ctx := context.Background()
+	pool := connections.Postgres()
+
+	tag, err := pool.Exec(ctx, `DELETE FROM api_tokens WHERE id = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrTokenNotFound
+	}
+	return nil
+}
+
+// Touch records that a token was used. Writes are skipped when the last
+// one was under a minute ago so busy scripts don't write on every request.
+func (p *Postgres) Touch(id int) error {
+	ctx := context.Background()
+	pool := connections.Postgres()
+
+	_, err := pool.Exec(ctx, `
+		UPDATE api_tokens SET last_used_at = NOW()
+		WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute')
+	`, id)
+	return err
+}
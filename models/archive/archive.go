@@ -0,0 +1,193 @@
+package archive
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/Ptt-Alertor/ptt-alertor/models/article"
+)
+
+var (
+	ErrPolicyNotFound  = errors.New("archive policy not found")
+	ErrArticleNotFound = errors.New("archived article not found")
+	ErrInvalidDate     = errors.New("invalid date, expected YYYY-MM-DD")
+	ErrNoSearchFilter  = errors.New("search needs a keyword, board or author")
+	ErrTooManyTerms    = errors.New("too many search terms")
+	ErrPageTooDeep     = errors.New("search page too deep")
+)
+
+const (
+	// MaxSearchTerms bounds the keywords of a search, each adds an ILIKE
+	MaxSearchTerms = 5
+	// MaxSearchPage bounds how deep a search pages, deep offsets still
+	// read every row before them
+	MaxSearchPage = 50
+)
+
+var cst = time.FixedZone("CST", 8*60*60)
+
+var codeRegexp = regexp.MustCompile(`/([GM]\.\d+\.A\.[0-9A-F]+)\.html$`)
+
+// Article is an archived PTT article
+type Article struct {
+	Code          string    `json:"code"`
+	Board         string    `json:"board"`
+	Title         string    `json:"title"`
+	Author        string    `json:"author"`
+	Link          string    `json:"link"`
+	PublishedAt   time.Time `json:"published_at"`
+	PushSum       int       `json:"push_sum"`
+	PositiveCount int       `json:"positive_count"`
+	NegativeCount int       `json:"negative_count"`
+	NeutralCount  int       `json:"neutral_count"`
+	Body          string    `json:"body,omitempty"`
+	FirstSeenAt   time.Time `json:"first_seen_at"`
+	LastSeenAt    time.Time `json:"last_seen_at"`
+}
+
+// FromArticle converts a crawled article, returns false when it has no code
+func FromArticle(a article.Article) (Article, bool) {
+	code := a.Code
+	if code == "" {
+		if m := codeRegexp.FindStringSubmatch(a.Link); len(m) == 2 {
+			code = m[1]
+		}
+	}
+	if code == "" {
+		return Article{}, false
+	}
+	board := a.Board
+	if board == "" {
+		board = boardFromLink(a.Link)
+	}
+	return Article{
+		Code:          code,
+		Board:         board,
+		Title:         a.Title,
+		Author:        a.Author,
+		Link:          a.Link,
+		PublishedAt:   time.Unix(int64(a.ID), 0),
+		PushSum:       a.PushSum,
+		PositiveCount: a.PositiveCount,
+		NegativeCount: a.NegativeCount,
+		NeutralCount:  a.NeutralCount,
+	}, true
+}
+
+// ToArticle converts back to the crawler's article type so the checkers'
+// matching logic can be reused
+func (a Article) ToArticle() article.Article {
+	return article.Article{
+		ID:            int(a.PublishedAt.Unix()),
+		Code:          a.Code,
+		Title:         a.Title,
+		Link:          a.Link,
+		Author:        a.Author,
+		Board:         a.Board,
+		PushSum:       a.PushSum,
+		PositiveCount: a.PositiveCount,
+		NegativeCount: a.NegativeCount,
+		NeutralCount:  a.NeutralCount,
+	}
+}
+
+func boardFromLink(link string) string {
+	parts := strings.Split(link, "/")
+	for i, p := range parts {
+		if p == "bbs" && i+1 < len(parts) {
+			return parts[i+1]
+		}
+	}
+	return ""
+}
+
+// SearchQuery is the filter of an archive search, From and To are
+// YYYY-MM-DD in Taiwan time and both inclusive. Keywords match titles
+// unless Body is set.
+type SearchQuery struct {
+	Q      string
+	Body   bool
+	Board  string
+	Author string
+	From   string
+	To     string
+	Page   int
+	Limit  int
+}
+
+// SearchResult represents a page of archived articles
+type SearchResult struct {
+	Articles []*Article `json:"articles"`
+	Total    int        `json:"total"`
+	Page     int        `json:"page"`
+	Limit    int        `json:"limit"`
+}
+
+// Policy is the retention setting of a board, RetentionDays <= 0 keeps
+// articles forever
+type Policy struct {
+	Board         string    `json:"board"`
+	RetentionDays int       `json:"retention_days"`
+	StoreBody     bool      `json:"store_body"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// buildSearchWhere turns a query into a WHERE clause and its arguments.
+// Every space separated term must appear in the title, or the body too
+// when asked; the trigram indexes make ILIKE usable for CJK text. A search
+// needs a keyword, board or author so it never scans the whole archive.
+func buildSearchWhere(q SearchQuery) (string, []interface{}, error) {
+	terms := strings.Fields(q.Q)
+	if len(terms) > MaxSearchTerms {
+		return "", nil, ErrTooManyTerms
+	}
+	if len(terms) == 0 && q.Board == "" && q.Author == "" {
+		return "", nil, ErrNoSearchFilter
+	}
+
+	var conds []string
+	var args []interface{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	for _, term := range terms {
+		p := arg("%" + escapeLike(term) + "%")
+		if q.Body {
+			conds = append(conds, fmt.Sprintf("(title ILIKE %s OR body ILIKE %s)", p, p))
+		} else {
+			conds = append(conds, "title ILIKE "+p)
+		}
+	}
+	if q.Board != "" {
+		conds = append(conds, "LOWER(board) = LOWER("+arg(q.Board)+")")
+	}
+	if q.Author != "" {
+		conds = append(conds, "LOWER(author) = LOWER("+arg(q.Author)+")")
+	}
+	if q.From != "" {
+		from, err := time.ParseInLocation("2006-01-02", q.From, cst)
+		if err != nil {
+			return "", nil, ErrInvalidDate
+		}
+		conds = append(conds, "published_at >= "+arg(from))
+	}
+	if q.To != "" {
+		to, err := time.ParseInLocation("2006-01-02", q.To, cst)
+		if err != nil {
+			return "", nil, ErrInvalidDate
+		}
+		conds = append(conds, "published_at < "+arg(to.AddDate(0, 0, 1)))
+	}
+
+	return "WHERE " + strings.Join(conds, " AND "), args, nil
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
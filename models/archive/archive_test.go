@@ -0,0 +1,71 @@
+package archive
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Ptt-Alertor/ptt-alertor/models/article"
+)
+
+func TestFromArticle(t *testing.T) {
+	tests := []struct {
+		name     string
+		a        article.Article
+		wantCode string
+		wantOK   bool
+	}{
+		{"code", article.Article{Code: "M.1498563199.A.35C", Board: "Gossiping"}, "M.1498563199.A.35C", true},
+		{"code from link", article.Article{Link: "https://www.ptt.cc/bbs/Gossiping/M.1498563199.A.35C.html"}, "M.1498563199.A.35C", true},
+		{"no code", article.Article{Link: "https://www.ptt.cc/bbs/Gossiping/index.html"}, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := FromArticle(tt.a)
+			if ok != tt.wantOK || got.Code != tt.wantCode {
+				t.Errorf("FromArticle() = %v, %v, want %v, %v", got.Code, ok, tt.wantCode, tt.wantOK)
+			}
+			if ok && got.Board != "Gossiping" {
+				t.Errorf("FromArticle() board = %v, want Gossiping", got.Board)
+			}
+		})
+	}
+}
+
+func Test_buildSearchWhere(t *testing.T) {
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, cst)
+	to := time.Date(2024, 2, 1, 0, 0, 0, 0, cst)
+	tests := []struct {
+		name      string
+		q         SearchQuery
+		wantWhere string
+		wantArgs  []interface{}
+		wantErr   error
+	}{
+		{"empty", SearchQuery{}, "", nil, ErrNoSearchFilter},
+		{"dates only", SearchQuery{From: "2024-01-01"}, "", nil, ErrNoSearchFilter},
+		{"terms", SearchQuery{Q: "iPhone 100%"}, "WHERE title ILIKE $1 AND title ILIKE $2",
+			[]interface{}{"%iPhone%", `%100\%%`}, nil},
+		{"terms in body", SearchQuery{Q: "iPhone 100%", Body: true}, "WHERE (title ILIKE $1 OR body ILIKE $1) AND (title ILIKE $2 OR body ILIKE $2)",
+			[]interface{}{"%iPhone%", `%100\%%`}, nil},
+		{"too many terms", SearchQuery{Q: "a b c d e f"}, "", nil, ErrTooManyTerms},
+		{"filters", SearchQuery{Board: "Gossiping", Author: "chodino", From: "2024-01-01", To: "2024-01-31"},
+			"WHERE LOWER(board) = LOWER($1) AND LOWER(author) = LOWER($2) AND published_at >= $3 AND published_at < $4",
+			[]interface{}{"Gossiping", "chodino", from, to}, nil},
+		{"bad date", SearchQuery{Board: "Gossiping", From: "2024/01/01"}, "", nil, ErrInvalidDate},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			where, args, err := buildSearchWhere(tt.q)
+			if err != tt.wantErr {
+				t.Fatalf("buildSearchWhere() error = %v, want %v", err, tt.wantErr)
+			}
+			if where != tt.wantWhere {
+				t.Errorf("buildSearchWhere() where = %q, want %q", where, tt.wantWhere)
+			}
+			if !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Errorf("buildSearchWhere() args = %v, want %v", args, tt.wantArgs)
+			}
+		})
+	}
+}
@@ -0,0 +1,300 @@
+package archive
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/Ptt-Alertor/ptt-alertor/connections"
+	"github.com/jackc/pgx/v5"
+)
+
+// Postgres is the PostgreSQL repository for archived articles
+type Postgres struct{}
+
+// Save upserts articles and returns the codes seen for the first time.
+// Push counts are only overwritten when withPush is true because the
+// RSS feed doesn't carry them.
+func (p *Postgres) Save(articles []Article, withPush bool) ([]string, error) {
+	ctx := context.Background()
+	pool := connections.Postgres()
+
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	var created []string
+	for _, a := range articles {
+		var inserted bool
+		err := tx.QueryRow(ctx, `
+			INSERT INTO article_archive (code, board, title, author, link, published_at,
+			                             push_sum, positive_count, negative_count, neutral_count)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+			ON CONFLICT (code) DO UPDATE SET
+				title = EXCLUDED.title,
+				push_sum = CASE WHEN $11 THEN EXCLUDED.push_sum ELSE article_archive.push_sum END,
+				positive_count = CASE WHEN $11 THEN EXCLUDED.positive_count ELSE article_archive.positive_count END,
+				negative_count = CASE WHEN $11 THEN EXCLUDED.negative_count ELSE article_archive.negative_count END,
+				neutral_count = CASE WHEN $11 THEN EXCLUDED.neutral_count ELSE article_archive.neutral_count END,
+				last_seen_at = NOW()
+			RETURNING (xmax = 0)
+		`, a.Code, a.Board, a.Title, a.Author, a.Link, a.PublishedAt,
+			a.PushSum, a.PositiveCount, a.NegativeCount, a.NeutralCount, withPush).Scan(&inserted)
+		if err != nil {
+			return nil, err
+		}
+		if inserted {
+			created = append(created, a.Code)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+// UpdateBody stores the article body
+func (p *Postgres) UpdateBody(code, body string) error {
+	ctx := context.Background()
+	pool := connections.Postgres()
+
+	_, err := pool.Exec(ctx, `
+		UPDATE article_archive SET body = $2 WHERE code = $1
+	`, code, body)
+	return err
+}
+
+// UpdatePushCounts stores push statistics aggregated from comments
+func (p *Postgres) UpdatePushCounts(code string, pushSum, positive, negative, neutral int) error {
+	ctx := context.Background()
+	pool := connections.Postgres()
+
+	_, err := pool.Exec(ctx, `
+		UPDATE article_archive
+		SET push_sum = $2, positive_count = $3, negative_count = $4, neutral_count = $5,
+		    last_seen_at = NOW()
+		WHERE code = $1
+	`, code, pushSum, positive, negative, neutral)
+	return err
+}
+
+// Search returns archived articles matching the query, newest first
+func (p *Postgres) Search(q SearchQuery) (*SearchResult, error) {
+	ctx := context.Background()
+	pool := connections.Postgres()
+
+	// Default values
+	if q.Page <= 0 {
+		q.Page = 1
+	}
+	if q.Limit <= 0 {
+		q.Limit = 20
+	}
+	if q.Page > MaxSearchPage {
+		return nil, ErrPageTooDeep
+	}
+
+	where, args, err := buildSearchWhere(q)
+	if err != nil {
+		return nil, err
+	}
+
+	var total int
+	err = pool.QueryRow(ctx, `SELECT COUNT(*) FROM article_archive `+where, args...).Scan(&total)
+	if err != nil {
+		return nil, err
+	}
+
+	args = append(args, q.Limit, (q.Page-1)*q.Limit)
+	rows, err := pool.Query(ctx, `
+		SELECT code, board, title, author, link, published_at, push_sum,
+		       positive_count, negative_count, neutral_count, first_seen_at, last_seen_at
+		FROM article_archive `+where+`
+		ORDER BY published_at DESC
+		LIMIT $`+strconv.Itoa(len(args)-1)+` OFFSET $`+strconv.Itoa(len(args)), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	articles := make([]*Article, 0)
+	for rows.Next() {
+		var a Article
+		if err := rows.Scan(
+			&a.Code, &a.Board, &a.Title, &a.Author, &a.Link, &a.PublishedAt, &a.PushSum,
+			&a.PositiveCount, &a.NegativeCount, &a.NeutralCount, &a.FirstSeenAt, &a.LastSeenAt,
+		); err != nil {
+			return nil, err
+		}
+		articles = append(articles, &a)
+	}
+
+	return &SearchResult{
+		Articles: articles,
+		Total:    total,
+		Page:     q.Page,
+		Limit:    q.Limit,
+	}, rows.Err()
+}
+
+// FindByCode returns an archived article without its body
+func (p *Postgres) FindByCode(code string) (*Article, error) {
+	ctx := context.Background()
+	pool := connections.Postgres()
+
+	var a Article
+	err := pool.QueryRow(ctx, `
+		SELECT code, board, title, author, link, published_at, push_sum,
+		       positive_count, negative_count, neutral_count, first_seen_at, last_seen_at
+		FROM article_archive
+		WHERE code = $1
+	`, code).Scan(
+		&a.Code, &a.Board, &a.Title, &a.Author, &a.Link, &a.PublishedAt, &a.PushSum,
+		&a.PositiveCount, &a.NegativeCount, &a.NeutralCount, &a.FirstSeenAt, &a.LastSeenAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrArticleNotFound
+		}
+		return nil, err
+	}
+	return &a, nil
+}
+
+// ListByBoard returns a board's articles published since the given time,
+// newest first, at most limit rows
+func (p *Postgres) ListByBoard(board string, since time.Time, limit int) ([]*Article, error) {
+	ctx := context.Background()
+	pool := connections.Postgres()
+
+	rows, err := pool.Query(ctx, `
+		SELECT code, board, title, author, link, published_at, push_sum,
+		       positive_count, negative_count, neutral_count, first_seen_at, last_seen_at
+		FROM article_archive
+		WHERE LOWER(board) = LOWER($1) AND published_at >= $2
+		ORDER BY published_at DESC
+		LIMIT $3
+	`, board, since, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	articles := make([]*Article, 0)
+	for rows.Next() {
+		var a Article
+		if err := rows.Scan(
+			&a.Code, &a.Board, &a.Title, &a.Author, &a.Link, &a.PublishedAt, &a.PushSum,
+			&a.PositiveCount, &a.NegativeCount, &a.NeutralCount, &a.FirstSeenAt, &a.LastSeenAt,
+		); err != nil {
+			return nil, err
+		}
+		articles = append(articles, &a)
+	}
+	return articles, rows.Err()
+}
+
+// Purge deletes articles older than their board's retention, boards
+// without a policy use defaultDays. Returns the number of deleted rows.
+func (p *Postgres) Purge(defaultDays int) (int64, error) {
+	ctx := context.Background()
+	pool := connections.Postgres()
+
+	tag, err := pool.Exec(ctx, `
+		DELETE FROM article_archive a
+		USING (
+			SELECT a2.code, COALESCE(p.retention_days, $1) AS days
+			FROM article_archive a2
+			LEFT JOIN article_archive_policies p ON p.board = a2.board
+		) r
+		WHERE a.code = r.code
+		  AND r.days > 0
+		  AND a.published_at < NOW() - make_interval(days => r.days)
+	`, defaultDays)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// GetPolicy returns the retention policy of a board
+func (p *Postgres) GetPolicy(board string) (*Policy, error) {
+	ctx := context.Background()
+	pool := connections.Postgres()
+
+	var pl Policy
+	err := pool.QueryRow(ctx, `
+		SELECT board, retention_days, store_body, created_at, updated_at
+		FROM article_archive_policies
+		WHERE board = $1
+	`, board).Scan(&pl.Board, &pl.RetentionDays, &pl.StoreBody, &pl.CreatedAt, &pl.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrPolicyNotFound
+		}
+		return nil, err
+	}
+	return &pl, nil
+}
+
+// ListPolicies returns all retention policies
+func (p *Postgres) ListPolicies() ([]*Policy, error) {
+	ctx := context.Background()
+	pool := connections.Postgres()
+
+	rows, err := pool.Query(ctx, `
+		SELECT board, retention_days, store_body, created_at, updated_at
+		FROM article_archive_policies
+		ORDER BY board
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	policies := make([]*Policy, 0)
+	for rows.Next() {
+		var pl Policy
+		if err := rows.Scan(&pl.Board, &pl.RetentionDays, &pl.StoreBody, &pl.CreatedAt, &pl.UpdatedAt); err != nil {
+			return nil, err
+		}
+		policies = append(policies, &pl)
+	}
+	return policies, rows.Err()
+}
+
+// SetPolicy creates or updates a board's retention policy
+func (p *Postgres) SetPolicy(pl *Policy) error {
+	ctx := context.Background()
+	pool := connections.Postgres()
+
+	return pool.QueryRow(ctx, `
+		INSERT INTO article_archive_policies (board, retention_days, store_body)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (board) DO UPDATE SET
+			retention_days = EXCLUDED.retention_days,
+			store_body = EXCLUDED.store_body
+		RETURNING created_at, updated_at
+	`, pl.Board, pl.RetentionDays, pl.StoreBody).Scan(&pl.CreatedAt, &pl.UpdatedAt)
+}
+
+// DeletePolicy removes a board's retention policy
+func (p *Postgres) DeletePolicy(board string) error {
+	ctx := context.Background()
+	pool := connections.Postgres()
+
+	tag, err := pool.Exec(ctx, `
+		DELETE FROM article_archive_policies WHERE board = $1
+	`, board)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrPolicyNotFound
+	}
+	return nil
+}
@@ -26,3 +26,8 @@ func (cs Comments) String() string {
 	}
 	return content
 }
+
+// CountByTag counts comments by their tag (推/噓/→)
+func (cs Comments) CountByTag() (positive, negative, neutral int) {
+	return countCommentsByTag(cs)
+}
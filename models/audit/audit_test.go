@@ -0,0 +1,93 @@
+package audit
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func Test_buildWhere(t *testing.T) {
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, cst)
+	to := time.Date(2024, 2, 1, 0, 0, 0, 0, cst)
+	tests := []struct {
+		name      string
+		q         Query
+		wantWhere string
+		wantArgs  []interface{}
+		wantErr   error
+	}{
+		{"empty", Query{}, "", nil, nil},
+		{"action", Query{ActorID: 1, Action: ActionRoleUpdate}, "WHERE actor_id = $1 AND action = $2",
+			[]interface{}{1, ActionRoleUpdate}, nil},
+		{"action prefix", Query{Action: "role.*"}, "WHERE action LIKE $1", []interface{}{"role.%"}, nil},
+		{"target and dates", Query{TargetType: TargetUser, TargetID: "5", From: "2024-01-01", To: "2024-01-31"},
+			"WHERE target_type = $1 AND target_id = $2 AND created_at >= $3 AND created_at < $4",
+			[]interface{}{TargetUser, "5", from, to}, nil},
+		{"bad date", Query{To: "2024/01/31"}, "", nil, ErrInvalidDate},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			where, args, err := buildWhere(tt.q)
+			if err != tt.wantErr {
+				t.Fatalf("buildWhere() error = %v, want %v", err, tt.wantErr)
+			}
+			if where != tt.wantWhere {
+				t.Errorf("buildWhere() where = %q, want %q", where, tt.wantWhere)
+			}
+			if !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Errorf("buildWhere() args = %v, want %v", args, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	var nilPtr *Entry
+	tests := []struct {
+		name string
+		v    interface{}
+		want string
+	}{
+		{"nil", nil, ""},
+		{"nil pointer", nilPtr, ""},
+		{"map", map[string]bool{"enabled": true}, `{"enabled":true}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(Snapshot(tt.v)); got != tt.want {
+				t.Errorf("Snapshot() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	actor := 1
+	entries := []*Entry{
+		{
+			ID:         2,
+			ActorID:    &actor,
+			ActorEmail: "admin@example.com",
+			Action:     ActionUserUpdate,
+			TargetType: TargetUser,
+			TargetID:   "5",
+			Before:     Snapshot(map[string]string{"role": "user"}),
+			After:      Snapshot(map[string]string{"role": "vip"}),
+			IP:         "127.0.0.1",
+			CreatedAt:  time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{ID: 1, Action: ActionPasswordReset, TargetType: TargetUser, TargetID: "3", CreatedAt: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	want := "id,created_at,actor_id,actor_email,action,target_type,target_id,before,after,ip\n" +
+		`2,2024-01-01T08:00:00+08:00,1,admin@example.com,user.update,user,5,"{""role"":""user""}","{""role"":""vip""}",127.0.0.1` + "\n" +
+		"1,2024-01-01T08:00:00+08:00,,,password.reset,user,3,,,\n"
+
+	var buf bytes.Buffer
+	if err := WriteCSV(&buf, entries); err != nil {
+		t.Fatalf("WriteCSV() error = %v", err)
+	}
+	if got := buf.String(); got != want {
+		t.Errorf("WriteCSV() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,96 @@
+package audit
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/Ptt-Alertor/ptt-alertor/connections"
+	"github.com/jackc/pgx/v5"
+)
+
+// Postgres is the PostgreSQL repository for the audit log
+type Postgres struct{}
+
+const entryColumns = `id, actor_id, actor_email, action, target_type, target_id, before, after, ip, created_at`
+
+func scanEntry(row pgx.Row) (*Entry, error) {
+	var e Entry
+	var before, after []byte
+	err := row.Scan(&e.ID, &e.ActorID, &e.ActorEmail, &e.Action, &e.TargetType, &e.TargetID, &before, &after, &e.IP, &e.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	e.Before, e.After = before, after
+	return &e, nil
+}
+
+// Create records an entry
+func (p *Postgres) Create(e *Entry) error {
+	ctx := context.Background()
+	pool := connections.Postgres()
+
+	return pool.QueryRow(ctx, `
+		INSERT INTO audit_log (actor_id, actor_email, action, target_type, target_id, before, after, ip)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id, created_at
+	`, e.ActorID, e.ActorEmail, e.Action, e.TargetType, e.TargetID, nullJSON(e.Before), nullJSON(e.After), e.IP).Scan(&e.ID, &e.CreatedAt)
+}
+
+// Search returns a page of entries matching the query, newest first
+func (p *Postgres) Search(q Query) (*Result, error) {
+	ctx := context.Background()
+	pool := connections.Postgres()
+
+	if q.Page <= 0 {
+		q.Page = 1
+	}
+	if q.Limit <= 0 {
+		q.Limit = 20
+	}
+
+	where, args, err := buildWhere(q)
+	if err != nil {
+		return nil, err
+	}
+
+	var total int
+	err = pool.QueryRow(ctx, `SELECT COUNT(*) FROM audit_log `+where, args...).Scan(&total)
+	if err != nil {
+		return nil, err
+	}
+
+	args = append(args, q.Limit, (q.Page-1)*q.Limit)
+	rows, err := pool.Query(ctx, `
+		SELECT `+entryColumns+`
+		FROM audit_log `+where+`
+		ORDER BY created_at DESC, id DESC
+		LIMIT $`+strconv.Itoa(len(args)-1)+` OFFSET $`+strconv.Itoa(len(args)), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := make([]*Entry, 0)
+	for rows.Next() {
+		e, err := scanEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+
+	return &Result{
+		Entries: entries,
+		Total:   total,
+		Page:    q.Page,
+		Limit:   q.Limit,
+	}, rows.Err()
+}
+
+// nullJSON stores an empty snapshot as NULL instead of invalid JSONB
+func nullJSON(b []byte) interface{} {
+	if len(b) == 0 {
+		return nil
+	}
+	return string(b)
+}
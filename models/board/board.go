@@ -6,11 +6,14 @@ import (
 
 	log "github.com/Ptt-Alertor/logrus"
 	"github.com/Ptt-Alertor/ptt-alertor/models/article"
+	"github.com/Ptt-Alertor/ptt-alertor/models/catalog"
 	"github.com/Ptt-Alertor/ptt-alertor/myutil/maputil"
 	"github.com/Ptt-Alertor/ptt-alertor/ptt/rss"
 	"github.com/Ptt-Alertor/ptt-alertor/ptt/web"
 )
 
+var catalogRepo = &catalog.Postgres{}
+
 type BoardNotExistError struct {
 	Suggestion string
 }
@@ -146,7 +149,17 @@ func fixLink(articles *article.Articles) {
 	}
 }
 
+// SuggestBoardName returns the closest board name by edit distance over the
+// board catalog, or by character overlap with tracked boards while the
+// catalog is empty
 func (bd Board) SuggestBoardName() string {
+	if names, err := catalogRepo.SuggestNames(bd.Name, 1); err == nil {
+		if len(names) > 0 {
+			return names[0]
+		}
+		return ""
+	}
+
 	names := bd.List()
 	boardWeight := map[string]int{}
 	chars := strings.Split(strings.ToLower(bd.Name), "")
@@ -162,13 +175,19 @@ func (bd Board) SuggestBoardName() string {
 	return maputil.MaxIntKey(boardWeight)
 }
 
+// InCatalog reports whether the board catalog lists the board
+func InCatalog(boardName string) bool {
+	_, err := catalogRepo.Find(boardName)
+	return err == nil
+}
+
 func CheckBoardExist(boardName string) (bool, string) {
 	bd := NewBoard(new(Postgres), new(Redis))
 	bd.Name = boardName
 	if bd.Exist() {
 		return true, ""
 	}
-	if rss.CheckBoardExist(boardName) {
+	if InCatalog(boardName) || rss.CheckBoardExist(boardName) {
 		bd.Create()
 		return true, ""
 	}
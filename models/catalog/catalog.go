@@ -0,0 +1,94 @@
+package catalog
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	ErrBoardNotFound = errors.New("board not found in catalog")
+	ErrCatalogEmpty  = errors.New("board catalog is empty")
+)
+
+// MaxBoardName is the longest a PTT board name can be
+const MaxBoardName = 12
+
+// Board is a PTT board as listed in the board hierarchy
+type Board struct {
+	Name        string    `json:"name"`
+	Title       string    `json:"title"`
+	Category    string    `json:"category"`
+	OnlineUsers int       `json:"online_users"`
+	Over18      *bool     `json:"over18"`
+	SyncedAt    time.Time `json:"synced_at"`
+}
+
+// ListResult represents a page of catalog boards
+type ListResult struct {
+	Boards      []*Board `json:"boards"`
+	Total       int      `json:"total"`
+	Page        int      `json:"page"`
+	Limit       int      `json:"limit"`
+	Suggestions []string `json:"suggestions,omitempty"`
+}
+
+// Suggest returns up to n board names closest to name by edit distance,
+// more popular boards first among equally close ones. Names further than
+// half of the input length are not suggested.
+func Suggest(name string, boards []*Board, n int) []string {
+	name = strings.ToLower(name)
+	maxDistance := len(name)/2 + 1
+
+	type candidate struct {
+		name     string
+		distance int
+		users    int
+	}
+	candidates := make([]candidate, 0)
+	for _, b := range boards {
+		d := levenshtein(name, strings.ToLower(b.Name))
+		if d > maxDistance {
+			continue
+		}
+		candidates = append(candidates, candidate{b.Name, d, b.OnlineUsers})
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].distance != candidates[j].distance {
+			return candidates[i].distance < candidates[j].distance
+		}
+		return candidates[i].users > candidates[j].users
+	})
+
+	names := make([]string, 0, n)
+	for _, c := range candidates {
+		if len(names) == n {
+			break
+		}
+		names = append(names, c.name)
+	}
+	return names
+}
+
+// levenshtein returns the edit distance between two strings
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
@@ -0,0 +1,53 @@
+package catalog
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_levenshtein(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"gossiping", "gossiping", 0},
+		{"gosiping", "gossiping", 1},
+		{"gossipign", "gossiping", 2},
+		{"stock", "", 5},
+		{"八卦", "八掛", 1},
+	}
+	for _, tt := range tests {
+		if got := levenshtein(tt.a, tt.b); got != tt.want {
+			t.Errorf("levenshtein(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	boards := []*Board{
+		{Name: "Gossiping", OnlineUsers: 50000},
+		{Name: "Stock", OnlineUsers: 8000},
+		{Name: "Steam", OnlineUsers: 3000},
+		{Name: "Stack", OnlineUsers: 100},
+		{Name: "joke", OnlineUsers: 500},
+	}
+	tests := []struct {
+		name  string
+		input string
+		n     int
+		want  []string
+	}{
+		{"typo", "gosiping", 1, []string{"Gossiping"}},
+		{"case", "STOCK", 1, []string{"Stock"}},
+		{"tie prefers popular", "Stick", 2, []string{"Stock", "Stack"}},
+		{"too far", "HatePolitics", 3, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Suggest(tt.input, boards, tt.n); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Suggest() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
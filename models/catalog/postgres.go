@@ -0,0 +1,228 @@
+package catalog
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Ptt-Alertor/ptt-alertor/connections"
+	"github.com/jackc/pgx/v5"
+)
+
+// Postgres is the PostgreSQL repository for the board catalog
+type Postgres struct{}
+
+// Upsert stores boards from a list page, keeping the over18 flag which
+// list pages don't carry
+func (p *Postgres) Upsert(boards []*Board) error {
+	ctx := context.Background()
+	pool := connections.Postgres()
+
+	batch := &pgx.Batch{}
+	for _, b := range boards {
+		batch.Queue(`
+			INSERT INTO board_catalog (name, title, category, online_users, synced_at)
+			VALUES ($1, $2, $3, $4, NOW())
+			ON CONFLICT (name) DO UPDATE SET
+				title = EXCLUDED.title,
+				category = COALESCE(NULLIF(EXCLUDED.category, ''), board_catalog.category),
+				online_users = EXCLUDED.online_users,
+				synced_at = NOW()
+		`, b.Name, b.Title, b.Category, b.OnlineUsers)
+	}
+	return pool.SendBatch(ctx, batch).Close()
+}
+
+// Find returns a board by name, case-insensitively
+func (p *Postgres) Find(name string) (*Board, error) {
+	ctx := context.Background()
+	pool := connections.Postgres()
+
+	b, err := scanBoard(pool.QueryRow(ctx, `
+		SELECT name, title, category, online_users, over18, synced_at
+		FROM board_catalog
+		WHERE LOWER(name) = LOWER($1)
+	`, name))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrBoardNotFound
+		}
+		return nil, err
+	}
+	return b, nil
+}
+
+// suggestCacheTTL is how long the board names suggestions are drawn from
+// are kept, the catalog changes daily
+const suggestCacheTTL = 10 * time.Minute
+
+var suggestCache struct {
+	mu       sync.Mutex
+	boards   []*Board
+	loadedAt time.Time
+}
+
+// SuggestNames returns up to n board names closest to name, see Suggest,
+// or ErrCatalogEmpty before the catalog is synced. The names are loaded
+// once per suggestCacheTTL rather than per call, and a name longer than
+// any board name gets no suggestions.
+func (p *Postgres) SuggestNames(name string, n int) ([]string, error) {
+	boards, err := p.suggestBoards()
+	if err != nil {
+		return nil, err
+	}
+	if len(boards) == 0 {
+		return nil, ErrCatalogEmpty
+	}
+	if utf8.RuneCountInString(name) > MaxBoardName {
+		return []string{}, nil
+	}
+	return Suggest(name, boards, n), nil
+}
+
+func (p *Postgres) suggestBoards() ([]*Board, error) {
+	suggestCache.mu.Lock()
+	defer suggestCache.mu.Unlock()
+	if len(suggestCache.boards) > 0 && time.Since(suggestCache.loadedAt) < suggestCacheTTL {
+		return suggestCache.boards, nil
+	}
+
+	ctx := context.Background()
+	pool := connections.Postgres()
+
+	rows, err := pool.Query(ctx, `
+		SELECT name, online_users FROM board_catalog
+		ORDER BY online_users DESC, name
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	boards := make([]*Board, 0)
+	for rows.Next() {
+		var b Board
+		if err := rows.Scan(&b.Name, &b.OnlineUsers); err != nil {
+			return nil, err
+		}
+		boards = append(boards, &b)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	suggestCache.boards, suggestCache.loadedAt = boards, time.Now()
+	return boards, nil
+}
+
+// Search returns boards whose name or title contains query, filtered by
+// category, most popular first
+func (p *Postgres) Search(query, category string, page, limit int) (*ListResult, error) {
+	ctx := context.Background()
+	pool := connections.Postgres()
+
+	// Default values
+	if page <= 0 {
+		page = 1
+	}
+	if limit <= 0 {
+		limit = 20
+	}
+
+	pattern := "%" + strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(query) + "%"
+	where := `
+		WHERE ($1 = '' OR name ILIKE $2 OR title ILIKE $2)
+		  AND ($3 = '' OR category = $3)
+	`
+
+	var total int
+	err := pool.QueryRow(ctx, `SELECT COUNT(*) FROM board_catalog `+where, query, pattern, category).Scan(&total)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := pool.Query(ctx, `
+		SELECT name, title, category, online_users, over18, synced_at
+		FROM board_catalog `+where+`
+		ORDER BY online_users DESC, name
+		LIMIT $4 OFFSET $5
+	`, query, pattern, category, limit, (page-1)*limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	boards, err := scanBoards(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ListResult{
+		Boards: boards,
+		Total:  total,
+		Page:   page,
+		Limit:  limit,
+	}, nil
+}
+
+// UnknownOver18 returns up to limit boards whose over18 flag hasn't been
+// checked yet, most popular first
+func (p *Postgres) UnknownOver18(limit int) ([]string, error) {
+	ctx := context.Background()
+	pool := connections.Postgres()
+
+	rows, err := pool.Query(ctx, `
+		SELECT name FROM board_catalog
+		WHERE over18 IS NULL
+		ORDER BY online_users DESC
+		LIMIT $1
+	`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
+
+// SetOver18 records whether a board asks for age confirmation
+func (p *Postgres) SetOver18(name string, over18 bool) error {
+	ctx := context.Background()
+	pool := connections.Postgres()
+
+	_, err := pool.Exec(ctx, `
+		UPDATE board_catalog SET over18 = $2 WHERE name = $1
+	`, name, over18)
+	return err
+}
+
+func scanBoard(row pgx.Row) (*Board, error) {
+	var b Board
+	err := row.Scan(&b.Name, &b.Title, &b.Category, &b.OnlineUsers, &b.Over18, &b.SyncedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+func scanBoards(rows pgx.Rows) ([]*Board, error) {
+	boards := make([]*Board, 0)
+	for rows.Next() {
+		b, err := scanBoard(rows)
+		if err != nil {
+			return nil, err
+		}
+		boards = append(boards, b)
+	}
+	return boards, rows.Err()
+}
@@ -0,0 +1,83 @@
+package pttmail
+
+import (
+	"context"
+	"time"
+
+	"github.com/Ptt-Alertor/ptt-alertor/connections"
+)
+
+// EnqueueInboxChecks queues an inbox check for every watched account whose
+// role still grants PTT mail and whose credentials are not known wrong,
+// unless one is queued or was queued within interval, so failed checks wait
+// as long. Returns the number of queued checks.
+func (p *Postgres) EnqueueInboxChecks(interval time.Duration) (int64, error) {
+	ctx := context.Background()
+	pool := connections.Postgres()
+
+	tag, err := pool.Exec(ctx, `
+		INSERT INTO ptt_mail_jobs (kind, user_id, ptt_username, recipient)
+		SELECT 'inbox', a.user_id, a.ptt_username, ''
+		FROM ptt_accounts a
+		JOIN users u ON u.id = a.user_id
+		JOIN role_limits r ON r.role = u.role
+		WHERE a.watch_inbox AND a.credential_status <> 'invalid' AND u.enabled IS NOT FALSE AND 'ptt_mail' = ANY(r.permissions)
+		  AND NOT EXISTS (
+			SELECT 1 FROM ptt_mail_jobs j
+			WHERE j.kind = 'inbox' AND j.user_id = a.user_id
+			  AND (j.status IN ('queued', 'running') OR j.created_at > $1)
+		  )
+	`, time.Now().Add(-interval))
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// EnqueueCredentialChecks queues a login check for every account whose
+// role still grants PTT mail and whose credentials are pending or were last
+// verified before interval. Accounts with wrong credentials wait for the
+// user to bind them again, and a check queued within retry is not repeated.
+// A check queued by a concurrent bind is skipped rather than failing the
+// batch. Returns the number of queued checks.
+func (p *Postgres) EnqueueCredentialChecks(interval, retry time.Duration) (int64, error) {
+	ctx := context.Background()
+	pool := connections.Postgres()
+
+	tag, err := pool.Exec(ctx, `
+		INSERT INTO ptt_mail_jobs (kind, user_id, ptt_username, recipient)
+		SELECT 'verify', a.user_id, a.ptt_username, ''
+		FROM ptt_accounts a
+		JOIN users u ON u.id = a.user_id
+		JOIN role_limits r ON r.role = u.role
+		WHERE a.credential_status <> 'invalid'
+		  AND (a.credential_status = 'pending' OR a.last_verified_at IS NULL OR a.last_verified_at < $1)
+		  AND u.enabled IS NOT FALSE AND 'ptt_mail' = ANY(r.permissions)
+		  AND NOT EXISTS (
+			SELECT 1 FROM ptt_mail_jobs j
+			WHERE j.kind = 'verify' AND j.user_id = a.user_id
+			  AND (j.status IN ('queued', 'running') OR j.created_at > $2)
+		  )
+		ON CONFLICT DO NOTHING
+	`, time.Now().Add(-interval), time.Now().Add(-retry))
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// DeleteChecks deletes finished inbox and credential checks queued before
+// before
+func (p *Postgres) DeleteChecks(before time.Time) (int64, error) {
+	ctx := context.Background()
+	pool := connections.Postgres()
+
+	tag, err := pool.Exec(ctx, `
+		DELETE FROM ptt_mail_jobs
+		WHERE kind IN ('inbox', 'verify') AND status IN ('sent', 'failed') AND created_at < $1
+	`, before)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
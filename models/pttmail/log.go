@@ -0,0 +1,167 @@
+package pttmail
+
+import (
+	"context"
+	"errors"
+	"os"
+	"time"
+
+	log "github.com/Ptt-Alertor/logrus"
+
+	"github.com/Ptt-Alertor/ptt-alertor/connections"
+	"github.com/jackc/pgx/v5"
+)
+
+// defaultCooldown is how long a user waits to mail the same author about
+// the same article again
+const defaultCooldown = 24 * time.Hour
+
+// LogEntry records a PTT mail that was sent or failed for good
+type LogEntry struct {
+	ID          int64     `json:"id"`
+	UserID      int       `json:"-"`
+	Recipient   string    `json:"recipient"`
+	Subject     string    `json:"subject"`
+	ArticleCode string    `json:"article_code,omitempty"`
+	Status      string    `json:"status"`
+	Error       string    `json:"error,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// HistoryResult represents a page of a user's mail log
+type HistoryResult struct {
+	Entries []*LogEntry `json:"entries"`
+	Total   int         `json:"total"`
+	Page    int         `json:"page"`
+	Limit   int         `json:"limit"`
+}
+
+// Cooldown returns PTT_MAIL_COOLDOWN (default 24h), 0 turns the
+// duplicate-send protection off
+func Cooldown() time.Duration {
+	return parseCooldown(os.Getenv("PTT_MAIL_COOLDOWN"))
+}
+
+func parseCooldown(v string) time.Duration {
+	if v == "" {
+		return defaultCooldown
+	}
+	if v == "0" {
+		return 0
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		log.WithField("env", "PTT_MAIL_COOLDOWN").Warn("Invalid PTT Mail Cooldown, Using Default")
+		return defaultCooldown
+	}
+	return d
+}
+
+const logColumns = `id, user_id, recipient, subject, article_code, status, error, created_at`
+
+func scanLogEntry(row pgx.Row) (*LogEntry, error) {
+	var e LogEntry
+	err := row.Scan(&e.ID, &e.UserID, &e.Recipient, &e.Subject, &e.ArticleCode, &e.Status, &e.Error, &e.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// Log records the outcome of a mail job
+func (p *Postgres) Log(j *Job, status, errMsg string) error {
+	ctx := context.Background()
+	pool := connections.Postgres()
+
+	_, err := pool.Exec(ctx, `
+		INSERT INTO ptt_mail_log (user_id, recipient, subject, article_code, status, error)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`, j.UserID, j.Recipient, j.Subject, j.ArticleCode, status, errMsg)
+	return err
+}
+
+// LastSent returns the user's latest mail to recipient about the article
+// sent after since, nil when there is none
+func (p *Postgres) LastSent(userID int, recipient, articleCode string, since time.Time) (*LogEntry, error) {
+	ctx := context.Background()
+	pool := connections.Postgres()
+
+	e, err := scanLogEntry(pool.QueryRow(ctx, `
+		SELECT `+logColumns+`
+		FROM ptt_mail_log
+		WHERE user_id = $1 AND LOWER(recipient) = LOWER($2) AND article_code = $3
+		  AND status = 'sent' AND created_at > $4
+		ORDER BY created_at DESC
+		LIMIT 1
+	`, userID, recipient, articleCode, since))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return e, nil
+}
+
+// Pending reports whether the user already has a queued or running mail to
+// recipient about the article
+func (p *Postgres) Pending(userID int, recipient, articleCode string) (bool, error) {
+	ctx := context.Background()
+	pool := connections.Postgres()
+
+	var exists bool
+	err := pool.QueryRow(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM ptt_mail_jobs
+			WHERE kind = 'mail' AND user_id = $1 AND LOWER(recipient) = LOWER($2) AND article_code = $3
+			  AND status IN ('queued', 'running')
+		)
+	`, userID, recipient, articleCode).Scan(&exists)
+	return exists, err
+}
+
+// History returns a page of the user's mail log, newest first
+func (p *Postgres) History(userID, page, limit int) (*HistoryResult, error) {
+	ctx := context.Background()
+	pool := connections.Postgres()
+
+	if page <= 0 {
+		page = 1
+	}
+	if limit <= 0 {
+		limit = 20
+	}
+
+	var total int
+	if err := pool.QueryRow(ctx, `SELECT COUNT(*) FROM ptt_mail_log WHERE user_id = $1`, userID).Scan(&total); err != nil {
+		return nil, err
+	}
+
+	rows, err := pool.Query(ctx, `
+		SELECT `+logColumns+`
+		FROM ptt_mail_log
+		WHERE user_id = $1
+		ORDER BY created_at DESC, id DESC
+		LIMIT $2 OFFSET $3
+	`, userID, limit, (page-1)*limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := make([]*LogEntry, 0)
+	for rows.Next() {
+		e, err := scanLogEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+
+	return &HistoryResult{
+		Entries: entries,
+		Total:   total,
+		Page:    page,
+		Limit:   limit,
+	}, rows.Err()
+}
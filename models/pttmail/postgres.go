@@ -0,0 +1,219 @@
+package pttmail
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Ptt-Alertor/ptt-alertor/connections"
+	"github.com/jackc/pgx/v5"
+)
+
+// Postgres is the PostgreSQL repository for PTT mail jobs
+type Postgres struct{}
+
+const jobColumns = `id, kind, user_id, subscription_id, ptt_username, recipient, subject, content, article_code, board, push_type,
+	status, attempts, last_error, telegram_chat_id, telegram_message_id, run_at, started_at, finished_at, created_at`
+
+func scanJob(row pgx.Row) (*Job, error) {
+	var j Job
+	var chatID *int64
+	var messageID *int
+	err := row.Scan(&j.ID, &j.Kind, &j.UserID, &j.SubscriptionID, &j.PTTUsername, &j.Recipient, &j.Subject, &j.Content, &j.ArticleCode, &j.Board, &j.PushType,
+		&j.Status, &j.Attempts, &j.LastError, &chatID, &messageID, &j.RunAt, &j.StartedAt, &j.FinishedAt, &j.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if chatID != nil {
+		j.TelegramChatID = *chatID
+	}
+	if messageID != nil {
+		j.TelegramMessageID = *messageID
+	}
+	return &j, nil
+}
+
+// nullable stores a zero Telegram ID as NULL
+func nullable[T int | int64](v T) *T {
+	if v == 0 {
+		return nil
+	}
+	return &v
+}
+
+// Enqueue adds a job to run as soon as a worker is free, a job without a
+// kind is a mail. Returns ErrMailPending when the user has the same mail
+// about the article queued or running.
+func (p *Postgres) Enqueue(j *Job) error {
+	ctx := context.Background()
+	pool := connections.Postgres()
+
+	if j.Kind == "" {
+		j.Kind = KindMail
+	}
+	err := pool.QueryRow(ctx, `
+		INSERT INTO ptt_mail_jobs (kind, user_id, subscription_id, ptt_username, recipient, subject, content,
+		                           article_code, board, push_type, telegram_chat_id, telegram_message_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		RETURNING id, status, run_at, created_at
+	`, j.Kind, j.UserID, j.SubscriptionID, j.PTTUsername, j.Recipient, j.Subject, j.Content,
+		j.ArticleCode, j.Board, j.PushType, nullable(j.TelegramChatID), nullable(j.TelegramMessageID)).Scan(&j.ID, &j.Status, &j.RunAt, &j.CreatedAt)
+	if err != nil && strings.Contains(err.Error(), `"idx_ptt_mail_jobs_pending_mail" (SQLSTATE 23505)`) {
+		return ErrMailPending
+	}
+	if err != nil && strings.Contains(err.Error(), `"idx_ptt_mail_jobs_pending_verify" (SQLSTATE 23505)`) {
+		return ErrVerifyPending
+	}
+	return err
+}
+
+// Claim marks the next due job running and returns it, nil when none is
+// due. Jobs of a PTT account with a running job wait, the unique index on
+// running jobs settles two workers racing for the same account.
+func (p *Postgres) Claim() (*Job, error) {
+	ctx := context.Background()
+	pool := connections.Postgres()
+
+	j, err := scanJob(pool.QueryRow(ctx, `
+		UPDATE ptt_mail_jobs
+		SET status = 'running', attempts = attempts + 1, started_at = NOW()
+		WHERE id = (
+			SELECT j.id FROM ptt_mail_jobs j
+			WHERE j.status = 'queued' AND j.run_at <= NOW()
+			  AND NOT EXISTS (
+				SELECT 1 FROM ptt_mail_jobs r
+				WHERE r.status = 'running' AND LOWER(r.ptt_username) = LOWER(j.ptt_username)
+			  )
+			ORDER BY j.run_at, j.id
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING `+jobColumns))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) || strings.Contains(err.Error(), "SQLSTATE 23505") {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return j, nil
+}
+
+// Complete marks a running job sent
+func (p *Postgres) Complete(id int64) error {
+	ctx := context.Background()
+	pool := connections.Postgres()
+
+	_, err := pool.Exec(ctx, `
+		UPDATE ptt_mail_jobs SET status = 'sent', last_error = '', finished_at = NOW()
+		WHERE id = $1
+	`, id)
+	return err
+}
+
+// Retry puts a running job back in the queue to run at runAt
+func (p *Postgres) Retry(id int64, lastError string, runAt time.Time) error {
+	ctx := context.Background()
+	pool := connections.Postgres()
+
+	_, err := pool.Exec(ctx, `
+		UPDATE ptt_mail_jobs SET status = 'queued', last_error = $2, run_at = $3
+		WHERE id = $1
+	`, id, lastError, runAt)
+	return err
+}
+
+// Fail marks a running job failed for good
+func (p *Postgres) Fail(id int64, lastError string) error {
+	ctx := context.Background()
+	pool := connections.Postgres()
+
+	_, err := pool.Exec(ctx, `
+		UPDATE ptt_mail_jobs SET status = 'failed', last_error = $2, finished_at = NOW()
+		WHERE id = $1
+	`, id, lastError)
+	return err
+}
+
+// Pace holds back the queued jobs of a PTT account for at least d, so its
+// logins are spaced out
+func (p *Postgres) Pace(pttUsername string, d time.Duration) error {
+	ctx := context.Background()
+	pool := connections.Postgres()
+
+	_, err := pool.Exec(ctx, `
+		UPDATE ptt_mail_jobs SET run_at = GREATEST(run_at, $2)
+		WHERE status = 'queued' AND LOWER(ptt_username) = LOWER($1)
+	`, pttUsername, time.Now().Add(d))
+	return err
+}
+
+// RequeueStale puts back jobs left running longer than d, by a worker that
+// died mid-send. Returns the number of requeued jobs.
+func (p *Postgres) RequeueStale(d time.Duration) (int64, error) {
+	ctx := context.Background()
+	pool := connections.Postgres()
+
+	tag, err := pool.Exec(ctx, `
+		UPDATE ptt_mail_jobs SET status = 'queued', run_at = NOW()
+		WHERE status = 'running' AND started_at < $1
+	`, time.Now().Add(-d))
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// List returns a page of a user's jobs, newest first, without inbox and
+// credential checks
+func (p *Postgres) List(q ListQuery) (*ListResult, error) {
+	ctx := context.Background()
+	pool := connections.Postgres()
+
+	if q.Page <= 0 {
+		q.Page = 1
+	}
+	if q.Limit <= 0 {
+		q.Limit = 20
+	}
+
+	where := `WHERE user_id = $1 AND kind NOT IN ('inbox', 'verify')`
+	args := []interface{}{q.UserID}
+	if q.Status != "" {
+		args = append(args, q.Status)
+		where += ` AND status = $2`
+	}
+
+	var total int
+	if err := pool.QueryRow(ctx, `SELECT COUNT(*) FROM ptt_mail_jobs `+where, args...).Scan(&total); err != nil {
+		return nil, err
+	}
+
+	args = append(args, q.Limit, (q.Page-1)*q.Limit)
+	rows, err := pool.Query(ctx, `
+		SELECT `+jobColumns+`
+		FROM ptt_mail_jobs `+where+`
+		ORDER BY created_at DESC, id DESC
+		LIMIT $`+strconv.Itoa(len(args)-1)+` OFFSET $`+strconv.Itoa(len(args)), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := make([]*Job, 0)
+	for rows.Next() {
+		j, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, j)
+	}
+
+	return &ListResult{
+		Jobs:  jobs,
+		Total: total,
+		Page:  q.Page,
+		Limit: q.Limit,
+	}, rows.Err()
+}
@@ -0,0 +1,109 @@
+// Package pttmail queues PTT mails, pushes, replies, inbox checks and
+// credential checks so they run in the background, one login at a time per
+// PTT account
+package pttmail
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrMailPending is returned when the same mail about an article is
+// already queued or running
+var ErrMailPending = errors.New("mail already queued")
+
+// ErrVerifyPending is returned when a credential check of the user is
+// already queued or running
+var ErrVerifyPending = errors.New("credential check already queued")
+
+// Statuses of a mail job
+const (
+	StatusQueued  = "queued"
+	StatusRunning = "running"
+	StatusSent    = "sent"
+	StatusFailed  = "failed"
+)
+
+// Kinds of a job
+const (
+	KindMail   = "mail"
+	KindPush   = "push"
+	KindReply  = "reply"
+	KindInbox  = "inbox"
+	KindVerify = "verify"
+)
+
+// MaxAttempts bounds how many times a job is tried before it fails
+const MaxAttempts = 3
+
+// retryBase is the delay before the first retry, doubled for each next one
+const retryBase = time.Minute
+
+// Job is a PTT mail, push or reply waiting to be sent or already handled.
+// Pushes and replies go to Board and ArticleCode with Content as the
+// comment or the reply. The Telegram message is edited with the result when
+// the job came from a button.
+type Job struct {
+	ID                int64      `json:"id"`
+	Kind              string     `json:"kind"`
+	UserID            int        `json:"-"`
+	SubscriptionID    *int       `json:"subscription_id"`
+	PTTUsername       string     `json:"ptt_username"`
+	Recipient         string     `json:"recipient"`
+	Subject           string     `json:"subject"`
+	Content           string     `json:"content"`
+	ArticleCode       string     `json:"article_code,omitempty"`
+	Board             string     `json:"board,omitempty"`
+	PushType          int        `json:"push_type,omitempty"`
+	Status            string     `json:"status"`
+	Attempts          int        `json:"attempts"`
+	LastError         string     `json:"last_error,omitempty"`
+	TelegramChatID    int64      `json:"-"`
+	TelegramMessageID int        `json:"-"`
+	RunAt             time.Time  `json:"run_at"`
+	StartedAt         *time.Time `json:"started_at"`
+	FinishedAt        *time.Time `json:"finished_at"`
+	CreatedAt         time.Time  `json:"created_at"`
+}
+
+// ListQuery is the filter of a user's jobs, Status is optional
+type ListQuery struct {
+	UserID int
+	Status string
+	Page   int
+	Limit  int
+}
+
+// ListResult represents a page of jobs
+type ListResult struct {
+	Jobs  []*Job `json:"jobs"`
+	Total int    `json:"total"`
+	Page  int    `json:"page"`
+	Limit int    `json:"limit"`
+}
+
+// ValidStatus reports whether status is a job status
+func ValidStatus(status string) bool {
+	switch status {
+	case StatusQueued, StatusRunning, StatusSent, StatusFailed:
+		return true
+	}
+	return false
+}
+
+// ValidKind reports whether kind is a job kind
+func ValidKind(kind string) bool {
+	switch kind {
+	case KindMail, KindPush, KindReply, KindInbox, KindVerify:
+		return true
+	}
+	return false
+}
+
+// RetryDelay is how long to wait after the attempts-th failed attempt
+func RetryDelay(attempts int) time.Duration {
+	if attempts < 1 {
+		attempts = 1
+	}
+	return retryBase << (attempts - 1)
+}
@@ -0,0 +1,81 @@
+package pttmail
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRetryDelay(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{0, time.Minute},
+		{1, time.Minute},
+		{2, 2 * time.Minute},
+		{3, 4 * time.Minute},
+	}
+	for _, tt := range tests {
+		if got := RetryDelay(tt.attempts); got != tt.want {
+			t.Errorf("RetryDelay(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestValidStatus(t *testing.T) {
+	tests := []struct {
+		status string
+		want   bool
+	}{
+		{StatusQueued, true},
+		{StatusRunning, true},
+		{StatusSent, true},
+		{StatusFailed, true},
+		{"", false},
+		{"SENT", false},
+	}
+	for _, tt := range tests {
+		if got := ValidStatus(tt.status); got != tt.want {
+			t.Errorf("ValidStatus(%q) = %v, want %v", tt.status, got, tt.want)
+		}
+	}
+}
+
+func TestValidKind(t *testing.T) {
+	tests := []struct {
+		kind string
+		want bool
+	}{
+		{KindMail, true},
+		{KindPush, true},
+		{KindReply, true},
+		{KindInbox, true},
+		{KindVerify, true},
+		{"", false},
+		{"post", false},
+	}
+	for _, tt := range tests {
+		if got := ValidKind(tt.kind); got != tt.want {
+			t.Errorf("ValidKind(%q) = %v, want %v", tt.kind, got, tt.want)
+		}
+	}
+}
+
+func TestParseCooldown(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{"", defaultCooldown},
+		{"0", 0},
+		{"2h", 2 * time.Hour},
+		{"30m", 30 * time.Minute},
+		{"-1h", defaultCooldown},
+		{"tomorrow", defaultCooldown},
+	}
+	for _, tt := range tests {
+		if got := parseCooldown(tt.value); got != tt.want {
+			t.Errorf("parseCooldown(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Ptt-Alertor/ptt-alertor/connections"
+	"github.com/jackc/pgx/v5"
+)
+
+// Postgres is the PostgreSQL repository for login sessions
+type Postgres struct{}
+
+// Create starts a session for a user with the hash of its refresh token
+func (p *Postgres) Create(userID int, tokenHash, userAgent, ip string, mfa bool) (*Session, error) {
+	ctx := context.Background()
+	pool := connections.Postgres()
+
+	id, err := newID()
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Session{ID: id, UserID: userID, UserAgent: userAgent, IP: ip, MFA: mfa}
+	err = pool.QueryRow(ctx, `
+		INSERT INTO sessions (id, user_id, refresh_token_hash, user_agent, ip, mfa, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING created_at, last_used_at, expires_at
+	`, id, userID, tokenHash, userAgent, ip, mfa, time.Now().Add(RefreshTTL)).Scan(
+		&s.CreatedAt, &s.LastUsedAt, &s.ExpiresAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Rotate swaps the refresh token of the session holding oldHash for
+// newHash and extends it. Presenting an already rotated token revokes the
+// session, since it means the token was copied.
+func (p *Postgres) Rotate(oldHash, newHash string) (*Session, error) {
+	ctx := context.Background()
+	pool := connections.Postgres()
+
+	var s Session
+	err := pool.QueryRow(ctx, `
+		UPDATE sessions
+		SET previous_token_hash = refresh_token_hash,
+		    refresh_token_hash = $2,
+		    last_used_at = NOW(),
+		    expires_at = $3
+		WHERE refresh_token_hash = $1 AND revoked_at IS NULL AND expires_at > NOW()
+		RETURNING id, user_id, user_agent, ip, mfa, created_at, last_used_at, expires_at
+	`, oldHash, newHash, time.Now().Add(RefreshTTL)).Scan(
+		&s.ID, &s.UserID, &s.UserAgent, &s.IP, &s.MFA, &s.CreatedAt, &s.LastUsedAt, &s.ExpiresAt,
+	)
+	if err == nil {
+		return &s, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return nil, err
+	}
+
+	// reuse of a rotated token
+	var id string
+	err = pool.QueryRow(ctx, `
+		UPDATE sessions SET revoked_at = NOW()
+		WHERE previous_token_hash = $1 AND revoked_at IS NULL
+		RETURNING id
+	`, oldHash).Scan(&id)
+	if err == nil {
+		markRevoked(id)
+		return nil, ErrTokenReused
+	}
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrSessionNotFound
+	}
+	return nil, err
+}
+
+// ListActive returns a user's sessions that are neither revoked nor expired
+func (p *Postgres) ListActive(userID int) ([]*Session, error) {
+	ctx := context.Background()
+	pool := connections.Postgres()
+
+	rows, err := pool.Query(ctx, `
+		SELECT id, user_id, user_agent, ip, mfa, created_at, last_used_at, expires_at
+		FROM sessions
+		WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > NOW()
+		ORDER BY last_used_at DESC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := make([]*Session, 0)
+	for rows.Next() {
+		var s Session
+		if err := rows.Scan(&s.ID, &s.UserID, &s.UserAgent, &s.IP, &s.MFA, &s.CreatedAt, &s.LastUsedAt, &s.ExpiresAt); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, &s)
+	}
+	return sessions, rows.Err()
+}
+
+// Revoke ends one of a user's sessions
+func (p *Postgres) Revoke(userID int, id string) error {
+	ctx := context.Background()
+	pool := connections.Postgres()
+
+	tag, err := pool.Exec(ctx, `
+		UPDATE sessions SET revoked_at = NOW()
+		WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL
+	`, id, userID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrSessionNotFound
+	}
+	markRevoked(id)
+	return nil
+}
+
+// MarkMFA records that a session's user completed two-factor
+// authentication, carried into access tokens on the next refresh
+func (p *Postgres) MarkMFA(id string) error {
+	ctx := context.Background()
+	pool := connections.Postgres()
+
+	_, err := pool.Exec(ctx, `UPDATE sessions SET mfa = TRUE WHERE id = $1`, id)
+	return err
+}
+
+// RevokeAll ends every session of a user except keepID, which may be empty
+func (p *Postgres) RevokeAll(userID int, keepID string) error {
+	ctx := context.Background()
+	pool := connections.Postgres()
+
+	rows, err := pool.Query(ctx, `
+		UPDATE sessions SET revoked_at = NOW()
+		WHERE user_id = $1 AND id <> $2 AND revoked_at IS NULL
+		RETURNING id
+	`, userID, keepID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return err
+		}
+		ids = append(ids, id)
+	}
+	markRevoked(ids...)
+	return rows.Err()
+}
+
+// DeleteExpired removes sessions that can no longer be refreshed
+func (p *Postgres) DeleteExpired() (int64, error) {
+	ctx := context.Background()
+	pool := connections.Postgres()
+
+	tag, err := pool.Exec(ctx, `
+		DELETE FROM sessions
+		WHERE expires_at < NOW() OR revoked_at < NOW() - INTERVAL '1 day'
+	`)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
@@ -0,0 +1,48 @@
+package session
+
+import (
+	"time"
+
+	log "github.com/Ptt-Alertor/logrus"
+	"github.com/Ptt-Alertor/ptt-alertor/connections"
+	"github.com/Ptt-Alertor/ptt-alertor/myutil"
+	"github.com/gomodule/redigo/redis"
+)
+
+const revokedPrefix = "session:revoked:"
+
+// revokedTTL outlives any access token, after which the revoked session
+// can only be resumed through its refresh token, which Postgres rejects
+const revokedTTL = 1 * time.Hour
+
+var connectRedis = connections.Redis
+
+// markRevoked lets access tokens of the sessions be rejected immediately
+func markRevoked(ids ...string) {
+	if len(ids) == 0 {
+		return
+	}
+	conn := connectRedis()
+	defer conn.Close()
+
+	for _, id := range ids {
+		conn.Send("SET", revokedPrefix+id, 1, "EX", int(revokedTTL.Seconds()))
+	}
+	if _, err := conn.Do(""); err != nil {
+		log.WithField("runtime", myutil.BasicRuntimeInfo()).WithError(err).Error("Mark Session Revoked Failed")
+	}
+}
+
+// IsRevoked reports whether a session was revoked recently enough that its
+// access tokens may still be unexpired
+func IsRevoked(id string) bool {
+	conn := connectRedis()
+	defer conn.Close()
+
+	revoked, err := redis.Bool(conn.Do("EXISTS", revokedPrefix+id))
+	if err != nil {
+		log.WithField("runtime", myutil.BasicRuntimeInfo()).WithError(err).Error("Check Session Revoked Failed")
+		return false
+	}
+	return revoked
+}
@@ -0,0 +1,74 @@
+package session
+
+import (
+	"os"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gomodule/redigo/redis"
+)
+
+var s *miniredis.Miniredis
+
+func TestMain(m *testing.M) {
+	var err error
+	s, err = miniredis.Run()
+	if err != nil {
+		panic(err)
+	}
+
+	connectRedis = func() redis.Conn {
+		conn, err := redis.Dial("tcp", s.Addr())
+		if err != nil {
+			panic(err)
+		}
+		return conn
+	}
+
+	v := m.Run()
+
+	s.Close()
+	os.Exit(v)
+}
+
+func TestNewRefreshToken(t *testing.T) {
+	token, hash, err := NewRefreshToken()
+	if err != nil {
+		t.Fatalf("NewRefreshToken() error = %v", err)
+	}
+	if len(token) != 43 {
+		t.Errorf("NewRefreshToken() token length = %d, want 43", len(token))
+	}
+	if hash != HashToken(token) {
+		t.Errorf("NewRefreshToken() hash = %v, want %v", hash, HashToken(token))
+	}
+	other, _, _ := NewRefreshToken()
+	if other == token {
+		t.Errorf("NewRefreshToken() returned the same token twice")
+	}
+}
+
+func TestIsRevoked(t *testing.T) {
+	markRevoked("a", "b")
+
+	tests := []struct {
+		name string
+		id   string
+		want bool
+	}{
+		{"revoked", "a", true},
+		{"revoked in batch", "b", true},
+		{"active", "c", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsRevoked(tt.id); got != tt.want {
+				t.Errorf("IsRevoked() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if ttl := s.TTL(revokedPrefix + "a"); ttl != revokedTTL {
+		t.Errorf("revoked key TTL = %v, want %v", ttl, revokedTTL)
+	}
+}
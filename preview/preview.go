@@ -0,0 +1,232 @@
+// Package preview back-tests a subscription against past articles so users
+// can tell whether a keyword is too broad or too narrow before saving it
+package preview
+
+import (
+	"errors"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Ptt-Alertor/ptt-alertor/models/archive"
+	"github.com/Ptt-Alertor/ptt-alertor/models/article"
+	"github.com/Ptt-Alertor/ptt-alertor/ptt/web"
+	"github.com/Ptt-Alertor/ptt-alertor/ratelimit"
+)
+
+const (
+	SourceArchive = "archive"
+	SourceLive    = "live"
+
+	DefaultDays = 7
+	MaxDays     = 30
+
+	// livePages is how many index pages are crawled for a live preview
+	livePages = 5
+	// maxScan caps the stored articles evaluated in one preview
+	maxScan = 5000
+	// maxMatches caps the matched articles returned
+	maxMatches = 50
+	// MaxPushSum bounds a pushsum value either way, as subscriptions do
+	MaxPushSum = 100
+)
+
+// Limit bounds the previews of an account, each can crawl several PTT
+// pages; RATE_LIMIT_PREVIEW overrides it
+var Limit = ratelimit.Limit{Requests: 10, Window: time.Hour}
+
+var (
+	ErrBoardRequired  = errors.New("board is required")
+	ErrInvalidSubType = errors.New("invalid sub_type")
+	ErrInvalidValue   = errors.New("invalid value")
+	ErrInvalidSource  = errors.New("invalid source")
+	ErrBoardNotFound  = errors.New("board not found")
+)
+
+// Request is a subscription to try out
+type Request struct {
+	Board   string `json:"board"`
+	SubType string `json:"sub_type"`
+	Value   string `json:"value"`
+	Days    int    `json:"days"`
+	Source  string `json:"source"`
+}
+
+// Match is an article the subscription would have alerted on
+type Match struct {
+	Title       string    `json:"title"`
+	Author      string    `json:"author"`
+	Link        string    `json:"link"`
+	PushSum     int       `json:"push_sum"`
+	PublishedAt time.Time `json:"published_at"`
+}
+
+// Result summarizes a back-test
+type Result struct {
+	Board        string  `json:"board"`
+	SubType      string  `json:"sub_type"`
+	Value        string  `json:"value"`
+	Source       string  `json:"source"`
+	Scanned      int     `json:"scanned"`
+	Matched      int     `json:"matched"`
+	Days         float64 `json:"days"`
+	AlertsPerDay float64 `json:"alerts_per_day"`
+	Articles     []Match `json:"articles"`
+}
+
+var archiveRepo = &archive.Postgres{}
+
+// Run evaluates the request against stored articles, or live index pages
+// when asked to or when nothing is stored for the board
+func Run(req Request) (*Result, error) {
+	if req.Board == "" {
+		return nil, ErrBoardRequired
+	}
+	match, err := Matcher(req.SubType, req.Value)
+	if err != nil {
+		return nil, err
+	}
+	if req.Days <= 0 {
+		req.Days = DefaultDays
+	}
+	if req.Days > MaxDays {
+		req.Days = MaxDays
+	}
+
+	var articles article.Articles
+	switch req.Source {
+	case "", SourceArchive:
+		articles, err = fromArchive(req.Board, req.Days)
+		if err != nil {
+			return nil, err
+		}
+		req.Source = SourceArchive
+		if len(articles) == 0 {
+			req.Source = SourceLive
+			articles, err = fromLive(req.Board)
+		}
+	case SourceLive:
+		articles, err = fromLive(req.Board)
+	default:
+		return nil, ErrInvalidSource
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	res := evaluate(articles, match, time.Now())
+	res.Board = req.Board
+	res.SubType = req.SubType
+	res.Value = req.Value
+	res.Source = req.Source
+	return res, nil
+}
+
+// Matcher returns the same matching rule the checkers apply for a
+// subscription of subType with value
+func Matcher(subType, value string) (func(article.Article) bool, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, ErrInvalidValue
+	}
+	switch subType {
+	case "keyword":
+		if strings.HasPrefix(value, "regexp:") {
+			if _, err := regexp.Compile(strings.TrimPrefix(value, "regexp:")); err != nil {
+				return nil, ErrInvalidValue
+			}
+		}
+		return func(a article.Article) bool {
+			return a.MatchKeyword(value)
+		}, nil
+	case "author":
+		return func(a article.Article) bool {
+			return strings.EqualFold(a.Author, value)
+		}, nil
+	case "pushsum":
+		sum, err := strconv.Atoi(value)
+		if err != nil || sum == 0 || sum > MaxPushSum || sum < -MaxPushSum {
+			return nil, ErrInvalidValue
+		}
+		if sum > 0 {
+			return func(a article.Article) bool { return a.PushSum >= sum }, nil
+		}
+		return func(a article.Article) bool { return a.PushSum <= sum }, nil
+	}
+	return nil, ErrInvalidSubType
+}
+
+// evaluate matches articles and extrapolates the alert rate over the
+// period they cover, at least one hour
+func evaluate(articles article.Articles, match func(article.Article) bool, now time.Time) *Result {
+	res := &Result{Articles: make([]Match, 0)}
+	oldest := now
+	for _, a := range articles {
+		if a.ID == 0 {
+			continue
+		}
+		res.Scanned++
+		published := time.Unix(int64(a.ID), 0)
+		if published.Before(oldest) {
+			oldest = published
+		}
+		if !match(a) {
+			continue
+		}
+		res.Matched++
+		if len(res.Articles) < maxMatches {
+			res.Articles = append(res.Articles, Match{
+				Title:       a.Title,
+				Author:      a.Author,
+				Link:        a.Link,
+				PushSum:     a.PushSum,
+				PublishedAt: published,
+			})
+		}
+	}
+
+	span := now.Sub(oldest)
+	if span < time.Hour {
+		span = time.Hour
+	}
+	res.Days = round(span.Hours() / 24)
+	res.AlertsPerDay = round(float64(res.Matched) / span.Hours() * 24)
+	return res
+}
+
+func round(f float64) float64 {
+	return math.Round(f*10) / 10
+}
+
+func fromArchive(board string, days int) (article.Articles, error) {
+	stored, err := archiveRepo.ListByBoard(board, time.Now().AddDate(0, 0, -days), maxScan)
+	if err != nil {
+		return nil, err
+	}
+	articles := make(article.Articles, 0, len(stored))
+	for _, a := range stored {
+		articles = append(articles, a.ToArticle())
+	}
+	return articles, nil
+}
+
+func fromLive(board string) (article.Articles, error) {
+	current, err := web.CurrentPage(board)
+	if err != nil {
+		if _, ok := err.(web.URLNotFoundError); ok {
+			return nil, ErrBoardNotFound
+		}
+		return nil, err
+	}
+	var articles article.Articles
+	for page := current; page > 0 && page > current-livePages; page-- {
+		pageArticles, err := web.FetchArticles(board, page)
+		if err != nil {
+			return nil, err
+		}
+		articles = append(articles, pageArticles...)
+	}
+	return articles, nil
+}
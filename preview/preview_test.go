@@ -0,0 +1,69 @@
+package preview
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Ptt-Alertor/ptt-alertor/models/article"
+)
+
+func TestMatcher(t *testing.T) {
+	a := article.Article{Title: "[問卦] 有沒有金城武的八卦", Author: "ChoDino", PushSum: 30}
+	tests := []struct {
+		name    string
+		subType string
+		value   string
+		want    bool
+		wantErr error
+	}{
+		{"keyword", "keyword", "金城武", true, nil},
+		{"keyword and", "keyword", "問卦&金城武", true, nil},
+		{"keyword exclude", "keyword", "!金城武", false, nil},
+		{"regexp", "keyword", "regexp:^\\[問卦\\]", true, nil},
+		{"bad regexp", "keyword", "regexp:[", false, ErrInvalidValue},
+		{"author", "author", "chodino", true, nil},
+		{"push up", "pushsum", "+30", true, nil},
+		{"push up miss", "pushsum", "50", false, nil},
+		{"push down", "pushsum", "-10", false, nil},
+		{"push zero", "pushsum", "0", false, ErrInvalidValue},
+		{"push over", "pushsum", "101", false, ErrInvalidValue},
+		{"push down over", "pushsum", "-101", false, ErrInvalidValue},
+		{"empty", "keyword", " ", false, ErrInvalidValue},
+		{"bad type", "comment", "x", false, ErrInvalidSubType},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			match, err := Matcher(tt.subType, tt.value)
+			if err != tt.wantErr {
+				t.Fatalf("Matcher() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && match(a) != tt.want {
+				t.Errorf("Matcher()(a) = %v, want %v", !tt.want, tt.want)
+			}
+		})
+	}
+}
+
+func Test_evaluate(t *testing.T) {
+	now := time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC)
+	articles := article.Articles{
+		{ID: int(now.Add(-48 * time.Hour).Unix()), Title: "[問卦] A"},
+		{ID: int(now.Add(-24 * time.Hour).Unix()), Title: "[新聞] B"},
+		{ID: int(now.Add(-1 * time.Hour).Unix()), Title: "[問卦] C"},
+		{ID: 0, Title: "(本文已被刪除)"},
+	}
+	match, _ := Matcher("keyword", "問卦")
+
+	res := evaluate(articles, match, now)
+	if res.Scanned != 3 || res.Matched != 2 || len(res.Articles) != 2 {
+		t.Fatalf("evaluate() scanned/matched = %d/%d, want 3/2", res.Scanned, res.Matched)
+	}
+	if res.Days != 2 || res.AlertsPerDay != 1 {
+		t.Errorf("evaluate() days = %v, per day = %v, want 2, 1", res.Days, res.AlertsPerDay)
+	}
+
+	res = evaluate(nil, match, now)
+	if res.Scanned != 0 || res.AlertsPerDay != 0 || res.Articles == nil {
+		t.Errorf("evaluate(nil) = %+v", res)
+	}
+}
@@ -0,0 +1,80 @@
+// Package aid converts PTT article codes, the file names such as
+// M.1498563199.A.35C, to and from AIDs, the short IDs such as #1PKa9_DS that
+// PTT's "#" key searches a board for.
+package aid
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalid = errors.New("invalid article code or AID")
+
+const (
+	alphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz-_"
+	length   = 8
+)
+
+var codePattern = regexp.MustCompile(`^([MG])\.(\d+)\.A\.([0-9A-F]{1,3})$`)
+
+// FromCode returns the AID of an article code, with the leading "#"
+func FromCode(code string) (string, error) {
+	m := codePattern.FindStringSubmatch(code)
+	if m == nil {
+		return "", ErrInvalid
+	}
+	var kind uint64
+	if m[1] == "G" {
+		kind = 1
+	}
+	timestamp, err := strconv.ParseUint(m[2], 10, 32)
+	if err != nil {
+		return "", ErrInvalid
+	}
+	random, err := strconv.ParseUint(m[3], 16, 12)
+	if err != nil {
+		return "", ErrInvalid
+	}
+
+	n := kind<<44 | timestamp<<12 | random
+	buf := make([]byte, length)
+	for i := length - 1; i >= 0; i-- {
+		buf[i] = alphabet[n%64]
+		n /= 64
+	}
+	if n != 0 {
+		return "", ErrInvalid
+	}
+	return "#" + string(buf), nil
+}
+
+// ToCode returns the article code of an AID, the "#" is optional
+func ToCode(aid string) (string, error) {
+	aid = strings.TrimPrefix(aid, "#")
+	if len(aid) != length {
+		return "", ErrInvalid
+	}
+	var n uint64
+	for i := 0; i < len(aid); i++ {
+		v := strings.IndexByte(alphabet, aid[i])
+		if v < 0 {
+			return "", ErrInvalid
+		}
+		n = n*64 + uint64(v)
+	}
+
+	kind := "M"
+	switch n >> 44 {
+	case 0:
+	case 1:
+		kind = "G"
+	default:
+		return "", ErrInvalid
+	}
+	timestamp := n >> 12 & 0xffffffff
+	random := n & 0xfff
+	return fmt.Sprintf("%s.%d.A.%03X", kind, timestamp, random), nil
+}
@@ -0,0 +1,58 @@
+package aid
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestFromCode(t *testing.T) {
+	tests := []struct {
+		code    string
+		want    string
+		wantErr error
+	}{
+		{"M.1498563199.A.35C", "#1PKa9_DS", nil},
+		{"G.1234567890.A.001", "#59bWBI01", nil},
+		{"M.1498563199.A.35C.html", "", ErrInvalid},
+		{"X.1498563199.A.35C", "", ErrInvalid},
+		{"M.99999999999.A.35C", "", ErrInvalid},
+		{"", "", ErrInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			got, err := FromCode(tt.code)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("FromCode() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("FromCode() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestToCode(t *testing.T) {
+	tests := []struct {
+		aid     string
+		want    string
+		wantErr error
+	}{
+		{"#1PKa9_DS", "M.1498563199.A.35C", nil},
+		{"1PKa9_DS", "M.1498563199.A.35C", nil},
+		{"#59bWBI01", "G.1234567890.A.001", nil},
+		{"#1PKa9_D", "", ErrInvalid},
+		{"#1PKa9_D!", "", ErrInvalid},
+		{"#z0000000", "", ErrInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.aid, func(t *testing.T) {
+			got, err := ToCode(tt.aid)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ToCode() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ToCode() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,522 @@
+// Package bbstest runs a fake PTT BBS over SSH so the terminal clients in
+// ptt/ can be tested without connecting to ptt.cc. It replays the screens
+// the clients wait for: login, duplicate login, wrong password, the mail
+// menu, mail compose, unknown recipient, the mailbox and reading mails, and
+// on boards the AID search, push and reply.
+package bbstest
+
+import (
+	"bufio"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/text/encoding/traditionalchinese"
+)
+
+// SSH users of PTT, bbsu gets UTF-8 screens and bbs gets Big5 ones
+const (
+	UserUTF8 = "bbsu"
+	UserBig5 = "bbs"
+)
+
+// Screens shown by the fake BBS, the texts the clients match on
+const (
+	ScreenLogin         = "請輸入代號，或以 guest 參觀，或以 new 註冊: "
+	ScreenWelcome       = "歡迎來到 批踢踢實業坊\r\n" + ScreenLogin
+	ScreenPassword      = "請輸入您的密碼: "
+	ScreenWrongPassword = "密碼不對或無此帳號。請檢查大小寫及有無輸入錯誤。\r\n"
+	ScreenDuplicate     = "注意: 您有其它連線已登入此帳號。\r\n您想刪除其他重複登入的連線嗎？[Y/n] "
+	ScreenAnyKey        = "請按任意鍵繼續"
+	ScreenMainMenu      = "【主功能表】 批踢踢實業坊\r\n (F)avorite 【 我 的 最愛 】\r\n (M)ail 【 私人信件區 】\r\n (G)oodbye 離開，再見…"
+	ScreenMailMenu      = "【郵件選單】 批踢踢實業坊\r\n (R)ead 我的信箱\r\n (S)end 站內寄信\r\n (E)xit 回主功能表"
+	ScreenRecipient     = "【站內寄信】\r\n收信人: "
+	ScreenNoUser        = "無此帳號\r\n"
+	ScreenSubject       = "主題: "
+	ScreenEditor        = "編輯文章 (^Z/F1)說明 (^P/^G)插入符號/範例圖片 (^X/^Q)離開"
+	ScreenSave          = "檔案處理 (S)存檔 (A)放棄 (T)改標題 (E)繼續 [S] "
+	ScreenSignature     = "選擇簽名檔 (0/1/2/3/4/5/6/7/8/9) [0]: "
+	ScreenDraft         = "是否自存底稿(Y/N)？[N] "
+	ScreenSent          = "順利寄出信件\r\n"
+)
+
+const ctrlX = 0x18
+
+// Config describes the accounts and the situation the fake BBS plays
+type Config struct {
+	// Users are the PTT accounts and their passwords, also the recipients
+	// mail can be sent to
+	Users map[string]string
+	// DuplicateLogin asks whether to kick the account's other connections
+	DuplicateLogin bool
+	// Boards can be entered with 's' from the main menu
+	Boards []Board
+	// Inbox holds the mails in each user's mailbox, oldest first. Mails
+	// sent through the fake are delivered to it too.
+	Inbox map[string][]Letter
+}
+
+// Mail is a mail sent through the fake BBS
+type Mail struct {
+	From    string
+	To      string
+	Subject string
+	Content string
+	// Charset is the SSH user's, UserUTF8 or UserBig5
+	Charset string
+}
+
+// Login is a login attempt
+type Login struct {
+	Username string
+	Success  bool
+	// KickOthers is the answer to the duplicate login prompt
+	KickOthers bool
+}
+
+// Server is a fake PTT BBS listening on a local port
+type Server struct {
+	cfg      Config
+	listener net.Listener
+	sshCfg   *ssh.ServerConfig
+
+	mu       sync.Mutex
+	conns    map[net.Conn]struct{}
+	mails    []Mail
+	logins   []Login
+	comments []Comment
+	posts    []Post
+	inbox    map[string][]Letter
+	wg       sync.WaitGroup
+}
+
+// Start listens on a random local port
+func Start(cfg Config) (*Server, error) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	// PTT takes any SSH password, the account logs in on the BBS screens
+	sshCfg := &ssh.ServerConfig{
+		PasswordCallback: func(ssh.ConnMetadata, []byte) (*ssh.Permissions, error) {
+			return nil, nil
+		},
+		NoClientAuth: true,
+	}
+	sshCfg.AddHostKey(signer)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{cfg: cfg, listener: l, sshCfg: sshCfg, conns: make(map[net.Conn]struct{}), inbox: make(map[string][]Letter)}
+	for username, letters := range cfg.Inbox {
+		s.inbox[username] = append([]Letter(nil), letters...)
+	}
+	s.wg.Add(1)
+	go s.serve()
+	return s, nil
+}
+
+// Addr is the host:port to dial
+func (s *Server) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// Close stops listening, drops open connections and waits for them to end
+func (s *Server) Close() error {
+	err := s.listener.Close()
+	s.mu.Lock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	return err
+}
+
+// Mails returns the mails sent so far
+func (s *Server) Mails() []Mail {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Mail(nil), s.mails...)
+}
+
+// Logins returns the login attempts so far
+func (s *Server) Logins() []Login {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Login(nil), s.logins...)
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.record(func() { s.conns[conn] = struct{}{} })
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.handleConn(conn)
+			s.record(func() { delete(s.conns, conn) })
+		}()
+	}
+}
+
+func (s *Server) handleConn(conn net.Conn) {
+	sconn, chans, reqs, err := ssh.NewServerConn(conn, s.sshCfg)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	defer sconn.Close()
+	go ssh.DiscardRequests(reqs)
+
+	for newCh := range chans {
+		if newCh.ChannelType() != "session" {
+			newCh.Reject(ssh.UnknownChannelType, "only sessions are supported")
+			continue
+		}
+		ch, chReqs, err := newCh.Accept()
+		if err != nil {
+			return
+		}
+
+		// shell is also closed when the channel ends without one, so the
+		// BBS goroutine below never waits forever
+		shell := make(chan struct{})
+		go func() {
+			started := false
+			for req := range chReqs {
+				switch {
+				case req.Type == "shell" && !started:
+					started = true
+					req.Reply(true, nil)
+					close(shell)
+				case req.Type == "pty-req", req.Type == "window-change", req.Type == "env":
+					req.Reply(true, nil)
+				default:
+					req.Reply(false, nil)
+				}
+			}
+			if !started {
+				close(shell)
+			}
+		}()
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			<-shell
+			s.runBBS(newSession(ch, sconn.User()))
+			ch.Close()
+			sconn.Close()
+		}()
+	}
+}
+
+// session is one terminal of the fake BBS
+type session struct {
+	in      *bufio.Reader
+	out     io.Writer
+	charset string
+	afterCR bool
+}
+
+func newSession(ch ssh.Channel, user string) *session {
+	sess := &session{in: bufio.NewReader(ch), out: ch, charset: UserUTF8}
+	if user == UserBig5 {
+		sess.charset = UserBig5
+		sess.out = traditionalchinese.Big5.NewEncoder().Writer(ch)
+	}
+	return sess
+}
+
+// write draws a new page, clearing the screen like PTT does
+func (sess *session) write(s string) error {
+	return sess.print("\x1b[H\x1b[2J" + s)
+}
+
+// print writes at the cursor
+func (sess *session) print(s string) error {
+	_, err := io.WriteString(sess.out, s)
+	return err
+}
+
+// readKey reads a single key press, the "\n" of a "\r\n" Enter is skipped
+func (sess *session) readKey() (byte, error) {
+	b, err := sess.in.ReadByte()
+	if err == nil && b == '\n' && sess.afterCR {
+		b, err = sess.in.ReadByte()
+	}
+	sess.afterCR = b == '\r'
+	return b, err
+}
+
+// readLine reads until Enter
+func (sess *session) readLine() (string, error) {
+	var sb strings.Builder
+	for {
+		b, err := sess.readKey()
+		if err != nil {
+			return "", err
+		}
+		if b == '\r' || b == '\n' {
+			return sess.decode(sb.String()), nil
+		}
+		sb.WriteByte(b)
+	}
+}
+
+// readUntil reads raw input until the key b, e.g. the editor until Ctrl+X
+func (sess *session) readUntil(b byte) (string, error) {
+	s, err := sess.in.ReadString(b)
+	if err != nil {
+		return "", err
+	}
+	sess.afterCR = false
+	s = strings.TrimSuffix(s, string(b))
+	s = strings.ReplaceAll(strings.ReplaceAll(s, "\r\n", "\n"), "\r", "\n")
+	return sess.decode(s), nil
+}
+
+// readMenu reads keys until Enter and returns the last letter pressed,
+// upper cased. Hot keys act at once and are returned as pressed.
+func (sess *session) readMenu(hotkeys string) (byte, error) {
+	var selected byte
+	for {
+		b, err := sess.readKey()
+		if err != nil {
+			return 0, err
+		}
+		if b == '\r' || b == '\n' {
+			return selected, nil
+		}
+		if strings.IndexByte(hotkeys, b) >= 0 {
+			return b, nil
+		}
+		if b >= 'a' && b <= 'z' {
+			b -= 'a' - 'A'
+		}
+		if b >= 'A' && b <= 'Z' {
+			selected = b
+		}
+	}
+}
+
+func (sess *session) decode(s string) string {
+	if sess.charset != UserBig5 {
+		return s
+	}
+	decoded, err := traditionalchinese.Big5.NewDecoder().String(s)
+	if err != nil {
+		return s
+	}
+	return decoded
+}
+
+var errGoodbye = errors.New("goodbye")
+
+func (s *Server) runBBS(sess *session) {
+	username, err := s.login(sess)
+	if err != nil {
+		return
+	}
+	for {
+		if err := sess.write(ScreenMainMenu); err != nil {
+			return
+		}
+		key, err := sess.readMenu("s")
+		if err != nil {
+			return
+		}
+		switch key {
+		case 's':
+			if err := s.selectBoard(sess, username); err != nil {
+				return
+			}
+		case 'M':
+			if err := s.mailMenu(sess, username); err != nil {
+				return
+			}
+		case 'G':
+			return
+		}
+	}
+}
+
+// login asks for the account until one logs in. Like PTT, the prompts and
+// errors are printed below each other on the welcome page.
+func (s *Server) login(sess *session) (string, error) {
+	if err := sess.write(ScreenWelcome); err != nil {
+		return "", err
+	}
+	for {
+		username, err := sess.readLine()
+		if err != nil {
+			return "", err
+		}
+		if err := sess.print("\r\n" + ScreenPassword); err != nil {
+			return "", err
+		}
+		password, err := sess.readLine()
+		if err != nil {
+			return "", err
+		}
+
+		want, ok := s.cfg.Users[username]
+		if !ok || want != password {
+			s.record(func() { s.logins = append(s.logins, Login{Username: username}) })
+			if err := sess.print("\r\n" + ScreenWrongPassword + ScreenLogin); err != nil {
+				return "", err
+			}
+			continue
+		}
+
+		login := Login{Username: username, Success: true}
+		if s.cfg.DuplicateLogin {
+			if err := sess.write(ScreenDuplicate); err != nil {
+				return "", err
+			}
+			answer, err := sess.readLine()
+			if err != nil {
+				return "", err
+			}
+			login.KickOthers = !strings.EqualFold(strings.TrimSpace(answer), "n")
+		}
+		s.record(func() { s.logins = append(s.logins, login) })
+
+		if err := sess.write(ScreenAnyKey); err != nil {
+			return "", err
+		}
+		if _, err := sess.readKey(); err != nil {
+			return "", err
+		}
+		return username, nil
+	}
+}
+
+func (s *Server) mailMenu(sess *session, from string) error {
+	for {
+		if err := sess.write(ScreenMailMenu); err != nil {
+			return err
+		}
+		key, err := sess.readMenu("")
+		if err != nil {
+			return err
+		}
+		switch key {
+		case 'R':
+			if err := s.mailList(sess, from); err != nil {
+				return err
+			}
+		case 'S':
+			if err := s.compose(sess, from); err != nil {
+				return err
+			}
+		case 'E':
+			return nil
+		case 'G':
+			return errGoodbye
+		}
+	}
+}
+
+func (s *Server) compose(sess *session, from string) error {
+	if err := sess.write(ScreenRecipient); err != nil {
+		return err
+	}
+	to, err := sess.readLine()
+	if err != nil {
+		return err
+	}
+	if _, ok := s.cfg.Users[to]; !ok {
+		if err := sess.write(ScreenNoUser + ScreenAnyKey); err != nil {
+			return err
+		}
+		_, err := sess.readKey()
+		return err
+	}
+
+	if err := sess.write(ScreenSubject); err != nil {
+		return err
+	}
+	subject, err := sess.readLine()
+	if err != nil {
+		return err
+	}
+
+	content, saved, err := s.edit(sess)
+	if err != nil || !saved {
+		return err
+	}
+
+	if err := sess.write(ScreenDraft); err != nil {
+		return err
+	}
+	if _, err := sess.readLine(); err != nil {
+		return err
+	}
+
+	s.record(func() {
+		s.mails = append(s.mails, Mail{From: from, To: to, Subject: subject, Content: content, Charset: sess.charset})
+		s.inbox[to] = append(s.inbox[to], Letter{From: from, Subject: subject, Date: time.Now().Format("1/02"), Content: content})
+	})
+	if err := sess.write(ScreenSent + ScreenAnyKey); err != nil {
+		return err
+	}
+	_, err = sess.readKey()
+	return err
+}
+
+// edit opens the editor until Ctrl+X, then asks to save and for the
+// signature. saved is false when the user aborts.
+func (s *Server) edit(sess *session) (content string, saved bool, err error) {
+	if err := sess.write(ScreenEditor); err != nil {
+		return "", false, err
+	}
+	content, err = sess.readUntil(ctrlX)
+	if err != nil {
+		return "", false, err
+	}
+
+	if err := sess.write(ScreenSave); err != nil {
+		return "", false, err
+	}
+	key, err := sess.readKey()
+	if err != nil {
+		return "", false, err
+	}
+	if key == 'a' || key == 'A' {
+		return "", false, nil
+	}
+
+	if err := sess.write(ScreenSignature); err != nil {
+		return "", false, err
+	}
+	if _, err := sess.readKey(); err != nil {
+		return "", false, err
+	}
+	return content, true, nil
+}
+
+func (s *Server) record(f func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f()
+}
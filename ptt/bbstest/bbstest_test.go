@@ -0,0 +1,78 @@
+package bbstest
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/text/encoding/traditionalchinese"
+)
+
+// welcomeScreen dials the server as user and returns the raw first screen
+func welcomeScreen(t *testing.T, srv *Server, user string) []byte {
+	t.Helper()
+	client, err := ssh.Dial("tcp", srv.Addr(), &ssh.ClientConfig{
+		User:            user,
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		Timeout:         5 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("ssh.Dial() error = %v", err)
+	}
+	defer client.Close()
+
+	sess, err := client.NewSession()
+	if err != nil {
+		t.Fatalf("NewSession() error = %v", err)
+	}
+	defer sess.Close()
+	stdout, err := sess.StdoutPipe()
+	if err != nil {
+		t.Fatalf("StdoutPipe() error = %v", err)
+	}
+	if err := sess.Shell(); err != nil {
+		t.Fatalf("Shell() error = %v", err)
+	}
+
+	var buf bytes.Buffer
+	chunk := make([]byte, 1024)
+	for !bytes.HasSuffix(buf.Bytes(), []byte(": ")) {
+		n, err := stdout.Read(chunk)
+		buf.Write(chunk[:n])
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Read() error = %v", err)
+		}
+	}
+	return buf.Bytes()
+}
+
+func TestServer_Charset(t *testing.T) {
+	srv, err := Start(Config{})
+	if err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	defer srv.Close()
+
+	utf8Screen := welcomeScreen(t, srv, UserUTF8)
+	if !strings.HasSuffix(string(utf8Screen), ScreenWelcome) {
+		t.Errorf("UTF-8 screen = %q, want %q", utf8Screen, ScreenWelcome)
+	}
+
+	big5Screen := welcomeScreen(t, srv, UserBig5)
+	if bytes.Contains(big5Screen, []byte("批踢踢")) {
+		t.Errorf("Big5 screen %q is UTF-8", big5Screen)
+	}
+	decoded, err := traditionalchinese.Big5.NewDecoder().Bytes(big5Screen)
+	if err != nil {
+		t.Fatalf("decode Big5 error = %v", err)
+	}
+	if !strings.HasSuffix(string(decoded), ScreenWelcome) {
+		t.Errorf("Big5 screen decoded = %q, want %q", decoded, ScreenWelcome)
+	}
+}
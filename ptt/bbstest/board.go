@@ -0,0 +1,262 @@
+package bbstest
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Ptt-Alertor/ptt-alertor/ptt/aid"
+)
+
+// Screens of boards
+const (
+	ScreenBoardPrompt     = "請輸入看板名稱(按空白鍵自動搜尋): "
+	ScreenAIDPrompt       = "搜尋文章代碼(AID): "
+	ScreenAIDNotFound     = "找不到這個文章代碼(AID)，可能是文章已消失，或是你找錯看板了"
+	ScreenPushChoice      = "您覺得這篇文章 1.值得推薦 2.給它噓聲 3.只加→註解 [1]? "
+	ScreenPushConfirm     = "確定要推文嗎? [y/N]: "
+	ScreenNoPush          = "本板禁止推薦"
+	ScreenReplyTo         = "▲ 回應至 (F)看板 (M)作者信箱 (B)二者皆是 (Q)取消？[F] "
+	ScreenReplyTitle      = "採用原標題[Y/n]? "
+	ScreenReplyQuote      = "請問要引用原文嗎(Y/N/All/Repost/1-9)?[Y] "
+	ScreenBoardEntryTitle = "進板畫面"
+)
+
+// Board is a board of the fake BBS
+type Board struct {
+	Name     string
+	Articles []Article
+	// EntryPage shows a page to press any key on before the article list
+	EntryPage bool
+	// NoPush refuses pushes like a board forbidding comments
+	NoPush bool
+}
+
+// Article is an article on a board
+type Article struct {
+	// Code is the file name, e.g. M.1498563199.A.35C
+	Code   string
+	Title  string
+	Author string
+}
+
+// Comment is a push comment left through the fake BBS
+type Comment struct {
+	Username string
+	Board    string
+	Code     string
+	// Type is 1 for 推, 2 for 噓 and 3 for →
+	Type int
+	Text string
+}
+
+// Post is a reply posted through the fake BBS
+type Post struct {
+	Username string
+	Board    string
+	// ReplyTo is the code of the article replied to
+	ReplyTo string
+	Title   string
+	Content string
+}
+
+// Comments returns the pushes so far
+func (s *Server) Comments() []Comment {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Comment(nil), s.comments...)
+}
+
+// Posts returns the replies so far
+func (s *Server) Posts() []Post {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Post(nil), s.posts...)
+}
+
+var pushMarks = map[int]string{1: "推", 2: "噓", 3: "→"}
+
+// selectBoard asks for a board and enters it, an unknown board goes back
+// to the main menu
+func (s *Server) selectBoard(sess *session, username string) error {
+	if err := sess.print("\r\n" + ScreenBoardPrompt); err != nil {
+		return err
+	}
+	name, err := sess.readLine()
+	if err != nil {
+		return err
+	}
+	for i := range s.cfg.Boards {
+		b := &s.cfg.Boards[i]
+		if !strings.EqualFold(b.Name, name) {
+			continue
+		}
+		if b.EntryPage {
+			if err := sess.write(ScreenBoardEntryTitle + "\r\n" + ScreenAnyKey); err != nil {
+				return err
+			}
+			if _, err := sess.readKey(); err != nil {
+				return err
+			}
+		}
+		return s.boardList(sess, username, b)
+	}
+	return nil
+}
+
+// boardList shows the articles with the cursor on one, until 'q'
+func (s *Server) boardList(sess *session, username string, b *Board) error {
+	cursor := len(b.Articles) - 1
+	status := ""
+	for {
+		if err := sess.write(listPage(b, cursor, status)); err != nil {
+			return err
+		}
+		status = ""
+
+		key, err := sess.readKey()
+		if err != nil {
+			return err
+		}
+		switch key {
+		case 'q':
+			return nil
+		case '#':
+			if err := sess.print("\r\n" + ScreenAIDPrompt); err != nil {
+				return err
+			}
+			id, err := sess.readLine()
+			if err != nil {
+				return err
+			}
+			code, _ := aid.ToCode(id)
+			found := false
+			for i, a := range b.Articles {
+				if a.Code == code {
+					cursor, found = i, true
+				}
+			}
+			if !found {
+				status = ScreenAIDNotFound
+			}
+		case 'X', '%':
+			if cursor < 0 {
+				continue
+			}
+			if b.NoPush {
+				status = ScreenNoPush
+				continue
+			}
+			if err := s.push(sess, username, b, b.Articles[cursor]); err != nil {
+				return err
+			}
+		case 'y':
+			if cursor < 0 {
+				continue
+			}
+			if err := s.reply(sess, username, b, b.Articles[cursor]); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func listPage(b *Board, cursor int, status string) string {
+	var sb strings.Builder
+	sb.WriteString("【板主:SYSOP】 看板《" + b.Name + "》\r\n")
+	sb.WriteString("   編號    日 期 作  者       文  章  標  題\r\n")
+	for i, a := range b.Articles {
+		mark := "  "
+		if i == cursor {
+			mark = "●"
+		}
+		sb.WriteString(fmt.Sprintf("%s%5d   6/27 %-12s □ %s\r\n", mark, i+1, a.Author, a.Title))
+	}
+	sb.WriteString(status)
+	return sb.String()
+}
+
+// push asks for the push type, unless the author pushes, the comment and
+// a confirmation
+func (s *Server) push(sess *session, username string, b *Board, a Article) error {
+	pushType := 3
+	if !strings.EqualFold(a.Author, username) {
+		if err := sess.print("\r\n" + ScreenPushChoice); err != nil {
+			return err
+		}
+		answer, err := sess.readLine()
+		if err != nil {
+			return err
+		}
+		switch strings.TrimSpace(answer) {
+		case "", "1":
+			pushType = 1
+		case "2":
+			pushType = 2
+		case "3":
+			pushType = 3
+		default:
+			return nil
+		}
+	}
+
+	if err := sess.print("\r\n" + pushMarks[pushType] + " " + username + ":"); err != nil {
+		return err
+	}
+	text, err := sess.readLine()
+	if err != nil {
+		return err
+	}
+	if err := sess.print("\r\n" + ScreenPushConfirm); err != nil {
+		return err
+	}
+	answer, err := sess.readLine()
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(strings.TrimSpace(answer), "y") {
+		return nil
+	}
+
+	s.record(func() {
+		s.comments = append(s.comments, Comment{Username: username, Board: b.Name, Code: a.Code, Type: pushType, Text: text})
+	})
+	return nil
+}
+
+// reply asks where to reply, the title and quoting, then opens the editor
+func (s *Server) reply(sess *session, username string, b *Board, a Article) error {
+	if err := sess.print("\r\n" + ScreenReplyTo); err != nil {
+		return err
+	}
+	to, err := sess.readLine()
+	if err != nil {
+		return err
+	}
+	if strings.EqualFold(strings.TrimSpace(to), "q") {
+		return nil
+	}
+
+	if err := sess.print("\r\n" + ScreenReplyTitle); err != nil {
+		return err
+	}
+	if _, err := sess.readLine(); err != nil {
+		return err
+	}
+	if err := sess.print("\r\n" + ScreenReplyQuote); err != nil {
+		return err
+	}
+	if _, err := sess.readLine(); err != nil {
+		return err
+	}
+
+	content, saved, err := s.edit(sess)
+	if err != nil || !saved {
+		return err
+	}
+
+	title := "Re: " + strings.TrimPrefix(a.Title, "Re: ")
+	s.record(func() {
+		s.posts = append(s.posts, Post{Username: username, Board: b.Name, ReplyTo: a.Code, Title: title, Content: content})
+	})
+	return nil
+}
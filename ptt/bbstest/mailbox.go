@@ -0,0 +1,133 @@
+package bbstest
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Screens of the mailbox
+const (
+	ScreenMailListTitle  = "【郵件選單】 批踢踢實業坊"
+	ScreenMailListHeader = "  編號   日 期 作 者          信  件  標  題"
+	ScreenJumpPrompt     = "跳至第幾項："
+	ScreenViewerStatus   = "瀏覽 第 %d/%d 頁 (%3d%%)  (y)回應 (←)離開"
+)
+
+// viewerRows is the rows of a page of the mail viewer without the status
+// row, PTT's 24 row screen
+const viewerRows = 23
+
+// Letter is a mail in a user's mailbox
+type Letter struct {
+	From    string
+	Subject string
+	// Date is the day shown in the list, e.g. 6/27
+	Date    string
+	Content string
+	Read    bool
+}
+
+// Inbox returns the mailbox of username, oldest first
+func (s *Server) Inbox(username string) []Letter {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Letter(nil), s.inbox[username]...)
+}
+
+// mailList lists the mailbox with the cursor on the newest mail, until 'q'
+func (s *Server) mailList(sess *session, username string) error {
+	s.mu.Lock()
+	cursor := len(s.inbox[username]) - 1
+	s.mu.Unlock()
+	for {
+		if err := sess.write(s.listLetters(username, cursor)); err != nil {
+			return err
+		}
+
+		key, err := sess.readKey()
+		if err != nil {
+			return err
+		}
+		switch {
+		case key == 'q' || key == 'e':
+			return nil
+		case key >= '1' && key <= '9':
+			if err := sess.print("\r\n" + ScreenJumpPrompt + string(key)); err != nil {
+				return err
+			}
+			rest, err := sess.readLine()
+			if err != nil {
+				return err
+			}
+			n, err := strconv.Atoi(string(key) + rest)
+			if err == nil && n >= 1 && n <= len(s.Inbox(username)) {
+				cursor = n - 1
+			}
+		case key == 'r' || key == '\r':
+			if cursor < 0 {
+				continue
+			}
+			if err := s.readLetter(sess, username, cursor); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (s *Server) listLetters(username string, cursor int) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var sb strings.Builder
+	sb.WriteString(ScreenMailListTitle + "\r\n")
+	sb.WriteString("[←]離開 [→,r]讀信 [R]回信 [x]轉寄 [d]刪除\r\n")
+	sb.WriteString(ScreenMailListHeader + "\r\n")
+	for i, l := range s.inbox[username] {
+		mark, unread := "  ", ' '
+		if i == cursor {
+			mark = "●"
+		}
+		if !l.Read {
+			unread = '+'
+		}
+		sb.WriteString(fmt.Sprintf("%s%5d %c%5s %-12s ◇ %s\r\n", mark, i+1, unread, l.Date, l.From, l.Subject))
+	}
+	return sb.String()
+}
+
+// readLetter shows the mail a page at a time, space turns the page and
+// leaving the last page or 'q' goes back to the list
+func (s *Server) readLetter(sess *session, username string, i int) error {
+	s.mu.Lock()
+	s.inbox[username][i].Read = true
+	l := s.inbox[username][i]
+	s.mu.Unlock()
+
+	lines := []string{
+		"作者  " + l.From,
+		"標題  " + l.Subject,
+		"時間  " + l.Date,
+		strings.Repeat("─", 39),
+	}
+	lines = append(lines, strings.Split(l.Content, "\n")...)
+	pages := (len(lines) + viewerRows - 1) / viewerRows
+
+	for page := 1; page <= pages; page++ {
+		end := min(page*viewerRows, len(lines))
+		status := fmt.Sprintf(ScreenViewerStatus, page, pages, end*100/len(lines))
+		text := strings.Join(lines[(page-1)*viewerRows:end], "\r\n")
+		if err := sess.write(text + "\x1b[24;1H" + status); err != nil {
+			return err
+		}
+
+		key, err := sess.readKey()
+		if err != nil {
+			return err
+		}
+		if key == 'q' {
+			return nil
+		}
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package http
+
+import (
+	"sync"
+	"time"
+
+	log "github.com/Ptt-Alertor/logrus"
+)
+
+const (
+	tooManyWindow    = 30 * time.Second
+	tooManyThreshold = 3
+	minBackoff       = 5 * time.Second
+	maxBackoff       = 5 * time.Minute
+)
+
+// backoff tracks 429 responses across every PTT request and pauses crawling
+// with an exponentially growing delay when they cluster
+type backoff struct {
+	mu       sync.Mutex
+	hits     []time.Time
+	delay    time.Duration
+	until    time.Time
+	now      func() time.Time
+	minDelay time.Duration
+	maxDelay time.Duration
+}
+
+func newBackoff() *backoff {
+	return &backoff{
+		now:      time.Now,
+		minDelay: minBackoff,
+		maxDelay: maxBackoff,
+	}
+}
+
+// tooMany records a 429 and starts or extends the backoff when enough
+// arrive within the window
+func (b *backoff) tooMany() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	hits := b.hits[:0]
+	for _, t := range b.hits {
+		if now.Sub(t) < tooManyWindow {
+			hits = append(hits, t)
+		}
+	}
+	b.hits = append(hits, now)
+	if len(b.hits) < tooManyThreshold || now.Before(b.until) {
+		return
+	}
+
+	if b.delay == 0 {
+		b.delay = b.minDelay
+	} else {
+		b.delay *= 2
+	}
+	if b.delay > b.maxDelay {
+		b.delay = b.maxDelay
+	}
+	b.until = now.Add(b.delay)
+	b.hits = b.hits[:0]
+	log.WithField("delay", b.delay.String()).Warn("PTT Too Many Requests, Back Off")
+}
+
+// success resets the delay once PTT answers normally outside a backoff
+func (b *backoff) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.delay != 0 && b.now().After(b.until) {
+		b.delay = 0
+		log.Info("PTT Backoff Reset")
+	}
+}
+
+// remaining returns how long callers should still wait
+func (b *backoff) remaining() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if d := b.until.Sub(b.now()); d > 0 {
+		return d
+	}
+	return 0
+}
@@ -0,0 +1,231 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/Ptt-Alertor/logrus"
+)
+
+const (
+	directProxy      = "direct"
+	failureThreshold = 5
+	openDuration     = 1 * time.Minute
+	healthInterval   = 30 * time.Second
+	healthCheckURL   = "https://www.ptt.cc/bbs/index.html"
+)
+
+// ErrBackoff is returned while PTT is answering with 429 and requests are paused
+var ErrBackoff = errors.New("ptt backoff in progress")
+
+// proxy is one outbound route to PTT with its own circuit breaker
+type proxy struct {
+	name      string
+	transport http.RoundTripper
+
+	successes atomic.Int64
+	errors    atomic.Int64
+
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+}
+
+// available reports whether the breaker lets requests through; after the
+// open period one trial request is allowed (half-open)
+func (p *proxy) available(now time.Time) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return now.After(p.openUntil)
+}
+
+func (p *proxy) succeed() {
+	p.successes.Add(1)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.failures = 0
+	p.openUntil = time.Time{}
+}
+
+func (p *proxy) fail(now time.Time) {
+	p.errors.Add(1)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.failures++
+	if p.failures >= failureThreshold {
+		p.openUntil = now.Add(openDuration)
+		log.WithFields(log.Fields{
+			"proxy":    p.name,
+			"failures": p.failures,
+		}).Warn("Proxy Circuit Open")
+	}
+}
+
+// ProxyStats is the exported view of a proxy's health and counters
+type ProxyStats struct {
+	Proxy     string `json:"proxy"`
+	Open      bool   `json:"open"`
+	Successes int64  `json:"successes"`
+	Errors    int64  `json:"errors"`
+}
+
+func (p *proxy) stats(now time.Time) ProxyStats {
+	return ProxyStats{
+		Proxy:     p.name,
+		Open:      !p.available(now),
+		Successes: p.successes.Load(),
+		Errors:    p.errors.Load(),
+	}
+}
+
+// Pool rotates requests over the configured proxies and falls back to a
+// direct connection when none are configured or all circuits are open
+type Pool struct {
+	proxies []*proxy
+	direct  *proxy
+	next    atomic.Uint64
+	backoff *backoff
+}
+
+// NewPool builds a pool from proxy URLs (http://, https:// or socks5://)
+func NewPool(proxyURLs []string) *Pool {
+	p := &Pool{
+		direct:  &proxy{name: directProxy},
+		backoff: newBackoff(),
+	}
+	for _, raw := range proxyURLs {
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			continue
+		}
+		u, err := url.Parse(raw)
+		if err != nil || u.Host == "" {
+			log.WithField("proxy", raw).WithError(err).Error("Invalid Proxy URL")
+			continue
+		}
+		p.proxies = append(p.proxies, &proxy{
+			name:      u.Redacted(),
+			transport: &http.Transport{Proxy: http.ProxyURL(u)},
+		})
+	}
+	return p
+}
+
+var defaultPool = NewPool(strings.Split(os.Getenv("PTT_PROXIES"), ","))
+
+func init() {
+	if len(defaultPool.proxies) > 0 {
+		log.WithField("count", len(defaultPool.proxies)).Info("PTT Proxy Pool Enabled")
+		go defaultPool.healthCheck(healthInterval)
+	}
+}
+
+// pick returns the next proxy whose circuit is closed
+func (p *Pool) pick() *proxy {
+	now := time.Now()
+	n := len(p.proxies)
+	for i := 0; i < n; i++ {
+		px := p.proxies[int(p.next.Add(1)-1)%n]
+		if px.available(now) {
+			return px
+		}
+	}
+	return p.direct
+}
+
+// Do sends req through the pool using client's settings, recording the
+// outcome on the chosen proxy and on the PTT-wide backoff
+func (p *Pool) Do(client *http.Client, req *http.Request) (*http.Response, error) {
+	if p.backoff.remaining() > 0 {
+		return nil, ErrBackoff
+	}
+
+	px := p.pick()
+	c := *client
+	if px.transport != nil {
+		c.Transport = px.transport
+	}
+
+	resp, err := c.Do(req)
+	now := time.Now()
+	switch {
+	case err != nil && resp == nil:
+		px.fail(now)
+	case resp.StatusCode == http.StatusTooManyRequests:
+		px.fail(now)
+		p.backoff.tooMany()
+	case resp.StatusCode >= http.StatusInternalServerError:
+		px.fail(now)
+	default:
+		px.succeed()
+		p.backoff.success()
+	}
+	return resp, err
+}
+
+// Stats returns counters for every route, direct first
+func (p *Pool) Stats() []ProxyStats {
+	now := time.Now()
+	stats := []ProxyStats{p.direct.stats(now)}
+	for _, px := range p.proxies {
+		stats = append(stats, px.stats(now))
+	}
+	return stats
+}
+
+// healthCheck probes proxies with open circuits so they rejoin the rotation
+// as soon as they work again
+func (p *Pool) healthCheck(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		now := time.Now()
+		for _, px := range p.proxies {
+			if px.available(now) {
+				continue
+			}
+			req, err := HttpRequest(healthCheckURL)
+			if err != nil {
+				continue
+			}
+			c := http.Client{Transport: px.transport, Timeout: 10 * time.Second}
+			resp, err := c.Do(req)
+			if err != nil {
+				continue
+			}
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusOK {
+				px.succeed()
+				log.WithField("proxy", px.name).Info("Proxy Circuit Closed")
+			}
+		}
+	}
+}
+
+// Do sends a PTT request through the default proxy pool
+func Do(client *http.Client, req *http.Request) (*http.Response, error) {
+	return defaultPool.Do(client, req)
+}
+
+// Backoff returns how long PTT requests are paused, zero when not backing off
+func Backoff() time.Duration {
+	return defaultPool.backoff.remaining()
+}
+
+// WaitBackoff blocks until the PTT-wide backoff is over
+func WaitBackoff() {
+	if d := Backoff(); d > 0 {
+		time.Sleep(d)
+	}
+}
+
+// Stats returns the default pool's per-proxy counters
+func Stats() []ProxyStats {
+	return defaultPool.Stats()
+}
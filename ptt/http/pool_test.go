@@ -0,0 +1,101 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	b := newBackoff()
+	b.now = func() time.Time { return now }
+
+	for i := 0; i < tooManyThreshold-1; i++ {
+		b.tooMany()
+	}
+	if got := b.remaining(); got != 0 {
+		t.Fatalf("remaining() = %v before threshold, want 0", got)
+	}
+
+	b.tooMany()
+	if got := b.remaining(); got != minBackoff {
+		t.Fatalf("remaining() = %v, want %v", got, minBackoff)
+	}
+
+	// another cluster after the first backoff doubles the delay
+	now = now.Add(minBackoff + time.Second)
+	for i := 0; i < tooManyThreshold; i++ {
+		b.tooMany()
+	}
+	if got := b.remaining(); got != 2*minBackoff {
+		t.Fatalf("remaining() = %v, want %v", got, 2*minBackoff)
+	}
+
+	now = now.Add(3 * minBackoff)
+	b.success()
+	if b.delay != 0 {
+		t.Errorf("delay = %v after success, want 0", b.delay)
+	}
+}
+
+func TestPool_Do(t *testing.T) {
+	status := http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	p := NewPool(nil)
+	req, _ := HttpRequest(srv.URL)
+
+	resp, err := p.Do(http.DefaultClient, req)
+	if err != nil {
+		t.Fatalf("Do() error = %v", err)
+	}
+	resp.Body.Close()
+
+	status = http.StatusTooManyRequests
+	for i := 0; i < tooManyThreshold; i++ {
+		resp, err := p.Do(http.DefaultClient, req)
+		if err != nil {
+			t.Fatalf("Do() error = %v", err)
+		}
+		resp.Body.Close()
+	}
+
+	if _, err := p.Do(http.DefaultClient, req); err != ErrBackoff {
+		t.Errorf("Do() error = %v, want ErrBackoff", err)
+	}
+
+	stats := p.Stats()
+	if len(stats) != 1 || stats[0].Proxy != directProxy {
+		t.Fatalf("Stats() = %v, want only direct", stats)
+	}
+	if stats[0].Successes != 1 || stats[0].Errors != tooManyThreshold {
+		t.Errorf("Stats() = %+v, want 1 success and %d errors", stats[0], tooManyThreshold)
+	}
+}
+
+func TestPool_pick(t *testing.T) {
+	p := NewPool([]string{"http://127.0.0.1:1", "socks5://127.0.0.1:2", "::bad"})
+	if len(p.proxies) != 2 {
+		t.Fatalf("proxies = %d, want 2", len(p.proxies))
+	}
+
+	first, second := p.pick(), p.pick()
+	if first == second {
+		t.Errorf("pick() should rotate proxies")
+	}
+
+	now := time.Now()
+	for _, px := range p.proxies {
+		for i := 0; i < failureThreshold; i++ {
+			px.fail(now)
+		}
+	}
+	if got := p.pick(); got != p.direct {
+		t.Errorf("pick() = %s with all circuits open, want direct", got.name)
+	}
+}
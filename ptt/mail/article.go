@@ -0,0 +1,271 @@
+package mail
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	log "github.com/Ptt-Alertor/logrus"
+	"github.com/Ptt-Alertor/ptt-alertor/ptt/aid"
+	"github.com/Ptt-Alertor/ptt-alertor/ptt/term"
+)
+
+// PushType is the kind of a push comment, the number PTT asks for
+type PushType int
+
+// Push types
+const (
+	PushUp    PushType = 1 // 推
+	PushDown  PushType = 2 // 噓
+	PushArrow PushType = 3 // →
+)
+
+// MaxPushWidth is the longest push comment in screen columns, where a
+// Chinese character takes two. It is kept under what PTT allows the
+// longest IDs.
+const MaxPushWidth = 40
+
+var (
+	ErrBoardNotFound   = errors.New("board not found")
+	ErrArticleNotFound = errors.New("article not found")
+	// ErrActionDenied means the board or PTT refused the push or reply,
+	// e.g. the board forbids comments or pushes come too fast
+	ErrActionDenied   = errors.New("action denied by PTT")
+	ErrInvalidComment = errors.New("invalid push comment")
+)
+
+// ValidPushType reports whether t is a push type
+func ValidPushType(t PushType) bool {
+	return t == PushUp || t == PushDown || t == PushArrow
+}
+
+// ValidateComment checks a push comment is one non-empty line that fits
+func ValidateComment(comment string) error {
+	if strings.TrimSpace(comment) == "" || strings.ContainsAny(comment, "\r\n") {
+		return ErrInvalidComment
+	}
+	width := 0
+	for _, r := range comment {
+		if r < 0x20 || r == 0x7f {
+			return ErrInvalidComment
+		}
+		width++
+		if r >= 0x80 {
+			width++
+		}
+	}
+	if width > MaxPushWidth {
+		return ErrInvalidComment
+	}
+	return nil
+}
+
+// denied matches the messages PTT shows at the bottom when it refuses
+var denied = onPrompt("禁止", "權限不足", "無法", "不能")
+
+// Push pushes a one-line comment to an article
+func (c *PTTClient) Push(board, code string, t PushType, comment string) error {
+	if !ValidPushType(t) {
+		return fmt.Errorf("%w: push type %d", ErrInvalidComment, t)
+	}
+	if err := ValidateComment(comment); err != nil {
+		return err
+	}
+	return c.run(func(ctx context.Context) error {
+		if err := c.gotoArticle(ctx, board, code); err != nil {
+			return err
+		}
+		if err := c.pushInternal(ctx, t, comment); err != nil {
+			return fmt.Errorf("push failed: %w", err)
+		}
+		log.WithFields(log.Fields{
+			"board": board,
+			"code":  code,
+		}).Info("PTT comment pushed")
+		return nil
+	})
+}
+
+// Reply posts a reply to an article on its board, titled after it
+func (c *PTTClient) Reply(board, code, content string) error {
+	return c.run(func(ctx context.Context) error {
+		if err := c.gotoArticle(ctx, board, code); err != nil {
+			return err
+		}
+		if err := c.replyInternal(ctx, content); err != nil {
+			return fmt.Errorf("reply failed: %w", err)
+		}
+		log.WithFields(log.Fields{
+			"board": board,
+			"code":  code,
+		}).Info("PTT reply posted")
+		return nil
+	})
+}
+
+// gotoArticle enters the board from the main menu and puts the cursor on
+// the article
+func (c *PTTClient) gotoArticle(ctx context.Context, board, code string) error {
+	id, err := aid.FromCode(code)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrArticleNotFound, code)
+	}
+
+	// 's' searches a board by name
+	if err := c.send("s"); err != nil {
+		return fmt.Errorf("failed to send s: %w", err)
+	}
+	if !c.waitFor(ctx, 5*time.Second, onPrompt("看板名稱", "請輸入看板")) {
+		return fmt.Errorf("%w: board prompt not shown", ErrUnexpectedScreen)
+	}
+	version := c.screen.Version()
+	if err := c.sendLine(board); err != nil {
+		return fmt.Errorf("failed to send board: %w", err)
+	}
+
+	// the board list has 《board》 on its title, some boards show an entry
+	// page first and unknown boards leave the main menu on screen
+	boardList := onTitle("《")
+	entered := false
+	for range 3 {
+		if !c.waitRedraw(ctx, 5*time.Second, version) {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+		version = c.screen.Version()
+		if boardList(c.screen) {
+			entered = true
+			break
+		}
+		if onPrompt("按任意鍵")(c.screen) {
+			c.send(" ")
+			continue
+		}
+		if mainMenu(c.screen) {
+			return fmt.Errorf("%w: %s", ErrBoardNotFound, board)
+		}
+	}
+	if !entered {
+		return fmt.Errorf("%w: board list not shown", ErrUnexpectedScreen)
+	}
+
+	// '#' searches the board for an AID
+	if err := c.send("#"); err != nil {
+		return fmt.Errorf("failed to send #: %w", err)
+	}
+	if !c.waitFor(ctx, 5*time.Second, onPrompt("文章代碼", "AID")) {
+		return fmt.Errorf("%w: AID prompt not shown", ErrUnexpectedScreen)
+	}
+	version = c.screen.Version()
+	if err := c.sendLine(strings.TrimPrefix(id, "#")); err != nil {
+		return fmt.Errorf("failed to send AID: %w", err)
+	}
+	if !c.waitRedraw(ctx, 5*time.Second, version) {
+		return fmt.Errorf("%w: board list not redrawn", ErrUnexpectedScreen)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if onScreen("找不到這個文章代碼")(c.screen) {
+		return fmt.Errorf("%w: %s", ErrArticleNotFound, code)
+	}
+	return nil
+}
+
+// pushInternal pushes a comment to the article under the cursor
+func (c *PTTClient) pushInternal(ctx context.Context, t PushType, comment string) error {
+	if err := c.send("X"); err != nil {
+		return fmt.Errorf("failed to send X: %w", err)
+	}
+
+	// PTT skips the choice when the author comments on their own article
+	choice := onPrompt("值得推薦", "給它噓聲", "註解")
+	input := c.onCommentInput()
+	if !c.waitFor(ctx, 5*time.Second, either(choice, input, denied)) {
+		return fmt.Errorf("%w: push prompt not shown", ErrUnexpectedScreen)
+	}
+	if denied(c.screen) {
+		return fmt.Errorf("%w: %s", ErrActionDenied, c.screen.CursorRow())
+	}
+	if choice(c.screen) {
+		if err := c.sendLine(fmt.Sprint(int(t))); err != nil {
+			return fmt.Errorf("failed to send push type: %w", err)
+		}
+		if !c.waitFor(ctx, 5*time.Second, either(input, denied)) {
+			return fmt.Errorf("%w: comment prompt not shown", ErrUnexpectedScreen)
+		}
+		if denied(c.screen) {
+			return fmt.Errorf("%w: %s", ErrActionDenied, c.screen.CursorRow())
+		}
+	}
+
+	if err := c.sendLine(comment); err != nil {
+		return fmt.Errorf("failed to send comment: %w", err)
+	}
+	if !c.waitFor(ctx, 5*time.Second, either(onPrompt("確定"), denied)) {
+		return fmt.Errorf("%w: confirm prompt not shown", ErrUnexpectedScreen)
+	}
+	if denied(c.screen) {
+		return fmt.Errorf("%w: %s", ErrActionDenied, c.screen.CursorRow())
+	}
+
+	version := c.screen.Version()
+	if err := c.sendLine("y"); err != nil {
+		return fmt.Errorf("failed to confirm: %w", err)
+	}
+	c.waitRedraw(ctx, 5*time.Second, version)
+	time.Sleep(100 * time.Millisecond)
+	if denied(c.screen) {
+		return fmt.Errorf("%w: %s", ErrActionDenied, c.screen.CursorRow())
+	}
+	return nil
+}
+
+// onCommentInput matches the push input line, which starts with the
+// pusher's ID, e.g. "推 username:"
+func (c *PTTClient) onCommentInput() screenMatch {
+	id := strings.ToLower(c.username) + ":"
+	return func(scr *term.Screen) bool {
+		return strings.Contains(strings.ToLower(scr.CursorRow()), id)
+	}
+}
+
+// replyInternal replies to the article under the cursor on the board
+func (c *PTTClient) replyInternal(ctx context.Context, content string) error {
+	if err := c.send("y"); err != nil {
+		return fmt.Errorf("failed to send y: %w", err)
+	}
+
+	// PTT refuses on the bottom row when the board takes no replies
+	to := onPrompt("回應至")
+	if !c.waitFor(ctx, 5*time.Second, either(to, onPrompt("原標題"), denied)) {
+		return fmt.Errorf("%w: reply prompt not shown", ErrUnexpectedScreen)
+	}
+	if denied(c.screen) {
+		return fmt.Errorf("%w: %s", ErrActionDenied, c.screen.CursorRow())
+	}
+	if to(c.screen) {
+		// F replies on the board only
+		if err := c.sendLine("F"); err != nil {
+			return fmt.Errorf("failed to send F: %w", err)
+		}
+	}
+
+	if c.waitFor(ctx, 5*time.Second, onPrompt("原標題")) {
+		if err := c.sendLine("y"); err != nil {
+			return fmt.Errorf("failed to keep title: %w", err)
+		}
+	}
+	if c.waitFor(ctx, 5*time.Second, onPrompt("引用")) {
+		if err := c.sendLine("n"); err != nil {
+			return fmt.Errorf("failed to skip quote: %w", err)
+		}
+	}
+
+	if err := c.writeInEditor(ctx, content); err != nil {
+		return err
+	}
+
+	c.waitFor(ctx, 5*time.Second, either(onTitle("《"), onPrompt("按任意鍵")))
+	return nil
+}
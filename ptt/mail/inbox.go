@@ -0,0 +1,206 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/Ptt-Alertor/logrus"
+)
+
+// maxViewerPages bounds the pages read of one mail
+const maxViewerPages = 20
+
+// InboxMail is a mail read from the mailbox
+type InboxMail struct {
+	// Index is the mail's number in the mailbox list
+	Index   int
+	Author  string
+	Date    string
+	Subject string
+	Content string
+}
+
+// Inbox is the outcome of a mailbox check
+type Inbox struct {
+	Mails []*InboxMail
+	// LastIndex is the index to check after next time
+	LastIndex int
+}
+
+// mailEntry is a row of the mailbox list
+type mailEntry struct {
+	index   int
+	unread  bool
+	date    string
+	author  string
+	subject string
+}
+
+// mailRowRegexp matches a mailbox row, e.g. "●    3 + 6/27 seller ◇ Re: 詢問",
+// where + marks an unread mail
+var mailRowRegexp = regexp.MustCompile(`^[\s●>]*(\d+)\s(.)\s*(\d{1,2}/\d{1,2})\s+(\S+)\s+(.*)$`)
+
+// parseMailList reads the mailbox rows on screen
+func parseMailList(rows []string) []mailEntry {
+	var entries []mailEntry
+	for _, row := range rows {
+		m := mailRowRegexp.FindStringSubmatch(row)
+		if m == nil {
+			continue
+		}
+		index, _ := strconv.Atoi(m[1])
+		subject := strings.TrimSpace(m[5])
+		for _, prefix := range []string{"◇", "□", "R:"} {
+			subject = strings.TrimSpace(strings.TrimPrefix(subject, prefix))
+		}
+		entries = append(entries, mailEntry{
+			index:   index,
+			unread:  m[2] == "+",
+			date:    m[3],
+			author:  m[4],
+			subject: subject,
+		})
+	}
+	return entries
+}
+
+// mailList matches the column header of the mailbox list, the mail menu
+// has the same title
+var mailList = onScreen("信  件  標  題", "信件標題")
+
+// Inbox reads at most limit (0 for all) unread mails numbered after after,
+// oldest first. A negative after only finds the last index, so mails
+// already in the mailbox are not read. Only the page of the newest mails is
+// checked, and reading a mail marks it read on PTT.
+func (c *PTTClient) Inbox(after, limit int) (*Inbox, error) {
+	var inbox *Inbox
+	err := c.run(func(ctx context.Context) error {
+		var err error
+		if inbox, err = c.inboxInternal(ctx, after, limit); err != nil {
+			return fmt.Errorf("read inbox failed: %w", err)
+		}
+		return nil
+	})
+	return inbox, err
+}
+
+func (c *PTTClient) inboxInternal(ctx context.Context, after, limit int) (*Inbox, error) {
+	if err := c.enterMailMenu(ctx); err != nil {
+		return nil, err
+	}
+	// 'R' + Enter for the mailbox
+	if err := c.selectMenu(ctx, "R", mailList); err != nil {
+		return nil, err
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	entries := parseMailList(c.screen.Rows())
+	last := 0
+	for _, e := range entries {
+		last = e.index
+	}
+	inbox := &Inbox{LastIndex: last}
+	if after < 0 {
+		return inbox, nil
+	}
+	// mails were deleted and the rest renumbered, the unread marks keep
+	// mails read before from coming again
+	if last < after {
+		after = 0
+	}
+
+	for _, e := range entries {
+		if e.index <= after || !e.unread {
+			continue
+		}
+		if limit > 0 && len(inbox.Mails) == limit {
+			// the rest waits for the next check
+			inbox.LastIndex = inbox.Mails[len(inbox.Mails)-1].Index
+			break
+		}
+		content, err := c.readMail(ctx, e.index)
+		if err != nil {
+			return nil, fmt.Errorf("read mail %d: %w", e.index, err)
+		}
+		inbox.Mails = append(inbox.Mails, &InboxMail{
+			Index:   e.index,
+			Author:  e.author,
+			Date:    e.date,
+			Subject: e.subject,
+			Content: content,
+		})
+	}
+
+	log.WithFields(log.Fields{
+		"mails":      len(inbox.Mails),
+		"last_index": inbox.LastIndex,
+	}).Info("PTT inbox checked")
+	return inbox, nil
+}
+
+// readMail opens the mail numbered index from the mailbox list, reads it
+// to the end and goes back to the list
+func (c *PTTClient) readMail(ctx context.Context, index int) (string, error) {
+	// typing the number jumps to the mail
+	if err := c.sendLine(strconv.Itoa(index)); err != nil {
+		return "", fmt.Errorf("failed to jump to mail: %w", err)
+	}
+	time.Sleep(200 * time.Millisecond)
+	if err := c.send("r"); err != nil {
+		return "", fmt.Errorf("failed to send r: %w", err)
+	}
+
+	viewer := onPrompt("瀏覽")
+	var lines []string
+	for page := 1; ; page++ {
+		if !c.waitFor(ctx, 5*time.Second, viewer) {
+			return "", fmt.Errorf("%w: mail viewer not shown", ErrUnexpectedScreen)
+		}
+		time.Sleep(100 * time.Millisecond)
+
+		rows := c.screen.Rows()
+		status := c.screen.CursorRow()
+		row, _ := c.screen.Cursor()
+		content := rows[:row]
+		if page == 1 {
+			content = skipMailHeader(content)
+		}
+		lines = append(lines, content...)
+
+		if strings.Contains(status, "100%") || page == maxViewerPages {
+			break
+		}
+		version := c.screen.Version()
+		if err := c.send(" "); err != nil {
+			return "", fmt.Errorf("failed to turn page: %w", err)
+		}
+		if !c.waitRedraw(ctx, 5*time.Second, version) {
+			return "", fmt.Errorf("%w: next page not shown", ErrUnexpectedScreen)
+		}
+	}
+
+	if err := c.send("q"); err != nil {
+		return "", fmt.Errorf("failed to send q: %w", err)
+	}
+	if !c.waitFor(ctx, 5*time.Second, either(mailList, onPrompt("按任意鍵"))) {
+		return "", fmt.Errorf("%w: mailbox not shown", ErrUnexpectedScreen)
+	}
+	return strings.Trim(strings.Join(lines, "\n"), "\n"), nil
+}
+
+// skipMailHeader drops the 作者, 標題 and 時間 rows and the line below them
+func skipMailHeader(rows []string) []string {
+	for i, row := range rows {
+		row = strings.TrimSpace(row)
+		if strings.HasPrefix(row, "作者") || strings.HasPrefix(row, "標題") ||
+			strings.HasPrefix(row, "時間") || strings.HasPrefix(row, "─") {
+			continue
+		}
+		return rows[i:]
+	}
+	return nil
+}
@@ -1,17 +1,17 @@
+// Package mail drives PTT over SSH with a bound account: it sends and reads
+// mails, pushes comments and replies to articles.
 package mail
 
 import (
-	"bufio"
-	"bytes"
 	"context"
 	"errors"
 	"fmt"
 	"io"
 	"strings"
-	"sync"
 	"time"
 
 	log "github.com/Ptt-Alertor/logrus"
+	"github.com/Ptt-Alertor/ptt-alertor/ptt/term"
 	"golang.org/x/crypto/ssh"
 )
 
@@ -19,6 +19,8 @@ const (
 	pttHost        = "ptt.cc:22"
 	pttSSHUser     = "bbsu"
 	connectTimeout = 15 * time.Second
+	ptyRows        = 40
+	ptyCols        = 120
 )
 
 var (
@@ -26,24 +28,29 @@ var (
 	ErrSendMailFailed = errors.New("failed to send PTT mail")
 	ErrTimeout        = errors.New("operation timeout")
 	ErrUserNotFound   = errors.New("recipient user not found")
+	// ErrUnexpectedScreen means PTT showed a screen the client does not
+	// know, usually after PTT changed a prompt
+	ErrUnexpectedScreen = errors.New("unexpected PTT screen")
 )
 
 // PTTClient represents a PTT SSH client
 type PTTClient struct {
-	username   string
-	password   string
-	client     *ssh.Client
-	session    *ssh.Session
-	stdin      io.WriteCloser
-	stdout     io.Reader
-	screenBuf  bytes.Buffer
-	screenLock sync.Mutex
-	stopRead   chan struct{}
+	// addr is the SSH host:port, tests point it at a fake BBS
+	addr     string
+	username string
+	password string
+	client   *ssh.Client
+	session  *ssh.Session
+	stdin    io.WriteCloser
+	stdout   io.Reader
+	screen   *term.Screen
+	stopRead chan struct{}
 }
 
 // NewPTTClient creates a new PTT client
 func NewPTTClient(username, password string) *PTTClient {
 	return &PTTClient{
+		addr:     pttHost,
 		username: username,
 		password: password,
 	}
@@ -51,6 +58,16 @@ func NewPTTClient(username, password string) *PTTClient {
 
 // SendMail sends a mail to a recipient on PTT
 func (c *PTTClient) SendMail(recipient, subject, content string) error {
+	return c.run(func(ctx context.Context) error {
+		if err := c.sendMailInternal(ctx, recipient, subject, content); err != nil {
+			return fmt.Errorf("send mail failed: %w", err)
+		}
+		return nil
+	})
+}
+
+// run logs in, does the action from the main menu and logs out
+func (c *PTTClient) run(action func(ctx context.Context) error) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 90*time.Second)
 	defer cancel()
 
@@ -65,12 +82,7 @@ func (c *PTTClient) SendMail(recipient, subject, content string) error {
 		return fmt.Errorf("login failed: %w", err)
 	}
 
-	// Send mail
-	if err := c.sendMailInternal(ctx, recipient, subject, content); err != nil {
-		return fmt.Errorf("send mail failed: %w", err)
-	}
-
-	return nil
+	return action(ctx)
 }
 
 // connect establishes SSH connection to PTT
@@ -84,7 +96,7 @@ func (c *PTTClient) connect(_ context.Context) error {
 		Timeout:         connectTimeout,
 	}
 
-	client, err := ssh.Dial("tcp", pttHost, cfg)
+	client, err := ssh.Dial("tcp", c.addr, cfg)
 	if err != nil {
 		return fmt.Errorf("ssh dial failed: %w", err)
 	}
@@ -103,7 +115,7 @@ func (c *PTTClient) connect(_ context.Context) error {
 		ssh.TTY_OP_ISPEED: 14400,
 		ssh.TTY_OP_OSPEED: 14400,
 	}
-	if err := sess.RequestPty("xterm", 40, 120, modes); err != nil {
+	if err := sess.RequestPty("xterm", ptyRows, ptyCols, modes); err != nil {
 		sess.Close()
 		client.Close()
 		return fmt.Errorf("request pty failed: %w", err)
@@ -132,15 +144,15 @@ func (c *PTTClient) connect(_ context.Context) error {
 	}
 
 	// Start background reader
+	c.screen = term.NewScreen(ptyRows, ptyCols, term.UTF8)
 	c.stopRead = make(chan struct{})
 	go c.readLoop()
 
 	return nil
 }
 
-// readLoop continuously reads from stdout and accumulates in buffer
+// readLoop continuously draws stdout on the screen
 func (c *PTTClient) readLoop() {
-	reader := bufio.NewReader(c.stdout)
 	buf := make([]byte, 4096)
 
 	for {
@@ -150,17 +162,9 @@ func (c *PTTClient) readLoop() {
 		default:
 		}
 
-		n, err := reader.Read(buf)
+		n, err := c.stdout.Read(buf)
 		if n > 0 {
-			c.screenLock.Lock()
-			c.screenBuf.Write(buf[:n])
-			// Prevent unbounded growth
-			if c.screenBuf.Len() > 50000 {
-				tmp := c.screenBuf.Bytes()
-				c.screenBuf.Reset()
-				c.screenBuf.Write(tmp[len(tmp)-20000:])
-			}
-			c.screenLock.Unlock()
+			c.screen.Write(buf[:n])
 		}
 		if err != nil {
 			return
@@ -204,46 +208,67 @@ func (c *PTTClient) sendByte(b byte) error {
 	return err
 }
 
-// getScreen returns current screen content as UTF-8 string
-func (c *PTTClient) getScreen() string {
-	c.screenLock.Lock()
-	defer c.screenLock.Unlock()
+// screenMatch tells whether the screen shows what a step waits for
+type screenMatch func(scr *term.Screen) bool
 
-	if c.screenBuf.Len() == 0 {
-		return ""
+// onScreen matches any of texts anywhere on the screen, for messages
+func onScreen(texts ...string) screenMatch {
+	return func(scr *term.Screen) bool {
+		for _, text := range texts {
+			if scr.Contains(text) {
+				return true
+			}
+		}
+		return false
 	}
-	return c.screenBuf.String()
 }
 
-// clearScreen clears the screen buffer
-func (c *PTTClient) clearScreen() {
-	c.screenLock.Lock()
-	defer c.screenLock.Unlock()
-	c.screenBuf.Reset()
+// onPrompt matches any of texts on the cursor row, where PTT asks for input
+func onPrompt(texts ...string) screenMatch {
+	return func(scr *term.Screen) bool {
+		row := scr.CursorRow()
+		for _, text := range texts {
+			if strings.Contains(row, text) {
+				return true
+			}
+		}
+		return false
+	}
 }
 
-// stripANSI removes ANSI escape codes from string for easier text matching
-func stripANSI(s string) string {
-	result := make([]byte, 0, len(s))
-	inEscape := false
-	for i := 0; i < len(s); i++ {
-		if s[i] == 0x1b {
-			inEscape = true
-			continue
+// onTitle matches any of texts on the first row, where PTT puts the menu
+// name
+func onTitle(texts ...string) screenMatch {
+	return func(scr *term.Screen) bool {
+		row := scr.Row(0)
+		for _, text := range texts {
+			if strings.Contains(row, text) {
+				return true
+			}
 		}
-		if inEscape {
-			if (s[i] >= 'A' && s[i] <= 'Z') || (s[i] >= 'a' && s[i] <= 'z') {
-				inEscape = false
+		return false
+	}
+}
+
+// either matches when any of ms does
+func either(ms ...screenMatch) screenMatch {
+	return func(scr *term.Screen) bool {
+		for _, m := range ms {
+			if m(scr) {
+				return true
 			}
-			continue
 		}
-		result = append(result, s[i])
+		return false
 	}
-	return string(result)
 }
 
-// waitFor waits for any of the specified texts to appear on screen
-func (c *PTTClient) waitFor(ctx context.Context, timeout time.Duration, texts ...string) (string, bool) {
+var (
+	mainMenu    = onTitle("主功能表", "主選單")
+	loginFailed = onScreen("密碼不對", "密碼錯誤")
+)
+
+// waitFor waits until the screen matches
+func (c *PTTClient) waitFor(ctx context.Context, timeout time.Duration, match screenMatch) bool {
 	deadline := time.Now().Add(timeout)
 	ticker := time.NewTicker(150 * time.Millisecond)
 	defer ticker.Stop()
@@ -251,194 +276,186 @@ func (c *PTTClient) waitFor(ctx context.Context, timeout time.Duration, texts ..
 	for time.Now().Before(deadline) {
 		select {
 		case <-ctx.Done():
-			return c.getScreen(), false
+			return false
 		case <-ticker.C:
-			screen := c.getScreen()
-			strippedScreen := stripANSI(screen)
-			for _, text := range texts {
-				if text != "" {
-					if strings.Contains(screen, text) || strings.Contains(strippedScreen, text) {
-						return screen, true
-					}
-				}
+			if match(c.screen) {
+				return true
 			}
 		}
 	}
-	return c.getScreen(), false
+	return false
+}
+
+// waitRedraw waits until the screen changes after version, so a step does
+// not act twice on the same screen
+func (c *PTTClient) waitRedraw(ctx context.Context, timeout time.Duration, version uint64) bool {
+	return c.waitFor(ctx, timeout, func(scr *term.Screen) bool {
+		return scr.Version() != version
+	})
 }
 
 // login performs PTT login
 func (c *PTTClient) login(ctx context.Context) error {
 	// Wait for PTT welcome screen
-	screen, found := c.waitFor(ctx, 10*time.Second, "請輸入代號", "代號", "PTT", "批踢踢")
-
-	if !found && screen == "" {
-		return errors.New("no response from PTT server")
+	if !c.waitFor(ctx, 10*time.Second, either(onPrompt("請輸入代號"), onScreen("批踢踢"))) {
+		if c.screen.Version() == 0 {
+			return errors.New("no response from PTT server")
+		}
+		return fmt.Errorf("%w: login prompt not shown", ErrUnexpectedScreen)
 	}
 
-	c.clearScreen()
-
 	// Send username
 	if err := c.sendLine(c.username); err != nil {
 		return err
 	}
 
 	// Wait for password prompt
-	c.waitFor(ctx, 5*time.Second, "請輸入您的密碼", "密碼")
+	c.waitFor(ctx, 5*time.Second, onPrompt("請輸入您的密碼", "密碼"))
 
 	// Send password
-	c.clearScreen()
+	version := c.screen.Version()
 	if err := c.sendLine(c.password); err != nil {
 		return err
 	}
 
-	// Handle post-login screens
+	// Handle post-login screens, each once it is drawn
 	for range 25 {
-		time.Sleep(400 * time.Millisecond)
-		screen = c.getScreen()
-		strippedScreen := stripANSI(screen)
-
-		// Check for login failure
-		if strings.Contains(strippedScreen, "密碼不對") || (strings.Contains(strippedScreen, "錯誤") && strings.Contains(strippedScreen, "密碼")) {
-			return ErrLoginFailed
+		if !c.waitRedraw(ctx, 400*time.Millisecond, version) {
+			continue
 		}
+		// let the rest of the page arrive
+		time.Sleep(100 * time.Millisecond)
+		version = c.screen.Version()
 
-		// Check if we reached main menu
-		if strings.Contains(strippedScreen, "主功能表") || strings.Contains(strippedScreen, "【主選單】") ||
-			strings.Contains(strippedScreen, "主選單") {
+		switch {
+		case loginFailed(c.screen):
+			return ErrLoginFailed
+		case mainMenu(c.screen):
 			return nil
-		}
-
-		// Handle duplicate login
-		if strings.Contains(strippedScreen, "您想刪除其他重複登入") || strings.Contains(strippedScreen, "重複登入") {
-			c.clearScreen()
+		case onPrompt("重複登入")(c.screen):
 			c.sendLine("n")
-			continue
-		}
-
-		// Press any key to continue
-		if strings.Contains(strippedScreen, "請按任意鍵繼續") || strings.Contains(strippedScreen, "按任意鍵") {
-			c.clearScreen()
-			c.send("\r")
-			continue
-		}
-
-		// Handle error attempts deletion prompt
-		if strings.Contains(strippedScreen, "您要刪除以上錯誤嘗試") {
-			c.clearScreen()
+		case onPrompt("您要刪除以上錯誤嘗試")(c.screen):
 			c.sendLine("y")
-			continue
+		case onPrompt("按任意鍵")(c.screen):
+			c.send("\r")
 		}
 	}
 
-	// Check final state
-	screen = c.getScreen()
-	if strings.Contains(screen, "主功能表") || strings.Contains(screen, "【主選單】") {
+	if mainMenu(c.screen) {
 		return nil
 	}
-
-	return nil
+	return fmt.Errorf("%w: main menu not reached", ErrUnexpectedScreen)
 }
 
-// sendMailInternal sends mail after login
-func (c *PTTClient) sendMailInternal(ctx context.Context, recipient, subject, content string) error {
-	c.clearScreen()
-
-	// Step 1: Press 'M' + Enter for Mail menu
-	if err := c.send("M"); err != nil {
-		return fmt.Errorf("failed to send M: %w", err)
+// selectMenu presses key and Enter, then waits for the menu titled title
+func (c *PTTClient) selectMenu(ctx context.Context, key string, title screenMatch) error {
+	if err := c.send(key); err != nil {
+		return fmt.Errorf("failed to send %s: %w", key, err)
 	}
 	time.Sleep(200 * time.Millisecond)
 	if err := c.send("\r"); err != nil {
-		return fmt.Errorf("failed to send Enter after M: %w", err)
+		return fmt.Errorf("failed to send Enter after %s: %w", key, err)
 	}
-
-	_, found := c.waitFor(ctx, 5*time.Second, "郵件選單", "我的信箱", "電子郵件", "站內寄信", "寄發新信")
-
-	if !found {
-		c.clearScreen()
-		c.send("M")
-		time.Sleep(200 * time.Millisecond)
-		c.send("\r")
-		c.waitFor(ctx, 5*time.Second, "郵件選單", "我的信箱", "電子郵件")
+	if !c.waitFor(ctx, 5*time.Second, title) {
+		return fmt.Errorf("%w: menu %s not shown", ErrUnexpectedScreen, key)
 	}
+	return nil
+}
 
-	// Step 2: Press 'S' + Enter for Send mail
-	c.clearScreen()
-	if err := c.send("S"); err != nil {
-		return fmt.Errorf("failed to send S: %w", err)
+// enterMailMenu presses 'M' + Enter for the mail menu, once more if the
+// first key is lost
+func (c *PTTClient) enterMailMenu(ctx context.Context) error {
+	mailMenu := onTitle("郵件選單", "電子郵件")
+	if err := c.selectMenu(ctx, "M", mailMenu); err != nil {
+		return c.selectMenu(ctx, "M", mailMenu)
 	}
-	time.Sleep(200 * time.Millisecond)
-	if err := c.send("\r"); err != nil {
-		return fmt.Errorf("failed to send Enter after S: %w", err)
+	return nil
+}
+
+// sendMailInternal sends mail after login
+func (c *PTTClient) sendMailInternal(ctx context.Context, recipient, subject, content string) error {
+	// Step 1: Mail menu
+	if err := c.enterMailMenu(ctx); err != nil {
+		return err
 	}
 
-	c.waitFor(ctx, 5*time.Second, "收信人", "收件人", "站內寄信", "請輸入收件人")
+	// Step 2: 'S' + Enter for Send mail
+	if err := c.selectMenu(ctx, "S", onPrompt("收信人", "收件人", "請輸入收件人")); err != nil {
+		return err
+	}
 
 	// Step 3: Enter recipient
-	c.clearScreen()
 	if err := c.sendLine(recipient); err != nil {
 		return fmt.Errorf("failed to send recipient: %w", err)
 	}
 
-	screen, _ := c.waitFor(ctx, 5*time.Second, "標題", "主旨", "主題", "Subject", "無此帳號", "找不到")
-	stripped := stripANSI(screen)
-
-	if strings.Contains(stripped, "無此帳號") || strings.Contains(stripped, "找不到") {
+	notFound := onScreen("無此帳號", "找不到")
+	if !c.waitFor(ctx, 5*time.Second, either(onPrompt("標題", "主旨", "主題", "Subject"), notFound)) {
+		return fmt.Errorf("%w: subject prompt not shown", ErrUnexpectedScreen)
+	}
+	if notFound(c.screen) {
 		return ErrUserNotFound
 	}
 
 	// Step 4: Enter subject
-	c.clearScreen()
 	if err := c.sendLine(subject); err != nil {
 		return fmt.Errorf("failed to send subject: %w", err)
 	}
 
-	c.waitFor(ctx, 3*time.Second, "編輯", "Ctrl", "內文")
+	// Step 5: Write and save the content
+	if err := c.writeInEditor(ctx, content); err != nil {
+		return err
+	}
+
+	// Step 6: Press 'n' + Enter to not save draft
+	if c.waitFor(ctx, 3*time.Second, onPrompt("存底", "底稿")) {
+		if err := c.sendLine("n"); err != nil {
+			return fmt.Errorf("failed to send n: %w", err)
+		}
+	}
+
+	c.waitFor(ctx, 3*time.Second, onScreen("順利寄出", "按任意鍵"))
+
+	log.WithFields(log.Fields{
+		"recipient": recipient,
+		"subject":   subject,
+	}).Info("PTT mail sent")
+
+	return nil
+}
+
+// writeInEditor types content in PTT's editor once it opens, then saves it
+// without a signature
+func (c *PTTClient) writeInEditor(ctx context.Context, content string) error {
+	if !c.waitFor(ctx, 3*time.Second, onScreen("編輯文章", "Ctrl")) {
+		return fmt.Errorf("%w: editor not shown", ErrUnexpectedScreen)
+	}
 
-	// Step 5: Enter content
-	c.clearScreen()
 	if err := c.send(content); err != nil {
 		return fmt.Errorf("failed to send content: %w", err)
 	}
 	time.Sleep(500 * time.Millisecond)
 
-	// Step 6: Press Ctrl+X to finish editing
+	// Ctrl+X finishes editing
 	if err := c.sendByte(0x18); err != nil {
 		return fmt.Errorf("failed to send Ctrl+X: %w", err)
 	}
 
-	c.waitFor(ctx, 3*time.Second, "檔案處理", "存檔", "儲存", "(S)")
+	if !c.waitFor(ctx, 3*time.Second, onPrompt("檔案處理", "存檔")) {
+		return fmt.Errorf("%w: save prompt not shown", ErrUnexpectedScreen)
+	}
 
-	// Step 7: Press Enter to save/send
-	c.clearScreen()
+	// Enter takes the default, save
 	if err := c.send("\r"); err != nil {
 		return fmt.Errorf("failed to send Enter: %w", err)
 	}
 
-	c.waitFor(ctx, 3*time.Second, "簽名檔", "選擇簽名檔")
-
-	// Step 8: Select '0' for no signature
-	c.clearScreen()
-	if err := c.send("0"); err != nil {
-		return fmt.Errorf("failed to send 0: %w", err)
-	}
-
-	c.waitFor(ctx, 3*time.Second, "存底", "底稿", "自存底稿", "是否")
-
-	// Step 9: Press 'n' + Enter to not save draft
-	c.clearScreen()
-	if err := c.sendLine("n"); err != nil {
-		return fmt.Errorf("failed to send n: %w", err)
+	// '0' for no signature, when asked
+	if c.waitFor(ctx, 3*time.Second, onPrompt("簽名檔")) {
+		if err := c.send("0"); err != nil {
+			return fmt.Errorf("failed to send 0: %w", err)
+		}
 	}
-
-	time.Sleep(500 * time.Millisecond)
-
-	log.WithFields(log.Fields{
-		"recipient": recipient,
-		"subject":   subject,
-	}).Info("PTT mail sent")
-
 	return nil
 }
 
@@ -0,0 +1,310 @@
+package mail
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/Ptt-Alertor/ptt-alertor/ptt/bbstest"
+	"github.com/Ptt-Alertor/ptt-alertor/ptt/term"
+)
+
+var bbsUsers = map[string]string{
+	"sender": "secret",
+	"seller": "whatever",
+}
+
+func startBBS(t *testing.T, cfg bbstest.Config) *bbstest.Server {
+	t.Helper()
+	srv, err := bbstest.Start(cfg)
+	if err != nil {
+		t.Fatalf("bbstest.Start() error = %v", err)
+	}
+	t.Cleanup(func() { srv.Close() })
+	return srv
+}
+
+func newTestClient(srv *bbstest.Server, username, password string) *PTTClient {
+	c := NewPTTClient(username, password)
+	c.addr = srv.Addr()
+	return c
+}
+
+func TestPTTClient_TestLogin(t *testing.T) {
+	tests := []struct {
+		name      string
+		duplicate bool
+		password  string
+		wantErr   error
+		wantLogin bbstest.Login
+	}{
+		{"ok", false, "secret", nil, bbstest.Login{Username: "sender", Success: true}},
+		{"keeps other connections", true, "secret", nil, bbstest.Login{Username: "sender", Success: true}},
+		{"wrong password", false, "wrong", ErrLoginFailed, bbstest.Login{Username: "sender"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := startBBS(t, bbstest.Config{Users: bbsUsers, DuplicateLogin: tt.duplicate})
+
+			err := newTestClient(srv, "sender", tt.password).TestLogin()
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("TestLogin() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			srv.Close()
+			logins := srv.Logins()
+			if len(logins) != 1 || logins[0] != tt.wantLogin {
+				t.Errorf("Logins() = %+v, want [%+v]", logins, tt.wantLogin)
+			}
+		})
+	}
+}
+
+func TestPTTClient_SendMail(t *testing.T) {
+	tests := []struct {
+		name      string
+		recipient string
+		wantErr   error
+		wantMails []bbstest.Mail
+	}{
+		{"ok", "seller", nil, []bbstest.Mail{{
+			From:    "sender",
+			To:      "seller",
+			Subject: "詢問 iPad",
+			Content: "您好\n請問還有嗎？",
+			Charset: bbstest.UserUTF8,
+		}}},
+		{"unknown recipient", "nobody", ErrUserNotFound, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := startBBS(t, bbstest.Config{Users: bbsUsers})
+
+			err := newTestClient(srv, "sender", "secret").SendMail(tt.recipient, "詢問 iPad", "您好\n請問還有嗎？")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("SendMail() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			srv.Close()
+			mails := srv.Mails()
+			if len(mails) != len(tt.wantMails) {
+				t.Fatalf("Mails() = %+v, want %+v", mails, tt.wantMails)
+			}
+			for i := range mails {
+				if mails[i] != tt.wantMails[i] {
+					t.Errorf("Mails()[%d] = %+v, want %+v", i, mails[i], tt.wantMails[i])
+				}
+			}
+		})
+	}
+}
+
+var bbsBoards = []bbstest.Board{
+	{Name: "MacShop", EntryPage: true, Articles: []bbstest.Article{
+		{Code: "M.1498563199.A.35C", Title: "[販售] iPad Pro 12.9", Author: "seller"},
+		{Code: "M.1498563299.A.123", Title: "[收購] MacBook Air", Author: "sender"},
+	}},
+	{Name: "Silent", NoPush: true, Articles: []bbstest.Article{
+		{Code: "M.1498563199.A.35C", Title: "[公告] 本板禁止推文", Author: "seller"},
+	}},
+}
+
+func TestPTTClient_Push(t *testing.T) {
+	tests := []struct {
+		name         string
+		board        string
+		code         string
+		pushType     PushType
+		comment      string
+		wantErr      error
+		wantComments []bbstest.Comment
+	}{
+		{"push", "macshop", "M.1498563199.A.35C", PushUp, "還有嗎？", nil, []bbstest.Comment{
+			{Username: "sender", Board: "MacShop", Code: "M.1498563199.A.35C", Type: 1, Text: "還有嗎？"},
+		}},
+		{"boo", "MacShop", "M.1498563199.A.35C", PushDown, "太貴", nil, []bbstest.Comment{
+			{Username: "sender", Board: "MacShop", Code: "M.1498563199.A.35C", Type: 2, Text: "太貴"},
+		}},
+		{"own article", "MacShop", "M.1498563299.A.123", PushUp, "已收到", nil, []bbstest.Comment{
+			{Username: "sender", Board: "MacShop", Code: "M.1498563299.A.123", Type: 3, Text: "已收到"},
+		}},
+		{"board not found", "Nowhere", "M.1498563199.A.35C", PushUp, "還有嗎？", ErrBoardNotFound, nil},
+		{"article not found", "MacShop", "M.1234567890.A.001", PushUp, "還有嗎？", ErrArticleNotFound, nil},
+		{"denied", "Silent", "M.1498563199.A.35C", PushUp, "收到", ErrActionDenied, nil},
+		{"invalid comment", "MacShop", "M.1498563199.A.35C", PushUp, "一\n二", ErrInvalidComment, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := startBBS(t, bbstest.Config{Users: bbsUsers, Boards: bbsBoards})
+
+			err := newTestClient(srv, "sender", "secret").Push(tt.board, tt.code, tt.pushType, tt.comment)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Push() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			srv.Close()
+			comments := srv.Comments()
+			if len(comments) != len(tt.wantComments) {
+				t.Fatalf("Comments() = %+v, want %+v", comments, tt.wantComments)
+			}
+			for i := range comments {
+				if comments[i] != tt.wantComments[i] {
+					t.Errorf("Comments()[%d] = %+v, want %+v", i, comments[i], tt.wantComments[i])
+				}
+			}
+		})
+	}
+}
+
+func TestPTTClient_Reply(t *testing.T) {
+	tests := []struct {
+		name      string
+		code      string
+		wantErr   error
+		wantPosts []bbstest.Post
+	}{
+		{"ok", "M.1498563199.A.35C", nil, []bbstest.Post{{
+			Username: "sender",
+			Board:    "MacShop",
+			ReplyTo:  "M.1498563199.A.35C",
+			Title:    "Re: [販售] iPad Pro 12.9",
+			Content:  "請問還有嗎？\n可以面交嗎？",
+		}}},
+		{"article not found", "M.1234567890.A.001", ErrArticleNotFound, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := startBBS(t, bbstest.Config{Users: bbsUsers, Boards: bbsBoards})
+
+			err := newTestClient(srv, "sender", "secret").Reply("MacShop", tt.code, "請問還有嗎？\n可以面交嗎？")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Reply() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			srv.Close()
+			posts := srv.Posts()
+			if len(posts) != len(tt.wantPosts) {
+				t.Fatalf("Posts() = %+v, want %+v", posts, tt.wantPosts)
+			}
+			for i := range posts {
+				if posts[i] != tt.wantPosts[i] {
+					t.Errorf("Posts()[%d] = %+v, want %+v", i, posts[i], tt.wantPosts[i])
+				}
+			}
+		})
+	}
+}
+
+func TestValidateComment(t *testing.T) {
+	tests := []struct {
+		name    string
+		comment string
+		wantErr bool
+	}{
+		{"ok", "還有嗎？", false},
+		{"empty", " ", true},
+		{"multi line", "一\n二", true},
+		{"control", "a\x1bb", true},
+		{"fits", strings.Repeat("推", MaxPushWidth/2), false},
+		{"too wide", strings.Repeat("推", MaxPushWidth/2) + "a", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateComment(tt.comment); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateComment() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_screenMatch(t *testing.T) {
+	scr := term.NewScreen(24, 80, term.UTF8)
+	// the mail menu stays on screen until the prompt's page is drawn over it
+	scr.Write([]byte("\x1b[H\x1b[2J【郵件選單】\r\n (S)end 站內寄信\x1b[24;1H收信人: "))
+
+	tests := []struct {
+		name  string
+		match screenMatch
+		want  bool
+	}{
+		{"title", onTitle("郵件選單"), true},
+		{"not the title", onTitle("站內寄信"), false},
+		{"prompt", onPrompt("收信人"), true},
+		{"not the prompt", onPrompt("站內寄信"), false},
+		{"anywhere", onScreen("站內寄信"), true},
+		{"either", either(onPrompt("主題"), onScreen("郵件選單")), true},
+		{"main menu", mainMenu, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.match(scr); got != tt.want {
+				t.Errorf("match() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPTTClient_Inbox(t *testing.T) {
+	long := strings.TrimSuffix(strings.Repeat("第一行\n", 30), "\n")
+	inbox := []bbstest.Letter{
+		{From: "seller", Subject: "舊信", Date: "6/25", Content: "已讀過", Read: true},
+		{From: "seller", Subject: "Re: 詢問 iPad", Date: "6/27", Content: "還有喔\n可以面交"},
+		{From: "buyer", Subject: "長信", Date: "6/28", Content: long},
+	}
+	tests := []struct {
+		name      string
+		after     int
+		limit     int
+		wantMails []InboxMail
+		wantLast  int
+	}{
+		{"first check", -1, 5, nil, 3},
+		{"unread", 0, 5, []InboxMail{
+			{Index: 2, Author: "seller", Date: "6/27", Subject: "Re: 詢問 iPad", Content: "還有喔\n可以面交"},
+			{Index: 3, Author: "buyer", Date: "6/28", Subject: "長信", Content: long},
+		}, 3},
+		{"after", 2, 5, []InboxMail{
+			{Index: 3, Author: "buyer", Date: "6/28", Subject: "長信", Content: long},
+		}, 3},
+		{"limit", 0, 1, []InboxMail{
+			{Index: 2, Author: "seller", Date: "6/27", Subject: "Re: 詢問 iPad", Content: "還有喔\n可以面交"},
+		}, 2},
+		{"renumbered", 9, 5, []InboxMail{
+			{Index: 2, Author: "seller", Date: "6/27", Subject: "Re: 詢問 iPad", Content: "還有喔\n可以面交"},
+			{Index: 3, Author: "buyer", Date: "6/28", Subject: "長信", Content: long},
+		}, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := startBBS(t, bbstest.Config{Users: bbsUsers, Inbox: map[string][]bbstest.Letter{"sender": inbox}})
+
+			got, err := newTestClient(srv, "sender", "secret").Inbox(tt.after, tt.limit)
+			if err != nil {
+				t.Fatalf("Inbox() error = %v", err)
+			}
+			if got.LastIndex != tt.wantLast {
+				t.Errorf("Inbox() LastIndex = %d, want %d", got.LastIndex, tt.wantLast)
+			}
+			if len(got.Mails) != len(tt.wantMails) {
+				t.Fatalf("Inbox() Mails = %+v, want %+v", got.Mails, tt.wantMails)
+			}
+			for i := range got.Mails {
+				if *got.Mails[i] != tt.wantMails[i] {
+					t.Errorf("Inbox() Mails[%d] = %+v, want %+v", i, *got.Mails[i], tt.wantMails[i])
+				}
+			}
+
+			// reading marks the mails read on PTT
+			srv.Close()
+			forwarded := make(map[int]bool)
+			for _, m := range tt.wantMails {
+				forwarded[m.Index] = true
+			}
+			for i, l := range srv.Inbox("sender") {
+				if want := inbox[i].Read || forwarded[i+1]; l.Read != want {
+					t.Errorf("Inbox(sender)[%d].Read = %v, want %v", i, l.Read, want)
+				}
+			}
+		})
+	}
+}
@@ -29,6 +29,9 @@ func CheckBoardExist(board string) bool {
 func BuildArticles(board string) (articles article.Articles, err error) {
 	feed, err := parseURL("https://www.ptt.cc/atom/" + board + ".xml")
 	if err != nil {
+		if err == pttHttp.ErrBackoff {
+			return nil, ErrTooManyRequests
+		}
 		if herr, ok := err.(gofeed.HTTPError); ok && herr.StatusCode == http.StatusTooManyRequests {
 			return nil, ErrTooManyRequests
 		}
@@ -69,7 +72,7 @@ func parseURL(feedURL string) (feed *gofeed.Feed, err error) {
 	if err != nil {
 		return nil, err
 	}
-	resp, err := client.Do(req)
+	resp, err := pttHttp.Do(&client, req)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,414 @@
+// Package term keeps the screen of a VT100 terminal, the way PTT draws it,
+// so clients read what is on screen now instead of every byte received.
+//
+// It handles cursor addressing and movement, erasing, scrolling and line
+// wrapping; colors and other modes are parsed and ignored. PTT lays pages
+// out in Big5, where every non-ASCII character takes two columns, and the
+// screen counts them the same way in UTF-8.
+package term
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/traditionalchinese"
+)
+
+// Charset is the encoding of the bytes written to a Screen
+type Charset int
+
+// Charsets of PTT connections, bbsu logins get UTF-8 and bbs ones Big5
+const (
+	UTF8 Charset = iota
+	Big5
+)
+
+// continuation marks the right half of a two-column character
+const continuation = -1
+
+type parseState int
+
+const (
+	stateGround parseState = iota
+	stateEscape
+	stateCSI
+)
+
+// Screen is a terminal screen. It is safe for concurrent use, one
+// goroutine writing the connection's output while others read rows.
+type Screen struct {
+	mu      sync.Mutex
+	rows    int
+	cols    int
+	charset Charset
+	cells   [][]rune
+
+	row, col           int
+	savedRow, savedCol int
+	wrapPending        bool
+	state              parseState
+	params             []byte
+	pending            []byte
+	version            uint64
+}
+
+// NewScreen creates a blank rows x cols screen, e.g. 24x80
+func NewScreen(rows, cols int, charset Charset) *Screen {
+	s := &Screen{rows: rows, cols: cols, charset: charset}
+	s.cells = make([][]rune, rows)
+	for i := range s.cells {
+		s.cells[i] = blankRow(cols)
+	}
+	return s
+}
+
+func blankRow(cols int) []rune {
+	r := make([]rune, cols)
+	for i := range r {
+		r[i] = ' '
+	}
+	return r
+}
+
+// Write feeds terminal output to the screen, it never fails
+func (s *Screen) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, b := range p {
+		s.feed(b)
+	}
+	s.version++
+	return len(p), nil
+}
+
+// Version changes on every write, to tell whether the screen was redrawn
+func (s *Screen) Version() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.version
+}
+
+// Row returns the text of row i without trailing spaces
+func (s *Screen) Row(i int) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if i < 0 || i >= s.rows {
+		return ""
+	}
+	return s.rowText(i)
+}
+
+// Rows returns the text of every row
+func (s *Screen) Rows() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rows := make([]string, s.rows)
+	for i := range rows {
+		rows[i] = s.rowText(i)
+	}
+	return rows
+}
+
+// String returns the rows joined by newlines
+func (s *Screen) String() string {
+	return strings.Join(s.Rows(), "\n")
+}
+
+// Contains reports whether any row contains text
+func (s *Screen) Contains(text string) bool {
+	for _, row := range s.Rows() {
+		if strings.Contains(row, text) {
+			return true
+		}
+	}
+	return false
+}
+
+// Cursor returns the 0-based cursor position
+func (s *Screen) Cursor() (row, col int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.row, s.col
+}
+
+// CursorRow returns the text of the row the cursor is on, where PTT puts
+// the prompt waiting for input
+func (s *Screen) CursorRow() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.rowText(s.row)
+}
+
+func (s *Screen) rowText(i int) string {
+	var sb strings.Builder
+	for _, r := range s.cells[i] {
+		if r != continuation {
+			sb.WriteRune(r)
+		}
+	}
+	return strings.TrimRight(sb.String(), " ")
+}
+
+func (s *Screen) feed(b byte) {
+	switch s.state {
+	case stateEscape:
+		s.escape(b)
+		return
+	case stateCSI:
+		if b >= 0x40 && b <= 0x7e {
+			s.csi(b)
+			s.state = stateGround
+			return
+		}
+		s.params = append(s.params, b)
+		return
+	}
+
+	// PTT may put a color change between the two bytes of a Big5
+	// character, so a pending lead byte waits across escape sequences
+	if b == 0x1b {
+		s.state = stateEscape
+		return
+	}
+	if b < 0x20 || b == 0x7f {
+		s.pending = s.pending[:0]
+		s.control(b)
+		return
+	}
+	s.pending = append(s.pending, b)
+	s.decode()
+}
+
+// decode prints the pending bytes once they form a character
+func (s *Screen) decode() {
+	if s.charset == Big5 {
+		lead := s.pending[0]
+		if lead < 0x80 {
+			s.pending = s.pending[:0]
+			s.print(rune(lead))
+			return
+		}
+		if lead == 0x80 || lead == 0xff {
+			s.pending = s.pending[:0]
+			s.print('�')
+			return
+		}
+		if len(s.pending) < 2 {
+			return
+		}
+		r := '�'
+		if out, err := traditionalchinese.Big5.NewDecoder().Bytes(s.pending[:2]); err == nil {
+			if decoded, _ := utf8.DecodeRune(out); decoded != utf8.RuneError {
+				r = decoded
+			}
+		}
+		s.pending = s.pending[:0]
+		s.print(r)
+		return
+	}
+
+	if !utf8.FullRune(s.pending) {
+		return
+	}
+	r, _ := utf8.DecodeRune(s.pending)
+	s.pending = s.pending[:0]
+	s.print(r)
+}
+
+func (s *Screen) print(r rune) {
+	width := 1
+	if r >= 0x80 {
+		width = 2
+	}
+	if s.wrapPending || s.col+width > s.cols {
+		s.wrapPending = false
+		s.col = 0
+		s.lineFeed()
+	}
+
+	line := s.cells[s.row]
+	s.clearHalf(s.row, s.col)
+	if width == 2 {
+		s.clearHalf(s.row, s.col+1)
+		line[s.col+1] = continuation
+	}
+	line[s.col] = r
+
+	s.col += width
+	if s.col >= s.cols {
+		s.col = s.cols - 1
+		s.wrapPending = true
+	}
+}
+
+// clearHalf blanks the other half of a two-column character at col before
+// col is overwritten
+func (s *Screen) clearHalf(row, col int) {
+	line := s.cells[row]
+	if line[col] == continuation && col > 0 {
+		line[col-1] = ' '
+	}
+	if line[col] != continuation && col+1 < s.cols && line[col+1] == continuation {
+		line[col+1] = ' '
+	}
+}
+
+func (s *Screen) control(b byte) {
+	switch b {
+	case '\r':
+		s.col = 0
+		s.wrapPending = false
+	case '\n', '\v', '\f':
+		s.lineFeed()
+		s.wrapPending = false
+	case '\b':
+		if s.col > 0 {
+			s.col--
+		}
+		s.wrapPending = false
+	case '\t':
+		s.col = min((s.col/8+1)*8, s.cols-1)
+	}
+}
+
+// lineFeed moves the cursor down, scrolling at the bottom
+func (s *Screen) lineFeed() {
+	if s.row < s.rows-1 {
+		s.row++
+		return
+	}
+	copy(s.cells, s.cells[1:])
+	s.cells[s.rows-1] = blankRow(s.cols)
+}
+
+// reverseLineFeed moves the cursor up, scrolling at the top
+func (s *Screen) reverseLineFeed() {
+	if s.row > 0 {
+		s.row--
+		return
+	}
+	copy(s.cells[1:], s.cells[:s.rows-1])
+	s.cells[0] = blankRow(s.cols)
+}
+
+func (s *Screen) escape(b byte) {
+	s.state = stateGround
+	switch b {
+	case '[':
+		s.state = stateCSI
+		s.params = s.params[:0]
+	case '7':
+		s.savedRow, s.savedCol = s.row, s.col
+	case '8':
+		s.row, s.col = s.savedRow, s.savedCol
+		s.wrapPending = false
+	case 'D':
+		s.lineFeed()
+	case 'E':
+		s.col = 0
+		s.lineFeed()
+	case 'M':
+		s.reverseLineFeed()
+	case 'c':
+		for i := range s.cells {
+			s.cells[i] = blankRow(s.cols)
+		}
+		s.row, s.col = 0, 0
+	}
+}
+
+// param returns the i-th numeric parameter of the CSI sequence, def when
+// it is missing or 0
+func (s *Screen) param(i, def int) int {
+	fields := strings.Split(strings.TrimLeft(string(s.params), "?>"), ";")
+	if i >= len(fields) {
+		return def
+	}
+	n, err := strconv.Atoi(fields[i])
+	if err != nil || n == 0 {
+		return def
+	}
+	return n
+}
+
+func (s *Screen) csi(final byte) {
+	s.wrapPending = false
+	switch final {
+	case 'H', 'f':
+		s.moveTo(s.param(0, 1)-1, s.param(1, 1)-1)
+	case 'A':
+		s.moveTo(s.row-s.param(0, 1), s.col)
+	case 'B', 'e':
+		s.moveTo(s.row+s.param(0, 1), s.col)
+	case 'C', 'a':
+		s.moveTo(s.row, s.col+s.param(0, 1))
+	case 'D':
+		s.moveTo(s.row, s.col-s.param(0, 1))
+	case 'E':
+		s.moveTo(s.row+s.param(0, 1), 0)
+	case 'F':
+		s.moveTo(s.row-s.param(0, 1), 0)
+	case 'G', '`':
+		s.moveTo(s.row, s.param(0, 1)-1)
+	case 'd':
+		s.moveTo(s.param(0, 1)-1, s.col)
+	case 'J':
+		s.eraseDisplay(s.param(0, 0))
+	case 'K':
+		s.eraseLine(s.row, s.param(0, 0))
+	case 's':
+		s.savedRow, s.savedCol = s.row, s.col
+	case 'u':
+		s.row, s.col = s.savedRow, s.savedCol
+	}
+}
+
+func (s *Screen) moveTo(row, col int) {
+	s.row = max(0, min(row, s.rows-1))
+	s.col = max(0, min(col, s.cols-1))
+}
+
+// eraseDisplay handles ESC[J: 0 erases below the cursor, 1 above it and
+// 2 the whole screen
+func (s *Screen) eraseDisplay(mode int) {
+	switch mode {
+	case 0:
+		s.eraseLine(s.row, 0)
+		for i := s.row + 1; i < s.rows; i++ {
+			s.cells[i] = blankRow(s.cols)
+		}
+	case 1:
+		s.eraseLine(s.row, 1)
+		for i := 0; i < s.row; i++ {
+			s.cells[i] = blankRow(s.cols)
+		}
+	default:
+		for i := range s.cells {
+			s.cells[i] = blankRow(s.cols)
+		}
+	}
+}
+
+// eraseLine handles ESC[K: 0 erases right of the cursor, 1 left of it and
+// 2 the whole row
+func (s *Screen) eraseLine(row, mode int) {
+	from, to := 0, s.cols
+	switch mode {
+	case 0:
+		from = s.col
+	case 1:
+		to = s.col + 1
+	}
+	line := s.cells[row]
+	if from > 0 && line[from] == continuation {
+		line[from-1] = ' '
+	}
+	if to < s.cols && line[to] == continuation {
+		line[to] = ' '
+	}
+	for i := from; i < to; i++ {
+		line[i] = ' '
+	}
+}
@@ -0,0 +1,85 @@
+package term
+
+import (
+	"reflect"
+	"testing"
+
+	"golang.org/x/text/encoding/traditionalchinese"
+)
+
+func TestScreen_Write(t *testing.T) {
+	tests := []struct {
+		name       string
+		output     string
+		wantRows   []string
+		wantCursor [2]int
+	}{
+		{"text and newline", "ab\r\ncd", []string{"ab", "cd", "", ""}, [2]int{1, 2}},
+		{"cursor addressing", "\x1b[3;5Hx\x1b[Hy", []string{"y", "", "    x", ""}, [2]int{0, 1}},
+		{"cursor movement", "abc\x1b[2D\x1b[BX\x1b[AY", []string{"abY", " X", "", ""}, [2]int{0, 3}},
+		{"clear screen keeps cursor", "old\r\nold\x1b[2J\x1b[1;1Hnew", []string{"new", "", "", ""}, [2]int{0, 3}},
+		{"erase below", "aaa\r\nbbb\r\nccc\x1b[2;2H\x1b[J", []string{"aaa", "b", "", ""}, [2]int{1, 1}},
+		{"erase line", "abcdef\x1b[1;3H\x1b[K", []string{"ab", "", "", ""}, [2]int{0, 2}},
+		{"colors ignored", "\x1b[1;33m主選單\x1b[m", []string{"主選單", "", "", ""}, [2]int{0, 6}},
+		{"wide characters", "主選單x", []string{"主選單x", "", "", ""}, [2]int{0, 7}},
+		{"overwrite half of wide", "主選單\x1b[1;2Hx", []string{" x選單", "", "", ""}, [2]int{0, 2}},
+		{"wraps", "0123456789ab", []string{"0123456789", "ab", "", ""}, [2]int{1, 2}},
+		{"full line then newline", "0123456789\r\nx", []string{"0123456789", "x", "", ""}, [2]int{1, 1}},
+		{"wide at line end wraps", "012345678主", []string{"012345678", "主", "", ""}, [2]int{1, 2}},
+		{"scrolls", "1\r\n2\r\n3\r\n4\r\n5", []string{"2", "3", "4", "5"}, [2]int{3, 1}},
+		{"save and restore cursor", "ab\x1b7\r\ncd\x1b8e", []string{"abe", "cd", "", ""}, [2]int{0, 3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewScreen(4, 10, UTF8)
+			s.Write([]byte(tt.output))
+			if got := s.Rows(); !reflect.DeepEqual(got, tt.wantRows) {
+				t.Errorf("Rows() = %q, want %q", got, tt.wantRows)
+			}
+			if row, col := s.Cursor(); [2]int{row, col} != tt.wantCursor {
+				t.Errorf("Cursor() = %d, %d, want %v", row, col, tt.wantCursor)
+			}
+		})
+	}
+}
+
+func TestScreen_Write_split(t *testing.T) {
+	// a UTF-8 character and an escape sequence cut across reads
+	s := NewScreen(2, 20, UTF8)
+	out := []byte("\x1b[1;33m請輸入代號")
+	for i := range out {
+		s.Write(out[i : i+1])
+	}
+	if got := s.Row(0); got != "請輸入代號" {
+		t.Errorf("Row(0) = %q, want 請輸入代號", got)
+	}
+}
+
+func TestScreen_Write_big5(t *testing.T) {
+	big5, err := traditionalchinese.Big5.NewEncoder().Bytes([]byte("批踢踢實業坊"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// PTT colors each half of a character by putting an escape sequence
+	// between its two bytes
+	out := append([]byte{}, big5[:1]...)
+	out = append(out, "\x1b[31m"...)
+	out = append(out, big5[1:]...)
+
+	s := NewScreen(2, 20, Big5)
+	s.Write(out)
+	if got := s.Row(0); got != "批踢踢實業坊" {
+		t.Errorf("Row(0) = %q, want 批踢踢實業坊", got)
+	}
+}
+
+func TestScreen_CursorRow(t *testing.T) {
+	s := NewScreen(4, 40, UTF8)
+	s.Write([]byte("【站內寄信】\r\n\x1b[4;1H收信人: "))
+	if got := s.CursorRow(); got != "收信人:" {
+		t.Errorf("CursorRow() = %q, want 收信人:", got)
+	}
+	if !s.Contains("站內寄信") || s.Contains("主題") {
+		t.Errorf("Contains() mismatch on %q", s.String())
+	}
+}
@@ -37,3 +37,28 @@ func findEmailProtected(node *html.Node) *html.Node {
 	}
 	return nil
 }
+
+func findMainContent(node *html.Node) *html.Node {
+	if node.Type == html.ElementNode && node.Data == "div" {
+		for _, attr := range node.Attr {
+			if attr.Key == "id" && attr.Val == "main-content" {
+				return node
+			}
+		}
+	}
+	return nil
+}
+
+// isBodyExcluded reports whether node is article metadata, a comment or a
+// system note (※ 發信站, 文章網址) rather than body text
+func isBodyExcluded(node *html.Node) bool {
+	if node.Type != html.ElementNode {
+		return false
+	}
+	for _, className := range []string{"article-metaline", "article-metaline-right", "push"} {
+		if findDivByClassName(node, className) != nil {
+			return true
+		}
+	}
+	return findSpanByClassName(node, "f2") != nil
+}
@@ -13,3 +13,23 @@ func findArticleBlocks(node *html.Node) *html.Node {
 func findPagingBlock(node *html.Node) *html.Node {
 	return findDivByClassName(node, "btn-group btn-group-paging")
 }
+
+func findBoardEntryBlocks(node *html.Node) *html.Node {
+	return findDivByClassName(node, "b-ent")
+}
+
+func findBoardNameDiv(node *html.Node) *html.Node {
+	return findDivByClassName(node, "board-name")
+}
+
+func findBoardTitleDiv(node *html.Node) *html.Node {
+	return findDivByClassName(node, "board-title")
+}
+
+func findBoardClassDiv(node *html.Node) *html.Node {
+	return findDivByClassName(node, "board-class")
+}
+
+func findBoardUsersDiv(node *html.Node) *html.Node {
+	return findDivByClassName(node, "board-nuser")
+}
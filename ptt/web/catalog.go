@@ -0,0 +1,110 @@
+package web
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	pttHttp "github.com/Ptt-Alertor/ptt-alertor/ptt/http"
+	"golang.org/x/net/html"
+)
+
+// RootClass is the top of PTT's board hierarchy
+const RootClass = "1"
+
+// BoardEntry is one row of a board list page, either a board or a class
+// (sub-category) that lists more boards
+type BoardEntry struct {
+	Name    string
+	Title   string
+	Class   string
+	Users   int
+	ClassID string
+}
+
+// IsClass reports whether the entry links to another class page
+func (e BoardEntry) IsClass() bool {
+	return e.ClassID != ""
+}
+
+// FetchHotBoards returns the boards on the hot boards page
+func FetchHotBoards() ([]BoardEntry, error) {
+	return fetchBoardList(pttHostURL + "/bbs/hotboards.html")
+}
+
+// FetchClass returns the boards and sub-classes of a class page
+func FetchClass(classID string) ([]BoardEntry, error) {
+	return fetchBoardList(pttHostURL + "/cls/" + classID)
+}
+
+// IsOver18 reports whether a board asks for age confirmation
+func IsOver18(board string) (bool, error) {
+	req, err := pttHttp.HttpRequest(makeBoardURL(board, -1))
+	if err != nil {
+		return false, err
+	}
+	resp, err := pttHttp.Do(client, req)
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+	if uerr, ok := err.(*url.Error); ok && uerr.Err == errRedirect {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return false, URLNotFoundError{req.URL.String()}
+	}
+	return false, nil
+}
+
+func fetchBoardList(reqURL string) ([]BoardEntry, error) {
+	htmlNodes, err := fetchHTML(reqURL)
+	if err != nil {
+		return nil, err
+	}
+	return parseBoardList(htmlNodes), nil
+}
+
+func parseBoardList(htmlNodes *html.Node) []BoardEntry {
+	entries := make([]BoardEntry, 0)
+	for _, block := range findNodes(htmlNodes, findBoardEntryBlocks) {
+		var entry BoardEntry
+		for _, anchor := range findNodes(block, findAnchor) {
+			link := getAnchorLink(anchor)
+			if strings.HasPrefix(link, "/cls/") {
+				entry.ClassID = strings.TrimPrefix(link, "/cls/")
+			}
+		}
+		entry.Name = nodeText(findNodes(block, findBoardNameDiv))
+		entry.Title = nodeText(findNodes(block, findBoardTitleDiv))
+		entry.Class = nodeText(findNodes(block, findBoardClassDiv))
+		entry.Users, _ = strconv.Atoi(nodeText(findNodes(block, findBoardUsersDiv)))
+		if entry.Name == "" {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// nodeText joins the text under the first node
+func nodeText(nodes []*html.Node) string {
+	if len(nodes) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			if child.Type == html.TextNode {
+				b.WriteString(child.Data)
+			}
+			walk(child)
+		}
+	}
+	walk(nodes[0])
+	return strings.TrimSpace(b.String())
+}
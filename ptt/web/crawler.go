@@ -191,6 +191,41 @@ PushBlocks:
 	return atcl, nil
 }
 
+// FetchArticleBody returns the article's main text without meta lines,
+// comments and system notes
+func FetchArticleBody(board, articleCode string) (string, error) {
+	htmlNodes, err := fetchHTML(makeArticleURL(board, articleCode))
+	if err != nil {
+		return "", err
+	}
+	nodes := findNodes(htmlNodes, findMainContent)
+	if len(nodes) == 0 {
+		return "", nil
+	}
+	return articleBody(nodes[0]), nil
+}
+
+func articleBody(mainContent *html.Node) string {
+	var b strings.Builder
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			if child.Type == html.TextNode {
+				b.WriteString(child.Data)
+				continue
+			}
+			if isBodyExcluded(child) {
+				continue
+			}
+			walk(child)
+		}
+	}
+	walk(mainContent)
+	// drop the signature separator left before the system notes
+	body := strings.TrimSuffix(strings.TrimSpace(b.String()), "--")
+	return strings.TrimSpace(body)
+}
+
 func parseDateTime(ipdatetime string) (time.Time, error) {
 	re, _ := regexp.Compile("(\\d+\\.\\d+\\.\\d+\\.\\d+)?\\s*(.*)")
 	subMatches := re.FindStringSubmatch(ipdatetime)
@@ -224,7 +259,11 @@ func CheckArticleExist(board, articleCode string) bool {
 }
 
 func checkURLExist(url string) bool {
-	resp, err := http.Get(url)
+	req, err := pttHttp.HttpRequest(url)
+	if err != nil {
+		return false
+	}
+	resp, err := pttHttp.Do(http.DefaultClient, req)
 	if err != nil {
 		return false
 	}
@@ -272,7 +311,7 @@ func fetchHTML(reqURL string) (doc *html.Node, err error) {
 	if err != nil {
 		return nil, err
 	}
-	resp, err := client.Do(req)
+	resp, err := pttHttp.Do(client, req)
 	if err != nil && resp == nil {
 		log.WithField("url", reqURL).WithError(err).Error("Fetch URL Failed")
 		return nil, err
@@ -286,7 +325,7 @@ func fetchHTML(reqURL string) (doc *html.Node, err error) {
 
 	if uerr, ok := err.(*url.Error); ok && uerr.Err == errRedirect {
 		req := passR18(reqURL)
-		resp, err = client.Do(req)
+		resp, err = pttHttp.Do(client, req)
 		if err != nil {
 			return nil, err
 		}
@@ -221,6 +221,45 @@ func TestBuildArticle(t *testing.T) {
 	}
 }
 
+func TestFetchArticleBody(t *testing.T) {
+	defer gock.Off()
+	gock.New("https://www.ptt.cc").Get("/bbs/TFSHS66th321/M.1498563199.A.35C.html").
+		Reply(200).BodyString(dummyArticle)
+
+	got, err := FetchArticleBody("TFSHS66th321", "M.1498563199.A.35C")
+	if err != nil {
+		t.Fatalf("FetchArticleBody() error = %v", err)
+	}
+	if want := "測"; got != want {
+		t.Errorf("FetchArticleBody() = %q, want %q", got, want)
+	}
+}
+
+func TestFetchClass(t *testing.T) {
+	defer gock.Off()
+	gock.New("https://www.ptt.cc").Get("/cls/1").
+		Reply(200).BodyString(dummyClass)
+
+	got, err := FetchClass("1")
+	if err != nil {
+		t.Fatalf("FetchClass() error = %v", err)
+	}
+	want := []BoardEntry{
+		{Name: "1PTTCenter", Title: "PTT 中心", Class: "", ClassID: "2"},
+		{Name: "Gossiping", Title: "◎[八卦] 討論", Class: "綜合", Users: 12345},
+		{Name: "Beauty", Title: "《表特板》", Class: "閒聊", Users: 0},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("FetchClass() = %#v, want %#v", got, want)
+	}
+}
+
+var dummyClass = `<html><body><div class="b-list-container action-bar-margin bbs-screen">
+<div class="b-ent"><a class="board" href="/cls/2"><div class="board-name">1PTTCenter</div><div class="board-nuser"><span class="hl f6"></span></div><div class="board-class"></div><div class="board-title">PTT 中心</div></a></div>
+<div class="b-ent"><a class="board" href="/bbs/Gossiping/index.html"><div class="board-name">Gossiping</div><div class="board-nuser"><span class="hl f6">12345</span></div><div class="board-class">綜合</div><div class="board-title">◎[八卦] 討論</div></a></div>
+<div class="b-ent"><a class="board" href="/bbs/Beauty/index.html"><div class="board-name">Beauty</div><div class="board-nuser"><span class="hl f1">HOT</span></div><div class="board-class">閒聊</div><div class="board-title">《表特板》</div></a></div>
+</div></body></html>`
+
 var dummyBody = `
 <!DOCTYPE html>
 <html>
@@ -0,0 +1,86 @@
+package ratelimit
+
+import (
+	"time"
+
+	log "github.com/Ptt-Alertor/logrus"
+	"github.com/Ptt-Alertor/ptt-alertor/myutil"
+	"github.com/gomodule/redigo/redis"
+)
+
+const (
+	failPrefix = prefix + "fail:"
+	lockPrefix = prefix + "lock:"
+
+	// FailureThreshold failures in a row start the lockout
+	FailureThreshold = 5
+	// failureTTL forgets failures after a quiet day
+	failureTTL = 24 * time.Hour
+
+	baseLockout = 1 * time.Minute
+	maxLockout  = 1 * time.Hour
+)
+
+// lockoutFor doubles the lockout with every failure past the threshold
+func lockoutFor(failures int) time.Duration {
+	if failures < FailureThreshold {
+		return 0
+	}
+	d := baseLockout
+	for i := FailureThreshold; i < failures; i++ {
+		d *= 2
+		if d >= maxLockout {
+			return maxLockout
+		}
+	}
+	return d
+}
+
+// Locked returns how long key stays locked out, zero when it is not
+func Locked(key string) time.Duration {
+	conn := connectRedis()
+	defer conn.Close()
+
+	ttl, err := redis.Int64(conn.Do("PTTL", lockPrefix+key))
+	if err != nil {
+		log.WithField("runtime", myutil.BasicRuntimeInfo()).WithError(err).Error("Check Lockout Failed")
+		return 0
+	}
+	if ttl <= 0 {
+		return 0
+	}
+	return time.Duration(ttl) * time.Millisecond
+}
+
+// Fail records a failed attempt of key and returns the lockout it caused,
+// zero while under the threshold
+func Fail(key string) time.Duration {
+	conn := connectRedis()
+	defer conn.Close()
+
+	failures, err := redis.Int(conn.Do("INCR", failPrefix+key))
+	if err != nil {
+		log.WithField("runtime", myutil.BasicRuntimeInfo()).WithError(err).Error("Record Failure Failed")
+		return 0
+	}
+	conn.Send("EXPIRE", failPrefix+key, int(failureTTL.Seconds()))
+
+	d := lockoutFor(failures)
+	if d > 0 {
+		conn.Send("SET", lockPrefix+key, failures, "PX", d.Milliseconds())
+	}
+	if _, err := conn.Do(""); err != nil {
+		log.WithField("runtime", myutil.BasicRuntimeInfo()).WithError(err).Error("Record Failure Failed")
+	}
+	return d
+}
+
+// Reset clears the failures of key after a successful attempt
+func Reset(key string) {
+	conn := connectRedis()
+	defer conn.Close()
+
+	if _, err := conn.Do("DEL", failPrefix+key, lockPrefix+key); err != nil {
+		log.WithField("runtime", myutil.BasicRuntimeInfo()).WithError(err).Error("Reset Failures Failed")
+	}
+}
@@ -0,0 +1,223 @@
+// Package ratelimit counts requests and failed logins in Redis so limits
+// hold across every web server instance.
+package ratelimit
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Ptt-Alertor/logrus"
+	"github.com/Ptt-Alertor/ptt-alertor/connections"
+	"github.com/Ptt-Alertor/ptt-alertor/myutil"
+	"github.com/gomodule/redigo/redis"
+)
+
+const prefix = "ratelimit:"
+
+var ErrInvalidLimit = errors.New("invalid rate limit")
+
+var connectRedis = connections.Redis
+
+// hitScript counts a request in the current window, starting the window on
+// the first request, and returns the count and the window's remaining time
+var hitScript = redis.NewScript(1, `
+local n = redis.call("INCR", KEYS[1])
+if n == 1 then
+	redis.call("PEXPIRE", KEYS[1], ARGV[1])
+end
+return {n, redis.call("PTTL", KEYS[1])}`)
+
+// Limit allows Requests per Window. A negative Requests means unlimited.
+type Limit struct {
+	Requests int
+	Window   time.Duration
+}
+
+// Unlimited reports whether the limit never rejects a request
+func (l Limit) Unlimited() bool {
+	return l.Requests < 0
+}
+
+// ParseLimit parses a limit written as "<requests>/<window>", e.g. "10/1m"
+func ParseLimit(s string) (Limit, error) {
+	parts := strings.SplitN(s, "/", 2)
+	if len(parts) != 2 {
+		return Limit{}, ErrInvalidLimit
+	}
+	requests, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+	if err != nil {
+		return Limit{}, ErrInvalidLimit
+	}
+	window, err := time.ParseDuration(strings.TrimSpace(parts[1]))
+	if err != nil || window <= 0 {
+		return Limit{}, ErrInvalidLimit
+	}
+	return Limit{Requests: requests, Window: window}, nil
+}
+
+// Configured returns the limit of a route, overridable by the environment
+// variable RATE_LIMIT_<ROUTE>, e.g. RATE_LIMIT_LOGIN=10/1m
+func Configured(route string, def Limit) Limit {
+	name := "RATE_LIMIT_" + strings.ToUpper(strings.NewReplacer("-", "_", ".", "_").Replace(route))
+	v := os.Getenv(name)
+	if v == "" {
+		return def
+	}
+	l, err := ParseLimit(v)
+	if err != nil {
+		log.WithField("env", name).WithError(err).Warn("Invalid Rate Limit, Using Default")
+		return def
+	}
+	return l
+}
+
+// Result is the outcome of counting a request
+type Result struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	RetryAfter time.Duration
+}
+
+// Allow counts a request of id against the bucket's limit. Redis failures
+// let the request through, a limiter outage should not take the API down.
+func Allow(bucket, id string, limit Limit) Result {
+	if limit.Unlimited() {
+		return Result{Allowed: true, Limit: -1, Remaining: -1}
+	}
+
+	conn := connectRedis()
+	defer conn.Close()
+
+	reply, err := redis.Int64s(hitScript.Do(conn, prefix+bucket+":"+id, limit.Window.Milliseconds()))
+	if err != nil || len(reply) != 2 {
+		log.WithField("runtime", myutil.BasicRuntimeInfo()).WithError(err).Error("Count Rate Limit Failed")
+		return Result{Allowed: true, Limit: limit.Requests, Remaining: limit.Requests}
+	}
+
+	count, ttl := int(reply[0]), time.Duration(reply[1])*time.Millisecond
+	if ttl < 0 {
+		ttl = limit.Window
+	}
+	remaining := limit.Requests - count
+	if remaining < 0 {
+		remaining = 0
+	}
+	res := Result{Allowed: count <= limit.Requests, Limit: limit.Requests, Remaining: remaining}
+	if !res.Allowed {
+		res.RetryAfter = ttl
+	}
+	return res
+}
+
+// SetHeaders writes the X-RateLimit-* headers, and Retry-After when the
+// request was rejected
+func SetHeaders(w http.ResponseWriter, res Result) {
+	if res.Limit < 0 {
+		return
+	}
+	w.Header().Set("X-RateLimit-Limit", strconv.Itoa(res.Limit))
+	w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(res.Remaining))
+	if !res.Allowed {
+		SetRetryAfter(w, res.RetryAfter)
+	}
+}
+
+// SetRetryAfter writes the Retry-After header in whole seconds, rounded up
+func SetRetryAfter(w http.ResponseWriter, d time.Duration) {
+	secs := int((d + time.Second - 1) / time.Second)
+	if secs < 1 {
+		secs = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(secs))
+}
+
+// trustedProxies are the networks of the reverse proxies in front of the
+// server, set as TRUSTED_PROXIES of comma separated IPs or CIDRs. Only
+// they are believed about X-Forwarded-For.
+var (
+	trustedProxies     []*net.IPNet
+	trustedProxiesOnce sync.Once
+)
+
+// parseTrustedProxies parses comma separated IPs or CIDRs, skipping and
+// logging invalid ones
+func parseTrustedProxies(s string) []*net.IPNet {
+	var nets []*net.IPNet
+	for _, v := range strings.Split(s, ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		if !strings.Contains(v, "/") {
+			if ip := net.ParseIP(v); ip != nil && ip.To4() != nil {
+				v += "/32"
+			} else {
+				v += "/128"
+			}
+		}
+		_, n, err := net.ParseCIDR(v)
+		if err != nil {
+			log.WithField("proxy", v).WithError(err).Warn("Invalid Trusted Proxy, Skipped")
+			continue
+		}
+		nets = append(nets, n)
+	}
+	return nets
+}
+
+// ClientIP returns the caller's address. X-Forwarded-For is only read when
+// the peer is a trusted proxy, then the right-most hop not a trusted proxy
+// is the caller, hops left of it are whatever the client sent.
+func ClientIP(r *http.Request) string {
+	trustedProxiesOnce.Do(func() {
+		trustedProxies = parseTrustedProxies(os.Getenv("TRUSTED_PROXIES"))
+	})
+	return clientIP(r, trustedProxies)
+}
+
+func clientIP(r *http.Request, trusted []*net.IPNet) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if !isTrusted(host, trusted) {
+		return host
+	}
+
+	var hops []string
+	for _, v := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(v, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if net.ParseIP(hop) == nil {
+			// a malformed hop cannot be traced further
+			return host
+		}
+		if !isTrusted(hop, trusted) {
+			return hop
+		}
+		host = hop
+	}
+	return host
+}
+
+func isTrusted(addr string, trusted []*net.IPNet) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, n := range trusted {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,215 @@
+package ratelimit
+
+import (
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gomodule/redigo/redis"
+)
+
+var s *miniredis.Miniredis
+
+func TestMain(m *testing.M) {
+	var err error
+	s, err = miniredis.Run()
+	if err != nil {
+		panic(err)
+	}
+
+	connectRedis = func() redis.Conn {
+		conn, err := redis.Dial("tcp", s.Addr())
+		if err != nil {
+			panic(err)
+		}
+		return conn
+	}
+
+	v := m.Run()
+
+	s.Close()
+	os.Exit(v)
+}
+
+func TestParseLimit(t *testing.T) {
+	tests := []struct {
+		name    string
+		s       string
+		want    Limit
+		wantErr bool
+	}{
+		{"minute", "10/1m", Limit{10, time.Minute}, false},
+		{"spaces", " 5 / 30s ", Limit{5, 30 * time.Second}, false},
+		{"unlimited", "-1/1m", Limit{-1, time.Minute}, false},
+		{"no window", "10", Limit{}, true},
+		{"bad count", "x/1m", Limit{}, true},
+		{"bad window", "10/minute", Limit{}, true},
+		{"zero window", "10/0s", Limit{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseLimit(tt.s)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseLimit() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseLimit() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfigured(t *testing.T) {
+	def := Limit{10, time.Minute}
+	t.Setenv("RATE_LIMIT_BIND_CODE", "3/1h")
+	t.Setenv("RATE_LIMIT_LOGIN", "oops")
+
+	tests := []struct {
+		route string
+		want  Limit
+	}{
+		{"bind-code", Limit{3, time.Hour}},
+		{"login", def},
+		{"register", def},
+	}
+	for _, tt := range tests {
+		t.Run(tt.route, func(t *testing.T) {
+			if got := Configured(tt.route, def); got != tt.want {
+				t.Errorf("Configured() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAllow(t *testing.T) {
+	s.FlushAll()
+	limit := Limit{3, time.Minute}
+
+	for i := 1; i <= 3; i++ {
+		res := Allow("test", "1.2.3.4", limit)
+		if !res.Allowed || res.Remaining != 3-i {
+			t.Fatalf("Allow() request %d = %+v, want allowed with %d remaining", i, res, 3-i)
+		}
+	}
+
+	res := Allow("test", "1.2.3.4", limit)
+	if res.Allowed {
+		t.Fatal("Allow() over limit was allowed")
+	}
+	if res.RetryAfter <= 0 || res.RetryAfter > time.Minute {
+		t.Errorf("Allow() RetryAfter = %v, want within window", res.RetryAfter)
+	}
+
+	if res := Allow("test", "5.6.7.8", limit); !res.Allowed {
+		t.Error("Allow() other id was limited")
+	}
+
+	s.FastForward(time.Minute)
+	if res := Allow("test", "1.2.3.4", limit); !res.Allowed {
+		t.Error("Allow() after window was limited")
+	}
+
+	if res := Allow("test", "1.2.3.4", Limit{-1, time.Minute}); !res.Allowed {
+		t.Error("Allow() unlimited was limited")
+	}
+}
+
+func TestSetHeaders(t *testing.T) {
+	w := httptest.NewRecorder()
+	SetHeaders(w, Result{Allowed: false, Limit: 10, Remaining: 0, RetryAfter: 1500 * time.Millisecond})
+
+	if got := w.Header().Get("Retry-After"); got != "2" {
+		t.Errorf("Retry-After = %q, want %q", got, "2")
+	}
+	if got := w.Header().Get("X-RateLimit-Limit"); got != "10" {
+		t.Errorf("X-RateLimit-Limit = %q, want %q", got, "10")
+	}
+}
+
+func Test_clientIP(t *testing.T) {
+	trusted := parseTrustedProxies("10.0.0.0/8, 192.168.1.1, bad")
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  string
+		want       string
+	}{
+		{"direct", "203.0.113.5:4321", "", "203.0.113.5"},
+		{"spoofed header from client", "203.0.113.5:4321", "198.51.100.1", "203.0.113.5"},
+		{"behind proxy", "10.0.0.2:80", "203.0.113.5", "203.0.113.5"},
+		{"client prepends a hop", "10.0.0.2:80", "198.51.100.1, 203.0.113.5", "203.0.113.5"},
+		{"proxy chain", "10.0.0.2:80", "203.0.113.5, 192.168.1.1, 10.0.0.3", "203.0.113.5"},
+		{"all trusted", "10.0.0.2:80", "10.0.0.3", "10.0.0.3"},
+		{"malformed hop", "10.0.0.2:80", "203.0.113.5, junk", "10.0.0.2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			if tt.forwarded != "" {
+				r.Header.Set("X-Forwarded-For", tt.forwarded)
+			}
+			if got := clientIP(r, trusted); got != tt.want {
+				t.Errorf("clientIP() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_lockoutFor(t *testing.T) {
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{1, 0},
+		{FailureThreshold - 1, 0},
+		{FailureThreshold, time.Minute},
+		{FailureThreshold + 1, 2 * time.Minute},
+		{FailureThreshold + 3, 8 * time.Minute},
+		{FailureThreshold + 20, time.Hour},
+	}
+	for _, tt := range tests {
+		if got := lockoutFor(tt.failures); got != tt.want {
+			t.Errorf("lockoutFor(%d) = %v, want %v", tt.failures, got, tt.want)
+		}
+	}
+}
+
+func TestLockout(t *testing.T) {
+	s.FlushAll()
+	key := "login:a@b.c"
+
+	for i := 1; i < FailureThreshold; i++ {
+		if d := Fail(key); d != 0 {
+			t.Fatalf("Fail() #%d locked for %v", i, d)
+		}
+	}
+	if d := Locked(key); d != 0 {
+		t.Fatalf("Locked() below threshold = %v", d)
+	}
+
+	if d := Fail(key); d != time.Minute {
+		t.Fatalf("Fail() at threshold = %v, want %v", d, time.Minute)
+	}
+	if d := Locked(key); d <= 0 {
+		t.Fatal("Locked() after threshold = 0")
+	}
+
+	s.FastForward(time.Minute)
+	if d := Locked(key); d != 0 {
+		t.Fatalf("Locked() after lockout = %v", d)
+	}
+	if d := Fail(key); d != 2*time.Minute {
+		t.Fatalf("Fail() after lockout = %v, want %v", d, 2*time.Minute)
+	}
+
+	Reset(key)
+	if d := Locked(key); d != 0 {
+		t.Errorf("Locked() after Reset = %v", d)
+	}
+	if d := Fail(key); d != 0 {
+		t.Errorf("Fail() after Reset = %v", d)
+	}
+}